@@ -20,6 +20,22 @@ func main() {
 	flag.IntVar(&cfg.ServerPort, "server-port", 0, "Server Port，必填")
 	flag.DurationVar(&cfg.RequestTimeout, "request-timeout", 30*time.Second, "HTTP 匹配缓存超时时间")
 	flag.BoolVar(&cfg.EnableEBPF, "enable-ebpf", true, "启用 eBPF 进程采集")
+	flag.IntVar(&cfg.QueueSize, "queue-size", 10000, "上报队列容量（条）")
+	flag.IntVar(&cfg.BatchSize, "batch-size", 200, "单批上报条数上限")
+	flag.DurationVar(&cfg.FlushInterval, "flush-interval", time.Second, "未攒满一批时的最长发送间隔")
+	flag.StringVar(&cfg.Overflow, "overflow", "drop-oldest", "队列满时的策略：drop-oldest / drop-newest / block")
+	flag.StringVar(&cfg.Encoding, "encoding", "json", "批量上报编码：json / protobuf")
+	flag.StringVar(&cfg.Compression, "compression", "none", "批量上报压缩：none / gzip / zstd")
+	flag.StringVar(&cfg.SpoolDir, "spool-dir", "", "上报失败时的本地落盘目录，为空则不落盘（直接丢弃）")
+	flag.Int64Var(&cfg.SpoolMaxBytes, "spool-max-bytes", 256<<20, "spool 目录容量上限（字节），超出后淘汰最旧数据")
+	flag.BoolVar(&cfg.TLS.Enable, "tls", false, "使用 HTTPS 上报（指定 -tls-ca 或 -tls-cert 时自动开启）")
+	flag.StringVar(&cfg.TLS.CAFile, "tls-ca", "", "校验 server 证书的 CA（PEM），为空则使用系统根证书")
+	flag.StringVar(&cfg.TLS.CertFile, "tls-cert", "", "agent 客户端证书（PEM），用于 mTLS")
+	flag.StringVar(&cfg.TLS.KeyFile, "tls-key", "", "agent 客户端私钥（PEM）")
+	flag.StringVar(&cfg.TLS.ServerName, "tls-server-name", "", "校验 server 证书时使用的名称，默认取 -server-ip")
+	flag.StringVar(&cfg.Token, "token", "", "上报使用的 Bearer token（server 启用认证时必填）")
+	flag.StringVar(&cfg.TokenFile, "token-file", "", "从文件读取 Bearer token，优先于 -token")
+	flag.StringVar(&cfg.DebugAddr, "debug-listen", "127.0.0.1:6060", "本地调试接口监听地址，为空则关闭")
 	flag.Parse()
 
 	if cfg.Interface == "" || cfg.ServerIP == "" || cfg.ServerPort == 0 {
@@ -2,26 +2,145 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"lightobs/internal/client/app"
 )
 
-func main() {
-	var cfg app.Config
-	flag.StringVar(&cfg.IP, "ip", "", "目标 IP，必填")
-	flag.IntVar(&cfg.PID, "pid", 0, "进程 ID，用于按进程查询")
-	flag.StringVar(&cfg.Server, "server", "http://127.0.0.1:8080", "Server 地址")
-	flag.Parse()
+// 子命令：省略时为 query，保持 `client -ip ...` 的旧用法不变。
+var commands = map[string]func(args []string) error{
+	"anomalies": runAnomalies,
+	"export":    runExport,
+	"import":    runImport,
+	"query":     runQuery,
+	"stats":     runStats,
+	"tail":      runTail,
+	"topology":  runTopology,
+}
 
-	if cfg.IP == "" && cfg.PID == 0 {
-		flag.Usage()
+func main() {
+	name, args := "query", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	run, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "未知子命令：%s（可选 query / stats / topology / tail / anomalies / export / import）\n", name)
 		os.Exit(2)
 	}
-
-	if err := app.Run(cfg); err != nil {
+	if err := run(args); err != nil {
 		log.Printf("client 失败：%v", err)
 		os.Exit(1)
 	}
 }
+
+func runQuery(args []string) error {
+	var cfg app.Config
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	filterFlags(fs, &cfg)
+	fs.StringVar(&cfg.Sort, "sort", "", "排序字段：timestamp / latency / status")
+	fs.StringVar(&cfg.Order, "order", "", "排序方向：asc / desc（默认 desc）")
+	fs.IntVar(&cfg.Limit, "limit", 0, "每页条数（默认 200，最大 5000）")
+	fs.BoolVar(&cfg.All, "all", false, "自动翻页拉取全部结果")
+	fs.StringVar(&cfg.Page, "page", "", "从上次输出的游标处继续查看下一页")
+	connFlags(fs, &cfg)
+	_ = fs.Parse(args)
+	return app.Run(cfg)
+}
+
+func runStats(args []string) error {
+	var cfg app.Config
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	filterFlags(fs, &cfg)
+	fs.StringVar(&cfg.GroupBy, "group-by", "dst_ip,dst_port", "分组维度，逗号分隔：src_ip / dst_ip / dst_port / method / path / raw_path / pid")
+	fs.StringVar(&cfg.Sort, "sort", "", "排序字段：count / errors / error_rate / avg / p50 / p90 / p99（降序）")
+	fs.IntVar(&cfg.Limit, "limit", 0, "最多返回的分组数（默认 100）")
+	connFlags(fs, &cfg)
+	_ = fs.Parse(args)
+	return app.RunStats(cfg)
+}
+
+func runTopology(args []string) error {
+	var cfg app.Config
+	fs := flag.NewFlagSet("topology", flag.ExitOnError)
+	filterFlags(fs, &cfg)
+	fs.StringVar(&cfg.By, "by", "process", "节点粒度：process（IP+PID / IP:端口）/ ip")
+	fs.StringVar(&cfg.Format, "format", "table", "输出格式：table / dot / mermaid")
+	fs.IntVar(&cfg.Limit, "limit", 0, "最多输出的边数，按请求数降序（默认 200）")
+	connFlags(fs, &cfg)
+	_ = fs.Parse(args)
+	return app.RunTopology(cfg)
+}
+
+func runTail(args []string) error {
+	var cfg app.Config
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	filterFlags(fs, &cfg)
+	connFlags(fs, &cfg)
+	_ = fs.Parse(args)
+	return app.RunTail(cfg)
+}
+
+func runAnomalies(args []string) error {
+	var cfg app.Config
+	fs := flag.NewFlagSet("anomalies", flag.ExitOnError)
+	fs.StringVar(&cfg.IP, "ip", "", "接口的目的 IP")
+	fs.StringVar(&cfg.From, "from", "", "起始时间：RFC3339、Unix 秒或相对时间（默认 -24h）")
+	fs.StringVar(&cfg.To, "to", "", "结束时间（不含），格式同 -from")
+	fs.StringVar(&cfg.Signal, "signal", "", "指标：p90_ms / error_rate，为空则全部")
+	fs.IntVar(&cfg.Limit, "limit", 0, "最多输出的事件数（默认 100）")
+	connFlags(fs, &cfg)
+	_ = fs.Parse(args)
+	return app.RunAnomalies(cfg)
+}
+
+func runExport(args []string) error {
+	var cfg app.Config
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	filterFlags(fs, &cfg)
+	fs.StringVar(&cfg.Format, "format", "ndjson", "导出格式：ndjson / csv / parquet（parquet 需要 server 使用 duckdb）")
+	fs.StringVar(&cfg.Output, "o", "", "输出文件，为空或 - 时写到标准输出")
+	connFlags(fs, &cfg)
+	_ = fs.Parse(args)
+	return app.RunExport(cfg)
+}
+
+func runImport(args []string) error {
+	var cfg app.Config
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.StringVar(&cfg.Input, "f", "", "导入文件（.ndjson / .csv / .parquet，可带 .gz 后缀）")
+	fs.StringVar(&cfg.Format, "format", "", "文件格式：ndjson / csv / parquet，默认按扩展名判断")
+	connFlags(fs, &cfg)
+	_ = fs.Parse(args)
+	return app.RunImport(cfg)
+}
+
+// filterFlags 注册各子命令共用的过滤条件。
+func filterFlags(fs *flag.FlagSet, cfg *app.Config) {
+	fs.StringVar(&cfg.IP, "ip", "", "目标 IP（源或目的）")
+	fs.IntVar(&cfg.PID, "pid", 0, "进程 ID，用于按进程查询")
+	fs.StringVar(&cfg.From, "from", "", "起始时间：RFC3339、Unix 秒或相对时间（如 -15m、-7d）")
+	fs.StringVar(&cfg.To, "to", "", "结束时间（不含），格式同 -from")
+	fs.StringVar(&cfg.Method, "method", "", "HTTP 方法")
+	fs.StringVar(&cfg.Path, "path", "", "路径前缀，含 * ? [ 时按 glob 匹配")
+	fs.StringVar(&cfg.Status, "status", "", "状态码或类别，逗号分隔，如 404,5xx")
+	fs.IntVar(&cfg.SrcPort, "src-port", 0, "源端口")
+	fs.IntVar(&cfg.DstPort, "dst-port", 0, "目的端口")
+	fs.Int64Var(&cfg.MinLatency, "min-latency", 0, "最小延迟（毫秒）")
+	fs.Int64Var(&cfg.MaxLatency, "max-latency", 0, "最大延迟（毫秒）")
+}
+
+// connFlags 注册 server 地址、TLS 与认证参数。
+func connFlags(fs *flag.FlagSet, cfg *app.Config) {
+	fs.StringVar(&cfg.Server, "server", "http://127.0.0.1:8080", "Server 地址")
+	fs.StringVar(&cfg.TLS.CAFile, "tls-ca", "", "校验 server 证书的 CA（PEM），为空则使用系统根证书")
+	fs.StringVar(&cfg.TLS.CertFile, "tls-cert", "", "客户端证书（PEM），用于 mTLS")
+	fs.StringVar(&cfg.TLS.KeyFile, "tls-key", "", "客户端私钥（PEM）")
+	fs.StringVar(&cfg.TLS.ServerName, "tls-server-name", "", "校验 server 证书时使用的名称")
+	fs.BoolVar(&cfg.TLS.InsecureSkipVerify, "tls-insecure", false, "跳过 server 证书校验（仅调试用）")
+	fs.StringVar(&cfg.APIKey, "api-key", os.Getenv("LIGHTOBS_API_KEY"), "查询用 API Key，默认读取环境变量 LIGHTOBS_API_KEY")
+	fs.StringVar(&cfg.Token, "token", os.Getenv("LIGHTOBS_TOKEN"), "Bearer token，默认读取环境变量 LIGHTOBS_TOKEN")
+}
@@ -10,15 +10,65 @@ import (
 	"syscall"
 	"time"
 
+	"lightobs/internal/server/anomaly"
 	"lightobs/internal/server/app"
+	"lightobs/internal/server/metrics"
+	"lightobs/internal/server/storage"
+	"lightobs/internal/server/storage/memory"
+	"lightobs/internal/server/writebuf"
 )
 
 func main() {
 	var cfg app.Config
 	flag.StringVar(&cfg.ListenAddr, "listen", ":8080", "监听地址")
-	flag.StringVar(&cfg.DBDriver, "db-driver", "duckdb", "数据库类型：duckdb 或 sqlite")
+	flag.StringVar(&cfg.DBDriver, "db-driver", "duckdb", "数据库类型：duckdb、sqlite 或 memory（仅保存在内存中）")
 	flag.StringVar(&cfg.DBPath, "db", "", "数据库文件路径")
+	flag.IntVar(&cfg.MemoryCapacity, "memory-capacity", memory.DefaultCapacity, "memory 后端最多保留的记录条数，写满后覆盖最旧的记录")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", "", "server 证书（PEM），与 -tls-key 同时指定后启用 HTTPS")
+	flag.StringVar(&cfg.TLSKey, "tls-key", "", "server 私钥（PEM）")
+	flag.StringVar(&cfg.TLSClientCA, "tls-client-ca", "", "校验客户端证书的 CA（PEM），为空则不校验")
+	flag.BoolVar(&cfg.TLSRequireClientCert, "tls-require-client-cert", false, "拒绝未提供客户端证书的连接（mTLS）")
+	flag.StringVar(&cfg.RoutesFile, "route-patterns", "", "路由模式文件，每行一条，如 /users/{id}/orders/*")
+	flag.StringVar(&cfg.AuthFile, "auth-config", "", "认证凭证文件（YAML），为空则不启用认证")
+	flag.StringVar(&cfg.AlertRulesFile, "alert-rules", "", "告警规则文件（YAML），为空则不启用告警")
+	flag.BoolVar(&cfg.EnableAnomaly, "anomaly", false, "按接口学习延迟与错误率基线，检测异常")
+	flag.StringVar(&cfg.Anomaly.StatePath, "anomaly-state", "", "基线模型与异常事件的保存文件，默认为数据库文件旁的 <db>.baselines.json")
+	flag.DurationVar(&cfg.Anomaly.Step, "anomaly-step", anomaly.DefaultStep, "异常检测的时间桶宽度")
+	flag.DurationVar(&cfg.Anomaly.HalfLife, "anomaly-half-life", anomaly.DefaultHalfLife, "基线的半衰期，越短适应越快")
+	flag.Float64Var(&cfg.Anomaly.Threshold, "anomaly-threshold", anomaly.DefaultThreshold, "判为异常的分数（高出基线的标准差倍数）")
+	flag.DurationVar(&cfg.Anomaly.Backfill, "anomaly-backfill", anomaly.DefaultBackfill, "首次启动时从历史数据学习的时长")
+	flag.DurationVar(&cfg.Retention.MaxAge, "retention-max-age", 0, "数据最长保留时间，如 168h；0 表示不按时间清理")
+	var maxMB int64
+	flag.Int64Var(&maxMB, "retention-max-mb", 0, "数据占用空间上限（MB），超出后从最旧的数据开始删除；0 表示不限制")
+	flag.DurationVar(&cfg.RetentionInterval, "retention-interval", 10*time.Minute, "保留策略清理任务的执行间隔")
+	var rollup bool
+	var rollupMinute, rollupHour time.Duration
+	flag.BoolVar(&rollup, "rollup", true, "按分钟/小时预聚合流量，加速大时间范围的统计与时间序列查询")
+	flag.DurationVar(&rollupMinute, "rollup-1m-max-age", 720*time.Hour, "分钟预聚合表的保留时间；0 表示永久保留")
+	flag.DurationVar(&rollupHour, "rollup-1h-max-age", 0, "小时预聚合表的保留时间；0 表示永久保留")
+	flag.DurationVar(&cfg.RollupInterval, "rollup-interval", time.Minute, "预聚合任务的执行间隔")
+	flag.DurationVar(&cfg.Cold.SealAfter, "cold-after", 0, "DuckDB 冷存储：早于该时长的完整分区封存为 Parquet 文件，如 24h；0 表示不启用")
+	flag.DurationVar(&cfg.Cold.Partition, "cold-partition", time.Hour, "冷存储分区粒度：1h 或 24h")
+	flag.StringVar(&cfg.Cold.Dir, "cold-dir", "", "冷存储 Parquet 文件目录，默认为数据库文件旁的 <db>.cold")
+	flag.DurationVar(&cfg.ColdInterval, "cold-interval", 10*time.Minute, "冷存储封存任务的执行间隔")
+	var exposeMetrics bool
+	flag.BoolVar(&exposeMetrics, "metrics", true, "在 /metrics 暴露 Prometheus 格式的自身指标")
+	flag.BoolVar(&cfg.MetricsRED, "metrics-red", false, "在 /metrics 中额外输出按目的地址与接口划分的 RED 指标")
+	flag.IntVar(&cfg.MetricsREDMaxSeries, "metrics-red-max-series", metrics.DefaultREDMaxSeries, "RED 指标最多区分的接口数，超出的合并为 __overflow__")
+	var writeBuffer bool
+	flag.BoolVar(&writeBuffer, "write-buffer", true, "合并并发上报的记录批量写入（group commit）")
+	flag.IntVar(&cfg.WriteBuffer.MaxBatch, "write-max-batch", 1000, "写缓冲单批最多合并的条数")
+	flag.DurationVar(&cfg.WriteBuffer.MaxDelay, "write-max-delay", 0, "写缓冲为凑批额外等待的时间；0 表示空闲时立即写入")
+	flag.DurationVar(&cfg.WriteBuffer.WriteTimeout, "write-timeout", writebuf.DefaultWriteTimeout, "写缓冲单批写库的超时，超时后该批的上报请求返回 500")
 	flag.Parse()
+	cfg.DisableMetrics = !exposeMetrics
+	cfg.DisableWriteBuffer = !writeBuffer
+	cfg.Retention.MaxBytes = maxMB << 20
+	cfg.DisableRollup = !rollup
+	cfg.Rollup.MaxAge = map[storage.Resolution]time.Duration{
+		storage.ResolutionMinute: rollupMinute,
+		storage.ResolutionHour:   rollupHour,
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -35,7 +85,23 @@ func main() {
 		_ = srv.Shutdown(shutdownCtx)
 	}()
 
-	log.Printf("server 监听：%s", cfg.ListenAddr)
+	scheme := "http"
+	if srv.TLSEnabled() {
+		scheme = "https"
+	}
+	if cfg.AuthFile == "" {
+		log.Printf("未指定 -auth-config，API 不做认证")
+	}
+	if cfg.Retention.Enabled() {
+		log.Printf("数据保留策略：max-age=%s max-mb=%d，每 %s 清理一次", cfg.Retention.MaxAge, maxMB, cfg.RetentionInterval)
+	}
+	if rollup {
+		log.Printf("预聚合：1m 表保留 %s，1h 表保留 %s（0 为永久），每 %s 执行一次", rollupMinute, rollupHour, cfg.RollupInterval)
+	}
+	if cfg.Cold.SealAfter > 0 {
+		log.Printf("冷存储：早于 %s 的 %s 分区封存为 Parquet，每 %s 执行一次", cfg.Cold.SealAfter, cfg.Cold.Partition, cfg.ColdInterval)
+	}
+	log.Printf("server 监听：%s://%s", scheme, cfg.ListenAddr)
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("server 运行失败：%v", err)
 	}
@@ -4,16 +4,24 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 
 	"lightobs/internal/agent/capture"
+	"lightobs/internal/agent/debug"
 	"lightobs/internal/agent/filter"
 	"lightobs/internal/agent/httpmatcher"
 	"lightobs/internal/agent/pidmap"
 	"lightobs/internal/agent/report"
+	"lightobs/internal/agent/spool"
+	"lightobs/internal/tlsutil"
+	"lightobs/pkg/wire"
 )
 
 func Run(ctx context.Context, cfg Config) error {
@@ -37,7 +45,62 @@ func Run(ctx context.Context, cfg Config) error {
 		return fmt.Errorf("设置 BPF 失败：%w", err)
 	}
 
-	rep := report.NewClient(cfg.ServerIP, cfg.ServerPort, cfg.HTTPPostTimeout)
+	overflow, err := report.ParseOverflowPolicy(cfg.Overflow)
+	if err != nil {
+		return err
+	}
+	var sp *spool.Spool
+	if cfg.SpoolDir != "" {
+		sp, err = spool.Open(cfg.SpoolDir, cfg.SpoolMaxBytes)
+		if err != nil {
+			return err
+		}
+		if n := sp.Stats().Records; n > 0 {
+			log.Printf("spool 中有 %d 条待重放记录：%s", n, cfg.SpoolDir)
+		}
+	}
+	contentType, err := report.ParseEncoding(cfg.Encoding)
+	if err != nil {
+		return err
+	}
+	compression, err := wire.ParseCompression(cfg.Compression)
+	if err != nil {
+		return err
+	}
+	tlsCfg, err := tlsutil.ClientConfig(cfg.TLS)
+	if err != nil {
+		return err
+	}
+	token, err := loadToken(cfg)
+	if err != nil {
+		return err
+	}
+	rep := report.NewClient(cfg.ServerIP, cfg.ServerPort, cfg.HTTPPostTimeout,
+		report.WithEncoding(contentType),
+		report.WithCompression(compression),
+		report.WithTLS(tlsCfg),
+		report.WithToken(token),
+	)
+	pipeline := report.NewPipeline(rep, report.PipelineConfig{
+		QueueSize:     cfg.QueueSize,
+		BatchSize:     cfg.BatchSize,
+		FlushInterval: cfg.FlushInterval,
+		Overflow:      overflow,
+		Spool:         sp,
+	})
+	// 上报在独立 goroutine 中进行，慢 server 不会再阻塞抓包读取。
+	// 抓包循环无论因 ctx 结束还是读包出错返回，都先取消 pipeline 并等它把剩余数据发完。
+	pipelineCtx, cancelPipeline := context.WithCancel(ctx)
+	pipelineDone := make(chan struct{})
+	go func() {
+		defer close(pipelineDone)
+		pipeline.Run(pipelineCtx)
+	}()
+	defer func() {
+		cancelPipeline()
+		<-pipelineDone
+	}()
+
 	m := httpmatcher.NewMatcher(cfg.RequestTimeout)
 	var resolver *pidmap.Resolver
 	if cfg.EnableEBPF {
@@ -49,7 +112,36 @@ func Run(ctx context.Context, cfg Config) error {
 		defer resolver.Close()
 	}
 
-	log.Printf("开始抓包：iface=%s -> server=%s:%d", cfg.Interface, cfg.ServerIP, cfg.ServerPort)
+	var ps parserStats
+	if cfg.DebugAddr != "" {
+		src := debug.Sources{
+			Matcher: m,
+			Capture: handle,
+			Parser:  ps.snapshot,
+			Upload:  pipeline,
+		}
+		// 注意不能把 nil 的 *Resolver 直接赋给接口，否则接口本身非 nil。
+		if resolver != nil {
+			src.PIDMap = resolver
+		}
+		dbg, err := debug.Listen(cfg.DebugAddr, src)
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := dbg.Serve(); err != nil && err != http.ErrServerClosed {
+				log.Printf("调试接口退出：%v", err)
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			_ = dbg.Shutdown(shutdownCtx)
+		}()
+		log.Printf("调试接口监听：http://%s/debug/state", dbg.Addr())
+	}
+
+	log.Printf("开始抓包：iface=%s -> server=%s:%d tls=%v", cfg.Interface, cfg.ServerIP, cfg.ServerPort, tlsCfg != nil)
 
 	cleanupTicker := time.NewTicker(2 * time.Second)
 	defer cleanupTicker.Stop()
@@ -71,19 +163,23 @@ func Run(ctx context.Context, cfg Config) error {
 			return err
 		}
 
+		ps.packets.Add(1)
 		packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.NoCopy)
 		ip4 := packet.Layer(layers.LayerTypeIPv4)
 		if ip4 == nil {
+			ps.nonIPv4.Add(1)
 			continue
 		}
 		ipv4, _ := ip4.(*layers.IPv4)
 
 		tcpL := packet.Layer(layers.LayerTypeTCP)
 		if tcpL == nil {
+			ps.nonTCP.Add(1)
 			continue
 		}
 		tcp, _ := tcpL.(*layers.TCP)
 		if len(tcp.Payload) == 0 {
+			ps.emptyPayload.Add(1)
 			continue
 		}
 
@@ -98,16 +194,53 @@ func Run(ctx context.Context, cfg Config) error {
 		}
 
 		if m.ObserveRequest(meta) {
+			ps.requests.Add(1)
 			continue
 		}
 
-		if logEntry, ok := m.ObserveResponse(meta); ok {
-			if resolver != nil {
-				logEntry.PID = resolver.Lookup(logEntry.SrcIP, logEntry.SrcPort, logEntry.DstIP, logEntry.DstPort)
-			}
-			if err := rep.Upload(ctx, logEntry); err != nil {
-				log.Printf("上报失败（忽略继续抓包）：%v", err)
-			}
+		logEntry, ok := m.ObserveResponse(meta)
+		if !ok {
+			ps.ignored.Add(1)
+			continue
+		}
+		ps.responses.Add(1)
+		if resolver != nil {
+			logEntry.PID = resolver.Lookup(logEntry.SrcIP, logEntry.SrcPort, logEntry.DstIP, logEntry.DstPort)
 		}
+		pipeline.Enqueue(ctx, logEntry)
+	}
+}
+
+// parserStats 由抓包 goroutine 累加、调试接口并发读取，因此全部使用原子计数。
+type parserStats struct {
+	packets      atomic.Uint64
+	nonIPv4      atomic.Uint64
+	nonTCP       atomic.Uint64
+	emptyPayload atomic.Uint64
+	requests     atomic.Uint64
+	responses    atomic.Uint64
+	ignored      atomic.Uint64
+}
+
+func (p *parserStats) snapshot() debug.ParserStats {
+	return debug.ParserStats{
+		Packets:      p.packets.Load(),
+		NonIPv4:      p.nonIPv4.Load(),
+		NonTCP:       p.nonTCP.Load(),
+		EmptyPayload: p.emptyPayload.Load(),
+		Requests:     p.requests.Load(),
+		Responses:    p.responses.Load(),
+		Ignored:      p.ignored.Load(),
+	}
+}
+
+func loadToken(cfg Config) (string, error) {
+	if cfg.TokenFile == "" {
+		return cfg.Token, nil
+	}
+	data, err := os.ReadFile(cfg.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("读取 token 文件失败：%w", err)
 	}
+	return strings.TrimSpace(string(data)), nil
 }
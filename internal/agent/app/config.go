@@ -1,6 +1,10 @@
 package app
 
-import "time"
+import (
+	"time"
+
+	"lightobs/internal/tlsutil"
+)
 
 type Config struct {
 	Interface       string
@@ -9,4 +13,17 @@ type Config struct {
 	RequestTimeout  time.Duration
 	HTTPPostTimeout time.Duration
 	EnableEBPF      bool
+	DebugAddr       string
+	QueueSize       int
+	BatchSize       int
+	FlushInterval   time.Duration
+	Overflow        string
+	Encoding        string
+	Compression     string
+	SpoolDir        string
+	SpoolMaxBytes   int64
+	TLS             tlsutil.ClientOptions
+	// Token 是上报使用的 Bearer token；TokenFile 非空时从文件读取（便于挂载 Secret），优先于 Token。
+	Token     string
+	TokenFile string
 }
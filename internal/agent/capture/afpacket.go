@@ -96,6 +96,36 @@ func (h *AFPacketHandle) SetBPF(ins []bpf.RawInstruction) error {
 	return h.tp.SetBPF(ins)
 }
 
+// Stats 汇总用户态读取计数与内核 socket 计数（后者包含 ring buffer 满时的丢包）。
+type Stats struct {
+	Packets      int64 `json:"packets"`
+	Polls        int64 `json:"polls"`
+	KernelSeen   uint  `json:"kernel_packets"`
+	KernelDrops  uint  `json:"kernel_drops"`
+	QueueFreezes uint  `json:"queue_freezes"`
+}
+
+func (h *AFPacketHandle) Stats() (Stats, error) {
+	if h.tp == nil {
+		return Stats{}, os.ErrInvalid
+	}
+	st, err := h.tp.Stats()
+	if err != nil {
+		return Stats{}, fmt.Errorf("读取抓包统计失败：%w", err)
+	}
+	out := Stats{Packets: st.Packets, Polls: st.Polls}
+
+	// SocketStats 返回的是累计值；V3 与 V1/V2 只会有一组非零，直接相加即可。
+	ss, ssv3, err := h.tp.SocketStats()
+	if err != nil {
+		return out, fmt.Errorf("读取 socket 统计失败：%w", err)
+	}
+	out.KernelSeen = ss.Packets() + ssv3.Packets()
+	out.KernelDrops = ss.Drops() + ssv3.Drops()
+	out.QueueFreezes = ssv3.QueueFreezes()
+	return out, nil
+}
+
 func (h *AFPacketHandle) ReadPacket(ctx context.Context) ([]byte, gopacket.CaptureInfo, error) {
 	if h.tp == nil {
 		return nil, gopacket.CaptureInfo{}, os.ErrInvalid
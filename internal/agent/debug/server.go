@@ -0,0 +1,228 @@
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"lightobs/internal/agent/capture"
+	"lightobs/internal/agent/httpmatcher"
+	"lightobs/internal/agent/pidmap"
+	"lightobs/internal/agent/report"
+)
+
+type PIDMapSource interface {
+	Entries(limit int) ([]pidmap.Entry, error)
+}
+
+type MatcherSource interface {
+	Stats() httpmatcher.Stats
+	Pending(limit int) []httpmatcher.PendingRequest
+}
+
+type CaptureSource interface {
+	Stats() (capture.Stats, error)
+}
+
+type UploadSource interface {
+	Stats() report.Stats
+}
+
+// ParserStats 记录抓包主循环对每个包的分流结果。
+type ParserStats struct {
+	Packets      uint64 `json:"packets"`
+	NonIPv4      uint64 `json:"non_ipv4"`
+	NonTCP       uint64 `json:"non_tcp"`
+	EmptyPayload uint64 `json:"empty_payload"`
+	Requests     uint64 `json:"requests"`
+	Responses    uint64 `json:"responses"`
+	Ignored      uint64 `json:"ignored"`
+}
+
+// Sources 汇集调试接口需要读取的各模块；未启用的模块保持 nil 即可。
+type Sources struct {
+	PIDMap  PIDMapSource
+	Matcher MatcherSource
+	Capture CaptureSource
+	Parser  func() ParserStats
+	Upload  UploadSource
+}
+
+type Snapshot struct {
+	Time     time.Time                    `json:"time"`
+	PIDMap   *PIDMapSection               `json:"pidmap,omitempty"`
+	Matcher  *httpmatcher.Stats           `json:"matcher,omitempty"`
+	Requests []httpmatcher.PendingRequest `json:"requests,omitempty"`
+	Capture  *CaptureSection              `json:"capture,omitempty"`
+	Parser   *ParserStats                 `json:"parser,omitempty"`
+	Upload   *report.Stats                `json:"upload,omitempty"`
+}
+
+type PIDMapSection struct {
+	Entries []pidmap.Entry `json:"entries"`
+	Error   string         `json:"error,omitempty"`
+}
+
+type CaptureSection struct {
+	capture.Stats
+	Error string `json:"error,omitempty"`
+}
+
+const defaultLimit = 100
+
+// Handler 返回只读的调试路由：
+//   - /debug/state：所有模块的汇总快照
+//   - /debug/pidmap、/debug/requests、/debug/capture、/debug/parser、/debug/upload：单个模块
+//
+// pidmap 与 requests 支持 ?limit=N（默认 100，0 表示不限制）。
+func Handler(src Sources) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/state", func(w http.ResponseWriter, r *http.Request) {
+		limit := parseLimit(r)
+		snap := Snapshot{
+			Time:    time.Now(),
+			PIDMap:  src.pidmap(limit),
+			Capture: src.capture(),
+			Parser:  src.parser(),
+			Upload:  src.upload(),
+		}
+		if src.Matcher != nil {
+			st := src.Matcher.Stats()
+			snap.Matcher = &st
+			snap.Requests = src.Matcher.Pending(limit)
+		}
+		writeJSON(w, snap)
+	})
+	mux.HandleFunc("/debug/pidmap", func(w http.ResponseWriter, r *http.Request) {
+		writeSection(w, src.pidmap(parseLimit(r)))
+	})
+	mux.HandleFunc("/debug/requests", func(w http.ResponseWriter, r *http.Request) {
+		if src.Matcher == nil {
+			writeDisabled(w)
+			return
+		}
+		writeJSON(w, src.Matcher.Pending(parseLimit(r)))
+	})
+	mux.HandleFunc("/debug/capture", func(w http.ResponseWriter, r *http.Request) {
+		writeSection(w, src.capture())
+	})
+	mux.HandleFunc("/debug/parser", func(w http.ResponseWriter, r *http.Request) {
+		writeSection(w, src.parser())
+	})
+	mux.HandleFunc("/debug/upload", func(w http.ResponseWriter, r *http.Request) {
+		writeSection(w, src.upload())
+	})
+	return mux
+}
+
+func (s Sources) pidmap(limit int) *PIDMapSection {
+	if s.PIDMap == nil {
+		return nil
+	}
+	entries, err := s.PIDMap.Entries(limit)
+	sec := &PIDMapSection{Entries: entries}
+	if sec.Entries == nil {
+		sec.Entries = []pidmap.Entry{}
+	}
+	if err != nil {
+		sec.Error = err.Error()
+	}
+	return sec
+}
+
+func (s Sources) capture() *CaptureSection {
+	if s.Capture == nil {
+		return nil
+	}
+	st, err := s.Capture.Stats()
+	sec := &CaptureSection{Stats: st}
+	if err != nil {
+		sec.Error = err.Error()
+	}
+	return sec
+}
+
+func (s Sources) parser() *ParserStats {
+	if s.Parser == nil {
+		return nil
+	}
+	st := s.Parser()
+	return &st
+}
+
+func (s Sources) upload() *report.Stats {
+	if s.Upload == nil {
+		return nil
+	}
+	st := s.Upload.Stats()
+	return &st
+}
+
+func writeSection[T any](w http.ResponseWriter, sec *T) {
+	if sec == nil {
+		writeDisabled(w)
+		return
+	}
+	writeJSON(w, sec)
+}
+
+// writeDisabled 对未启用的模块返回 404，避免调用方把 null 误当作“没有数据”。
+func writeDisabled(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": "模块未启用"})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func parseLimit(r *http.Request) int {
+	limit := defaultLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v >= 0 {
+			limit = v
+		}
+	}
+	return limit
+}
+
+// Server 是 agent 本地的调试 HTTP 服务，只应监听回环地址或 Pod 内部地址。
+type Server struct {
+	ln         net.Listener
+	httpServer *http.Server
+}
+
+// Listen 先同步绑定端口，这样地址冲突能在 agent 启动时直接报错。
+func Listen(addr string, src Sources) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("调试接口监听失败：%w", err)
+	}
+	return &Server{
+		ln: ln,
+		httpServer: &http.Server{
+			Handler:           Handler(src),
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}, nil
+}
+
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+func (s *Server) Serve() error {
+	return s.httpServer.Serve(s.ln)
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
@@ -0,0 +1,119 @@
+package debug
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"lightobs/internal/agent/capture"
+	"lightobs/internal/agent/httpmatcher"
+	"lightobs/internal/agent/pidmap"
+	"lightobs/internal/agent/report"
+)
+
+type fakePIDMap struct {
+	entries []pidmap.Entry
+	err     error
+	limit   int
+}
+
+func (f *fakePIDMap) Entries(limit int) ([]pidmap.Entry, error) {
+	f.limit = limit
+	return f.entries, f.err
+}
+
+type fakeCapture struct{}
+
+func (fakeCapture) Stats() (capture.Stats, error) {
+	return capture.Stats{Packets: 10, KernelDrops: 2}, nil
+}
+
+type fakeUpload struct{}
+
+func (fakeUpload) Stats() report.Stats {
+	return report.Stats{Sent: 3, Failed: 1}
+}
+
+func TestStateSnapshot(t *testing.T) {
+	m := httpmatcher.NewMatcher(time.Minute)
+	m.ObserveRequest(httpmatcher.PacketMeta{
+		Timestamp: time.Now(),
+		SrcIP:     "10.0.0.2",
+		SrcPort:   40000,
+		DstIP:     "10.0.0.1",
+		DstPort:   80,
+		Payload:   []byte("GET /pending HTTP/1.1\r\n\r\n"),
+	})
+	pm := &fakePIDMap{entries: []pidmap.Entry{{SrcIP: "10.0.0.2", PID: 42}}}
+	h := Handler(Sources{
+		PIDMap:  pm,
+		Matcher: m,
+		Capture: fakeCapture{},
+		Parser:  func() ParserStats { return ParserStats{Packets: 7} },
+		Upload:  fakeUpload{},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/state?limit=5", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d", w.Code)
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(w.Body.Bytes(), &snap); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if pm.limit != 5 {
+		t.Errorf("limit=%d", pm.limit)
+	}
+	if snap.PIDMap == nil || len(snap.PIDMap.Entries) != 1 || snap.PIDMap.Entries[0].PID != 42 {
+		t.Errorf("pidmap=%+v", snap.PIDMap)
+	}
+	if snap.Matcher == nil || snap.Matcher.Pending != 1 {
+		t.Errorf("matcher=%+v", snap.Matcher)
+	}
+	if len(snap.Requests) != 1 || snap.Requests[0].Path != "/pending" {
+		t.Errorf("requests=%+v", snap.Requests)
+	}
+	if snap.Capture == nil || snap.Capture.KernelDrops != 2 {
+		t.Errorf("capture=%+v", snap.Capture)
+	}
+	if snap.Parser == nil || snap.Parser.Packets != 7 {
+		t.Errorf("parser=%+v", snap.Parser)
+	}
+	if snap.Upload == nil || snap.Upload.Sent != 3 {
+		t.Errorf("upload=%+v", snap.Upload)
+	}
+}
+
+func TestPIDMapError(t *testing.T) {
+	h := Handler(Sources{PIDMap: &fakePIDMap{err: errors.New("boom")}})
+	req := httptest.NewRequest(http.MethodGet, "/debug/pidmap", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d", w.Code)
+	}
+	var sec PIDMapSection
+	if err := json.Unmarshal(w.Body.Bytes(), &sec); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if sec.Error != "boom" || sec.Entries == nil {
+		t.Errorf("section=%+v", sec)
+	}
+}
+
+func TestDisabledSection(t *testing.T) {
+	h := Handler(Sources{})
+	for _, path := range []string{"/debug/pidmap", "/debug/requests", "/debug/capture", "/debug/upload"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s status=%d", path, w.Code)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package httpmatcher
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -31,6 +32,24 @@ type Matcher struct {
 	mu       sync.Mutex
 	requests map[string]requestState
 	timeout  time.Duration
+	stats    Stats
+}
+
+// Stats 是匹配器的累计计数，用于调试接口观察解析状态。
+type Stats struct {
+	Requests  uint64 `json:"requests"`
+	Matched   uint64 `json:"matched"`
+	Unmatched uint64 `json:"unmatched"`
+	Expired   uint64 `json:"expired"`
+	Pending   int    `json:"pending"`
+}
+
+// PendingRequest 是一条尚未等到响应的请求。
+type PendingRequest struct {
+	Flow      string    `json:"flow"`
+	Timestamp time.Time `json:"timestamp"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
 }
 
 func NewMatcher(timeout time.Duration) *Matcher {
@@ -55,6 +74,7 @@ func (m *Matcher) ObserveRequest(p PacketMeta) bool {
 
 	m.mu.Lock()
 	m.requests[key] = requestState{ts: p.Timestamp, method: method, path: path}
+	m.stats.Requests++
 	m.mu.Unlock()
 	return true
 }
@@ -72,6 +92,9 @@ func (m *Matcher) ObserveResponse(p PacketMeta) (*model.TrafficLog, bool) {
 	req, found := m.requests[key]
 	if found {
 		delete(m.requests, key)
+		m.stats.Matched++
+	} else {
+		m.stats.Unmatched++
 	}
 	m.mu.Unlock()
 
@@ -104,11 +127,36 @@ func (m *Matcher) Cleanup(now time.Time) {
 	for k, v := range m.requests {
 		if v.ts.Before(deadline) {
 			delete(m.requests, k)
+			m.stats.Expired++
 		}
 	}
 	m.mu.Unlock()
 }
 
+func (m *Matcher) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := m.stats
+	st.Pending = len(m.requests)
+	return st
+}
+
+// Pending 返回当前等待响应的请求（按时间升序），最多 limit 条（limit<=0 表示不限制）。
+func (m *Matcher) Pending(limit int) []PendingRequest {
+	m.mu.Lock()
+	out := make([]PendingRequest, 0, len(m.requests))
+	for k, v := range m.requests {
+		out = append(out, PendingRequest{Flow: k, Timestamp: v.ts, Method: v.method, Path: v.path})
+	}
+	m.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Timestamp.Before(out[j].Timestamp) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
 func flowKey(clientIP string, clientPort int, serverIP string, serverPort int) string {
 	return fmt.Sprintf("%s:%d-%s:%d", clientIP, clientPort, serverIP, serverPort)
 }
@@ -123,3 +123,38 @@ func TestMatcher_IgnoreNonHTTP(t *testing.T) {
 		t.Error("Should ignore non-HTTP traffic")
 	}
 }
+
+func TestMatcher_StatsAndPending(t *testing.T) {
+	m := NewMatcher(time.Minute)
+	now := time.Now()
+	for i, path := range []string{"/b", "/a"} {
+		m.ObserveRequest(PacketMeta{
+			Timestamp: now.Add(time.Duration(-i) * time.Second),
+			SrcIP:     "10.0.0.2",
+			SrcPort:   40000 + i,
+			DstIP:     "10.0.0.1",
+			DstPort:   80,
+			Payload:   []byte("GET " + path + " HTTP/1.1\r\n\r\n"),
+		})
+	}
+	m.ObserveResponse(PacketMeta{
+		SrcIP:   "10.0.0.1",
+		SrcPort: 80,
+		DstIP:   "10.0.0.9",
+		DstPort: 1,
+		Payload: []byte("HTTP/1.1 200 OK\r\n\r\n"),
+	})
+
+	st := m.Stats()
+	if st.Requests != 2 || st.Unmatched != 1 || st.Pending != 2 {
+		t.Errorf("stats=%+v", st)
+	}
+
+	pending := m.Pending(0)
+	if len(pending) != 2 || pending[0].Path != "/a" {
+		t.Fatalf("pending=%+v", pending)
+	}
+	if got := m.Pending(1); len(got) != 1 {
+		t.Errorf("limit ignored: %+v", got)
+	}
+}
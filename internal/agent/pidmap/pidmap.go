@@ -3,7 +3,6 @@ package pidmap
 import (
 	"encoding/binary"
 	"fmt"
-	"log"
 	"net"
 
 	"github.com/cilium/ebpf"
@@ -17,9 +16,20 @@ type Resolver struct {
 	m    *ebpf.Map
 	prog *ebpf.Program
 	tp   link.Link
-    debugDumped bool
+	// ports 是 map 中端口的字节序，与 tracepoint 提供的 sport/dport 一致，由 eBPF 程序原样写入。
+	ports portOrder
 }
 
+// portOrder 是 flowKey 中端口字段的字节序。
+type portOrder int
+
+const (
+	// hostOrder：tracepoint 已做过 ntohs（sport/dport 为 __u16），这是常见情况。
+	hostOrder portOrder = iota
+	// netOrder：sport/dport 声明为 __be16，端口按网络序保存。
+	netOrder
+)
+
 type flowKey struct {
 	SrcIP   uint32
 	DstIP   uint32
@@ -29,6 +39,7 @@ type flowKey struct {
 }
 
 type offsets struct {
+	ports    portOrder
 	family   int16
 	newstate int16
 	sport    int16
@@ -79,7 +90,7 @@ func NewResolver() (*Resolver, error) {
 		m.Close()
 		return nil, fmt.Errorf("挂载 tracepoint 失败：%w", err)
 	}
-	return &Resolver{m: m, prog: prog, tp: tp}, nil
+	return &Resolver{m: m, prog: prog, tp: tp, ports: off.ports}, nil
 }
 
 func (r *Resolver) Lookup(srcIP string, srcPort int, dstIP string, dstPort int) int {
@@ -87,64 +98,64 @@ func (r *Resolver) Lookup(srcIP string, srcPort int, dstIP string, dstPort int)
 		return 0
 	}
 	var pid uint32
-	keyNet, ok := makeKeyNet(srcIP, srcPort, dstIP, dstPort)
-	if ok {
+	if keyNet, ok := makeKeyNet(srcIP, srcPort, dstIP, dstPort); ok {
 		if err := r.m.Lookup(&keyNet, &pid); err == nil {
 			return int(pid)
-		} else {
-            // Debug logging for lookup failure
-            // Only log if it's NOT a "not found" error to avoid spam, or log sparingly?
-            // Actually, if user sees 0, it IS "not found".
-            // Let's log the first few failures or just log it.
-            // log.Printf("Lookup failed for Net Key: Src=%s:%d Dst=%s:%d Key=%+v Err=%v", srcIP, srcPort, dstIP, dstPort, keyNet, err)
 		}
 	}
-	keyHost, ok := makeKeyHost(srcIP, srcPort, dstIP, dstPort)
-	if ok {
+	if keyHost, ok := makeKeyHost(srcIP, srcPort, dstIP, dstPort); ok {
 		if err := r.m.Lookup(&keyHost, &pid); err == nil {
 			return int(pid)
 		}
 	}
-    
-    if pid == 0 && !r.debugDumped {
-		keyNetHex := fmt.Sprintf("%08x %08x %04x %04x", keyNet.SrcIP, keyNet.DstIP, keyNet.SrcPort, keyNet.DstPort)
-		keyHostHex := fmt.Sprintf("%08x %08x %04x %04x", keyHost.SrcIP, keyHost.DstIP, keyHost.SrcPort, keyHost.DstPort)
-		log.Printf("Lookup failed for %s:%d -> %s:%d. Dumping Map...", srcIP, srcPort, dstIP, dstPort)
-		log.Printf("Tried KeyNet (LE): %s", keyNetHex)
-		log.Printf("Tried KeyHost (LE): %s", keyHostHex)
-		r.DebugDump()
-		r.debugDumped = true
-	}
+	return 0
+}
 
-	return int(pid)
+// Entry 是 BPF map 中一条记录的可读形式，供 agent 调试接口按需查看。
+type Entry struct {
+	SrcIP   string `json:"src_ip"`
+	SrcPort int    `json:"src_port"`
+	DstIP   string `json:"dst_ip"`
+	DstPort int    `json:"dst_port"`
+	PID     int    `json:"pid"`
+	RawKey  string `json:"raw_key"`
 }
 
-func (r *Resolver) DebugDump() {
+// Entries 遍历 BPF map，最多返回 limit 条记录（limit<=0 表示不限制）。
+// 同一连接按两个方向各存一份；端口按写入 map 时的字节序还原。
+func (r *Resolver) Entries(limit int) ([]Entry, error) {
 	if r == nil || r.m == nil {
-		return
+		return nil, nil
 	}
 	var key flowKey
 	var val uint32
+	out := make([]Entry, 0, 64)
 	iter := r.m.Iterate()
-	log.Println("--- BPF Map Dump Start ---")
-	count := 0
 	for iter.Next(&key, &val) {
-		srcIP := make(net.IP, 4)
-		binary.LittleEndian.PutUint32(srcIP, key.SrcIP)
-		dstIP := make(net.IP, 4)
-		binary.LittleEndian.PutUint32(dstIP, key.DstIP)
-		srcPort := toNetPort(key.SrcPort)
-		dstPort := toNetPort(key.DstPort)
-		
-		keyHex := fmt.Sprintf("%08x %08x %04x %04x", key.SrcIP, key.DstIP, key.SrcPort, key.DstPort)
-		log.Printf("Map Entry: %s:%d -> %s:%d | PID: %d | RawKey: %s", srcIP, srcPort, dstIP, dstPort, val, keyHex)
-		count++
-		if count >= 20 {
-			log.Println("... (truncated)")
-			break
+		out = append(out, entryFromKey(key, val, r.ports))
+		if limit > 0 && len(out) >= limit {
+			return out, nil
 		}
 	}
-	log.Println("--- BPF Map Dump End ---")
+	if err := iter.Err(); err != nil {
+		return out, fmt.Errorf("遍历 map 失败：%w", err)
+	}
+	return out, nil
+}
+
+func entryFromKey(key flowKey, pid uint32, order portOrder) Entry {
+	srcIP := make(net.IP, 4)
+	binary.LittleEndian.PutUint32(srcIP, key.SrcIP)
+	dstIP := make(net.IP, 4)
+	binary.LittleEndian.PutUint32(dstIP, key.DstIP)
+	return Entry{
+		SrcIP:   srcIP.String(),
+		SrcPort: int(order.port(key.SrcPort)),
+		DstIP:   dstIP.String(),
+		DstPort: int(order.port(key.DstPort)),
+		PID:     int(pid),
+		RawKey:  fmt.Sprintf("%08x %08x %04x %04x", key.SrcIP, key.DstIP, key.SrcPort, key.DstPort),
+	}
 }
 
 func (r *Resolver) Close() error {
@@ -199,6 +210,14 @@ func toNetPort(p uint16) uint16 {
 	return (p << 8) | (p >> 8)
 }
 
+// port 把 map 中保存的端口还原为主机序的端口号。
+func (o portOrder) port(p uint16) uint16 {
+	if o == netOrder {
+		return toNetPort(p)
+	}
+	return p
+}
+
 func resolveOffsets(st *btf.Struct) (offsets, error) {
 	var out offsets
 	var err error
@@ -211,6 +230,7 @@ func resolveOffsets(st *btf.Struct) (offsets, error) {
 	if out.sport, err = memberOffset(st, "sport"); err != nil {
 		return offsets{}, err
 	}
+	out.ports = memberPortOrder(st, "sport")
 	if out.dport, err = memberOffset(st, "dport"); err != nil {
 		return offsets{}, err
 	}
@@ -232,6 +252,19 @@ func memberOffset(st *btf.Struct, name string) (int16, error) {
 	return 0, fmt.Errorf("成员缺失：%s", name)
 }
 
+// memberPortOrder 按成员的类型名判断端口字节序：__be16 为网络序，其余按主机序。
+func memberPortOrder(st *btf.Struct, name string) portOrder {
+	for _, m := range st.Members {
+		if m.Name != name {
+			continue
+		}
+		if td, ok := m.Type.(*btf.Typedef); ok && td.Name == "__be16" {
+			return netOrder
+		}
+	}
+	return hostOrder
+}
+
 func buildProgram(m *ebpf.Map, off offsets) asm.Instructions {
 	const (
 		afInet          = 2
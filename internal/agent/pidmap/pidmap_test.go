@@ -3,6 +3,8 @@ package pidmap
 import (
 	"testing"
 	"unsafe"
+
+	"github.com/cilium/ebpf/btf"
 )
 
 func TestMakeKeyEndianness(t *testing.T) {
@@ -95,3 +97,46 @@ func TestToNetPort(t *testing.T) {
 		t.Errorf("Expected 0x901F, got 0x%x", p)
 	}
 }
+
+func TestEntryFromKey(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		key   flowKey
+		order portOrder
+	}{
+		{"host", must(makeKeyHost("192.168.1.1", 12345, "10.0.0.1", 80)), hostOrder},
+		{"net", must(makeKeyNet("192.168.1.1", 12345, "10.0.0.1", 80)), netOrder},
+	} {
+		e := entryFromKey(tc.key, 4321, tc.order)
+		if e.SrcIP != "192.168.1.1" || e.DstIP != "10.0.0.1" {
+			t.Errorf("%s: ip mismatch: %+v", tc.name, e)
+		}
+		if e.SrcPort != 12345 || e.DstPort != 80 {
+			t.Errorf("%s: port mismatch: %+v", tc.name, e)
+		}
+		if e.PID != 4321 {
+			t.Errorf("%s: pid mismatch: %+v", tc.name, e)
+		}
+	}
+}
+
+func TestMemberPortOrder(t *testing.T) {
+	u16 := &btf.Int{Name: "unsigned short", Size: 2}
+	st := &btf.Struct{Members: []btf.Member{
+		{Name: "sport", Type: &btf.Typedef{Name: "__u16", Type: u16}},
+		{Name: "dport", Type: &btf.Typedef{Name: "__be16", Type: u16}},
+	}}
+	if o := memberPortOrder(st, "sport"); o != hostOrder {
+		t.Errorf("__u16: got %v, want hostOrder", o)
+	}
+	if o := memberPortOrder(st, "dport"); o != netOrder {
+		t.Errorf("__be16: got %v, want netOrder", o)
+	}
+}
+
+func must(k flowKey, ok bool) flowKey {
+	if !ok {
+		panic("make key failed")
+	}
+	return k
+}
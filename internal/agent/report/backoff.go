@@ -0,0 +1,38 @@
+package report
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoff 实现带 full jitter 的指数退避：第 n 次等待 [0, min(max, base*2^n)) 内的随机时长，
+// 避免大量 agent 在 server 恢复瞬间同时重放。
+type backoff struct {
+	base    time.Duration
+	max     time.Duration
+	attempt int
+}
+
+func newBackoff(base, max time.Duration) *backoff {
+	if base <= 0 {
+		base = 500 * time.Millisecond
+	}
+	if max < base {
+		max = base
+	}
+	return &backoff{base: base, max: max}
+}
+
+func (b *backoff) next() time.Duration {
+	d := b.base << b.attempt
+	if d <= 0 || d > b.max {
+		d = b.max
+	} else {
+		b.attempt++
+	}
+	return time.Duration(rand.Int63n(int64(d))) + 1
+}
+
+func (b *backoff) reset() {
+	b.attempt = 0
+}
@@ -3,39 +3,236 @@ package report
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
+	"lightobs/internal/agent/spool"
 	"lightobs/pkg/model"
+	"lightobs/pkg/wire"
 )
 
 type Client struct {
-	url    string
-	client *http.Client
+	url      string
+	batchURL string
+	client   *http.Client
+
+	// contentType/contentEncoding 只作用于批量上报；单条 Upload 始终使用 JSON。
+	contentType     string
+	contentEncoding string
+	tlsConfig       *tls.Config
+	token           string
+
+	sent     atomic.Uint64
+	failed   atomic.Uint64
+	rejected atomic.Uint64
+	inFlight atomic.Int64
+}
+
+// Stats 是上报的累计计数（按记录条数），供调试接口展示。
+// 队列相关字段只有经过 Pipeline 上报时才会填充。
+type Stats struct {
+	Sent     uint64 `json:"sent"`
+	Failed   uint64 `json:"failed"`
+	Rejected uint64 `json:"rejected"`
+	InFlight int64  `json:"in_flight"`
+
+	QueueDepth int    `json:"queue_depth"`
+	QueueCap   int    `json:"queue_cap"`
+	Enqueued   uint64 `json:"enqueued"`
+	Dropped    uint64 `json:"dropped"`
+	Batches    uint64 `json:"batches"`
+
+	Spool    *spool.Stats `json:"spool,omitempty"`
+	Spooled  uint64       `json:"spooled"`
+	Replayed uint64       `json:"replayed"`
+	Retries  uint64       `json:"retries"`
+}
+
+// BatchResult 与 server 端 /api/v1/upload/batch 的响应对应。
+type BatchResult struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Errors   []BatchReject `json:"errors,omitempty"`
 }
 
-func NewClient(serverIP string, serverPort int, timeout time.Duration) *Client {
-	return &Client{
-		url: fmt.Sprintf("http://%s:%d/api/v1/upload", serverIP, serverPort),
+type BatchReject struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+type Option func(*Client)
+
+// WithEncoding 选择批量上报的编码：wire.ContentTypeJSON 或 wire.ContentTypeProtobuf。
+func WithEncoding(contentType string) Option {
+	return func(c *Client) {
+		c.contentType = contentType
+	}
+}
+
+// WithCompression 选择批量上报的压缩方式：wire.EncodingGzip / wire.EncodingZstd，空串表示不压缩。
+func WithCompression(encoding string) Option {
+	return func(c *Client) {
+		c.contentEncoding = encoding
+	}
+}
+
+// WithTLS 改用 HTTPS 上报；cfg 中带客户端证书即为 mTLS。
+func WithTLS(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithToken 在每个请求上携带 Authorization: Bearer <token>，对应 server 的 ingest 凭证。
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+func NewClient(serverIP string, serverPort int, timeout time.Duration, opts ...Option) *Client {
+	c := &Client{
+		contentType: wire.ContentTypeJSON,
 		client: &http.Client{
 			Timeout: timeout,
 		},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	scheme := "http"
+	if c.tlsConfig != nil {
+		scheme = "https"
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = c.tlsConfig
+		c.client.Transport = transport
+	}
+	base := fmt.Sprintf("%s://%s/api/v1", scheme, net.JoinHostPort(serverIP, strconv.Itoa(serverPort)))
+	c.url = base + "/upload"
+	c.batchURL = base + "/upload/batch"
+	return c
+}
+
+// ParseEncoding 把命令行中的 json/protobuf 转为 Content-Type。
+func ParseEncoding(s string) (string, error) {
+	switch s {
+	case "", "json":
+		return wire.ContentTypeJSON, nil
+	case "protobuf", "proto":
+		return wire.ContentTypeProtobuf, nil
+	default:
+		return "", fmt.Errorf("不支持的编码：%s（可选 json / protobuf）", s)
+	}
+}
+
+func (c *Client) Stats() Stats {
+	return Stats{
+		Sent:     c.sent.Load(),
+		Failed:   c.failed.Load(),
+		Rejected: c.rejected.Load(),
+		InFlight: c.inFlight.Load(),
+	}
 }
 
 func (c *Client) Upload(ctx context.Context, logEntry *model.TrafficLog) error {
+	c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
 	body, err := json.Marshal(logEntry)
 	if err != nil {
+		c.failed.Add(1)
 		return fmt.Errorf("序列化 JSON 失败：%w", err)
 	}
+	if err := c.post(ctx, c.url, body, wire.ContentTypeJSON, wire.EncodingIdentity, nil); err != nil {
+		c.failed.Add(1)
+		return err
+	}
+	c.sent.Add(1)
+	return nil
+}
+
+// UploadBatch 一次请求上报多条记录。server 会逐条校验，非法记录计入 Rejected，不影响其他记录入库。
+func (c *Client) UploadBatch(ctx context.Context, logs []*model.TrafficLog) (BatchResult, error) {
+	if len(logs) == 0 {
+		return BatchResult{}, nil
+	}
+	c.inFlight.Add(int64(len(logs)))
+	defer c.inFlight.Add(-int64(len(logs)))
+
+	body, err := c.encodeBatch(logs)
+	if err != nil {
+		c.failed.Add(uint64(len(logs)))
+		return BatchResult{}, err
+	}
+	var res BatchResult
+	if err := c.post(ctx, c.batchURL, body, c.contentType, c.contentEncoding, &res); err != nil {
+		c.failed.Add(uint64(len(logs)))
+		return BatchResult{}, err
+	}
+	c.sent.Add(uint64(res.Accepted))
+	c.rejected.Add(uint64(res.Rejected))
+	return res, nil
+}
+
+// StatusError 表示 server 返回了非 2xx 状态码。
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("POST 上报失败：status=%s", e.Status)
+}
+
+// Retryable 判断上报错误是否值得重试：网络错误与 5xx/408/429 可重试；
+// 401 通常是凭证轮换未完成，修正后即可恢复，也按可重试处理以免丢弃已落盘的数据。
+// 403 说明凭证有效但缺少 ingest 角色，在重新配置前永远不会成功，重试只会让 spool 挤掉正常数据；
+// 其余 4xx 说明请求本身有问题，同样不重试。
+func Retryable(err error) bool {
+	var se *StatusError
+	if !errors.As(err, &se) {
+		return true
+	}
+	switch se.Code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusUnauthorized:
+		return true
+	}
+	return se.Code >= 500
+}
+
+func (c *Client) encodeBatch(logs []*model.TrafficLog) ([]byte, error) {
+	var body []byte
+	if c.contentType == wire.ContentTypeProtobuf {
+		body = wire.Marshal(logs)
+	} else {
+		b, err := json.Marshal(logs)
+		if err != nil {
+			return nil, fmt.Errorf("序列化 JSON 失败：%w", err)
+		}
+		body = b
+	}
+	return wire.Compress(c.contentEncoding, body)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+func (c *Client) post(ctx context.Context, url string, body []byte, contentType, contentEncoding string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("构造 HTTP 请求失败：%w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", contentType)
+	if contentEncoding != wire.EncodingIdentity {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
 
 	resp, err := c.client.Do(req)
 	if err != nil {
@@ -44,8 +241,12 @@ func (c *Client) Upload(ctx context.Context, logEntry *model.TrafficLog) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode/100 != 2 {
-		return fmt.Errorf("POST 上报失败：status=%s", resp.Status)
+		return &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("解析响应 JSON 失败：%w", err)
+		}
 	}
 	return nil
 }
-
@@ -2,14 +2,18 @@ package report
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"lightobs/pkg/model"
+	"lightobs/pkg/wire"
 )
 
 func TestClient_Upload(t *testing.T) {
@@ -54,3 +58,64 @@ func TestClient_Upload(t *testing.T) {
 		t.Fatalf("Upload failed: %v", err)
 	}
 }
+
+func TestClient_UploadBatchProtobuf(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != wire.ContentTypeProtobuf || r.Header.Get("Content-Encoding") != wire.EncodingGzip {
+			t.Errorf("headers: %v", r.Header)
+		}
+		if r.Header.Get("Authorization") != "Bearer agent-secret" {
+			t.Errorf("authorization=%q", r.Header.Get("Authorization"))
+		}
+		body, err := wire.NewReader(r.Header.Get("Content-Encoding"), r.Body)
+		if err != nil {
+			t.Errorf("NewReader: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer body.Close()
+		logs, err := wire.Decode(body, 0)
+		if err != nil {
+			t.Errorf("Decode: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(BatchResult{Accepted: len(logs)})
+	}))
+	defer server.Close()
+
+	addr := server.Listener.Addr().(*net.TCPAddr)
+	c := NewClient("127.0.0.1", addr.Port, time.Second,
+		WithEncoding(wire.ContentTypeProtobuf),
+		WithCompression(wire.EncodingGzip),
+		WithToken("agent-secret"),
+	)
+	res, err := c.UploadBatch(context.Background(), []*model.TrafficLog{{PID: 1}, {PID: 2}})
+	if err != nil {
+		t.Fatalf("UploadBatch failed: %v", err)
+	}
+	if res.Accepted != 2 || c.Stats().Sent != 2 {
+		t.Errorf("res=%+v stats=%+v", res, c.Stats())
+	}
+}
+
+func TestClient_UploadTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			t.Errorf("expected TLS connection")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	addr := server.Listener.Addr().(*net.TCPAddr)
+	c := NewClient("127.0.0.1", addr.Port, time.Second, WithTLS(&tls.Config{RootCAs: pool}))
+	if !strings.HasPrefix(c.url, "https://") {
+		t.Fatalf("url=%s", c.url)
+	}
+	if err := c.Upload(context.Background(), &model.TrafficLog{PID: 1}); err != nil {
+		t.Fatalf("Upload over TLS failed: %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"lightobs/internal/agent/spool"
+	"lightobs/pkg/model"
+)
+
+// OverflowPolicy 决定队列满时新记录如何处理。
+type OverflowPolicy string
+
+const (
+	// DropOldest 丢弃队首最旧的记录，为新记录腾位置（默认）。
+	DropOldest OverflowPolicy = "drop-oldest"
+	// DropNewest 直接丢弃新记录。
+	DropNewest OverflowPolicy = "drop-newest"
+	// Block 阻塞调用方直到有空位；会反压到抓包循环，仅适合不能丢数据的场景。
+	Block OverflowPolicy = "block"
+)
+
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch p := OverflowPolicy(s); p {
+	case DropOldest, DropNewest, Block:
+		return p, nil
+	case "":
+		return DropOldest, nil
+	default:
+		return "", fmt.Errorf("未知的溢出策略：%s（可选 drop-oldest / drop-newest / block）", s)
+	}
+}
+
+type PipelineConfig struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	Overflow      OverflowPolicy
+
+	// Spool 非空时，发送失败的批次会落盘，并由后台按顺序重放。
+	Spool        *spool.Spool
+	RetryBackoff time.Duration
+	RetryMax     time.Duration
+}
+
+// Pipeline 把抓包与上报解耦：抓包循环只负责 Enqueue，
+// 后台 Run 按条数或时间间隔攒批后调用 Client.UploadBatch。
+type Pipeline struct {
+	client *Client
+	cfg    PipelineConfig
+	queue  chan *model.TrafficLog
+	spool  *spool.Spool
+	wake   chan struct{}
+
+	enqueued atomic.Uint64
+	dropped  atomic.Uint64
+	batches  atomic.Uint64
+	spooled  atomic.Uint64
+	replayed atomic.Uint64
+	retries  atomic.Uint64
+}
+
+func NewPipeline(client *Client, cfg PipelineConfig) *Pipeline {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10000
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 200
+	}
+	if cfg.BatchSize > cfg.QueueSize {
+		cfg.BatchSize = cfg.QueueSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.Overflow == "" {
+		cfg.Overflow = DropOldest
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 500 * time.Millisecond
+	}
+	if cfg.RetryMax <= 0 {
+		cfg.RetryMax = 30 * time.Second
+	}
+	return &Pipeline{
+		client: client,
+		cfg:    cfg,
+		queue:  make(chan *model.TrafficLog, cfg.QueueSize),
+		spool:  cfg.Spool,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Enqueue 把记录放入队列，返回 false 表示这条新记录被丢弃。
+func (p *Pipeline) Enqueue(ctx context.Context, logEntry *model.TrafficLog) bool {
+	switch p.cfg.Overflow {
+	case Block:
+		select {
+		case p.queue <- logEntry:
+		case <-ctx.Done():
+			p.dropped.Add(1)
+			return false
+		}
+	case DropNewest:
+		select {
+		case p.queue <- logEntry:
+		default:
+			p.dropped.Add(1)
+			return false
+		}
+	default:
+		p.pushDropOldest(logEntry)
+	}
+	p.enqueued.Add(1)
+	return true
+}
+
+func (p *Pipeline) pushDropOldest(logEntry *model.TrafficLog) {
+	for {
+		select {
+		case p.queue <- logEntry:
+			return
+		default:
+		}
+		// 队列已满：挤掉一条最旧的再重试。发送端可能同时在消费，所以这里也用非阻塞接收。
+		select {
+		case <-p.queue:
+			p.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+// Run 阻塞运行直到 ctx 结束；退出前会把队列中剩余记录尽力发送一次（失败则落盘）。
+func (p *Pipeline) Run(ctx context.Context) {
+	if p.spool != nil {
+		replayDone := make(chan struct{})
+		go func() {
+			defer close(replayDone)
+			p.replay(ctx)
+		}()
+		defer func() { <-replayDone }()
+	}
+
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*model.TrafficLog, 0, p.cfg.BatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			p.drain(batch)
+			return
+		case logEntry := <-p.queue:
+			batch = append(batch, logEntry)
+			if len(batch) >= p.cfg.BatchSize {
+				p.flush(ctx, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(ctx, batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+func (p *Pipeline) drain(batch []*model.TrafficLog) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		select {
+		case logEntry := <-p.queue:
+			batch = append(batch, logEntry)
+			if len(batch) >= p.cfg.BatchSize {
+				p.flush(ctx, batch)
+				batch = batch[:0]
+			}
+		default:
+			if len(batch) > 0 {
+				p.flush(ctx, batch)
+			}
+			return
+		}
+	}
+}
+
+func (p *Pipeline) flush(ctx context.Context, batch []*model.TrafficLog) {
+	p.batches.Add(1)
+
+	// spool 中还有积压时新批次也排到后面，保证 server 恢复后按原始顺序收到数据。
+	if p.spool != nil && p.spool.Len() > 0 {
+		p.spill(batch)
+		return
+	}
+
+	res, err := p.client.UploadBatch(ctx, batch)
+	if err != nil {
+		if p.spool != nil && Retryable(err) {
+			log.Printf("批量上报失败，%d 条写入 spool：%v", len(batch), err)
+			p.spill(batch)
+			return
+		}
+		log.Printf("批量上报失败（丢弃 %d 条）：%v", len(batch), err)
+		return
+	}
+	if res.Rejected > 0 {
+		log.Printf("批量上报：server 拒绝 %d/%d 条", res.Rejected, len(batch))
+	}
+}
+
+func (p *Pipeline) spill(batch []*model.TrafficLog) {
+	if err := p.spool.Append(batch); err != nil {
+		log.Printf("写入 spool 失败（丢弃 %d 条）：%v", len(batch), err)
+		return
+	}
+	p.spooled.Add(uint64(len(batch)))
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// replay 按顺序重放 spool 中的 segment：成功或遇到不可重试的错误就删除，
+// 可重试的错误按指数退避（带 jitter）等待后再试同一个 segment。
+func (p *Pipeline) replay(ctx context.Context) {
+	bo := newBackoff(p.cfg.RetryBackoff, p.cfg.RetryMax)
+	for {
+		seg, logs, ok, err := p.spool.Oldest()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.wake:
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("spool 文件不可用，跳过 %d 条：%v", seg.Count, err)
+			p.removeSegment(seg)
+			continue
+		}
+
+		res, err := p.client.UploadBatch(ctx, logs)
+		if err == nil || !Retryable(err) {
+			if err != nil {
+				log.Printf("spool 重放被 server 拒绝（丢弃 %d 条）：%v", len(logs), err)
+			} else {
+				p.replayed.Add(uint64(res.Accepted))
+			}
+			p.removeSegment(seg)
+			bo.reset()
+			continue
+		}
+
+		p.retries.Add(1)
+		wait := bo.next()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (p *Pipeline) removeSegment(seg spool.Segment) {
+	if err := p.spool.Remove(seg); err != nil {
+		log.Printf("删除 spool 文件失败：%v", err)
+	}
+}
+
+func (p *Pipeline) Stats() Stats {
+	st := p.client.Stats()
+	st.QueueDepth = len(p.queue)
+	st.QueueCap = cap(p.queue)
+	st.Enqueued = p.enqueued.Load()
+	st.Dropped = p.dropped.Load()
+	st.Batches = p.batches.Load()
+	if p.spool != nil {
+		sp := p.spool.Stats()
+		st.Spool = &sp
+		st.Spooled = p.spooled.Load()
+		st.Replayed = p.replayed.Load()
+		st.Retries = p.retries.Load()
+	}
+	return st
+}
@@ -0,0 +1,277 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"lightobs/internal/agent/spool"
+	"lightobs/pkg/model"
+)
+
+type batchServer struct {
+	mu      sync.Mutex
+	batches [][]model.TrafficLog
+}
+
+func (b *batchServer) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/upload/batch" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var logs []model.TrafficLog
+		if err := json.NewDecoder(r.Body).Decode(&logs); err != nil {
+			t.Errorf("Invalid JSON: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		b.mu.Lock()
+		b.batches = append(b.batches, logs)
+		b.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(BatchResult{Accepted: len(logs)})
+	}
+}
+
+func (b *batchServer) total() (batches, records int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, batch := range b.batches {
+		records += len(batch)
+	}
+	return len(b.batches), records
+}
+
+func newTestClient(t *testing.T, h http.Handler) *Client {
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	addr := server.Listener.Addr().(*net.TCPAddr)
+	return NewClient("127.0.0.1", addr.Port, time.Second)
+}
+
+func TestPipeline_FlushBySize(t *testing.T) {
+	bs := &batchServer{}
+	p := NewPipeline(newTestClient(t, bs.handler(t)), PipelineConfig{
+		QueueSize:     100,
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+
+	for i := 0; i < 20; i++ {
+		p.Enqueue(ctx, &model.TrafficLog{PID: i})
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if n, _ := bs.total(); n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("batches not flushed by size")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	st := p.Stats()
+	if st.Sent != 20 || st.Batches != 2 || st.QueueDepth != 0 {
+		t.Errorf("stats=%+v", st)
+	}
+}
+
+func TestPipeline_FlushByIntervalAndDrain(t *testing.T) {
+	bs := &batchServer{}
+	p := NewPipeline(newTestClient(t, bs.handler(t)), PipelineConfig{
+		QueueSize:     100,
+		BatchSize:     50,
+		FlushInterval: 20 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+
+	p.Enqueue(ctx, &model.TrafficLog{PID: 1})
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, n := bs.total(); n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("batch not flushed by interval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 退出前入队的记录也应被发出。
+	p.Enqueue(ctx, &model.TrafficLog{PID: 2})
+	p.Enqueue(ctx, &model.TrafficLog{PID: 3})
+	cancel()
+	<-done
+	if _, n := bs.total(); n != 3 {
+		t.Errorf("records=%d, want 3", n)
+	}
+}
+
+func TestPipeline_Overflow(t *testing.T) {
+	c := NewClient("127.0.0.1", 1, time.Second)
+
+	p := NewPipeline(c, PipelineConfig{QueueSize: 2, Overflow: DropNewest})
+	for i := 0; i < 3; i++ {
+		p.Enqueue(context.Background(), &model.TrafficLog{PID: i})
+	}
+	if st := p.Stats(); st.Dropped != 1 || st.QueueDepth != 2 {
+		t.Errorf("drop-newest stats=%+v", st)
+	}
+	if first := <-p.queue; first.PID != 0 {
+		t.Errorf("drop-newest kept pid=%d first", first.PID)
+	}
+
+	p = NewPipeline(c, PipelineConfig{QueueSize: 2, Overflow: DropOldest})
+	for i := 0; i < 3; i++ {
+		p.Enqueue(context.Background(), &model.TrafficLog{PID: i})
+	}
+	if st := p.Stats(); st.Dropped != 1 || st.Enqueued != 3 {
+		t.Errorf("drop-oldest stats=%+v", st)
+	}
+	if first := <-p.queue; first.PID != 1 {
+		t.Errorf("drop-oldest kept pid=%d first", first.PID)
+	}
+
+	p = NewPipeline(c, PipelineConfig{QueueSize: 1, Overflow: Block})
+	p.Enqueue(context.Background(), &model.TrafficLog{})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if p.Enqueue(ctx, &model.TrafficLog{}) {
+		t.Errorf("block policy should give up when ctx is done")
+	}
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	if p, err := ParseOverflowPolicy(""); err != nil || p != DropOldest {
+		t.Errorf("default policy=%q err=%v", p, err)
+	}
+	if _, err := ParseOverflowPolicy("bogus"); err == nil {
+		t.Errorf("expected error for unknown policy")
+	}
+}
+
+func TestPipeline_SpoolAndReplay(t *testing.T) {
+	bs := &batchServer{}
+	var mu sync.Mutex
+	healthy := false
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ok := healthy
+		mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		bs.handler(t)(w, r)
+	})
+	sp, err := spool.Open(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("spool.Open failed: %v", err)
+	}
+	p := NewPipeline(newTestClient(t, h), PipelineConfig{
+		QueueSize:     100,
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+		Spool:         sp,
+		RetryBackoff:  5 * time.Millisecond,
+		RetryMax:      20 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+
+	for i := 0; i < 6; i++ {
+		p.Enqueue(ctx, &model.TrafficLog{PID: i})
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for p.Stats().Spooled != 6 {
+		if time.Now().After(deadline) {
+			t.Fatalf("records not spooled: %+v", p.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mu.Lock()
+	healthy = true
+	mu.Unlock()
+	for sp.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("spool not drained: %+v", p.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	var pids []int
+	for _, batch := range bs.batches {
+		for _, l := range batch {
+			pids = append(pids, l.PID)
+		}
+	}
+	for i, pid := range pids {
+		if pid != i {
+			t.Fatalf("replay out of order: %v", pids)
+		}
+	}
+	if len(pids) != 6 || p.Stats().Retries == 0 {
+		t.Fatalf("pids=%v stats=%+v", pids, p.Stats())
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	if !Retryable(&StatusError{Code: http.StatusServiceUnavailable}) {
+		t.Errorf("503 should be retryable")
+	}
+	if Retryable(&StatusError{Code: http.StatusBadRequest}) {
+		t.Errorf("400 should not be retryable")
+	}
+	if !Retryable(&StatusError{Code: http.StatusUnauthorized}) {
+		t.Errorf("401 should be retryable so spooled data survives a token rotation")
+	}
+	if Retryable(&StatusError{Code: http.StatusForbidden}) {
+		t.Errorf("403 should not be retryable: a token without the ingest role never succeeds")
+	}
+	if !Retryable(context.DeadlineExceeded) {
+		t.Errorf("network errors should be retryable")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(10*time.Millisecond, 40*time.Millisecond)
+	for i := 0; i < 10; i++ {
+		if d := b.next(); d <= 0 || d > 40*time.Millisecond {
+			t.Fatalf("attempt %d backoff=%v out of range", i, d)
+		}
+	}
+	b.reset()
+	if d := b.next(); d > 10*time.Millisecond {
+		t.Errorf("backoff after reset=%v", d)
+	}
+}
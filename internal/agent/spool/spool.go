@@ -0,0 +1,283 @@
+package spool
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"lightobs/pkg/model"
+)
+
+// Spool 是上报失败时的本地落盘队列。
+//
+// 每个失败批次写成一个独立的 segment 文件（NDJSON），文件名为 "<序号>-<条数>.ndjson"：
+// 序号单调递增，保证重放顺序；条数用于容量淘汰时统计丢弃量而无需读文件。
+// 写入先落到 .tmp 再 rename，因此进程崩溃不会留下半个 segment；重启后扫描目录即可恢复全部状态。
+// rename 与删除之后都会 fsync 目录，掉电后目录项的变化不会丢失。
+type Spool struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	segments []segment
+	bytes    int64
+	nextSeq  uint64
+	dropped  uint64
+}
+
+type segment struct {
+	seq   uint64
+	count int
+	size  int64
+}
+
+// Segment 标识一个已落盘的批次，Oldest 返回后需调用 Remove 确认消费。
+type Segment struct {
+	seq   uint64
+	Count int
+}
+
+type Stats struct {
+	Segments int    `json:"segments"`
+	Records  int    `json:"records"`
+	Bytes    int64  `json:"bytes"`
+	MaxBytes int64  `json:"max_bytes"`
+	Dropped  uint64 `json:"dropped"`
+}
+
+const suffix = ".ndjson"
+
+func Open(dir string, maxBytes int64) (*Spool, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("spool 目录不能为空")
+	}
+	if maxBytes <= 0 {
+		maxBytes = 256 << 20
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建 spool 目录失败：%w", err)
+	}
+	s := &Spool{dir: dir, maxBytes: maxBytes, nextSeq: 1}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("读取 spool 目录失败：%w", err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			// 上次写入到一半就退出了，数据不完整，直接清理。
+			_ = os.Remove(filepath.Join(s.dir, name))
+			continue
+		}
+		seq, count, ok := parseName(name)
+		if !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return fmt.Errorf("读取 spool 文件信息失败：%w", err)
+		}
+		s.segments = append(s.segments, segment{seq: seq, count: count, size: info.Size()})
+		s.bytes += info.Size()
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+	return nil
+}
+
+// Append 把一个批次写成新的 segment。超出容量上限时先淘汰最旧的 segment。
+func (s *Spool) Append(logs []*model.TrafficLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq := s.nextSeq
+	s.nextSeq++
+	name := segmentName(seq, len(logs))
+	tmp := filepath.Join(s.dir, name+".tmp")
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("创建 spool 文件失败：%w", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, l := range logs {
+		if err := enc.Encode(l); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return fmt.Errorf("写入 spool 失败：%w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("写入 spool 失败：%w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("同步 spool 文件失败：%w", err)
+	}
+	info, err := f.Stat()
+	f.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("读取 spool 文件信息失败：%w", err)
+	}
+	if info.Size() > s.maxBytes {
+		os.Remove(tmp)
+		s.dropped += uint64(len(logs))
+		return fmt.Errorf("单个批次 %d 字节超过 spool 上限 %d", info.Size(), s.maxBytes)
+	}
+	final := filepath.Join(s.dir, name)
+	if err := os.Rename(tmp, final); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("提交 spool 文件失败：%w", err)
+	}
+	if err := s.syncDir(); err != nil {
+		// 未能确认落盘的 segment 不计入，以免调用方按失败处理后又被重放。
+		os.Remove(final)
+		return err
+	}
+
+	s.segments = append(s.segments, segment{seq: seq, count: len(logs), size: info.Size()})
+	s.bytes += info.Size()
+	for s.bytes > s.maxBytes && len(s.segments) > 1 {
+		oldest := s.segments[0]
+		if err := s.removeLocked(oldest.seq); err != nil {
+			return err
+		}
+		s.dropped += uint64(oldest.count)
+	}
+	return nil
+}
+
+// Oldest 读取最旧的 segment；ok=false 表示 spool 为空。
+// 如果文件损坏，会返回对应的 Segment 和错误，调用方应 Remove 后继续。
+func (s *Spool) Oldest() (Segment, []*model.TrafficLog, bool, error) {
+	s.mu.Lock()
+	if len(s.segments) == 0 {
+		s.mu.Unlock()
+		return Segment{}, nil, false, nil
+	}
+	seg := s.segments[0]
+	path := filepath.Join(s.dir, segmentName(seg.seq, seg.count))
+	s.mu.Unlock()
+
+	// 读文件不持锁：Append 只会追加新的 segment，不会改动已有文件。
+	// 唯一的例外是容量淘汰，此时读到 ENOENT，调用方 Remove 后读下一个即可。
+	out := Segment{seq: seg.seq, Count: seg.count}
+	f, err := os.Open(path)
+	if err != nil {
+		return out, nil, true, fmt.Errorf("打开 spool 文件失败：%w", err)
+	}
+	defer f.Close()
+
+	logs := make([]*model.TrafficLog, 0, seg.count)
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		var l model.TrafficLog
+		if err := dec.Decode(&l); err != nil {
+			return out, nil, true, fmt.Errorf("解析 spool 文件失败：%w", err)
+		}
+		logs = append(logs, &l)
+	}
+	return out, logs, true, nil
+}
+
+// Remove 确认某个 segment 已处理完毕（成功发送或放弃）。
+func (s *Spool) Remove(seg Segment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removeLocked(seg.seq)
+}
+
+func (s *Spool) removeLocked(seq uint64) error {
+	for i, seg := range s.segments {
+		if seg.seq != seq {
+			continue
+		}
+		err := os.Remove(filepath.Join(s.dir, segmentName(seg.seq, seg.count)))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除 spool 文件失败：%w", err)
+		}
+		s.segments = append(s.segments[:i], s.segments[i+1:]...)
+		s.bytes -= seg.size
+		return s.syncDir()
+	}
+	return nil
+}
+
+// syncDir fsync spool 目录，使 rename 与删除在掉电后仍然有效。
+func (s *Spool) syncDir() error {
+	d, err := os.Open(s.dir)
+	if err != nil {
+		return fmt.Errorf("打开 spool 目录失败：%w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("同步 spool 目录失败：%w", err)
+	}
+	return nil
+}
+
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.segments)
+}
+
+func (s *Spool) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := Stats{
+		Segments: len(s.segments),
+		Bytes:    s.bytes,
+		MaxBytes: s.maxBytes,
+		Dropped:  s.dropped,
+	}
+	for _, seg := range s.segments {
+		st.Records += seg.count
+	}
+	return st
+}
+
+func segmentName(seq uint64, count int) string {
+	return fmt.Sprintf("%020d-%d%s", seq, count, suffix)
+}
+
+func parseName(name string) (seq uint64, count int, ok bool) {
+	if !strings.HasSuffix(name, suffix) {
+		return 0, 0, false
+	}
+	seqStr, countStr, found := strings.Cut(strings.TrimSuffix(name, suffix), "-")
+	if !found {
+		return 0, 0, false
+	}
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	count, err = strconv.Atoi(countStr)
+	if err != nil {
+		return 0, 0, false
+	}
+	return seq, count, true
+}
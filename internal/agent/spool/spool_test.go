@@ -0,0 +1,121 @@
+package spool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lightobs/pkg/model"
+)
+
+func batch(pids ...int) []*model.TrafficLog {
+	out := make([]*model.TrafficLog, 0, len(pids))
+	for _, pid := range pids {
+		out = append(out, &model.TrafficLog{PID: pid, HTTPPath: "/spool"})
+	}
+	return out
+}
+
+func TestSpool_OrderAndRemove(t *testing.T) {
+	s, err := Open(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := s.Append(batch(1, 2)); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if err := s.Append(batch(3)); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	seg, logs, ok, err := s.Oldest()
+	if !ok || err != nil {
+		t.Fatalf("Oldest ok=%v err=%v", ok, err)
+	}
+	if len(logs) != 2 || logs[0].PID != 1 || logs[1].PID != 2 {
+		t.Fatalf("first segment=%+v", logs)
+	}
+	if err := s.Remove(seg); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+
+	_, logs, ok, _ = s.Oldest()
+	if !ok || len(logs) != 1 || logs[0].PID != 3 {
+		t.Fatalf("second segment=%+v", logs)
+	}
+}
+
+func TestSpool_ReopenKeepsState(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := s.Append(batch(1)); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if err := s.Append(batch(2, 3)); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	// 模拟写入中途崩溃留下的临时文件。
+	if err := os.WriteFile(filepath.Join(dir, "garbage.ndjson.tmp"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s2, err := Open(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	st := s2.Stats()
+	if st.Segments != 2 || st.Records != 3 {
+		t.Fatalf("stats after reopen=%+v", st)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "garbage.ndjson.tmp")); !os.IsNotExist(err) {
+		t.Errorf("tmp file should be cleaned up")
+	}
+
+	// 新写入的序号必须排在已有 segment 之后。
+	if err := s2.Append(batch(4)); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	var pids []int
+	for {
+		seg, logs, ok, err := s2.Oldest()
+		if !ok {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Oldest failed: %v", err)
+		}
+		for _, l := range logs {
+			pids = append(pids, l.PID)
+		}
+		_ = s2.Remove(seg)
+	}
+	if len(pids) != 4 || pids[0] != 1 || pids[3] != 4 {
+		t.Fatalf("replay order=%v", pids)
+	}
+}
+
+func TestSpool_SizeCapEvictsOldest(t *testing.T) {
+	s, err := Open(t.TempDir(), 400)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := s.Append(batch(i)); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	st := s.Stats()
+	if st.Bytes > 400 {
+		t.Errorf("bytes=%d exceeds cap", st.Bytes)
+	}
+	if st.Dropped == 0 || uint64(st.Records)+st.Dropped != 5 {
+		t.Errorf("stats=%+v", st)
+	}
+	_, logs, _, _ := s.Oldest()
+	if len(logs) != 1 || logs[0].PID != int(st.Dropped) {
+		t.Errorf("oldest kept=%+v dropped=%d", logs, st.Dropped)
+	}
+}
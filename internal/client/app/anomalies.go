@@ -0,0 +1,90 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+type anomaliesResponse struct {
+	Watermark time.Time      `json:"watermark"`
+	Events    []anomalyEvent `json:"events"`
+}
+
+type anomalyEvent struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	DstIP    string    `json:"dst_ip"`
+	DstPort  int       `json:"dst_port"`
+	Method   string    `json:"method"`
+	Route    string    `json:"route"`
+	Signal   string    `json:"signal"`
+	Value    float64   `json:"value"`
+	Baseline float64   `json:"baseline"`
+	Score    float64   `json:"score"`
+	Count    int64     `json:"count"`
+}
+
+// RunAnomalies 查询 /api/v1/anomalies 并按时间倒序输出异常事件。
+func RunAnomalies(cfg Config) error {
+	client, u, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	u.Path = "/api/v1/anomalies"
+	params := url.Values{}
+	for key, v := range map[string]string{"ip": cfg.IP, "from": cfg.From, "to": cfg.To, "signal": cfg.Signal} {
+		if v != "" {
+			params.Set(key, v)
+		}
+	}
+	if cfg.Limit > 0 {
+		params.Set("limit", strconv.Itoa(cfg.Limit))
+	}
+	u.RawQuery = params.Encode()
+
+	var resp anomaliesResponse
+	if err := getJSON(client, u.String(), &resp); err != nil {
+		return err
+	}
+	if resp.Watermark.IsZero() {
+		fmt.Println("异常检测未启用或尚未完成首次学习（server 需要 -anomaly）")
+		return nil
+	}
+	fmt.Printf("已检测到：%s\n", resp.Watermark.Local().Format(time.DateTime))
+	renderAnomalies(os.Stdout, resp.Events)
+	return nil
+}
+
+func renderAnomalies(w io.Writer, events []anomalyEvent) {
+	t := tablewriter.NewWriter(w)
+	t.SetHeader([]string{"Start", "Duration", "Endpoint", "Signal", "Value", "Baseline", "Score", "Count"})
+	t.SetAutoWrapText(false)
+	t.SetRowLine(false)
+	for _, e := range events {
+		t.Append([]string{
+			e.Start.Local().Format(time.DateTime),
+			e.End.Sub(e.Start).String(),
+			fmt.Sprintf("%s %s:%d%s", e.Method, e.DstIP, e.DstPort, e.Route),
+			e.Signal,
+			formatSignal(e.Signal, e.Value),
+			formatSignal(e.Signal, e.Baseline),
+			fmt.Sprintf("%.1f", e.Score),
+			fmt.Sprint(e.Count),
+		})
+	}
+	t.Render()
+}
+
+// formatSignal 把错误率显示为百分比，延迟显示为毫秒。
+func formatSignal(signal string, v float64) string {
+	if signal == "error_rate" {
+		return fmt.Sprintf("%.2f%%", v*100)
+	}
+	return fmt.Sprintf("%.1fms", v)
+}
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderAnomalies(t *testing.T) {
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	renderAnomalies(&buf, []anomalyEvent{
+		{Start: start, End: start.Add(5 * time.Minute), DstIP: "10.0.0.8", DstPort: 80, Method: "GET", Route: "/users/{id}",
+			Signal: "p90_ms", Value: 412, Baseline: 101.26, Score: 27.43, Count: 100},
+		{Start: start, End: start.Add(time.Minute), DstIP: "10.0.0.9", DstPort: 8080, Method: "POST", Route: "/orders",
+			Signal: "error_rate", Value: 0.5, Baseline: 0.004, Score: 24, Count: 20},
+	})
+	out := buf.String()
+	for _, want := range []string{
+		"GET 10.0.0.8:80/users/{id}", "5m0s", "412.0ms", "101.3ms", "27.4",
+		"POST 10.0.0.9:8080/orders", "50.00%", "0.40%",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
@@ -7,29 +7,69 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/olekukonko/tablewriter"
 
+	"lightobs/internal/tlsutil"
 	"lightobs/pkg/model"
 )
 
 func Run(cfg Config) error {
+	client, u, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	u.Path = "/api/v1/search"
+	params := searchParams(cfg)
+	if cfg.Page != "" {
+		params.Set("cursor", cfg.Page)
+	}
+
+	var rows []model.TrafficLog
+	for {
+		u.RawQuery = params.Encode()
+		var page searchPage
+		if err := getJSON(client, u.String(), &page); err != nil {
+			return err
+		}
+		rows = append(rows, page.Items...)
+		if page.NextCursor == "" {
+			break
+		}
+		if !cfg.All {
+			renderTable(rows)
+			fmt.Fprintf(os.Stderr, "还有更多结果，继续查看：-page %s（或使用 -all 拉取全部）\n", page.NextCursor)
+			return nil
+		}
+		params.Set("cursor", page.NextCursor)
+	}
+
+	renderTable(rows)
+	return nil
+}
+
+type searchPage struct {
+	Items      []model.TrafficLog `json:"items"`
+	NextCursor string             `json:"next_cursor"`
+}
+
+// connect 解析 -server 并构造 HTTP 客户端，各子命令共用。
+func connect(cfg Config) (*http.Client, *url.URL, error) {
 	u, err := url.Parse(cfg.Server)
 	if err != nil {
-		return fmt.Errorf("server 参数非法：%w", err)
+		return nil, nil, fmt.Errorf("server 参数非法：%w", err)
 	}
-	u.Path = "/api/v1/query"
-	q := u.Query()
-	if cfg.PID > 0 {
-		q.Set("pid", fmt.Sprintf("%d", cfg.PID))
-	} else {
-		q.Set("ip", cfg.IP)
+	client, err := newHTTPClient(u, cfg)
+	if err != nil {
+		return nil, nil, err
 	}
-	u.RawQuery = q.Encode()
+	return client, u, nil
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get(u.String())
+func getJSON(client *http.Client, u string, out any) error {
+	resp, err := client.Get(u)
 	if err != nil {
 		return fmt.Errorf("请求失败：%w", err)
 	}
@@ -40,15 +80,80 @@ func Run(cfg Config) error {
 		return fmt.Errorf("查询失败：status=%s body=%s", resp.Status, string(b))
 	}
 
-	var rows []model.TrafficLog
-	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
 		return fmt.Errorf("解析响应 JSON 失败：%w", err)
 	}
-
-	renderTable(rows)
 	return nil
 }
 
+// searchParams 把命令行条件转换为 /api/v1/search 的查询参数，未设置的条件不传。
+func searchParams(cfg Config) url.Values {
+	q := url.Values{}
+	set := func(key, v string) {
+		if v != "" {
+			q.Set(key, v)
+		}
+	}
+	setInt := func(key string, v int64) {
+		if v > 0 {
+			q.Set(key, strconv.FormatInt(v, 10))
+		}
+	}
+	set("ip", cfg.IP)
+	setInt("pid", int64(cfg.PID))
+	set("from", cfg.From)
+	set("to", cfg.To)
+	set("method", cfg.Method)
+	set("path", cfg.Path)
+	set("status", cfg.Status)
+	setInt("src_port", int64(cfg.SrcPort))
+	setInt("dst_port", int64(cfg.DstPort))
+	setInt("min_latency", cfg.MinLatency)
+	setInt("max_latency", cfg.MaxLatency)
+	set("sort", cfg.Sort)
+	set("order", cfg.Order)
+	setInt("limit", int64(cfg.Limit))
+	return q
+}
+
+// newHTTPClient 按 TLS 与凭证参数构造 HTTP 客户端。https 地址在未指定 TLS 参数时使用系统根证书。
+func newHTTPClient(u *url.URL, cfg Config) (*http.Client, error) {
+	tlsCfg, err := tlsutil.ClientConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	var transport http.RoundTripper = http.DefaultTransport
+	if tlsCfg != nil {
+		if u.Scheme != "https" {
+			return nil, fmt.Errorf("启用 TLS 时 -server 需使用 https:// 地址")
+		}
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = tlsCfg
+		transport = t
+	}
+	if cfg.APIKey != "" || cfg.Token != "" {
+		transport = &credentialTransport{base: transport, apiKey: cfg.APIKey, token: cfg.Token}
+	}
+	return &http.Client{Timeout: 10 * time.Second, Transport: transport}, nil
+}
+
+// credentialTransport 在每个请求上附加认证头。
+type credentialTransport struct {
+	base   http.RoundTripper
+	apiKey string
+	token  string
+}
+
+func (t *credentialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	} else {
+		req.Header.Set("X-API-Key", t.apiKey)
+	}
+	return t.base.RoundTrip(req)
+}
+
 func renderTable(rows []model.TrafficLog) {
 	t := tablewriter.NewWriter(os.Stdout)
 	t.SetHeader([]string{"Time", "PID", "Source", "Destination", "Method", "Path", "Status", "Latency(ms)", "Size"})
@@ -1,7 +1,47 @@
 package app
 
+import "lightobs/internal/tlsutil"
+
 type Config struct {
 	IP     string
 	PID    int
 	Server string
+
+	// 以下为 /api/v1/search 的过滤与排序条件，零值表示不限制。
+	From       string
+	To         string
+	Method     string
+	Path       string
+	Status     string
+	SrcPort    int
+	DstPort    int
+	MinLatency int64
+	MaxLatency int64
+	Sort       string
+	Order      string
+	Limit      int
+
+	// GroupBy 是 stats 子命令的分组维度，逗号分隔。
+	GroupBy string
+
+	// Signal 是 anomalies 子命令的指标（p90_ms / error_rate），为空则全部。
+	Signal string
+
+	// By 与 Format 是 topology 子命令的节点粒度（process / ip）与输出格式（table / dot / mermaid）；
+	// export、import 子命令的 Format 为文件格式（ndjson / csv / parquet）。
+	By     string
+	Format string
+
+	// Output 是 export 子命令的输出文件，为空时写到标准输出；Input 是 import 子命令读取的文件。
+	Output string
+	Input  string
+
+	// All 为 true 时沿 next_cursor 拉取全部结果；Page 为上次输出的游标，从该位置继续查看。
+	All  bool
+	Page string
+
+	TLS tlsutil.ClientOptions
+	// APIKey 通过 X-API-Key 发送；Token 通过 Authorization: Bearer 发送，二者填一个即可。
+	APIKey string
+	Token  string
 }
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RunExport 调用 /api/v1/export，把满足条件的记录写入 cfg.Output（为空或 - 时写到标准输出）。
+// 写文件时先写入同目录的临时文件，确认 server 完整导出后再改名，失败时不留下残缺文件。
+func RunExport(cfg Config) error {
+	client, u, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	// 导出可能持续很久，不能沿用查询用的整体超时。
+	client.Timeout = 0
+	u.Path = "/api/v1/export"
+	params := searchParams(cfg)
+	for _, k := range []string{"sort", "order", "limit"} {
+		params.Del(k)
+	}
+	if cfg.Format != "" {
+		params.Set("format", cfg.Format)
+	}
+	u.RawQuery = params.Encode()
+
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return fmt.Errorf("请求失败：%w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("导出失败：status=%s body=%s", resp.Status, strings.TrimSpace(string(b)))
+	}
+
+	if cfg.Output == "" || cfg.Output == "-" {
+		_, err := copyExport(os.Stdout, resp)
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(cfg.Output), "."+filepath.Base(cfg.Output)+".*")
+	if err != nil {
+		return fmt.Errorf("创建输出文件失败：%w", err)
+	}
+	defer os.Remove(tmp.Name())
+	n, err := copyExport(tmp, resp)
+	if cerr := tmp.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("写入输出文件失败：%w", cerr)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), cfg.Output); err != nil {
+		return fmt.Errorf("写入输出文件失败：%w", err)
+	}
+	if n != "" {
+		fmt.Fprintf(os.Stderr, "已导出 %s 条记录到 %s\n", n, cfg.Output)
+	} else {
+		fmt.Fprintf(os.Stderr, "已导出到 %s\n", cfg.Output)
+	}
+	return nil
+}
+
+// copyExport 把响应体写入 w，并检查 server 在 trailer 中报告的错误，返回导出条数（parquet 无此信息时为空）。
+func copyExport(w io.Writer, resp *http.Response) (string, error) {
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return "", fmt.Errorf("导出中断：连接提前关闭")
+		}
+		return "", fmt.Errorf("导出中断：%w", err)
+	}
+	if msg := resp.Trailer.Get("X-Export-Error"); msg != "" {
+		return "", fmt.Errorf("server 导出失败，结果不完整：%s", msg)
+	}
+	return resp.Trailer.Get("X-Export-Rows"), nil
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunExport(t *testing.T) {
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "csv" || r.URL.Query().Get("status") != "5xx" {
+			http.Error(w, "bad query: "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Trailer", "X-Export-Rows, X-Export-Error")
+		fmt.Fprint(w, "timestamp,src_ip\n2024-05-01T08:00:00Z,10.0.0.1\n")
+		w.Header().Set("X-Export-Rows", "1")
+		if fail {
+			w.Header().Set("X-Export-Error", "查询失败")
+		}
+	}))
+	defer srv.Close()
+
+	out := filepath.Join(t.TempDir(), "traffic.csv")
+	cfg := Config{Server: srv.URL, Format: "csv", Status: "5xx", Output: out}
+	if err := RunExport(cfg); err != nil {
+		t.Fatalf("RunExport: %v", err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil || string(b) != "timestamp,src_ip\n2024-05-01T08:00:00Z,10.0.0.1\n" {
+		t.Fatalf("file=%q err=%v", b, err)
+	}
+
+	// server 中途失败时不覆盖已有文件，也不留下临时文件。
+	fail = true
+	if err := RunExport(cfg); err == nil {
+		t.Fatal("expected error")
+	}
+	entries, _ := os.ReadDir(filepath.Dir(out))
+	if len(entries) != 1 {
+		t.Errorf("entries=%v", entries)
+	}
+	if b2, _ := os.ReadFile(out); string(b2) != string(b) {
+		t.Errorf("file overwritten: %q", b2)
+	}
+
+	cfg.Format = "xlsx"
+	if err := RunExport(cfg); err == nil {
+		t.Error("expected error for rejected request")
+	}
+}
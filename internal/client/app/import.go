@@ -0,0 +1,99 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type importResponse struct {
+	Accepted int    `json:"accepted"`
+	Rejected int    `json:"rejected"`
+	Error    string `json:"error"`
+	Errors   []struct {
+		Row   int    `json:"row"`
+		Error string `json:"error"`
+	} `json:"errors"`
+}
+
+// RunImport 把 cfg.Input 上传到 /api/v1/import。未指定 -format 时按扩展名判断格式，
+// .gz 结尾的文件以 Content-Encoding: gzip 原样上传，由 server 解压。
+func RunImport(cfg Config) error {
+	if cfg.Input == "" {
+		return fmt.Errorf("需要通过 -f 指定导入文件")
+	}
+	format, gzipped := importFormat(cfg.Input)
+	if cfg.Format != "" {
+		format = cfg.Format
+	}
+	if format == "" {
+		return fmt.Errorf("无法从文件名判断格式，请通过 -format 指定（ndjson / csv / parquet）")
+	}
+
+	client, u, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	// 导入大文件可能持续很久，不能沿用查询用的整体超时。
+	client.Timeout = 0
+	u.Path = "/api/v1/import"
+	u.RawQuery = url.Values{"format": {format}}.Encode()
+
+	f, err := os.Open(cfg.Input)
+	if err != nil {
+		return fmt.Errorf("打开导入文件失败：%w", err)
+	}
+	defer f.Close()
+	req, err := http.NewRequest(http.MethodPost, u.String(), f)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败：%w", err)
+	}
+	defer resp.Body.Close()
+
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var out importResponse
+	if err := json.Unmarshal(b, &out); err != nil {
+		return fmt.Errorf("导入失败：status=%s body=%s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	fmt.Fprintf(os.Stderr, "写入 %d 条，拒绝 %d 条\n", out.Accepted, out.Rejected)
+	for _, e := range out.Errors {
+		fmt.Fprintf(os.Stderr, "  第 %d 行：%s\n", e.Row, e.Error)
+	}
+	if len(out.Errors) < out.Rejected {
+		fmt.Fprintf(os.Stderr, "  ……另有 %d 行被拒绝\n", out.Rejected-len(out.Errors))
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("导入失败：status=%s %s", resp.Status, out.Error)
+	}
+	return nil
+}
+
+// importFormat 根据扩展名判断格式，如 traffic.csv.gz 返回 csv 与 true。
+func importFormat(name string) (format string, gzipped bool) {
+	name = strings.ToLower(name)
+	if strings.HasSuffix(name, ".gz") {
+		name, gzipped = strings.TrimSuffix(name, ".gz"), true
+	}
+	switch filepath.Ext(name) {
+	case ".ndjson", ".jsonl", ".json":
+		return "ndjson", gzipped
+	case ".csv":
+		return "csv", gzipped
+	case ".parquet":
+		return "parquet", gzipped
+	}
+	return "", gzipped
+}
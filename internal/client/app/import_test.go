@@ -0,0 +1,63 @@
+package app
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportFormat(t *testing.T) {
+	cases := []struct {
+		name    string
+		format  string
+		gzipped bool
+	}{
+		{"traffic.ndjson", "ndjson", false},
+		{"dump.JSONL.gz", "ndjson", true},
+		{"a/b.csv", "csv", false},
+		{"x.parquet", "parquet", false},
+		{"x.txt", "", false},
+	}
+	for _, c := range cases {
+		format, gz := importFormat(c.name)
+		if format != c.format || gz != c.gzipped {
+			t.Errorf("%s: got %q %v", c.name, format, gz)
+		}
+	}
+}
+
+func TestRunImport(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = r.URL.Query().Get("format") + "|" + r.Header.Get("Content-Encoding") + "|" + string(b)
+		if r.URL.Query().Get("format") == "parquet" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"accepted":0,"rejected":0,"errors":[],"error":"文件格式错误"}`))
+			return
+		}
+		w.Write([]byte(`{"accepted":1,"rejected":1,"errors":[{"row":2,"error":"src_ip/dst_ip 非法"}]}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	in := filepath.Join(dir, "seed.csv.gz")
+	if err := os.WriteFile(in, []byte("gzip-bytes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunImport(Config{Server: srv.URL, Input: in}); err != nil {
+		t.Fatalf("RunImport: %v", err)
+	}
+	if got != "csv|gzip|gzip-bytes" {
+		t.Errorf("request=%q", got)
+	}
+	if err := RunImport(Config{Server: srv.URL, Input: in, Format: "parquet"}); err == nil {
+		t.Error("expected error on 400")
+	}
+	if err := RunImport(Config{Server: srv.URL, Input: filepath.Join(dir, "x.bin")}); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+type statsResponse struct {
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	GroupBy []string         `json:"group_by"`
+	Rows    []map[string]any `json:"rows"`
+}
+
+// RunStats 查询 /api/v1/stats 并按分组输出 RED 指标。
+func RunStats(cfg Config) error {
+	client, u, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	u.Path = "/api/v1/stats"
+	params := searchParams(cfg)
+	if cfg.GroupBy != "" {
+		params.Set("group_by", cfg.GroupBy)
+	}
+	u.RawQuery = params.Encode()
+
+	var resp statsResponse
+	if err := getJSON(client, u.String(), &resp); err != nil {
+		return err
+	}
+	fmt.Printf("窗口：%s ~ %s\n", resp.From.Local().Format(time.DateTime), resp.To.Local().Format(time.DateTime))
+	renderStats(resp)
+	return nil
+}
+
+func renderStats(resp statsResponse) {
+	t := tablewriter.NewWriter(os.Stdout)
+	header := make([]string, 0, len(resp.GroupBy)+8)
+	for _, g := range resp.GroupBy {
+		header = append(header, strings.ToUpper(g))
+	}
+	header = append(header, "Count", "RPS", "Errors", "Err%", "Avg(ms)", "P50(ms)", "P90(ms)", "P99(ms)")
+	t.SetHeader(header)
+	t.SetAutoWrapText(false)
+	t.SetRowLine(false)
+
+	for _, r := range resp.Rows {
+		row := make([]string, 0, len(header))
+		for _, g := range resp.GroupBy {
+			row = append(row, fmt.Sprint(r[g]))
+		}
+		row = append(row,
+			fmt.Sprintf("%.0f", num(r["count"])),
+			fmt.Sprintf("%.2f", num(r["rps"])),
+			fmt.Sprintf("%.0f", num(r["errors"])),
+			fmt.Sprintf("%.2f", num(r["error_rate"])*100),
+			fmt.Sprintf("%.1f", num(r["avg_ms"])),
+			fmt.Sprintf("%.1f", num(r["p50_ms"])),
+			fmt.Sprintf("%.1f", num(r["p90_ms"])),
+			fmt.Sprintf("%.1f", num(r["p99_ms"])),
+		)
+		t.Append(row)
+	}
+	t.Render()
+}
+
+func num(v any) float64 {
+	f, _ := v.(float64)
+	return f
+}
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"lightobs/pkg/model"
+)
+
+// 断线重连的退避区间。
+const (
+	tailMinBackoff = time.Second
+	tailMaxBackoff = 30 * time.Second
+)
+
+// errTailRejected 表示 server 拒绝了请求（参数或认证错误），重连也无济于事。
+var errTailRejected = errors.New("server 拒绝了推送请求")
+
+// RunTail 订阅 /api/v1/tail，持续输出新写入的记录，类似 `kubectl logs -f`。
+// 连接断开后按指数退避自动重连，Ctrl-C 退出。
+func RunTail(cfg Config) error {
+	client, u, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	// 推送连接长期保持，不能沿用查询用的整体超时。
+	client.Timeout = 0
+	u.Path = "/api/v1/tail"
+	params := searchParams(cfg)
+	for _, k := range []string{"from", "to", "sort", "order", "limit"} {
+		params.Del(k)
+	}
+	u.RawQuery = params.Encode()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	backoff := tailMinBackoff
+	for {
+		start := time.Now()
+		err := streamTail(ctx, client, u.String(), os.Stdout)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, errTailRejected) {
+			return err
+		}
+		// 连接维持了一段时间才断开时，从最短间隔重新开始退避。
+		if time.Since(start) > tailMaxBackoff {
+			backoff = tailMinBackoff
+		}
+		fmt.Fprintf(os.Stderr, "推送连接断开（%v），%s 后重连\n", err, backoff)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, tailMaxBackoff)
+	}
+}
+
+func streamTail(ctx context.Context, client *http.Client, u string, out io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := fmt.Errorf("status=%s body=%s", resp.Status, strings.TrimSpace(string(b)))
+		if resp.StatusCode/100 == 4 {
+			return fmt.Errorf("%w：%v", errTailRejected, err)
+		}
+		return err
+	}
+	return readEvents(resp.Body, func(event, data string) {
+		switch event {
+		case "log":
+			var l model.TrafficLog
+			if err := json.Unmarshal([]byte(data), &l); err != nil {
+				fmt.Fprintf(os.Stderr, "解析记录失败：%v\n", err)
+				return
+			}
+			fmt.Fprintln(out, formatTailLine(&l))
+		case "dropped":
+			fmt.Fprintf(os.Stderr, "消费过慢，server 已丢弃部分记录：%s\n", data)
+		}
+	})
+}
+
+// readEvents 解析 SSE 流，每个以空行结束的事件回调一次；注释行（: 开头）被忽略。
+func readEvents(r io.Reader, fn func(event, data string)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	var event string
+	var data []string
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if event == "" {
+					event = "message"
+				}
+				fn(event, strings.Join(data, "\n"))
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// formatTailLine 输出单行记录：时间 PID 源 -> 目的 方法 路径 状态码 延迟。
+func formatTailLine(l *model.TrafficLog) string {
+	path := l.HTTPPath
+	if l.HTTPQuery != "" {
+		path += "?" + l.HTTPQuery
+	}
+	return fmt.Sprintf("%s pid=%d %s:%d -> %s:%d %s %s %d %dms",
+		l.Timestamp.Local().Format("2006-01-02T15:04:05.000"),
+		l.PID, l.SrcIP, l.SrcPort, l.DstIP, l.DstPort,
+		l.HTTPMethod, path, l.StatusCode, l.LatencyMS)
+}
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadEvents(t *testing.T) {
+	stream := ": ping\n\n" +
+		"event:log\ndata:{\"a\":1}\n\n" +
+		"data: line1\ndata: line2\n\n" +
+		"event:dropped\ndata:{\"dropped\":3}\n\n" +
+		"event:log\ndata:{\"partial\""
+	var got []string
+	err := readEvents(strings.NewReader(stream), func(event, data string) {
+		got = append(got, event+"="+data)
+	})
+	want := []string{`log={"a":1}`, "message=line1\nline2", `dropped={"dropped":3}`}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q want %q", got, want)
+	}
+	// 流结束即视为断线，由调用方重连。
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("err=%v", err)
+	}
+}
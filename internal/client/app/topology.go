@@ -0,0 +1,137 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+type topologyResponse struct {
+	From  time.Time      `json:"from"`
+	To    time.Time      `json:"to"`
+	Nodes []topologyNode `json:"nodes"`
+	Edges []topologyEdge `json:"edges"`
+}
+
+type topologyNode struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+type topologyEdge struct {
+	Source    string  `json:"source"`
+	Target    string  `json:"target"`
+	Count     int64   `json:"count"`
+	RPS       float64 `json:"rps"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	AvgMS     float64 `json:"avg_ms"`
+	P99MS     float64 `json:"p99_ms"`
+}
+
+// RunTopology 查询 /api/v1/topology，按 -format 输出表格、Graphviz DOT 或 Mermaid。
+func RunTopology(cfg Config) error {
+	client, u, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	u.Path = "/api/v1/topology"
+	params := searchParams(cfg)
+	if cfg.By != "" {
+		params.Set("by", cfg.By)
+	}
+	u.RawQuery = params.Encode()
+
+	var resp topologyResponse
+	if err := getJSON(client, u.String(), &resp); err != nil {
+		return err
+	}
+	switch cfg.Format {
+	case "", "table":
+		fmt.Printf("窗口：%s ~ %s\n", resp.From.Local().Format(time.DateTime), resp.To.Local().Format(time.DateTime))
+		renderTopology(os.Stdout, resp)
+	case "dot":
+		writeDOT(os.Stdout, resp)
+	case "mermaid":
+		writeMermaid(os.Stdout, resp)
+	default:
+		return fmt.Errorf("不支持的输出格式：%s（可选 table / dot / mermaid）", cfg.Format)
+	}
+	return nil
+}
+
+func renderTopology(w io.Writer, resp topologyResponse) {
+	labels := nodeLabels(resp.Nodes)
+	t := tablewriter.NewWriter(w)
+	t.SetHeader([]string{"Source", "Target", "Count", "RPS", "Errors", "Err%", "Avg(ms)", "P99(ms)"})
+	t.SetAutoWrapText(false)
+	t.SetRowLine(false)
+	for _, e := range resp.Edges {
+		t.Append([]string{
+			labels[e.Source],
+			labels[e.Target],
+			fmt.Sprint(e.Count),
+			fmt.Sprintf("%.2f", e.RPS),
+			fmt.Sprint(e.Errors),
+			fmt.Sprintf("%.2f", e.ErrorRate*100),
+			fmt.Sprintf("%.1f", e.AvgMS),
+			fmt.Sprintf("%.1f", e.P99MS),
+		})
+	}
+	t.Render()
+}
+
+// writeDOT 输出 Graphviz 有向图，可用 `dot -Tsvg` 渲染；有错误的边标红。
+func writeDOT(w io.Writer, resp topologyResponse) {
+	fmt.Fprintln(w, "digraph lightobs {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+	for _, n := range resp.Nodes {
+		fmt.Fprintf(w, "  %s [label=%s];\n", dotQuote(n.ID), dotQuote(n.Label))
+	}
+	for _, e := range resp.Edges {
+		attrs := "label=" + dotQuote(edgeLabel(e))
+		if e.Errors > 0 {
+			attrs += ", color=red"
+		}
+		fmt.Fprintf(w, "  %s -> %s [%s];\n", dotQuote(e.Source), dotQuote(e.Target), attrs)
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// writeMermaid 输出 Mermaid flowchart。Mermaid 的节点 ID 不能含 . : / 等字符，因此按顺序编号为 n0、n1...
+func writeMermaid(w io.Writer, resp topologyResponse) {
+	ids := make(map[string]string, len(resp.Nodes))
+	fmt.Fprintln(w, "flowchart LR")
+	for i, n := range resp.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(w, "  %s[%s]\n", ids[n.ID], mermaidQuote(n.Label))
+	}
+	for _, e := range resp.Edges {
+		fmt.Fprintf(w, "  %s -->|%s| %s\n", ids[e.Source], mermaidQuote(edgeLabel(e)), ids[e.Target])
+	}
+}
+
+func edgeLabel(e topologyEdge) string {
+	return fmt.Sprintf("%.2f rps, %.1f%% err, p99 %.0fms", e.RPS, e.ErrorRate*100, e.P99MS)
+}
+
+func nodeLabels(nodes []topologyNode) map[string]string {
+	out := make(map[string]string, len(nodes))
+	for _, n := range nodes {
+		out[n.ID] = n.Label
+	}
+	return out
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
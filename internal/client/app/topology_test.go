@@ -0,0 +1,49 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func sampleTopology() topologyResponse {
+	return topologyResponse{
+		Nodes: []topologyNode{
+			{ID: "10.0.0.1/pid:42", Label: "10.0.0.1 (pid 42)"},
+			{ID: "10.0.0.9:80", Label: "10.0.0.9:80"},
+		},
+		Edges: []topologyEdge{
+			{Source: "10.0.0.1/pid:42", Target: "10.0.0.9:80", Count: 600, RPS: 1, Errors: 6, ErrorRate: 0.01, P99MS: 120},
+		},
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	writeDOT(&buf, sampleTopology())
+	out := buf.String()
+	for _, want := range []string{
+		`digraph lightobs {`,
+		`"10.0.0.1/pid:42" [label="10.0.0.1 (pid 42)"];`,
+		`"10.0.0.1/pid:42" -> "10.0.0.9:80" [label="1.00 rps, 1.0% err, p99 120ms", color=red];`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if got := dotQuote(`a"b\c`); got != `"a\"b\\c"` {
+		t.Errorf("dotQuote=%s", got)
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	var buf bytes.Buffer
+	writeMermaid(&buf, sampleTopology())
+	want := "flowchart LR\n" +
+		"  n0[\"10.0.0.1 (pid 42)\"]\n" +
+		"  n1[\"10.0.0.9:80\"]\n" +
+		"  n0 -->|\"1.00 rps, 1.0% err, p99 120ms\"| n1\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
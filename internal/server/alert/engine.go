@@ -0,0 +1,261 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lightobs/internal/server/storage"
+)
+
+// State 是告警的状态：条件成立但未持续满 For 时为 pending，之后为 firing，条件不再成立后为 resolved。
+type State string
+
+const (
+	StatePending  State = "pending"
+	StateFiring   State = "firing"
+	StateResolved State = "resolved"
+)
+
+// maxGroups 是单条规则一次评估的最大分组数，超出部分按请求数排序截断。
+const maxGroups = 1000
+
+// resolvedRetention 是 resolved 告警在 Alerts 中保留的时长。
+const resolvedRetention = 15 * time.Minute
+
+// Alert 是一条规则在某个分组上的告警实例。
+type Alert struct {
+	Rule      string            `json:"rule"`
+	State     State             `json:"state"`
+	Group     map[string]string `json:"group,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Condition string            `json:"condition"`
+	// Value 是最近一次条件成立时的指标值。
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Summary   string  `json:"summary,omitempty"`
+
+	ActiveAt   time.Time  `json:"active_at"`
+	FiredAt    *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Notifier 接收状态变为 firing 或 resolved 的告警。
+type Notifier interface {
+	Notify(ctx context.Context, alerts []Alert) error
+}
+
+// Engine 保存规则与告警状态；Evaluate 由调用方周期执行，Alerts 可并发调用。
+type Engine struct {
+	store    storage.Store
+	rules    []Rule
+	notifier Notifier
+	now      func() time.Time
+
+	mu     sync.Mutex
+	alerts map[string]*Alert
+	// unsent 是尚未成功发送的状态变化，按告警 key 只保留最新的一次，发送失败时留到下次评估重发。
+	unsent map[string]Alert
+}
+
+// NewEngine 创建规则引擎，notifier 为 nil 时不发送通知。
+func NewEngine(store storage.Store, rules []Rule, notifier Notifier) *Engine {
+	return &Engine{
+		store:    store,
+		rules:    rules,
+		notifier: notifier,
+		now:      time.Now,
+		alerts:   make(map[string]*Alert),
+		unsent:   make(map[string]Alert),
+	}
+}
+
+// Rules 返回引擎中的规则。
+func (e *Engine) Rules() []Rule {
+	return e.rules
+}
+
+// Evaluate 评估全部规则并更新告警状态，状态变为 firing 或 resolved 的告警合并为一次通知发送。
+// 单条规则查询失败时保留其原有状态，不影响其他规则。
+// 通知发送失败时这些告警随下次评估的通知一起重发；同一告警在此期间再次变化时只发送最新的状态。
+func (e *Engine) Evaluate(ctx context.Context) error {
+	now := e.now()
+	var errs []error
+	for i := range e.rules {
+		r := &e.rules[i]
+		rows, err := e.query(ctx, r, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("告警规则 %s 查询失败：%w", r.Name, err))
+			continue
+		}
+		e.apply(r, rows, now)
+	}
+	if keys, alerts := e.takeUnsent(); len(alerts) > 0 {
+		if err := e.notifier.Notify(ctx, alerts); err != nil {
+			e.requeue(keys, alerts)
+			errs = append(errs, fmt.Errorf("发送告警通知失败：%w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// takeUnsent 取出全部待发送的告警，按 key 排序。
+func (e *Engine) takeUnsent() ([]string, []Alert) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	keys := make([]string, 0, len(e.unsent))
+	for k := range e.unsent {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	alerts := make([]Alert, len(keys))
+	for i, k := range keys {
+		alerts[i] = e.unsent[k]
+	}
+	clear(e.unsent)
+	return keys, alerts
+}
+
+// requeue 放回发送失败的告警；取出之后又有更新的状态时保留更新的。
+func (e *Engine) requeue(keys []string, alerts []Alert) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, k := range keys {
+		if _, ok := e.unsent[k]; !ok {
+			e.unsent[k] = alerts[i]
+		}
+	}
+}
+
+func (e *Engine) query(ctx context.Context, r *Rule, now time.Time) ([]storage.StatsRow, error) {
+	f := r.Filter
+	f.From, f.To = now.Add(-r.Window), now
+	rows, err := e.store.Stats(ctx, storage.StatsQuery{Filter: f, GroupBy: r.GroupBy, Sort: storage.StatsSortCount, Limit: maxGroups})
+	if err != nil {
+		return nil, err
+	}
+	// 不分组且窗口内没有流量时按全零处理，使 count < N 之类的规则能够触发。
+	if len(r.GroupBy) == 0 && len(rows) == 0 {
+		rows = []storage.StatsRow{{}}
+	}
+	return rows, nil
+}
+
+// apply 根据一次查询结果推进规则下各告警的状态，状态变为 firing 或 resolved 的告警记入待发送。
+func (e *Engine) apply(r *Rule, rows []storage.StatsRow, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	active := make(map[string]bool)
+	for _, row := range rows {
+		if row.Count < r.MinCount {
+			continue
+		}
+		v := r.Metric.value(row, r.Window)
+		if !r.match(v, r.Threshold) {
+			continue
+		}
+		key := alertKey(r.Name, row.Group)
+		active[key] = true
+		a := e.alerts[key]
+		if a == nil || a.State == StateResolved {
+			a = &Alert{
+				Rule:      r.Name,
+				State:     StatePending,
+				Group:     groupLabels(r.GroupBy, row.Group),
+				Labels:    r.Labels,
+				Condition: r.Condition(),
+				Threshold: r.Threshold,
+				ActiveAt:  now,
+			}
+			e.alerts[key] = a
+		}
+		a.Value = v
+		a.Summary = r.render(a)
+		if a.State == StatePending && now.Sub(a.ActiveAt) >= r.For {
+			a.State = StateFiring
+			fired := now
+			a.FiredAt = &fired
+			e.changed(key, a)
+		}
+	}
+
+	prefix := r.Name + "\x00"
+	for key, a := range e.alerts {
+		if !strings.HasPrefix(key, prefix) || active[key] {
+			continue
+		}
+		switch a.State {
+		case StatePending:
+			delete(e.alerts, key)
+		case StateFiring:
+			a.State = StateResolved
+			resolved := now
+			a.ResolvedAt = &resolved
+			e.changed(key, a)
+		case StateResolved:
+			if now.Sub(*a.ResolvedAt) >= resolvedRetention {
+				delete(e.alerts, key)
+			}
+		}
+	}
+}
+
+// changed 记下状态变化，未配置通知时不记录。调用方持有 mu。
+func (e *Engine) changed(key string, a *Alert) {
+	if e.notifier != nil {
+		e.unsent[key] = *a
+	}
+}
+
+// Alerts 返回当前告警的快照：firing 在前，其次 pending、resolved，同状态按规则名与分组排序。
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	keys := make([]string, 0, len(e.alerts))
+	for k := range e.alerts {
+		keys = append(keys, k)
+	}
+	out := make([]Alert, 0, len(keys))
+	sort.Strings(keys)
+	for _, k := range keys {
+		out = append(out, *e.alerts[k])
+	}
+	e.mu.Unlock()
+
+	rank := map[State]int{StateFiring: 0, StatePending: 1, StateResolved: 2}
+	sort.SliceStable(out, func(i, j int) bool {
+		return rank[out[i].State] < rank[out[j].State]
+	})
+	return out
+}
+
+func alertKey(rule string, group []string) string {
+	return rule + "\x00" + strings.Join(group, "\x00")
+}
+
+func groupLabels(dims []storage.Dimension, values []string) map[string]string {
+	if len(dims) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(dims))
+	for i, d := range dims {
+		m[string(d)] = values[i]
+	}
+	return m
+}
+
+// render 用告警实例填充 summary 模板，模板执行失败时返回错误信息，便于在通知中发现问题。
+func (r *Rule) render(a *Alert) string {
+	if r.summary == nil {
+		return ""
+	}
+	var b strings.Builder
+	if err := r.summary.Execute(&b, a); err != nil {
+		return "summary 模板执行失败：" + err.Error()
+	}
+	return b.String()
+}
@@ -0,0 +1,271 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"lightobs/internal/server/storage/memory"
+	"lightobs/pkg/model"
+)
+
+// hookStub 是本地 webhook 接收端，记录收到的每次通知。
+type hookStub struct {
+	mu       sync.Mutex
+	payloads []webhookPayload
+	status   int
+}
+
+func (h *hookStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var p webhookPayload
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil || r.Header.Get("X-Token") != "secret" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.payloads = append(h.payloads, p)
+	if h.status != 0 {
+		w.WriteHeader(h.status)
+	}
+}
+
+func (h *hookStub) take() []webhookPayload {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p := h.payloads
+	h.payloads = nil
+	return p
+}
+
+func TestEngine(t *testing.T) {
+	ctx := context.Background()
+	st := memory.NewStore(0)
+	defer st.Close()
+	t0 := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	// 10.0.0.8 的 20 个请求中 5 个 5xx；10.0.0.9 全部成功；10.0.0.7 出错但请求数不足 min_count。
+	var logs []model.TrafficLog
+	for i := 0; i < 20; i++ {
+		for _, dst := range []string{"10.0.0.8", "10.0.0.9"} {
+			l := model.TrafficLog{Timestamp: t0.Add(-time.Duration(i+1) * time.Second), SrcIP: "10.0.0.2", DstIP: dst, DstPort: 80,
+				HTTPMethod: "GET", HTTPPath: "/", StatusCode: 200, LatencyMS: 10}
+			if dst == "10.0.0.8" && i%4 == 0 {
+				l.StatusCode = 503
+			}
+			logs = append(logs, l)
+		}
+	}
+	logs = append(logs, model.TrafficLog{Timestamp: t0.Add(-time.Second), SrcIP: "10.0.0.2", DstIP: "10.0.0.7", StatusCode: 500})
+	if err := st.InsertBatch(ctx, logs); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Parse([]byte(`
+rules:
+  - name: dst-5xx
+    metric: error_rate
+    op: ">"
+    threshold: 0.05
+    for: 1m
+    min_count: 10
+    group_by: [dst_ip]
+    labels: {severity: page}
+    summary: "{{.Group.dst_ip}} 5xx {{printf \"%.0f%%\" (mul .Value 100)}}"
+  - name: no-traffic
+    metric: count
+    op: "<"
+    threshold: 1
+    window: 3m
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &hookStub{}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+	e := NewEngine(st, f.Rules, NewWebhook(WebhookConfig{URL: srv.URL, Headers: map[string]string{"X-Token": "secret"}}))
+	now := t0
+	e.now = func() time.Time { return now }
+
+	evaluate := func(at time.Duration) {
+		t.Helper()
+		now = t0.Add(at)
+		if err := e.Evaluate(ctx); err != nil {
+			t.Fatalf("Evaluate at %s: %v", at, err)
+		}
+	}
+
+	// 条件刚成立：pending，不发通知。
+	evaluate(0)
+	alerts := e.Alerts()
+	if len(alerts) != 1 || alerts[0].State != StatePending || alerts[0].Group["dst_ip"] != "10.0.0.8" || alerts[0].Value != 0.25 {
+		t.Fatalf("t0 alerts=%+v", alerts)
+	}
+	if p := stub.take(); len(p) != 0 {
+		t.Errorf("notified while pending: %+v", p)
+	}
+
+	// 持续满 for：firing 并通知。
+	evaluate(time.Minute)
+	p := stub.take()
+	if len(p) != 1 || len(p[0].Alerts) != 1 {
+		t.Fatalf("firing payloads=%+v", p)
+	}
+	if a := p[0].Alerts[0]; a.State != StateFiring || a.Labels["severity"] != "page" || a.Summary != "10.0.0.8 5xx 25%" ||
+		a.FiredAt == nil || !a.ActiveAt.Equal(t0) {
+		t.Errorf("firing alert=%+v", a)
+	}
+
+	// 仍然成立：不重复通知。
+	evaluate(2 * time.Minute)
+	if p := stub.take(); len(p) != 0 {
+		t.Errorf("repeated notification: %+v", p)
+	}
+
+	// 流量移出窗口：dst-5xx 恢复；no-traffic 的 3 分钟窗口内没有流量，立即 firing，两者合并为一次通知。
+	evaluate(6 * time.Minute)
+	p = stub.take()
+	if len(p) != 1 || len(p[0].Alerts) != 2 {
+		t.Fatalf("resolve payloads=%+v", p)
+	}
+	states := map[string]State{}
+	for _, a := range p[0].Alerts {
+		states[a.Rule] = a.State
+	}
+	if states["dst-5xx"] != StateResolved || states["no-traffic"] != StateFiring {
+		t.Errorf("states=%v", states)
+	}
+	alerts = e.Alerts()
+	if len(alerts) != 2 || alerts[0].Rule != "no-traffic" || alerts[1].State != StateResolved || alerts[1].ResolvedAt == nil {
+		t.Errorf("alerts=%+v", alerts)
+	}
+
+	// resolved 保留一段时间后移除。
+	evaluate(6*time.Minute + resolvedRetention)
+	if alerts := e.Alerts(); len(alerts) != 1 || alerts[0].Rule != "no-traffic" {
+		t.Errorf("after retention alerts=%+v", alerts)
+	}
+}
+
+func TestEngine_PendingCleared(t *testing.T) {
+	ctx := context.Background()
+	st := memory.NewStore(0)
+	defer st.Close()
+	t0 := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	if err := st.Insert(ctx, &model.TrafficLog{Timestamp: t0.Add(-time.Second), SrcIP: "10.0.0.2", DstIP: "10.0.0.8", LatencyMS: 900}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Parse([]byte(`rules: [{name: slow, metric: p99, op: ">", threshold: 500, window: 1m, for: 5m}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &hookStub{}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+	e := NewEngine(st, f.Rules, NewWebhook(WebhookConfig{URL: srv.URL}))
+	now := t0
+	e.now = func() time.Time { return now }
+
+	if err := e.Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if alerts := e.Alerts(); len(alerts) != 1 || alerts[0].State != StatePending || alerts[0].Value != 900 {
+		t.Fatalf("alerts=%+v", alerts)
+	}
+	// 未满 for 条件即不再成立：直接丢弃，不发通知。
+	now = t0.Add(2 * time.Minute)
+	if err := e.Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if alerts := e.Alerts(); len(alerts) != 0 {
+		t.Errorf("alerts=%+v", alerts)
+	}
+	if p := stub.take(); len(p) != 0 {
+		t.Errorf("payloads=%+v", p)
+	}
+}
+
+func TestEngine_RetryNotify(t *testing.T) {
+	ctx := context.Background()
+	st := memory.NewStore(0)
+	defer st.Close()
+	t0 := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	if err := st.Insert(ctx, &model.TrafficLog{Timestamp: t0.Add(-time.Second), SrcIP: "10.0.0.2", DstIP: "10.0.0.8", LatencyMS: 900}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Parse([]byte(`rules: [{name: slow, metric: p99, op: ">", threshold: 500, window: 1m}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &hookStub{status: http.StatusBadGateway}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+	e := NewEngine(st, f.Rules, NewWebhook(WebhookConfig{URL: srv.URL, Headers: map[string]string{"X-Token": "secret"}}))
+	now := t0
+	e.now = func() time.Time { return now }
+
+	// 第一次发送失败：返回错误，告警状态照常推进。
+	if err := e.Evaluate(ctx); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Fatalf("err=%v", err)
+	}
+	if alerts := e.Alerts(); len(alerts) != 1 || alerts[0].State != StateFiring {
+		t.Fatalf("alerts=%+v", alerts)
+	}
+	stub.take()
+
+	// 下次评估时状态未变，仍补发 firing。
+	stub.mu.Lock()
+	stub.status = 0
+	stub.mu.Unlock()
+	now = t0.Add(30 * time.Second)
+	if err := e.Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	p := stub.take()
+	if len(p) != 1 || len(p[0].Alerts) != 1 || p[0].Alerts[0].State != StateFiring {
+		t.Fatalf("retry payloads=%+v", p)
+	}
+	// 发送成功后不再重复。
+	if err := e.Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if p := stub.take(); len(p) != 0 {
+		t.Errorf("repeated notification: %+v", p)
+	}
+
+	// resolved 的通知发送失败时同样在下次评估补发。
+	stub.mu.Lock()
+	stub.status = http.StatusBadGateway
+	stub.mu.Unlock()
+	now = t0.Add(2 * time.Minute)
+	if err := e.Evaluate(ctx); err == nil {
+		t.Fatal("expected notify error")
+	}
+	stub.take()
+	stub.mu.Lock()
+	stub.status = 0
+	stub.mu.Unlock()
+	now = t0.Add(3 * time.Minute)
+	if err := e.Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if p := stub.take(); len(p) != 1 || len(p[0].Alerts) != 1 || p[0].Alerts[0].State != StateResolved {
+		t.Errorf("resolved retry payloads=%+v", p)
+	}
+}
+
+func TestWebhookFailure(t *testing.T) {
+	stub := &hookStub{status: http.StatusBadGateway}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+	w := NewWebhook(WebhookConfig{URL: srv.URL, Headers: map[string]string{"X-Token": "secret"}})
+	err := w.Notify(context.Background(), []Alert{{Rule: "a", State: StateFiring}})
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("err=%v", err)
+	}
+}
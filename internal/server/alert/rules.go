@@ -0,0 +1,250 @@
+// Package alert 周期性地对最近一段时间的流量评估告警规则，维护 pending/firing/resolved 状态，
+// 并在状态变化时通过 webhook 发送通知。
+package alert
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"lightobs/internal/server/storage"
+)
+
+// DefaultInterval 是规则文件未指定 interval 时的评估间隔。
+const DefaultInterval = 30 * time.Second
+
+// DefaultWindow 是规则未指定 window 时的统计窗口。
+const DefaultWindow = 5 * time.Minute
+
+// Metric 是规则比较的指标，取自 RED 聚合结果；延迟单位为毫秒。
+type Metric string
+
+const (
+	MetricCount     Metric = "count"
+	MetricErrors    Metric = "errors"
+	MetricErrorRate Metric = "error_rate"
+	MetricRPS       Metric = "rps"
+	MetricAvg       Metric = "avg"
+	MetricP50       Metric = "p50"
+	MetricP90       Metric = "p90"
+	MetricP99       Metric = "p99"
+)
+
+// value 从一组聚合结果中取出指标值，window 用于计算 rps。
+func (m Metric) value(r storage.StatsRow, window time.Duration) float64 {
+	switch m {
+	case MetricCount:
+		return float64(r.Count)
+	case MetricErrors:
+		return float64(r.Errors)
+	case MetricErrorRate:
+		return r.ErrorRate()
+	case MetricRPS:
+		return float64(r.Count) / window.Seconds()
+	case MetricAvg:
+		return r.AvgMS
+	case MetricP50:
+		return r.P50MS
+	case MetricP90:
+		return r.P90MS
+	case MetricP99:
+		return r.P99MS
+	}
+	return 0
+}
+
+func parseMetric(s string) (Metric, error) {
+	switch m := Metric(strings.ToLower(strings.TrimSpace(s))); m {
+	case MetricCount, MetricErrors, MetricErrorRate, MetricRPS, MetricAvg, MetricP50, MetricP90, MetricP99:
+		return m, nil
+	default:
+		return "", fmt.Errorf("不支持的指标：%s（可选 count / errors / error_rate / rps / avg / p50 / p90 / p99）", s)
+	}
+}
+
+// compare 返回比较运算符对应的判断函数。
+func compare(op string) (func(v, threshold float64) bool, error) {
+	switch op {
+	case ">":
+		return func(v, t float64) bool { return v > t }, nil
+	case ">=":
+		return func(v, t float64) bool { return v >= t }, nil
+	case "<":
+		return func(v, t float64) bool { return v < t }, nil
+	case "<=":
+		return func(v, t float64) bool { return v <= t }, nil
+	default:
+		return nil, fmt.Errorf("不支持的比较运算符：%q（可选 > / >= / < / <=）", op)
+	}
+}
+
+// Rule 是一条已校验的告警规则：对 [now-Window, now) 内满足 Filter 的流量按 GroupBy 分组聚合，
+// 每组的 Metric 与 Threshold 比较，条件持续 For 后进入 firing。
+type Rule struct {
+	Name      string
+	Metric    Metric
+	Op        string
+	Threshold float64
+	Window    time.Duration
+	For       time.Duration
+	// MinCount 为组内请求数下限，请求过少的组不参与评估，避免个别错误导致错误率抖动。
+	MinCount int64
+	Filter   storage.Filter
+	GroupBy  []storage.Dimension
+	Labels   map[string]string
+
+	match   func(v, threshold float64) bool
+	summary *template.Template
+}
+
+// File 是解析后的规则文件。
+type File struct {
+	Interval time.Duration
+	Webhook  WebhookConfig
+	Rules    []Rule
+}
+
+// WebhookConfig 描述通知的接收地址；URL 为空时只在 API 中展示告警，不发送通知。
+type WebhookConfig struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Timeout time.Duration     `yaml:"timeout"`
+}
+
+type fileConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	Webhook  WebhookConfig `yaml:"webhook"`
+	Rules    []ruleConfig  `yaml:"rules"`
+}
+
+type ruleConfig struct {
+	Name      string            `yaml:"name"`
+	Metric    string            `yaml:"metric"`
+	Op        string            `yaml:"op"`
+	Threshold float64           `yaml:"threshold"`
+	Window    time.Duration     `yaml:"window"`
+	For       time.Duration     `yaml:"for"`
+	MinCount  int64             `yaml:"min_count"`
+	Filter    filterConfig      `yaml:"filter"`
+	GroupBy   []string          `yaml:"group_by"`
+	Labels    map[string]string `yaml:"labels"`
+	Summary   string            `yaml:"summary"`
+}
+
+type filterConfig struct {
+	IP      string `yaml:"ip"`
+	SrcIP   string `yaml:"src_ip"`
+	DstIP   string `yaml:"dst_ip"`
+	DstPort int    `yaml:"dst_port"`
+	PID     int    `yaml:"pid"`
+	Method  string `yaml:"method"`
+	Path    string `yaml:"path"`
+	Route   string `yaml:"route"`
+}
+
+// Load 读取 YAML 规则文件，格式：
+//
+//	interval: 30s
+//	webhook:
+//	  url: http://alertmanager.local/hook
+//	  headers: {Authorization: "Bearer xxx"}
+//	rules:
+//	  - name: dst-5xx
+//	    metric: error_rate
+//	    op: ">"
+//	    threshold: 0.05
+//	    window: 5m
+//	    for: 1m
+//	    min_count: 20
+//	    filter: {dst_ip: 10.0.0.8}
+//	    group_by: [dst_ip, dst_port]
+//	    labels: {severity: page}
+//	    summary: "{{.Group.dst_ip}} 5xx 比例 {{printf \"%.1f%%\" (mul .Value 100)}}"
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取告警规则失败：%w", err)
+	}
+	return Parse(data)
+}
+
+// Parse 解析并校验规则文件内容。
+func Parse(data []byte) (*File, error) {
+	var fc fileConfig
+	if err := yaml.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("解析告警规则失败：%w", err)
+	}
+	f := &File{Interval: fc.Interval, Webhook: fc.Webhook}
+	if f.Interval <= 0 {
+		f.Interval = DefaultInterval
+	}
+	seen := make(map[string]bool)
+	for i, rc := range fc.Rules {
+		r, err := rc.rule()
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 条告警规则：%w", i+1, err)
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("告警规则 %s 重复", r.Name)
+		}
+		seen[r.Name] = true
+		f.Rules = append(f.Rules, r)
+	}
+	return f, nil
+}
+
+// templateFuncs 供 summary 模板换算单位。
+var templateFuncs = template.FuncMap{
+	"mul": func(a, b float64) float64 { return a * b },
+}
+
+func (rc ruleConfig) rule() (Rule, error) {
+	r := Rule{
+		Name:      strings.TrimSpace(rc.Name),
+		Op:        strings.TrimSpace(rc.Op),
+		Threshold: rc.Threshold,
+		Window:    rc.Window,
+		For:       rc.For,
+		MinCount:  rc.MinCount,
+		Labels:    rc.Labels,
+		Filter: storage.Filter{
+			IP: rc.Filter.IP, SrcIP: rc.Filter.SrcIP, DstIP: rc.Filter.DstIP,
+			DstPort: rc.Filter.DstPort, PID: rc.Filter.PID,
+			Method: strings.ToUpper(rc.Filter.Method), Path: rc.Filter.Path, Route: rc.Filter.Route,
+		},
+	}
+	if r.Name == "" {
+		return r, fmt.Errorf("缺少 name")
+	}
+	var err error
+	if r.Metric, err = parseMetric(rc.Metric); err != nil {
+		return r, fmt.Errorf("%s：%w", r.Name, err)
+	}
+	if r.match, err = compare(r.Op); err != nil {
+		return r, fmt.Errorf("%s：%w", r.Name, err)
+	}
+	if r.Window == 0 {
+		r.Window = DefaultWindow
+	}
+	if r.Window < 0 || r.For < 0 {
+		return r, fmt.Errorf("%s：window 与 for 不能为负", r.Name)
+	}
+	if r.GroupBy, err = storage.ParseDimensions(strings.Join(rc.GroupBy, ",")); err != nil {
+		return r, fmt.Errorf("%s：%w", r.Name, err)
+	}
+	if rc.Summary != "" {
+		if r.summary, err = template.New(r.Name).Funcs(templateFuncs).Option("missingkey=zero").Parse(rc.Summary); err != nil {
+			return r, fmt.Errorf("%s：summary 模板错误：%w", r.Name, err)
+		}
+	}
+	return r, nil
+}
+
+// Condition 返回规则条件的文字描述，如 "error_rate > 0.05 (5m)"。
+func (r *Rule) Condition() string {
+	return fmt.Sprintf("%s %s %g (%s)", r.Metric, r.Op, r.Threshold, r.Window)
+}
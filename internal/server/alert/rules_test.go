@@ -0,0 +1,73 @@
+package alert
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"lightobs/internal/server/storage"
+)
+
+func TestParse(t *testing.T) {
+	f, err := Parse([]byte(`
+webhook:
+  url: http://127.0.0.1:9/hook
+rules:
+  - name: dst-5xx
+    metric: error_rate
+    op: ">"
+    threshold: 0.05
+    for: 1m
+    min_count: 20
+    filter: {dst_ip: 10.0.0.8, method: get}
+    group_by: [dst_ip, dst_port]
+    labels: {severity: page}
+    summary: "{{.Group.dst_ip}} {{printf \"%.0f%%\" (mul .Value 100)}}"
+  - name: slow
+    metric: P99
+    op: ">="
+    threshold: 500
+    window: 10m
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if f.Interval != DefaultInterval || f.Webhook.URL != "http://127.0.0.1:9/hook" || len(f.Rules) != 2 {
+		t.Fatalf("file=%+v", f)
+	}
+	r := f.Rules[0]
+	if r.Metric != MetricErrorRate || r.Window != DefaultWindow || r.For != time.Minute || r.MinCount != 20 ||
+		r.Filter.DstIP != "10.0.0.8" || r.Filter.Method != "GET" || len(r.GroupBy) != 2 || r.GroupBy[1] != storage.DimDstPort {
+		t.Errorf("rule=%+v", r)
+	}
+	if got := r.render(&Alert{Value: 0.25, Group: map[string]string{"dst_ip": "10.0.0.8"}}); got != "10.0.0.8 25%" {
+		t.Errorf("summary=%q", got)
+	}
+	if r.Condition() != "error_rate > 0.05 (5m0s)" {
+		t.Errorf("condition=%q", r.Condition())
+	}
+	if f.Rules[1].Metric != MetricP99 || !f.Rules[1].match(500, 500) || f.Rules[1].match(499, 500) {
+		t.Errorf("slow rule=%+v", f.Rules[1])
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		yaml string
+		want string
+	}{
+		{"rules: [{metric: count, op: '>'}]", "缺少 name"},
+		{"rules: [{name: a, metric: qps, op: '>'}]", "不支持的指标"},
+		{"rules: [{name: a, metric: count, op: '=='}]", "比较运算符"},
+		{"rules: [{name: a, metric: count, op: '>', group_by: [host]}]", "分组维度"},
+		{"rules: [{name: a, metric: count, op: '>', for: -1m}]", "不能为负"},
+		{"rules: [{name: a, metric: count, op: '>', summary: '{{.Value'}]", "summary"},
+		{"rules: [{name: a, metric: count, op: '>'}, {name: a, metric: p99, op: '>'}]", "重复"},
+		{"rules: {", "解析告警规则失败"},
+	} {
+		_, err := Parse([]byte(tc.yaml))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err=%v, want %q", tc.yaml, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// defaultWebhookTimeout 是 WebhookConfig.Timeout 未设置时单次请求的超时。
+const defaultWebhookTimeout = 10 * time.Second
+
+// Webhook 把告警以 JSON POST 到通用 webhook：
+//
+//	{"alerts": [{"rule": "dst-5xx", "state": "firing", "group": {...}, "value": 0.12, ...}]}
+//
+// 一次评估中状态变化的告警合并为一个请求，非 2xx 响应视为失败。
+type Webhook struct {
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+func NewWebhook(cfg WebhookConfig) *Webhook {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultWebhookTimeout
+	}
+	return &Webhook{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+type webhookPayload struct {
+	Alerts []Alert `json:"alerts"`
+}
+
+func (w *Webhook) Notify(ctx context.Context, alerts []Alert) error {
+	body, err := json.Marshal(webhookPayload{Alerts: alerts})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook 返回 %s：%s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,127 @@
+// Package anomaly 从已存储的流量中为每个接口学习延迟与错误率的基线（EWMA 均值与方差），
+// 把明显偏离基线的时间桶记为异常事件。模型与事件保存在状态文件中，server 重启后继续使用。
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"lightobs/internal/server/storage"
+)
+
+// Signal 是被建模的指标。
+type Signal string
+
+const (
+	// SignalLatency 是时间桶内的 p90 延迟（毫秒），比 p99 更不容易被少量慢请求带偏。
+	SignalLatency Signal = "p90_ms"
+	// SignalErrorRate 是时间桶内的 5xx 占比（0~1）。
+	SignalErrorRate Signal = "error_rate"
+)
+
+// signals 是每个接口建模的指标，按固定顺序处理以保证事件顺序稳定。
+var signals = []Signal{SignalLatency, SignalErrorRate}
+
+func (s Signal) value(p storage.StatsRow) float64 {
+	if s == SignalLatency {
+		return p.P90MS
+	}
+	return p.ErrorRate()
+}
+
+// minStd 是标准差的下限，避免基线非常平稳时微小波动也得到很高的分数：
+// 延迟至少取均值的 10%（且不低于 1ms），错误率至少取 2 个百分点。
+func (s Signal) minStd(mean float64) float64 {
+	if s == SignalLatency {
+		return math.Max(mean*0.1, 1)
+	}
+	return 0.02
+}
+
+// ParseSignal 解析指标名，空串表示不限制。
+func ParseSignal(s string) (Signal, error) {
+	switch v := Signal(s); v {
+	case "", SignalLatency, SignalErrorRate:
+		return v, nil
+	default:
+		return "", fmt.Errorf("不支持的指标：%s（可选 p90_ms / error_rate）", s)
+	}
+}
+
+// endpointDims 是接口的分组维度：目的 IP、端口、方法与路由模板。
+var endpointDims = []storage.Dimension{storage.DimDstIP, storage.DimDstPort, storage.DimMethod, storage.DimPath}
+
+// Endpoint 标识一个被建模的接口。
+type Endpoint struct {
+	DstIP   string `json:"dst_ip"`
+	DstPort int    `json:"dst_port"`
+	Method  string `json:"method"`
+	Route   string `json:"route"`
+}
+
+func endpointFromGroup(g []string) Endpoint {
+	port, _ := strconv.Atoi(g[1])
+	return Endpoint{DstIP: g[0], DstPort: port, Method: g[2], Route: g[3]}
+}
+
+func (e Endpoint) key() string {
+	return fmt.Sprintf("%s\x00%d\x00%s\x00%s", e.DstIP, e.DstPort, e.Method, e.Route)
+}
+
+func (e Endpoint) String() string {
+	return fmt.Sprintf("%s %s:%d%s", e.Method, e.DstIP, e.DstPort, e.Route)
+}
+
+// Baseline 是某个指标的指数加权均值与方差，N 为已学习的时间桶数。
+type Baseline struct {
+	Mean float64 `json:"mean"`
+	Var  float64 `json:"var"`
+	N    int     `json:"n"`
+}
+
+// Std 返回标准差。
+func (b *Baseline) Std() float64 {
+	return math.Sqrt(b.Var)
+}
+
+// score 返回 x 高出均值多少个标准差，标准差不低于 minStd。
+func (b *Baseline) score(s Signal, x float64) float64 {
+	return (x - b.Mean) / math.Max(b.Std(), s.minStd(b.Mean))
+}
+
+// update 以权重 alpha 吸收新样本（增量式 EWMA 方差）。
+func (b *Baseline) update(x, alpha float64) {
+	if b.N == 0 {
+		b.Mean, b.Var, b.N = x, 0, 1
+		return
+	}
+	diff := x - b.Mean
+	incr := alpha * diff
+	b.Mean += incr
+	b.Var = (1 - alpha) * (b.Var + diff*incr)
+	b.N++
+}
+
+// Model 是一个接口的各指标基线。
+type Model struct {
+	Endpoint  Endpoint             `json:"endpoint"`
+	Baselines map[Signal]*Baseline `json:"baselines"`
+	// LastSeen 是最近一个有足够流量的时间桶。
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Event 是一次异常：同一接口同一指标连续异常的时间桶合并为一个事件，[Start, End) 覆盖这些桶。
+// Value、Baseline 与 Score 取分数最高的那个桶。
+type Event struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Endpoint
+	Signal   Signal  `json:"signal"`
+	Value    float64 `json:"value"`
+	Baseline float64 `json:"baseline"`
+	Score    float64 `json:"score"`
+	// Count 是异常期间的请求数。
+	Count int64 `json:"count"`
+}
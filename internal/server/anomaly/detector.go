@@ -0,0 +1,322 @@
+package anomaly
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"lightobs/internal/server/storage"
+)
+
+// 以下为 Options 未设置时的默认值。
+const (
+	DefaultStep      = time.Minute
+	DefaultHalfLife  = time.Hour
+	DefaultThreshold = 4.0
+	DefaultMinCount  = 10
+	DefaultWarmup    = 30
+	DefaultBackfill  = 24 * time.Hour
+	DefaultMaxEvents = 1000
+)
+
+// maxEndpoints 是同时建模的接口数上限，超出后新出现的接口不再建模。
+const maxEndpoints = 10000
+
+// modelTTL 是接口没有流量多久后丢弃其模型。
+const modelTTL = 7 * 24 * time.Hour
+
+type Options struct {
+	// Step 是时间桶宽度，每个桶是一个样本。
+	Step time.Duration
+	// HalfLife 是基线的半衰期：这么久之前的样本权重减半。
+	HalfLife time.Duration
+	// Threshold 是判为异常的分数（高出基线的标准差倍数），只检测变差的方向。
+	Threshold float64
+	// MinCount 是桶内请求数下限，请求更少的桶既不学习也不检测。
+	MinCount int64
+	// Warmup 是开始检测前至少学习的桶数。
+	Warmup int
+	// Backfill 是首次启动（或停机过久）时从历史数据学习的时长。
+	Backfill time.Duration
+	// MaxEvents 是保留的异常事件条数，超出后丢弃最旧的。
+	MaxEvents int
+	// StatePath 是模型与事件的保存路径，为空则只保存在内存中。
+	StatePath string
+}
+
+func (o *Options) setDefaults() {
+	if o.Step <= 0 {
+		o.Step = DefaultStep
+	}
+	if o.HalfLife <= 0 {
+		o.HalfLife = DefaultHalfLife
+	}
+	if o.Threshold <= 0 {
+		o.Threshold = DefaultThreshold
+	}
+	if o.MinCount <= 0 {
+		o.MinCount = DefaultMinCount
+	}
+	if o.Warmup <= 0 {
+		o.Warmup = DefaultWarmup
+	}
+	if o.Backfill <= 0 {
+		o.Backfill = DefaultBackfill
+	}
+	if o.MaxEvents <= 0 {
+		o.MaxEvents = DefaultMaxEvents
+	}
+}
+
+// state 是持久化到 StatePath 的内容。
+type state struct {
+	// Watermark 之前的时间桶都已处理。
+	Watermark time.Time `json:"watermark"`
+	Models    []*Model  `json:"models"`
+	Events    []Event   `json:"events"`
+}
+
+// Detector 按时间桶增量学习基线并检测异常。Update 由单个协程周期调用，Events、Models 可并发调用。
+type Detector struct {
+	store storage.Store
+	opts  Options
+	// alpha 是每个样本的 EWMA 权重，由 Step 与 HalfLife 换算。
+	alpha float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	watermark time.Time
+	models    map[string]*Model
+	events    []Event
+}
+
+// New 创建检测器，StatePath 指向的文件存在时从中恢复模型与事件。
+func New(store storage.Store, opts Options) (*Detector, error) {
+	opts.setDefaults()
+	d := &Detector{
+		store:  store,
+		opts:   opts,
+		alpha:  1 - math.Exp2(-float64(opts.Step)/float64(opts.HalfLife)),
+		now:    time.Now,
+		models: make(map[string]*Model),
+	}
+	if opts.StatePath == "" {
+		return d, nil
+	}
+	data, err := os.ReadFile(opts.StatePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取基线状态失败：%w", err)
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("解析基线状态失败：%w", err)
+	}
+	d.watermark = st.Watermark
+	d.events = st.Events
+	for _, m := range st.Models {
+		d.models[m.Endpoint.key()] = m
+	}
+	return d, nil
+}
+
+// Update 处理上次水位之后已经结束的时间桶，返回新增或延续的异常事件数。
+// 最近一个桶要等下一个桶也结束后才处理，给迟到的上报留出时间。
+func (d *Detector) Update(ctx context.Context) (int, error) {
+	now := d.now()
+	end := now.Add(-d.opts.Step).Truncate(d.opts.Step)
+	d.mu.Lock()
+	start := d.watermark
+	d.mu.Unlock()
+	if floor := now.Add(-d.opts.Backfill).Truncate(d.opts.Step); start.Before(floor) {
+		start = floor
+	}
+	if !start.Before(end) {
+		return 0, nil
+	}
+
+	q := storage.SeriesQuery{Filter: storage.Filter{From: start, To: end}, Step: d.opts.Step, GroupBy: endpointDims}
+	points, err := d.store.Series(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+
+	d.mu.Lock()
+	n := 0
+	for _, p := range points {
+		n += d.observe(p)
+	}
+	for key, m := range d.models {
+		if end.Sub(m.LastSeen) > modelTTL {
+			delete(d.models, key)
+		}
+	}
+	if extra := len(d.events) - d.opts.MaxEvents; extra > 0 {
+		d.events = append([]Event(nil), d.events[extra:]...)
+	}
+	d.watermark = end
+	st := d.snapshot()
+	d.mu.Unlock()
+
+	return n, d.save(st)
+}
+
+// observe 用一个时间桶检测并更新对应接口的基线，返回新增或延续的事件数。调用方持有 mu。
+func (d *Detector) observe(p storage.SeriesPoint) int {
+	if p.Count < d.opts.MinCount {
+		return 0
+	}
+	ep := endpointFromGroup(p.Group)
+	m := d.models[ep.key()]
+	if m == nil {
+		if len(d.models) >= maxEndpoints {
+			return 0
+		}
+		m = &Model{Endpoint: ep, Baselines: make(map[Signal]*Baseline, len(signals))}
+		d.models[ep.key()] = m
+	}
+	m.LastSeen = p.Time
+
+	n := 0
+	for _, s := range signals {
+		b := m.Baselines[s]
+		if b == nil {
+			b = &Baseline{}
+			m.Baselines[s] = b
+		}
+		x := s.value(p.StatsRow)
+		score := b.score(s, x)
+		if b.N >= d.opts.Warmup && score >= d.opts.Threshold {
+			d.record(ep, s, p, x, b.Mean, score)
+			n++
+			// 异常样本截断到阈值处再学习，持续的异常会逐步抬高基线，但单个尖峰不会把基线带偏。
+			x = b.Mean + d.opts.Threshold*math.Max(b.Std(), s.minStd(b.Mean))
+		}
+		b.update(x, d.alpha)
+	}
+	return n
+}
+
+// record 记录一个异常桶：紧接在同一接口同一指标的上一个事件之后时合并进该事件。
+func (d *Detector) record(ep Endpoint, s Signal, p storage.SeriesPoint, x, mean, score float64) {
+	for i := len(d.events) - 1; i >= 0; i-- {
+		e := &d.events[i]
+		if e.Endpoint == ep && e.Signal == s && e.End.Equal(p.Time) {
+			e.End = p.Time.Add(d.opts.Step)
+			e.Count += p.Count
+			if score > e.Score {
+				e.Value, e.Baseline, e.Score = x, mean, score
+			}
+			return
+		}
+	}
+	d.events = append(d.events, Event{
+		Start: p.Time, End: p.Time.Add(d.opts.Step), Endpoint: ep, Signal: s,
+		Value: x, Baseline: mean, Score: score, Count: p.Count,
+	})
+}
+
+// snapshot 复制当前状态用于持久化。调用方持有 mu。
+func (d *Detector) snapshot() state {
+	st := state{Watermark: d.watermark, Events: append([]Event(nil), d.events...)}
+	keys := make([]string, 0, len(d.models))
+	for k := range d.models {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		m := *d.models[k]
+		m.Baselines = make(map[Signal]*Baseline, len(signals))
+		for s, b := range d.models[k].Baselines {
+			cp := *b
+			m.Baselines[s] = &cp
+		}
+		st.Models = append(st.Models, &m)
+	}
+	return st
+}
+
+// save 先写临时文件再改名，避免写到一半时退出留下损坏的状态文件。
+func (d *Detector) save(st state) error {
+	if d.opts.StatePath == "" {
+		return nil
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp := d.opts.StatePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("保存基线状态失败：%w", err)
+	}
+	if err := os.Rename(tmp, d.opts.StatePath); err != nil {
+		return fmt.Errorf("保存基线状态失败：%w", err)
+	}
+	return nil
+}
+
+// EventQuery 是异常事件的查询条件，零值表示不限制。
+type EventQuery struct {
+	// From/To 与事件的 [Start, End) 有交集即匹配。
+	From   time.Time
+	To     time.Time
+	DstIP  string
+	Signal Signal
+	Limit  int
+}
+
+// Events 按开始时间倒序返回匹配的异常事件。
+func (d *Detector) Events(q EventQuery) []Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := []Event{}
+	for i := len(d.events) - 1; i >= 0; i-- {
+		e := d.events[i]
+		switch {
+		case !q.From.IsZero() && !e.End.After(q.From):
+			continue
+		case !q.To.IsZero() && !e.Start.Before(q.To):
+			continue
+		case q.DstIP != "" && e.DstIP != q.DstIP:
+			continue
+		case q.Signal != "" && e.Signal != q.Signal:
+			continue
+		}
+		out = append(out, e)
+	}
+	// 合并延续的事件保持原位置，按 Start 重新排序。
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start.After(out[j].Start) })
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out
+}
+
+// Models 返回目的 IP 为 dstIP（为空则全部）的接口模型，按接口排序。
+func (d *Detector) Models(dstIP string) []Model {
+	d.mu.Lock()
+	st := d.snapshot()
+	d.mu.Unlock()
+	out := []Model{}
+	for _, m := range st.Models {
+		if dstIP == "" || m.Endpoint.DstIP == dstIP {
+			out = append(out, *m)
+		}
+	}
+	return out
+}
+
+// Watermark 返回已处理到的时间。
+func (d *Detector) Watermark() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.watermark
+}
@@ -0,0 +1,179 @@
+package anomaly
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"lightobs/internal/server/storage/memory"
+	"lightobs/pkg/model"
+)
+
+func TestBaselineUpdate(t *testing.T) {
+	var b Baseline
+	for i := 0; i < 100; i++ {
+		b.update(50, 0.1)
+	}
+	if b.Mean != 50 || b.Var != 0 || b.N != 100 {
+		t.Errorf("constant input: %+v", b)
+	}
+	// 方差为 0 时使用下限：50ms 的 10% 为 5ms。
+	if got := b.score(SignalLatency, 70); got != 4 {
+		t.Errorf("score=%v, want 4", got)
+	}
+
+	b = Baseline{}
+	for i := 0; i < 2000; i++ {
+		b.update(float64(90+20*(i%2)), 0.05)
+	}
+	if math.Abs(b.Mean-100) > 1 || math.Abs(b.Std()-10) > 1 {
+		t.Errorf("alternating input: mean=%v std=%v", b.Mean, b.Std())
+	}
+}
+
+// trafficAt 生成 start 起每分钟 20 条请求，latency/errors 决定该分钟的 p90 延迟与 5xx 条数。
+func trafficAt(start time.Time, minutes int, dst string, latency func(min int) int64, errors func(min int) int) []model.TrafficLog {
+	var logs []model.TrafficLog
+	for m := 0; m < minutes; m++ {
+		for i := 0; i < 20; i++ {
+			l := model.TrafficLog{
+				Timestamp: start.Add(time.Duration(m)*time.Minute + time.Duration(i)*time.Second),
+				SrcIP:     "10.0.0.2", DstIP: dst, DstPort: 80, HTTPMethod: "GET", HTTPPath: "/users/1", HTTPRoute: "/users/{id}",
+				StatusCode: 200, LatencyMS: latency(m) + int64(i*7%21) - 10,
+			}
+			if i < errors(m) {
+				l.StatusCode = 500
+			}
+			logs = append(logs, l)
+		}
+	}
+	return logs
+}
+
+func TestDetector(t *testing.T) {
+	ctx := context.Background()
+	st := memory.NewStore(0)
+	defer st.Close()
+	now := time.Date(2024, 5, 1, 10, 0, 30, 0, time.UTC)
+	start := now.Add(-2 * time.Hour).Truncate(time.Minute)
+	// 10.0.0.8 最后 5 分钟（已结束的桶中）延迟从 100ms 升到 400ms；10.0.0.9 在第 100、101 分钟一半请求 5xx。
+	slow := trafficAt(start, 120, "10.0.0.8", func(m int) int64 {
+		if m >= 114 && m < 119 {
+			return 400
+		}
+		return 100
+	}, func(int) int { return 0 })
+	flaky := trafficAt(start, 120, "10.0.0.9", func(int) int64 { return 30 }, func(m int) int {
+		if m == 100 || m == 101 {
+			return 10
+		}
+		return m % 30 / 29 // 偶尔 1 个错误
+	})
+	if err := st.InsertBatch(ctx, append(slow, flaky...)); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "baselines.json")
+	d, err := New(st, Options{StatePath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.now = func() time.Time { return now }
+	n, err := d.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	// 最近一个桶（第 119 分钟）尚未处理。
+	if wm := d.Watermark(); !wm.Equal(start.Add(119 * time.Minute)) {
+		t.Errorf("watermark=%v", wm)
+	}
+
+	events := d.Events(EventQuery{})
+	if n != 7 || len(events) != 2 {
+		t.Fatalf("n=%d events=%+v", n, events)
+	}
+	lat := events[0]
+	if lat.DstIP != "10.0.0.8" || lat.Signal != SignalLatency || lat.Route != "/users/{id}" ||
+		!lat.Start.Equal(start.Add(114*time.Minute)) || !lat.End.Equal(start.Add(119*time.Minute)) || lat.Count != 100 ||
+		lat.Value < 390 || lat.Baseline > 120 || lat.Score < DefaultThreshold {
+		t.Errorf("latency event=%+v", lat)
+	}
+	errEv := events[1]
+	if errEv.DstIP != "10.0.0.9" || errEv.Signal != SignalErrorRate || !errEv.Start.Equal(start.Add(100*time.Minute)) ||
+		!errEv.End.Equal(start.Add(102*time.Minute)) || errEv.Value != 0.5 {
+		t.Errorf("error event=%+v", errEv)
+	}
+
+	if got := d.Events(EventQuery{DstIP: "10.0.0.9"}); len(got) != 1 || got[0].Signal != SignalErrorRate {
+		t.Errorf("by ip=%+v", got)
+	}
+	if got := d.Events(EventQuery{Signal: SignalLatency, From: start.Add(118 * time.Minute)}); len(got) != 1 {
+		t.Errorf("latency overlapping window=%+v", got)
+	}
+	if got := d.Events(EventQuery{To: start.Add(100 * time.Minute)}); len(got) != 0 {
+		t.Errorf("before any event=%+v", got)
+	}
+	models := d.Models("10.0.0.9")
+	if len(models) != 1 || models[0].Baselines[SignalLatency].N != 119 || math.Abs(models[0].Baselines[SignalLatency].Mean-34) > 1 {
+		t.Errorf("models=%+v", models)
+	}
+
+	// 重启后从状态文件恢复：事件、模型与水位不变，已处理的桶不会重复计算。
+	d2, err := New(st, Options{StatePath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2.now = d.now
+	if !reflect.DeepEqual(d2.Events(EventQuery{}), events) || !reflect.DeepEqual(d2.Models(""), d.Models("")) {
+		t.Error("state differs after reload")
+	}
+	if n, err := d2.Update(ctx); err != nil || n != 0 {
+		t.Errorf("Update after reload: n=%d err=%v", n, err)
+	}
+
+	// 下一分钟处理第 119 个桶：延迟恢复，事件不再延续。
+	now = now.Add(time.Minute)
+	if n, err := d2.Update(ctx); err != nil || n != 0 {
+		t.Errorf("next bucket: n=%d err=%v", n, err)
+	}
+	if got := d2.Events(EventQuery{}); !got[0].End.Equal(lat.End) {
+		t.Errorf("event extended: %+v", got[0])
+	}
+}
+
+func TestDetector_Warmup(t *testing.T) {
+	ctx := context.Background()
+	st := memory.NewStore(0)
+	defer st.Close()
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	start := now.Add(-20 * time.Minute)
+	// 学习样本不足 Warmup 时不报异常，请求数不足 MinCount 的桶被忽略。
+	logs := trafficAt(start, 19, "10.0.0.8", func(m int) int64 { return int64(100 + 300*(m/15)) }, func(int) int { return 0 })
+	logs = append(logs, model.TrafficLog{Timestamp: start, SrcIP: "10.0.0.2", DstIP: "10.0.0.7", DstPort: 80, LatencyMS: 5})
+	if err := st.InsertBatch(ctx, logs); err != nil {
+		t.Fatal(err)
+	}
+	d, err := New(st, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.now = func() time.Time { return now }
+	if n, err := d.Update(ctx); err != nil || n != 0 {
+		t.Errorf("n=%d err=%v", n, err)
+	}
+	if models := d.Models(""); len(models) != 1 || models[0].Baselines[SignalLatency].N != 19 {
+		t.Errorf("models=%+v", models)
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	if s, err := ParseSignal("error_rate"); err != nil || s != SignalErrorRate {
+		t.Errorf("s=%v err=%v", s, err)
+	}
+	if _, err := ParseSignal("p99"); err == nil {
+		t.Error("p99 accepted")
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"lightobs/internal/server/alert"
+)
+
+// Alerts 返回告警规则引擎的当前告警：
+//
+//	state         pending / firing / resolved，为空则全部返回
+//
+// 未配置告警规则时返回空列表。
+func (h *Handlers) Alerts(c *gin.Context) {
+	state := alert.State(c.Query("state"))
+	switch state {
+	case "", alert.StatePending, alert.StateFiring, alert.StateResolved:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("state 参数非法：%s（可选 pending / firing / resolved）", state)})
+		return
+	}
+
+	out := []alert.Alert{}
+	rules := 0
+	if h.alerts != nil {
+		rules = len(h.alerts.Rules())
+		for _, a := range h.alerts.Alerts() {
+			if state == "" || a.State == state {
+				out = append(out, a)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": rules, "alerts": out})
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"lightobs/internal/server/alert"
+	"lightobs/internal/server/storage"
+)
+
+func TestAlerts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{
+		stats: func(ctx context.Context, q storage.StatsQuery) ([]storage.StatsRow, error) {
+			return []storage.StatsRow{
+				{Group: []string{"10.0.0.8"}, Count: 100, Errors: 20, P99MS: 800},
+				{Group: []string{"10.0.0.9"}, Count: 100, P99MS: 20},
+			}, nil
+		},
+	}
+	rules, err := alert.Parse([]byte(`
+rules:
+  - {name: dst-5xx, metric: error_rate, op: ">", threshold: 0.05, group_by: [dst_ip]}
+  - {name: slow, metric: p99, op: ">", threshold: 500, for: 5m, group_by: [dst_ip]}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := alert.NewEngine(store, rules.Rules, nil)
+	if err := e.Evaluate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.GET("/api/v1/alerts", NewHandlers(store, WithAlerts(e)).Alerts)
+	get := func(query string) (int, []alert.Alert) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/alerts"+query, nil))
+		var resp struct {
+			Rules  int           `json:"rules"`
+			Alerts []alert.Alert `json:"alerts"`
+		}
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Rules != 2 {
+				t.Fatalf("body=%s err=%v", w.Body.String(), err)
+			}
+		}
+		return w.Code, resp.Alerts
+	}
+
+	code, alerts := get("")
+	if code != http.StatusOK || len(alerts) != 2 || alerts[0].Rule != "dst-5xx" || alerts[0].State != alert.StateFiring ||
+		alerts[1].State != alert.StatePending || alerts[1].Group["dst_ip"] != "10.0.0.8" {
+		t.Errorf("alerts=%+v", alerts)
+	}
+	if code, alerts := get("?state=pending"); code != http.StatusOK || len(alerts) != 1 || alerts[0].Rule != "slow" {
+		t.Errorf("pending: code=%d alerts=%+v", code, alerts)
+	}
+	if code, _ := get("?state=silenced"); code != http.StatusBadRequest {
+		t.Errorf("bad state: code=%d", code)
+	}
+
+	// 未配置告警规则时返回空列表。
+	r = gin.New()
+	r.GET("/api/v1/alerts", NewHandlers(store).Alerts)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/alerts", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"alerts":[],"rules":0}` {
+		t.Errorf("no engine: code=%d body=%s", w.Code, w.Body.String())
+	}
+}
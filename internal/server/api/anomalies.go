@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lightobs/internal/server/anomaly"
+)
+
+// defaultAnomalyWindow 是 /anomalies 未指定 from 时的查询范围。
+const defaultAnomalyWindow = 24 * time.Hour
+
+// defaultAnomalyLimit 是 /anomalies 未指定 limit 时返回的最大事件数。
+const defaultAnomalyLimit = 100
+
+// Anomalies 返回与 [from, to) 有交集的异常事件，按开始时间倒序：
+//
+//	ip            接口的目的 IP
+//	signal        p90_ms / error_rate，为空则全部
+//	limit         默认 100，最大 1000
+//
+// 未指定 from 时查询最近 24 小时；未启用异常检测时返回空列表。
+func (h *Handlers) Anomalies(c *gin.Context) {
+	now := time.Now()
+	q, err := parseEventQuery(c, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	events := []anomaly.Event{}
+	var watermark time.Time
+	if h.anomalies != nil {
+		events = h.anomalies.Events(q)
+		watermark = h.anomalies.Watermark()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":      q.From,
+		"to":        q.To,
+		"watermark": watermark,
+		"events":    events,
+	})
+}
+
+func parseEventQuery(c *gin.Context, now time.Time) (anomaly.EventQuery, error) {
+	var (
+		q   anomaly.EventQuery
+		err error
+	)
+	if q.From, err = parseTime(c.Query("from"), now); err != nil {
+		return q, fmt.Errorf("from 参数非法：%w", err)
+	}
+	if q.To, err = parseTime(c.Query("to"), now); err != nil {
+		return q, fmt.Errorf("to 参数非法：%w", err)
+	}
+	if q.From.IsZero() {
+		q.From = now.Add(-defaultAnomalyWindow)
+	}
+	if !q.To.IsZero() && !q.From.Before(q.To) {
+		return q, fmt.Errorf("from 必须早于 to")
+	}
+	if raw := c.Query("ip"); raw != "" {
+		if net.ParseIP(raw) == nil {
+			return q, fmt.Errorf("ip 参数非法")
+		}
+		q.DstIP = raw
+	}
+	if q.Signal, err = anomaly.ParseSignal(c.Query("signal")); err != nil {
+		return q, err
+	}
+	q.Limit, err = parseStatsLimit(c, defaultAnomalyLimit)
+	return q, err
+}
+
+// Baselines 返回各接口当前学习到的基线：
+//
+//	ip            接口的目的 IP，为空则全部
+//
+// 每个基线包含均值、标准差与已学习的时间桶数。
+func (h *Handlers) Baselines(c *gin.Context) {
+	ip := c.Query("ip")
+	if ip != "" && net.ParseIP(ip) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ip 参数非法"})
+		return
+	}
+	out := []gin.H{}
+	if h.anomalies != nil {
+		for _, m := range h.anomalies.Models(ip) {
+			item := gin.H{"endpoint": m.Endpoint, "last_seen": m.LastSeen}
+			for s, b := range m.Baselines {
+				item[string(s)] = gin.H{"mean": b.Mean, "std": b.Std(), "samples": b.N}
+			}
+			out = append(out, item)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"baselines": out})
+}
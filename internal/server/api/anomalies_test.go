@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lightobs/internal/server/anomaly"
+	"lightobs/internal/server/storage"
+)
+
+func TestAnomalies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// 最近 40 分钟每分钟一个桶，倒数第二个桶延迟突增。
+	end := time.Now().Add(-time.Minute).Truncate(time.Minute)
+	store := &fakeStore{
+		series: func(ctx context.Context, q storage.SeriesQuery) ([]storage.SeriesPoint, error) {
+			var points []storage.SeriesPoint
+			for ts := end.Add(-40 * time.Minute); ts.Before(end); ts = ts.Add(time.Minute) {
+				p := storage.SeriesPoint{Time: ts, StatsRow: storage.StatsRow{
+					Group: []string{"10.0.0.8", "80", "GET", "/users/{id}"}, Count: 50, P90MS: 100}}
+				if ts.Equal(end.Add(-2 * time.Minute)) {
+					p.P90MS = 900
+				}
+				points = append(points, p)
+			}
+			return points, nil
+		},
+	}
+	d, err := anomaly.New(store, anomaly.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	h := NewHandlers(store, WithAnomalies(d))
+	r.GET("/api/v1/anomalies", h.Anomalies)
+	r.GET("/api/v1/baselines", h.Baselines)
+	get := func(path string, out any) int {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+				t.Fatalf("body=%s err=%v", w.Body.String(), err)
+			}
+		}
+		return w.Code
+	}
+
+	var resp struct {
+		Watermark time.Time        `json:"watermark"`
+		Events    []map[string]any `json:"events"`
+	}
+	if code := get("/api/v1/anomalies?ip=10.0.0.8&signal=p90_ms", &resp); code != http.StatusOK || len(resp.Events) != 1 || !resp.Watermark.Equal(end) {
+		t.Fatalf("code=%d resp=%+v", code, resp)
+	}
+	if e := resp.Events[0]; e["dst_ip"] != "10.0.0.8" || e["route"] != "/users/{id}" || e["value"] != float64(900) || e["baseline"] != float64(100) {
+		t.Errorf("event=%v", e)
+	}
+	if code := get("/api/v1/anomalies?signal=error_rate", &resp); code != http.StatusOK || len(resp.Events) != 0 {
+		t.Errorf("error_rate: code=%d events=%v", code, resp.Events)
+	}
+	// 默认只查最近 24 小时。
+	if code := get("/api/v1/anomalies?to=-25h&from=-48h", &resp); code != http.StatusOK || len(resp.Events) != 0 {
+		t.Errorf("old window: code=%d events=%v", code, resp.Events)
+	}
+
+	var baselines struct {
+		Baselines []map[string]any `json:"baselines"`
+	}
+	if code := get("/api/v1/baselines?ip=10.0.0.8", &baselines); code != http.StatusOK || len(baselines.Baselines) != 1 {
+		t.Fatalf("code=%d baselines=%+v", code, baselines)
+	}
+	if lat, _ := baselines.Baselines[0]["p90_ms"].(map[string]any); lat["samples"] != float64(40) {
+		t.Errorf("baseline=%v", baselines.Baselines[0])
+	}
+
+	for _, q := range []string{"/api/v1/anomalies?signal=p99", "/api/v1/anomalies?ip=x", "/api/v1/anomalies?limit=0", "/api/v1/baselines?ip=x"} {
+		if code := get(q, &resp); code != http.StatusBadRequest {
+			t.Errorf("%s: code=%d", q, code)
+		}
+	}
+
+	// 未启用异常检测时返回空列表。
+	r = gin.New()
+	r.GET("/api/v1/anomalies", NewHandlers(store).Anomalies)
+	if code := get("/api/v1/anomalies", &resp); code != http.StatusOK || len(resp.Events) != 0 || !resp.Watermark.IsZero() {
+		t.Errorf("disabled: code=%d resp=%+v", code, resp)
+	}
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lightobs/internal/server/storage"
+	"lightobs/pkg/model"
+)
+
+// 导出结束时通过 HTTP trailer 返回的字段：响应头在写出第一行前就已发送，
+// 中途失败只能在 trailer 中告知客户端，避免把截断的文件当作完整结果。
+const (
+	trailerExportRows  = "X-Export-Rows"
+	trailerExportError = "X-Export-Error"
+)
+
+var exportContentTypes = map[storage.ExportFormat]string{
+	storage.ExportNDJSON:  "application/x-ndjson",
+	storage.ExportCSV:     "text/csv; charset=utf-8",
+	storage.ExportParquet: "application/vnd.apache.parquet",
+}
+
+// Export 按时间升序导出满足条件的全部记录，过滤参数与 /search 相同（sort、limit、cursor 不生效）。
+// format=ndjson（默认）/ csv / parquet：
+//
+//	ndjson、csv  逐页读取并边读边写，内存中只保留一页；结束后在 trailer 中返回
+//	             X-Export-Rows（条数）与 X-Export-Error（中途失败的原因，成功时为空）
+//	parquet      仅 DuckDB 后端支持，由 COPY ... TO 写入临时文件后整体返回
+func (h *Handlers) Export(c *gin.Context) {
+	format, err := storage.ParseExportFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	f, err := parseConditions(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	f.Sort, f.Asc = storage.SortTimestamp, true
+
+	if format == storage.ExportParquet {
+		h.exportParquet(c, f)
+		return
+	}
+
+	setExportHeaders(c, format)
+	c.Header("Trailer", trailerExportRows+", "+trailerExportError)
+	c.Status(http.StatusOK)
+
+	var (
+		rows  int64
+		write func(*model.TrafficLog) error
+		flush = func() error { return nil }
+	)
+	switch format {
+	case storage.ExportCSV:
+		w := csv.NewWriter(c.Writer)
+		record := make([]string, len(storage.ExportColumns))
+		if err = w.Write(storage.ExportColumns); err != nil {
+			break
+		}
+		write = func(l *model.TrafficLog) error {
+			return w.Write(csvRecord(l, record))
+		}
+		flush = func() error {
+			w.Flush()
+			return w.Error()
+		}
+	default:
+		enc := json.NewEncoder(c.Writer)
+		write = func(l *model.TrafficLog) error { return enc.Encode(l) }
+	}
+	if err == nil {
+		err = storage.Scan(c.Request.Context(), h.store.Query, f, func(l *model.TrafficLog) error {
+			rows++
+			return write(l)
+		})
+	}
+	if ferr := flush(); err == nil {
+		err = ferr
+	}
+
+	header := c.Writer.Header()
+	header.Set(trailerExportRows, strconv.FormatInt(rows, 10))
+	if err != nil {
+		header.Set(trailerExportError, err.Error())
+		_ = c.Error(err)
+	}
+}
+
+func (h *Handlers) exportParquet(c *gin.Context, f storage.Filter) {
+	exporter, ok := h.store.(storage.ParquetExporter)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "当前存储后端不支持导出 parquet（请使用 duckdb 后端，或改用 csv / ndjson）"})
+		return
+	}
+	dir, err := os.MkdirTemp("", "lightobs-export-")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建临时目录失败：" + err.Error()})
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "traffic.parquet")
+	if err := exporter.ExportParquet(c.Request.Context(), f, path); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取导出文件失败：" + err.Error()})
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取导出文件失败：" + err.Error()})
+		return
+	}
+
+	setExportHeaders(c, storage.ExportParquet)
+	c.Header("Content-Length", strconv.FormatInt(info.Size(), 10))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, file); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+func setExportHeaders(c *gin.Context, format storage.ExportFormat) {
+	filename := fmt.Sprintf("traffic-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	c.Header("Content-Type", exportContentTypes[format])
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+}
+
+// csvRecord 按 storage.ExportColumns 的顺序填充 record，时间为 UTC RFC3339（纳秒精度）。
+func csvRecord(l *model.TrafficLog, record []string) []string {
+	record[0] = l.Timestamp.UTC().Format(time.RFC3339Nano)
+	record[1] = l.SrcIP
+	record[2] = strconv.Itoa(l.SrcPort)
+	record[3] = l.DstIP
+	record[4] = strconv.Itoa(l.DstPort)
+	record[5] = strconv.Itoa(l.PID)
+	record[6] = l.HTTPMethod
+	record[7] = l.HTTPPath
+	record[8] = l.HTTPQuery
+	record[9] = l.HTTPRoute
+	record[10] = strconv.Itoa(l.StatusCode)
+	record[11] = strconv.FormatInt(l.LatencyMS, 10)
+	record[12] = strconv.Itoa(l.PacketSize)
+	return record
+}
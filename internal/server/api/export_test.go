@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lightobs/internal/server/storage"
+	"lightobs/pkg/model"
+)
+
+// pagedStore 把 logs 按每页两条返回，游标为下一页的下标。
+func pagedStore(logs []model.TrafficLog, fail error) *fakeStore {
+	return &fakeStore{
+		query: func(ctx context.Context, f storage.Filter) (storage.Page, error) {
+			start := 0
+			if f.After != nil {
+				start = int(f.After.RowID)
+				if fail != nil {
+					return storage.Page{}, fail
+				}
+			}
+			end := min(start+2, len(logs))
+			page := storage.Page{Items: logs[start:end]}
+			if end < len(logs) {
+				page.Next = &storage.Cursor{Sort: f.Sort, Asc: f.Asc, RowID: int64(end)}
+			}
+			return page, nil
+		},
+	}
+}
+
+func exportServer(t *testing.T, store storage.Store) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/v1/export", NewHandlers(store).Export)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestExport(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	logs := []model.TrafficLog{
+		{Timestamp: ts, SrcIP: "10.0.0.2", DstIP: "10.0.0.1", DstPort: 80, HTTPMethod: "GET", HTTPPath: "/a", StatusCode: 200},
+		{Timestamp: ts.Add(time.Second), SrcIP: "10.0.0.2", DstIP: "10.0.0.1", DstPort: 80, HTTPMethod: "POST", HTTPPath: "/b,c", StatusCode: 500, LatencyMS: 12},
+		{Timestamp: ts.Add(2 * time.Second), SrcIP: "10.0.0.3", DstIP: "10.0.0.1", DstPort: 80, PID: 7, HTTPMethod: "GET", HTTPPath: "/d", HTTPQuery: "x=1", StatusCode: 404},
+	}
+	srv := exportServer(t, pagedStore(logs, nil))
+
+	resp, err := http.Get(srv.URL + "/api/v1/export?from=2024-05-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []model.TrafficLog
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		var l model.TrafficLog
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			t.Fatalf("line=%q err=%v", sc.Text(), err)
+		}
+		got = append(got, l)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/x-ndjson" || len(got) != 3 || got[2].HTTPQuery != "x=1" {
+		t.Fatalf("content-type=%s got=%+v", resp.Header.Get("Content-Type"), got)
+	}
+	if resp.Trailer.Get(trailerExportRows) != "3" || resp.Trailer.Get(trailerExportError) != "" {
+		t.Errorf("trailer=%v", resp.Trailer)
+	}
+
+	resp, err = http.Get(srv.URL + "/api/v1/export?format=csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil || len(records) != 4 {
+		t.Fatalf("records=%v err=%v", records, err)
+	}
+	if strings.Join(records[0], ",") != strings.Join(storage.ExportColumns, ",") {
+		t.Errorf("header=%v", records[0])
+	}
+	if records[1][0] != "2024-05-01T08:00:00Z" || records[2][7] != "/b,c" || records[3][5] != "7" {
+		t.Errorf("records=%v", records)
+	}
+	if !strings.Contains(resp.Header.Get("Content-Disposition"), ".csv") {
+		t.Errorf("content-disposition=%s", resp.Header.Get("Content-Disposition"))
+	}
+}
+
+func TestExportFailure(t *testing.T) {
+	logs := make([]model.TrafficLog, 5)
+	srv := exportServer(t, pagedStore(logs, errors.New("disk I/O error")))
+
+	resp, err := http.Get(srv.URL + "/api/v1/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status=%d", resp.StatusCode)
+	}
+	if resp.Trailer.Get(trailerExportRows) != "2" || !strings.Contains(resp.Trailer.Get(trailerExportError), "disk I/O error") {
+		t.Errorf("trailer=%v", resp.Trailer)
+	}
+
+	for _, q := range []string{"format=xlsx", "format=parquet", "status=abc"} {
+		resp, err := http.Get(srv.URL + "/api/v1/export?" + q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || resp.Header.Get("Content-Disposition") != "" {
+			t.Errorf("%s: status=%d content-disposition=%s", q, resp.StatusCode, resp.Header.Get("Content-Disposition"))
+		}
+	}
+}
@@ -1,51 +1,247 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 
+	"lightobs/internal/server/alert"
+	"lightobs/internal/server/anomaly"
 	"lightobs/internal/server/storage"
+	"lightobs/internal/server/tail"
+	"lightobs/internal/server/writebuf"
 	"lightobs/pkg/model"
+	"lightobs/pkg/pathnorm"
+	"lightobs/pkg/wire"
 )
 
 type Handlers struct {
 	store storage.Store
+	// writer 是上报记录的写入路径，默认为 inserter，启用写缓冲后为 writebuf.Buffer。
+	writer writebuf.BatchInserter
+	// inserter 是直接写库的路径（导入也使用），启用指标时记录写库耗时。
+	inserter writebuf.BatchInserter
+	metrics  *Metrics
+	paths    *pathnorm.Normalizer
+	tail     *tail.Hub
+	alerts   *alert.Engine
+	// anomalies 为 nil 表示未启用异常检测。
+	anomalies *anomaly.Detector
+	// parquet 为 nil 表示不支持导入 parquet。
+	parquet storage.ParquetReader
 }
 
-func NewHandlers(store storage.Store) *Handlers {
-	return &Handlers{store: store}
+type Option func(*Handlers)
+
+// WithNormalizer 指定写入前的路径归一化规则，默认只使用启发式规则。
+func WithNormalizer(n *pathnorm.Normalizer) Option {
+	return func(h *Handlers) {
+		h.paths = n
+	}
+}
+
+// WithTail 指定实时推送的分发器，写入成功的记录会发布给 /tail 的订阅者。
+func WithTail(hub *tail.Hub) Option {
+	return func(h *Handlers) {
+		h.tail = hub
+	}
+}
+
+// WithAlerts 指定告警规则引擎，/alerts 返回其当前告警。
+func WithAlerts(e *alert.Engine) Option {
+	return func(h *Handlers) {
+		h.alerts = e
+	}
+}
+
+// WithAnomalies 指定异常检测器，/anomalies 与 /baselines 返回其事件与模型。
+func WithAnomalies(d *anomaly.Detector) Option {
+	return func(h *Handlers) {
+		h.anomalies = d
+	}
+}
+
+// WithParquetReader 指定导入 parquet 文件时使用的读取器。
+func WithParquetReader(r storage.ParquetReader) Option {
+	return func(h *Handlers) {
+		h.parquet = r
+	}
+}
+
+// WithWriteBuffer 让 Upload 与 UploadBatch 经写缓冲合并后批量写入。
+func WithWriteBuffer(b *writebuf.Buffer) Option {
+	return func(h *Handlers) {
+		h.writer = b
+	}
+}
+
+func NewHandlers(store storage.Store, opts ...Option) *Handlers {
+	h := &Handlers{store: store}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.inserter = h.metrics.TimeInserts(store)
+	if h.writer == nil {
+		h.writer = h.inserter
+	}
+	return h
 }
 
 func (h *Handlers) Upload(c *gin.Context) {
+	body, err := openBody(c)
+	if err != nil {
+		h.metrics.reject(ingestUpload, rejectDecode, 1)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer body.Close()
 	var logEntry model.TrafficLog
-	if err := c.ShouldBindJSON(&logEntry); err != nil {
+	if wire.IsProtobuf(c.ContentType()) {
+		logs, err := wire.Decode(c.Request.Body, 1)
+		if err != nil || len(logs) != 1 {
+			h.metrics.reject(ingestUpload, rejectDecode, 1)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "protobuf 解析失败：需要恰好一条记录"})
+			return
+		}
+		logEntry = logs[0]
+	} else if err := c.ShouldBindJSON(&logEntry); err != nil {
+		h.metrics.reject(ingestUpload, rejectDecode, 1)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON 解析失败：" + err.Error()})
 		return
 	}
 
-	// 这里做最基本的数据校验，避免脏数据写入数据库。
-	if net.ParseIP(logEntry.SrcIP) == nil || net.ParseIP(logEntry.DstIP) == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "src_ip/dst_ip 非法"})
+	if err := validateLog(&logEntry); err != nil {
+		h.metrics.reject(ingestUpload, rejectReason(err), 1)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if !validPort(logEntry.SrcPort) || !validPort(logEntry.DstPort) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "src_port/dst_port 非法"})
+	h.paths.Apply(&logEntry)
+
+	logs := []model.TrafficLog{logEntry}
+	if err := h.writer.InsertBatch(c.Request.Context(), logs); err != nil {
+		h.metrics.reject(ingestUpload, rejectStoreError, 1)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "写入数据库失败：" + err.Error()})
 		return
 	}
-	if logEntry.HTTPMethod == "" || logEntry.HTTPPath == "" || logEntry.StatusCode == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "http_method/http_path/status_code 不能为空"})
+	h.metrics.accept(ingestUpload, logs)
+	h.tail.Publish(logEntry)
+
+	c.Status(http.StatusNoContent)
+}
+
+// maxBatchSize 限制单次批量上报的条数，防止单个请求占用过多内存。
+const maxBatchSize = 5000
+
+// maxBodyBytes 限制解压后的请求体大小，防止压缩炸弹。
+const maxBodyBytes = 64 << 20
+
+// openBody 按 Content-Encoding（gzip/zstd）把请求体替换为解压后的 reader。
+// net/http 只会关闭原始请求体，调用方读完后须关闭返回的解压器以释放其资源。
+func openBody(c *gin.Context) (io.Closer, error) {
+	rc, err := wire.NewReader(c.GetHeader("Content-Encoding"), c.Request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("请求体解压失败：%w", err)
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, rc, maxBodyBytes)
+	return rc, nil
+}
+
+// bindLogs 按 Content-Type 解析记录数组：二进制格式走 wire.Decode，其余按 JSON 处理。
+func bindLogs(c *gin.Context) ([]model.TrafficLog, int, error) {
+	body, err := openBody(c)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	defer body.Close()
+	if wire.IsProtobuf(c.ContentType()) {
+		logs, err := wire.Decode(c.Request.Body, maxBatchSize)
+		if errors.Is(err, wire.ErrTooManyRecords) {
+			return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("单批最多 %d 条", maxBatchSize)
+		}
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("protobuf 解析失败：%w", err)
+		}
+		return logs, 0, nil
+	}
+	var logs []model.TrafficLog
+	if err := c.ShouldBindJSON(&logs); err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("JSON 解析失败：%w", err)
+	}
+	if len(logs) > maxBatchSize {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("单批最多 %d 条", maxBatchSize)
+	}
+	return logs, 0, nil
+}
+
+type batchReject struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// UploadBatch 接收 TrafficLog 数组（JSON 或二进制格式）。校验规则与 Upload 相同，但逐条处理：
+// 非法记录记入 errors 并跳过，其余在一个事务中写入；只有写库失败才整体返回 500（此时没有记录入库）。
+func (h *Handlers) UploadBatch(c *gin.Context) {
+	logs, status, err := bindLogs(c)
+	if err != nil {
+		reason := rejectDecode
+		if status == http.StatusRequestEntityTooLarge {
+			reason = rejectTooLarge
+		}
+		h.metrics.reject(ingestUploadBatch, reason, 1)
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := h.store.Insert(c.Request.Context(), &logEntry); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "写入数据库失败：" + err.Error()})
+	valid := logs[:0]
+	rejects := make([]batchReject, 0)
+	for i := range logs {
+		if err := validateLog(&logs[i]); err != nil {
+			h.metrics.reject(ingestUploadBatch, rejectReason(err), 1)
+			rejects = append(rejects, batchReject{Index: i, Error: err.Error()})
+			continue
+		}
+		h.paths.Apply(&logs[i])
+		valid = append(valid, logs[i])
+	}
+	if err := h.writer.InsertBatch(c.Request.Context(), valid); err != nil {
+		h.metrics.reject(ingestUploadBatch, rejectStoreError, len(valid))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "写入数据库失败：" + err.Error(), "accepted": 0})
 		return
 	}
+	h.metrics.accept(ingestUploadBatch, valid)
+	h.tail.Publish(valid...)
 
-	c.Status(http.StatusNoContent)
+	c.JSON(http.StatusOK, gin.H{
+		"accepted": len(valid),
+		"rejected": len(rejects),
+		"errors":   rejects,
+	})
+}
+
+// validateLog 的校验错误，/metrics 按此区分拒绝原因。
+var (
+	errInvalidAddr  = errors.New("src_ip/dst_ip 非法")
+	errInvalidPort  = errors.New("src_port/dst_port 非法")
+	errMissingField = errors.New("http_method/http_path/status_code 不能为空")
+)
+
+// validateLog 做最基本的数据校验，避免脏数据写入数据库。
+func validateLog(logEntry *model.TrafficLog) error {
+	if net.ParseIP(logEntry.SrcIP) == nil || net.ParseIP(logEntry.DstIP) == nil {
+		return errInvalidAddr
+	}
+	if !validPort(logEntry.SrcPort) || !validPort(logEntry.DstPort) {
+		return errInvalidPort
+	}
+	if logEntry.HTTPMethod == "" || logEntry.HTTPPath == "" || logEntry.StatusCode == 0 {
+		return errMissingField
+	}
+	return nil
 }
 
 func (h *Handlers) Query(c *gin.Context) {
@@ -1,24 +1,48 @@
 package api
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"lightobs/internal/server/storage"
+	"lightobs/internal/server/tail"
+	"lightobs/internal/server/writebuf"
 	"lightobs/pkg/model"
+	"lightobs/pkg/pathnorm"
+	"lightobs/pkg/wire"
 )
 
 type fakeStore struct {
 	queryByIP  func(ctx context.Context, ip string, limit int) ([]model.TrafficLog, error)
 	queryByPID func(ctx context.Context, pid int, limit int) ([]model.TrafficLog, error)
+	query      func(ctx context.Context, f storage.Filter) (storage.Page, error)
+	stats      func(ctx context.Context, q storage.StatsQuery) ([]storage.StatsRow, error)
+	series     func(ctx context.Context, q storage.SeriesQuery) ([]storage.SeriesPoint, error)
+	prune      func(ctx context.Context, p storage.RetentionPolicy) (storage.PruneResult, error)
+	insertErr  error
+	inserted   []model.TrafficLog
 }
 
 func (f *fakeStore) Insert(ctx context.Context, logEntry *model.TrafficLog) error {
+	return f.InsertBatch(ctx, []model.TrafficLog{*logEntry})
+}
+
+func (f *fakeStore) InsertBatch(ctx context.Context, logs []model.TrafficLog) error {
+	if f.insertErr != nil {
+		return f.insertErr
+	}
+	f.inserted = append(f.inserted, logs...)
 	return nil
 }
 
@@ -30,6 +54,26 @@ func (f *fakeStore) QueryByPID(ctx context.Context, pid int, limit int) ([]model
 	return f.queryByPID(ctx, pid, limit)
 }
 
+func (f *fakeStore) Query(ctx context.Context, filter storage.Filter) (storage.Page, error) {
+	return f.query(ctx, filter)
+}
+
+func (f *fakeStore) Stats(ctx context.Context, q storage.StatsQuery) ([]storage.StatsRow, error) {
+	return f.stats(ctx, q)
+}
+
+func (f *fakeStore) Series(ctx context.Context, q storage.SeriesQuery) ([]storage.SeriesPoint, error) {
+	return f.series(ctx, q)
+}
+
+func (f *fakeStore) Prune(ctx context.Context, p storage.RetentionPolicy) (storage.PruneResult, error) {
+	return f.prune(ctx, p)
+}
+
+func (f *fakeStore) Rollup(ctx context.Context, p storage.RollupPolicy) (storage.RollupResult, error) {
+	return storage.RollupResult{}, nil
+}
+
 func (f *fakeStore) Close() error {
 	return nil
 }
@@ -123,3 +167,282 @@ func TestQueryMissingParams(t *testing.T) {
 		t.Fatalf("status=%d", w.Code)
 	}
 }
+
+func TestUploadBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	h := NewHandlers(store)
+	r := gin.New()
+	r.POST("/api/v1/upload/batch", h.UploadBatch)
+
+	body := `[
+		{"src_ip":"10.0.0.2","src_port":40000,"dst_ip":"10.0.0.1","dst_port":80,"http_method":"GET","http_path":"/a","status_code":200},
+		{"src_ip":"bad","src_port":40000,"dst_ip":"10.0.0.1","dst_port":80,"http_method":"GET","http_path":"/b","status_code":200},
+		{"src_ip":"10.0.0.2","src_port":40001,"dst_ip":"10.0.0.1","dst_port":80,"http_method":"GET","http_path":"/c","status_code":500}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	var res struct {
+		Accepted int `json:"accepted"`
+		Rejected int `json:"rejected"`
+		Errors   []struct {
+			Index int `json:"index"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if res.Accepted != 2 || res.Rejected != 1 || len(res.Errors) != 1 || res.Errors[0].Index != 1 {
+		t.Fatalf("res=%+v", res)
+	}
+	if len(store.inserted) != 2 || store.inserted[1].HTTPPath != "/c" {
+		t.Fatalf("inserted=%+v", store.inserted)
+	}
+}
+
+func TestUploadWriteBuffer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	buf := writebuf.New(store, writebuf.Options{})
+	defer buf.Close()
+	r := gin.New()
+	h := NewHandlers(store, WithWriteBuffer(buf))
+	r.POST("/api/v1/upload", h.Upload)
+	r.POST("/api/v1/upload/batch", h.UploadBatch)
+
+	one := `{"src_ip":"10.0.0.2","src_port":40000,"dst_ip":"10.0.0.1","dst_port":80,"http_method":"GET","http_path":"/a","status_code":200}`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/upload", strings.NewReader(one)))
+	if w.Code != http.StatusNoContent || len(store.inserted) != 1 {
+		t.Fatalf("status=%d inserted=%d", w.Code, len(store.inserted))
+	}
+
+	// 写库失败时整批不入库，accepted 为 0。
+	store.insertErr = errors.New("disk full")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/upload/batch", strings.NewReader("["+one+","+one+"]")))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), `"accepted":0`) {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestUploadBatchInvalidJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewHandlers(&fakeStore{})
+	r := gin.New()
+	r.POST("/api/v1/upload/batch", h.UploadBatch)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload/batch", strings.NewReader(`{"src_ip":"10.0.0.1"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d", w.Code)
+	}
+}
+
+func TestUploadBatchProtobuf(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	h := NewHandlers(store)
+	r := gin.New()
+	r.POST("/api/v1/upload/batch", h.UploadBatch)
+
+	logs := []*model.TrafficLog{
+		{SrcIP: "10.0.0.2", SrcPort: 40000, DstIP: "10.0.0.1", DstPort: 80, PID: 7, HTTPMethod: "GET", HTTPPath: "/pb", StatusCode: 200},
+		{SrcIP: "10.0.0.2", SrcPort: 0, DstIP: "10.0.0.1", DstPort: 80, HTTPMethod: "GET", HTTPPath: "/bad-port", StatusCode: 200},
+	}
+	body, err := wire.Compress(wire.EncodingZstd, wire.Marshal(logs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload/batch", bytes.NewReader(body))
+	req.Header.Set("Content-Type", wire.ContentTypeProtobuf)
+	req.Header.Set("Content-Encoding", wire.EncodingZstd)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	if len(store.inserted) != 1 || store.inserted[0].PID != 7 || store.inserted[0].HTTPPath != "/pb" {
+		t.Fatalf("inserted=%+v", store.inserted)
+	}
+}
+
+func TestUploadBadEncoding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewHandlers(&fakeStore{})
+	r := gin.New()
+	r.POST("/api/v1/upload", h.Upload)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload", strings.NewReader("{}"))
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d", w.Code)
+	}
+}
+
+// BenchmarkUploadBatch 对比同一批 200 条记录经 JSON 与二进制格式上报时 handler 的吞吐。
+func BenchmarkUploadBatch(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+	logs := make([]*model.TrafficLog, 0, 200)
+	for i := 0; i < 200; i++ {
+		logs = append(logs, &model.TrafficLog{
+			Timestamp:  time.Now(),
+			SrcIP:      "10.244.1.7",
+			SrcPort:    30000 + i,
+			DstIP:      "10.96.0.10",
+			DstPort:    80,
+			PID:        1234,
+			HTTPMethod: "GET",
+			HTTPPath:   fmt.Sprintf("/api/v1/users/%d", i),
+			StatusCode: 200,
+			LatencyMS:  12,
+			PacketSize: 640,
+		})
+	}
+	jsonBody, _ := json.Marshal(logs)
+	pbBody := wire.Marshal(logs)
+	zstdBody, _ := wire.Compress(wire.EncodingZstd, pbBody)
+
+	cases := []struct {
+		name        string
+		body        []byte
+		contentType string
+		encoding    string
+	}{
+		{"json", jsonBody, wire.ContentTypeJSON, ""},
+		{"protobuf", pbBody, wire.ContentTypeProtobuf, ""},
+		{"protobuf+zstd", zstdBody, wire.ContentTypeProtobuf, wire.EncodingZstd},
+	}
+	for _, tc := range cases {
+		b.Run(tc.name, func(b *testing.B) {
+			h := NewHandlers(&discardStore{})
+			r := gin.New()
+			r.POST("/api/v1/upload/batch", h.UploadBatch)
+			b.ReportAllocs()
+			b.SetBytes(int64(len(tc.body)))
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/api/v1/upload/batch", bytes.NewReader(tc.body))
+				req.Header.Set("Content-Type", tc.contentType)
+				if tc.encoding != "" {
+					req.Header.Set("Content-Encoding", tc.encoding)
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					b.Fatalf("status=%d", w.Code)
+				}
+			}
+			b.ReportMetric(float64(b.N*len(logs))/b.Elapsed().Seconds(), "records/s")
+		})
+	}
+}
+
+// discardStore 丢弃写入，避免基准测试中 fakeStore 的切片不断增长。
+type discardStore struct{ fakeStore }
+
+func (d *discardStore) Insert(ctx context.Context, logEntry *model.TrafficLog) error {
+	return nil
+}
+
+func TestUploadBatchNormalizesPath(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	paths, err := pathnorm.New([]string{"/static/**"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandlers(store, WithNormalizer(paths))
+	r := gin.New()
+	r.POST("/api/v1/upload/batch", h.UploadBatch)
+
+	body := `[
+		{"src_ip":"10.0.0.2","src_port":40000,"dst_ip":"10.0.0.1","dst_port":80,"http_method":"GET","http_path":"/users/42?tab=orders","status_code":200},
+		{"src_ip":"10.0.0.2","src_port":40001,"dst_ip":"10.0.0.1","dst_port":80,"http_method":"GET","http_path":"/static/js/app.js","status_code":200}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	if len(store.inserted) != 2 {
+		t.Fatalf("inserted=%+v", store.inserted)
+	}
+	if got := store.inserted[0]; got.HTTPPath != "/users/42" || got.HTTPQuery != "tab=orders" || got.HTTPRoute != "/users/{id}" {
+		t.Errorf("inserted[0]=%+v", got)
+	}
+	if got := store.inserted[1]; got.HTTPRoute != "/static/**" {
+		t.Errorf("inserted[1]=%+v", got)
+	}
+}
+
+func TestTail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := tail.NewHub()
+	h := NewHandlers(&fakeStore{}, WithTail(hub))
+	r := gin.New()
+	r.POST("/api/v1/upload/batch", h.UploadBatch)
+	r.GET("/api/v1/tail", h.Tail)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/tail?status=5xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status=%d content-type=%s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	body := `[
+		{"src_ip":"10.0.0.2","src_port":40000,"dst_ip":"10.0.0.1","dst_port":80,"http_method":"GET","http_path":"/ok","status_code":200},
+		{"src_ip":"10.0.0.2","src_port":40001,"dst_ip":"10.0.0.1","dst_port":80,"http_method":"GET","http_path":"/boom","status_code":502}
+	]`
+	up, err := http.Post(srv.URL+"/api/v1/upload/batch", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	up.Body.Close()
+
+	sc := bufio.NewScanner(resp.Body)
+	var event, data string
+	for sc.Scan() && data == "" {
+		line := sc.Text()
+		if v, ok := strings.CutPrefix(line, "event:"); ok {
+			event = v
+		}
+		if v, ok := strings.CutPrefix(line, "data:"); ok {
+			data = v
+		}
+	}
+	var got model.TrafficLog
+	if err := json.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatalf("data=%q err=%v", data, err)
+	}
+	if event != "log" || got.HTTPPath != "/boom" || got.HTTPRoute != "/boom" {
+		t.Errorf("event=%q log=%+v", event, got)
+	}
+
+	// server 退出时关闭订阅，推送连接随之结束。
+	hub.Close()
+	for sc.Scan() {
+	}
+	if hub.Subscribers() != 0 {
+		t.Errorf("subscribers=%d", hub.Subscribers())
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tail", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("closed hub: status=%d", w.Code)
+	}
+}
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lightobs/internal/server/storage"
+	"lightobs/pkg/model"
+	"lightobs/pkg/wire"
+)
+
+// importBatchSize 是导入时每批写入的条数。
+const importBatchSize = 1000
+
+// maxImportErrors 是导入响应中最多列出的被拒绝行，rejected 仍为总数。
+const maxImportErrors = 100
+
+// maxImportLine 是 NDJSON 单行的长度上限。
+const maxImportLine = 1 << 20
+
+// maxParquetBytes 是 parquet 导入落到临时文件的（解压后）大小上限，防止占满磁盘。
+var maxParquetBytes int64 = 1 << 30
+
+type importReject struct {
+	// Row 为行号：NDJSON 与 CSV 为文件中的行号（CSV 表头为第 1 行），Parquet 为从 1 开始的记录序号。
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// errImportFormat 表示文件本身无法解析（而不是某一行非法），导入在此处停止。
+var errImportFormat = errors.New("文件格式错误")
+
+// errImportTooLarge 表示 parquet 文件超过 maxParquetBytes。
+var errImportTooLarge = errors.New("文件过大")
+
+// Import 导入历史数据，请求体为 format=ndjson（默认）/ csv / parquet 格式的文件，
+// 支持 Content-Encoding: gzip/zstd。列与 /export 相同，CSV 按表头匹配列名。
+// 每行的校验规则与 Upload 相同：非法行记入 errors 并跳过，其余按批写入；导入的记录不推送给 /tail。
+// 响应为 {"accepted": n, "rejected": n, "errors": [{"row": 行号, "error": "..."}]}，errors 最多列出 100 条。
+// 文件无法继续解析时返回 400，parquet 文件超过大小上限返回 413，写库等其他失败返回 500，此前已写入的条数见 accepted。
+func (h *Handlers) Import(c *gin.Context) {
+	format, err := storage.ParseExportFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if format == storage.ExportParquet && h.parquet == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "当前服务不支持导入 parquet（请改用 csv / ndjson）"})
+		return
+	}
+	body, err := wire.NewReader(c.GetHeader("Content-Encoding"), c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求体解压失败：" + err.Error()})
+		return
+	}
+	defer body.Close()
+
+	im := &importer{ctx: c.Request.Context(), h: h, errors: make([]importReject, 0)}
+	switch format {
+	case storage.ExportCSV:
+		err = readCSV(body, im.add)
+	case storage.ExportParquet:
+		err = readParquet(im.ctx, h.parquet, body, im.add)
+	default:
+		err = readNDJSON(body, im.add)
+	}
+	if err == nil {
+		err = im.flush()
+	}
+
+	resp := gin.H{"accepted": im.accepted, "rejected": im.rejected, "errors": im.errors}
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, resp)
+	case errors.Is(err, errImportFormat):
+		resp["error"] = err.Error()
+		c.JSON(http.StatusBadRequest, resp)
+	case errors.Is(err, errImportTooLarge):
+		resp["error"] = err.Error()
+		c.JSON(http.StatusRequestEntityTooLarge, resp)
+	default:
+		resp["error"] = err.Error()
+		c.JSON(http.StatusInternalServerError, resp)
+	}
+}
+
+// importer 校验解析出的记录并按批写入。
+type importer struct {
+	ctx      context.Context
+	h        *Handlers
+	batch    []model.TrafficLog
+	accepted int
+	rejected int
+	errors   []importReject
+}
+
+// add 处理一行：err 为该行的解析错误。返回错误表示写库失败，导入随之停止。
+func (im *importer) add(row int, l *model.TrafficLog, err error) error {
+	if err == nil {
+		err = validateLog(l)
+	}
+	if err != nil {
+		im.h.metrics.reject(ingestImport, rejectReason(err), 1)
+		im.rejected++
+		if len(im.errors) < maxImportErrors {
+			im.errors = append(im.errors, importReject{Row: row, Error: err.Error()})
+		}
+		return nil
+	}
+	im.h.paths.Apply(l)
+	im.batch = append(im.batch, *l)
+	if len(im.batch) >= importBatchSize {
+		return im.flush()
+	}
+	return nil
+}
+
+// flush 把当前批直接写入 store：导入本身已按批组织，不经过上报用的写缓冲。
+func (im *importer) flush() error {
+	if err := im.h.inserter.InsertBatch(im.ctx, im.batch); err != nil {
+		im.h.metrics.reject(ingestImport, rejectStoreError, len(im.batch))
+		return fmt.Errorf("写入数据库失败：%w", err)
+	}
+	im.h.metrics.accept(ingestImport, im.batch)
+	im.accepted += len(im.batch)
+	im.batch = im.batch[:0]
+	return nil
+}
+
+type importFunc func(row int, l *model.TrafficLog, err error) error
+
+func readNDJSON(r io.Reader, fn importFunc) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxImportLine)
+	for line := 1; sc.Scan(); line++ {
+		b := sc.Bytes()
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+		var l model.TrafficLog
+		var perr error
+		if err := json.Unmarshal(b, &l); err != nil {
+			perr = fmt.Errorf("JSON 解析失败：%w", err)
+		}
+		if err := fn(line, &l, perr); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("%w：%v", errImportFormat, err)
+	}
+	return nil
+}
+
+func readCSV(r io.Reader, fn importFunc) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w：读取 CSV 表头失败：%v", errImportFormat, err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	known := 0
+	for _, name := range storage.ExportColumns {
+		if _, ok := cols[name]; ok {
+			known++
+		}
+	}
+	if known == 0 {
+		return fmt.Errorf("%w：CSV 表头中没有可识别的列（如 %s）", errImportFormat, strings.Join(storage.ExportColumns[:4], ", "))
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w：%v", errImportFormat, err)
+		}
+		line, _ := cr.FieldPos(0)
+		l, perr := parseCSVLog(cols, record)
+		if err := fn(line, &l, perr); err != nil {
+			return err
+		}
+	}
+}
+
+// parseCSVLog 按表头把一行转换为 TrafficLog，缺少的列或空值按零值处理。
+func parseCSVLog(cols map[string]int, record []string) (model.TrafficLog, error) {
+	var l model.TrafficLog
+	field := func(name string) string {
+		if i, ok := cols[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	if raw := field("timestamp"); raw != "" {
+		ts, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return l, fmt.Errorf("timestamp 非法：%s", raw)
+		}
+		l.Timestamp = ts
+	}
+	l.SrcIP, l.DstIP = field("src_ip"), field("dst_ip")
+	l.HTTPMethod, l.HTTPPath = field("http_method"), field("http_path")
+	l.HTTPQuery, l.HTTPRoute = field("http_query"), field("http_route")
+
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"src_port", &l.SrcPort}, {"dst_port", &l.DstPort}, {"pid", &l.PID},
+		{"status_code", &l.StatusCode}, {"packet_size", &l.PacketSize},
+	}
+	for _, f := range ints {
+		if raw := field(f.name); raw != "" {
+			v, err := strconv.Atoi(raw)
+			if err != nil {
+				return l, fmt.Errorf("%s 非法：%s", f.name, raw)
+			}
+			*f.dst = v
+		}
+	}
+	if raw := field("latency_ms"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return l, fmt.Errorf("latency_ms 非法：%s", raw)
+		}
+		l.LatencyMS = v
+	}
+	return l, nil
+}
+
+// readParquet 先把请求体落到临时文件（Parquet 需要随机读取文件尾部的元数据），再逐行读取。
+// 临时文件最多写入 maxParquetBytes，超出时停止接收。
+func readParquet(ctx context.Context, pr storage.ParquetReader, r io.Reader, fn importFunc) error {
+	tmp, err := os.CreateTemp("", "lightobs-import-*.parquet")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败：%w", err)
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, io.LimitReader(r, maxParquetBytes+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("%w：接收文件失败：%v", errImportFormat, err)
+	}
+	if n > maxParquetBytes {
+		return fmt.Errorf("%w：parquet 文件最大 %d MiB", errImportTooLarge, maxParquetBytes>>20)
+	}
+
+	row := 0
+	var fnErr error
+	err = pr.ReadParquet(ctx, tmp.Name(), func(l *model.TrafficLog) error {
+		row++
+		fnErr = fn(row, l, nil)
+		return fnErr
+	})
+	if err != nil && fnErr == nil {
+		return fmt.Errorf("%w：%v", errImportFormat, err)
+	}
+	return err
+}
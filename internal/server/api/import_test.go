@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"lightobs/internal/server/storage"
+	"lightobs/internal/server/storage/duckdb"
+	"lightobs/pkg/model"
+)
+
+var parquetReader = WithParquetReader(storage.ParquetReaderFunc(duckdb.ReadParquet))
+
+type importResult struct {
+	Accepted int            `json:"accepted"`
+	Rejected int            `json:"rejected"`
+	Errors   []importReject `json:"errors"`
+	Error    string         `json:"error"`
+}
+
+func postImport(t *testing.T, store *fakeStore, query string, body []byte, encoding string, opts ...Option) (int, importResult) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/import", NewHandlers(store, opts...).Import)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/import?"+query, bytes.NewReader(body))
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var res importResult
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("body=%s err=%v", w.Body.String(), err)
+	}
+	return w.Code, res
+}
+
+func TestImportNDJSON(t *testing.T) {
+	body := `{"timestamp":"2024-05-01T08:00:00Z","src_ip":"10.0.0.2","src_port":40000,"dst_ip":"10.0.0.1","dst_port":80,"http_method":"GET","http_path":"/users/42?tab=a","status_code":200}
+
+{"src_ip":"bad","src_port":1,"dst_ip":"10.0.0.1","dst_port":80,"http_method":"GET","http_path":"/","status_code":200}
+{"src_ip":
+{"src_ip":"10.0.0.2","src_port":40001,"dst_ip":"10.0.0.1","dst_port":80,"http_method":"GET","http_path":"/b","status_code":500}
+`
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(body))
+	zw.Close()
+
+	store := &fakeStore{}
+	code, res := postImport(t, store, "", gz.Bytes(), "gzip")
+	if code != http.StatusOK || res.Accepted != 2 || res.Rejected != 2 {
+		t.Fatalf("code=%d res=%+v", code, res)
+	}
+	if len(res.Errors) != 2 || res.Errors[0].Row != 3 || res.Errors[1].Row != 4 || !strings.Contains(res.Errors[1].Error, "JSON") {
+		t.Errorf("errors=%+v", res.Errors)
+	}
+	if len(store.inserted) != 2 || store.inserted[0].HTTPPath != "/users/42" || store.inserted[0].HTTPRoute != "/users/{id}" {
+		t.Errorf("inserted=%+v", store.inserted)
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	// 列顺序与导出不同、缺少部分列时按表头匹配。
+	var b strings.Builder
+	b.WriteString("status_code,http_path,http_method,dst_port,dst_ip,src_port,src_ip,timestamp\n")
+	for i := 0; i < importBatchSize+5; i++ {
+		fmt.Fprintf(&b, "200,/p/%d,GET,80,10.0.0.1,40000,10.0.0.2,2024-05-01T08:00:00Z\n", i)
+	}
+	b.WriteString("abc,/x,GET,80,10.0.0.1,40000,10.0.0.2,\n")
+	b.WriteString("200,/x,GET,80,10.0.0.1,40000,10.0.0.2,yesterday\n")
+
+	store := &fakeStore{}
+	code, res := postImport(t, store, "format=csv", []byte(b.String()), "")
+	if code != http.StatusOK || res.Accepted != importBatchSize+5 || res.Rejected != 2 {
+		t.Fatalf("code=%d res=%+v", code, res)
+	}
+	if res.Errors[0].Row != importBatchSize+7 || !strings.Contains(res.Errors[0].Error, "status_code") ||
+		!strings.Contains(res.Errors[1].Error, "timestamp") {
+		t.Errorf("errors=%+v", res.Errors)
+	}
+	if len(store.inserted) != importBatchSize+5 || store.inserted[3].HTTPPath != "/p/3" || store.inserted[3].Timestamp.IsZero() {
+		t.Errorf("inserted[3]=%+v", store.inserted[3])
+	}
+
+	code, res = postImport(t, &fakeStore{}, "format=csv", []byte("a,b\n1,2\n"), "")
+	if code != http.StatusBadRequest || res.Error == "" {
+		t.Errorf("unknown header: code=%d res=%+v", code, res)
+	}
+	code, _ = postImport(t, &fakeStore{}, "format=xml", nil, "")
+	if code != http.StatusBadRequest {
+		t.Errorf("bad format: code=%d", code)
+	}
+}
+
+func TestImportParquet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.parquet")
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// 没有 pid、http_query、http_route 列的文件同样可以导入。
+	_, err = db.ExecContext(context.Background(), `COPY (
+	SELECT TIMESTAMP '2024-05-01 08:00:00' AS timestamp, '10.0.0.2' AS src_ip, 40000 AS src_port,
+		'10.0.0.1' AS dst_ip, 80 AS dst_port, 'GET' AS http_method, '/users/7' AS http_path,
+		200 AS status_code, 12 AS latency_ms, 300 AS packet_size, 'x' AS extra
+	UNION ALL
+	SELECT TIMESTAMP '2024-05-01 08:00:01', '10.0.0.2', 0, '10.0.0.1', 80, 'GET', '/', 200, 1, 1, 'y'
+) TO '`+path+`' (FORMAT PARQUET)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &fakeStore{}
+	code, res := postImport(t, store, "format=parquet", data, "", parquetReader)
+	if code != http.StatusOK || res.Accepted != 1 || res.Rejected != 1 || res.Errors[0].Row != 2 {
+		t.Fatalf("code=%d res=%+v", code, res)
+	}
+	want := model.TrafficLog{
+		Timestamp: store.inserted[0].Timestamp, SrcIP: "10.0.0.2", SrcPort: 40000, DstIP: "10.0.0.1", DstPort: 80,
+		HTTPMethod: "GET", HTTPPath: "/users/7", HTTPRoute: "/users/{id}", StatusCode: 200, LatencyMS: 12, PacketSize: 300,
+	}
+	if store.inserted[0] != want || store.inserted[0].Timestamp.Unix() != 1714550400 {
+		t.Errorf("inserted=%+v", store.inserted[0])
+	}
+
+	code, res = postImport(t, &fakeStore{}, "format=parquet", []byte("not parquet"), "", parquetReader)
+	if code != http.StatusBadRequest || res.Error == "" {
+		t.Errorf("invalid parquet: code=%d res=%+v", code, res)
+	}
+
+	code, res = postImport(t, &fakeStore{}, "format=parquet", data, "")
+	if code != http.StatusBadRequest || !strings.Contains(res.Error, "不支持") {
+		t.Errorf("no reader: code=%d res=%+v", code, res)
+	}
+
+	defer func(n int64) { maxParquetBytes = n }(maxParquetBytes)
+	maxParquetBytes = int64(len(data) - 1)
+	store = &fakeStore{}
+	code, res = postImport(t, store, "format=parquet", data, "", parquetReader)
+	if code != http.StatusRequestEntityTooLarge || len(store.inserted) != 0 {
+		t.Errorf("too large: code=%d res=%+v", code, res)
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"lightobs/internal/server/metrics"
+	"lightobs/internal/server/writebuf"
+	"lightobs/pkg/model"
+)
+
+// 上报入口，作为 ingest 指标的 endpoint 标签。
+const (
+	ingestUpload      = "upload"
+	ingestUploadBatch = "upload_batch"
+	ingestImport      = "import"
+)
+
+// 记录被拒绝的原因，作为 ingest 指标的 reason 标签。请求体无法解析时整个请求按 1 条计。
+const (
+	rejectDecode       = "decode"
+	rejectTooLarge     = "too_large"
+	rejectInvalidAddr  = "invalid_addr"
+	rejectInvalidPort  = "invalid_port"
+	rejectMissingField = "missing_field"
+	rejectStoreError   = "store_error"
+)
+
+// insertBuckets 是写库耗时直方图的上界（秒）。
+var insertBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// queryBuckets 是查询耗时直方图的上界（秒）。
+var queryBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Metrics 是 API 层记录的 server 自身指标。nil Metrics 上的方法均为空操作。
+type Metrics struct {
+	accepted *prometheus.CounterVec
+	rejected *prometheus.CounterVec
+	insert   *prometheus.HistogramVec
+	query    *prometheus.HistogramVec
+	// red 为 nil 表示不输出按接口划分的 RED 指标。
+	red *metrics.RED
+}
+
+// NewMetrics 在 reg 中注册 ingest、写库与查询指标；red 非空时写入成功的记录同时计入 RED 指标。
+func NewMetrics(reg prometheus.Registerer, red *metrics.RED) *Metrics {
+	f := promauto.With(reg)
+	return &Metrics{
+		accepted: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "lightobs_ingest_accepted_total", Help: "写入成功的上报记录数。"}, []string{"endpoint"}),
+		rejected: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "lightobs_ingest_rejected_total", Help: "被拒绝的上报记录数，按原因区分。"}, []string{"endpoint", "reason"}),
+		insert: f.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "lightobs_store_insert_duration_seconds", Help: "每次批量写库的耗时（秒）。", Buckets: insertBuckets}, []string{"result"}),
+		query: f.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "lightobs_query_duration_seconds", Help: "查询接口的处理耗时（秒）。", Buckets: queryBuckets}, []string{"handler", "code"}),
+		red: red,
+	}
+}
+
+// WithMetrics 让 Handlers 记录 ingest 与写库指标。
+func WithMetrics(m *Metrics) Option {
+	return func(h *Handlers) {
+		h.metrics = m
+	}
+}
+
+// accept 记录写入成功的记录。导入的历史数据不计入 RED 指标，与不推送给 /tail 的原因相同。
+func (m *Metrics) accept(endpoint string, logs []model.TrafficLog) {
+	if m == nil || len(logs) == 0 {
+		return
+	}
+	m.accepted.WithLabelValues(endpoint).Add(float64(len(logs)))
+	if endpoint != ingestImport {
+		m.red.Observe(logs...)
+	}
+}
+
+func (m *Metrics) reject(endpoint, reason string, n int) {
+	if m == nil || n == 0 {
+		return
+	}
+	m.rejected.WithLabelValues(endpoint, reason).Add(float64(n))
+}
+
+// rejectReason 把校验错误归类为 reason 标签。
+func rejectReason(err error) string {
+	switch {
+	case errors.Is(err, errInvalidAddr):
+		return rejectInvalidAddr
+	case errors.Is(err, errInvalidPort):
+		return rejectInvalidPort
+	case errors.Is(err, errMissingField):
+		return rejectMissingField
+	default:
+		return rejectDecode
+	}
+}
+
+// TimeInserts 返回记录每次写库耗时的 w；m 为 nil 时原样返回 w。
+// 写缓冲应包装在它外面，这样统计的是实际的写库耗时而不是排队时间。
+func (m *Metrics) TimeInserts(w writebuf.BatchInserter) writebuf.BatchInserter {
+	if m == nil {
+		return w
+	}
+	return &timedInserter{next: w, hist: m.insert}
+}
+
+type timedInserter struct {
+	next writebuf.BatchInserter
+	hist *prometheus.HistogramVec
+}
+
+func (t *timedInserter) InsertBatch(ctx context.Context, logs []model.TrafficLog) error {
+	if len(logs) == 0 {
+		return t.next.InsertBatch(ctx, logs)
+	}
+	start := time.Now()
+	err := t.next.InsertBatch(ctx, logs)
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	t.hist.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// ObserveQuery 返回记录查询耗时的中间件，handler 标签为路由模板（如 /api/v1/search）。
+// /tail 这类长连接不应使用。
+func (m *Metrics) ObserveQuery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m == nil {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		c.Next()
+		m.query.WithLabelValues(c.FullPath(), statusClass(c.Writer.Status())).Observe(time.Since(start).Seconds())
+	}
+}
+
+// statusClass 把状态码归为 2xx、4xx 等，控制标签基数。
+func statusClass(code int) string {
+	return strconv.Itoa(code/100) + "xx"
+}
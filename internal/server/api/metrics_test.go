@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"lightobs/internal/server/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reg := prometheus.NewRegistry()
+	m := NewMetrics(reg, metrics.NewRED(reg, 0))
+	store := &fakeStore{}
+	h := NewHandlers(store, WithMetrics(m))
+	r := gin.New()
+	r.POST("/api/v1/upload", h.Upload)
+	r.POST("/api/v1/upload/batch", h.UploadBatch)
+	r.POST("/api/v1/import", h.Import)
+	r.GET("/api/v1/alerts", m.ObserveQuery(), h.Alerts)
+
+	post := func(path, body string) int {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	one := `{"src_ip":"10.0.0.2","src_port":40000,"dst_ip":"10.0.0.1","dst_port":80,"http_method":"GET","http_path":"/a","status_code":200}`
+	badPort := strings.Replace(one, `"src_port":40000`, `"src_port":0`, 1)
+	noMethod := strings.Replace(one, `"http_method":"GET"`, `"http_method":""`, 1)
+	badAddr := strings.Replace(one, `"src_ip":"10.0.0.2"`, `"src_ip":"bad"`, 1)
+
+	for _, tc := range []struct {
+		path, body string
+		code       int
+	}{
+		{"/api/v1/upload", one, http.StatusNoContent},
+		{"/api/v1/upload", badPort, http.StatusBadRequest},
+		{"/api/v1/upload", "{", http.StatusBadRequest},
+		{"/api/v1/upload/batch", "[" + one + "," + noMethod + "," + badAddr + "," + one + "]", http.StatusOK},
+		{"/api/v1/upload/batch", "not json", http.StatusBadRequest},
+		{"/api/v1/import", one + "\n" + badAddr + "\n", http.StatusOK},
+	} {
+		if code := post(tc.path, tc.body); code != tc.code {
+			t.Fatalf("%s %s: code=%d, want %d", tc.path, tc.body, code, tc.code)
+		}
+	}
+	store.insertErr = errors.New("disk full")
+	if code := post("/api/v1/upload/batch", "["+one+","+one+"]"); code != http.StatusInternalServerError {
+		t.Fatalf("insert error: code=%d", code)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/alerts", nil))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/alerts?state=x", nil))
+
+	w = httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	out := w.Body.String()
+	for _, want := range []string{
+		`lightobs_ingest_accepted_total{endpoint="import"} 1`,
+		`lightobs_ingest_accepted_total{endpoint="upload"} 1`,
+		`lightobs_ingest_accepted_total{endpoint="upload_batch"} 2`,
+		`lightobs_ingest_rejected_total{endpoint="import",reason="invalid_addr"} 1`,
+		`lightobs_ingest_rejected_total{endpoint="upload",reason="decode"} 1`,
+		`lightobs_ingest_rejected_total{endpoint="upload",reason="invalid_port"} 1`,
+		`lightobs_ingest_rejected_total{endpoint="upload_batch",reason="decode"} 1`,
+		`lightobs_ingest_rejected_total{endpoint="upload_batch",reason="invalid_addr"} 1`,
+		`lightobs_ingest_rejected_total{endpoint="upload_batch",reason="missing_field"} 1`,
+		`lightobs_ingest_rejected_total{endpoint="upload_batch",reason="store_error"} 2`,
+		`lightobs_store_insert_duration_seconds_count{result="ok"} 3`,
+		`lightobs_store_insert_duration_seconds_count{result="error"} 1`,
+		`lightobs_query_duration_seconds_count{code="2xx",handler="/api/v1/alerts"} 1`,
+		`lightobs_query_duration_seconds_count{code="4xx",handler="/api/v1/alerts"} 1`,
+		// 导入的历史数据不计入 RED。
+		`lightobs_red_requests_total{dst="10.0.0.1:80",method="GET",route="/a"} 3`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lightobs/internal/server/storage"
+)
+
+// maxSearchLimit 是 /search 单次返回条数上限。
+const maxSearchLimit = 5000
+
+// Search 是通用查询接口，参数之间按 AND 组合：
+//
+//	from/to       RFC3339、Unix 秒、now 或相对时间（-15m、-2h、-7d）
+//	ip/src_ip/dst_ip, src_port/dst_port, pid
+//	method        HTTP 方法，不区分大小写
+//	path          原始路径前缀匹配；含 * ? [ 时按 glob 匹配
+//	route         路由模板精确匹配，如 /users/{id}
+//	status        逗号分隔的状态码或类别，如 404,5xx
+//	min_latency/max_latency  毫秒
+//	sort          timestamp（默认）/ latency / status；order=asc|desc（默认 desc）
+//	limit         默认 200，最大 5000
+//	cursor        上一页响应中的 next_cursor，须与本次的 sort/order 一致
+//
+// 响应为 {"items": [...], "count": n, "next_cursor": "..."}，没有更多数据时不返回 next_cursor。
+func (h *Handlers) Search(c *gin.Context) {
+	f, err := parseFilter(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := h.store.Query(c.Request.Context(), f)
+	if errors.Is(err, storage.ErrCursorMismatch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败：" + err.Error()})
+		return
+	}
+	resp := gin.H{"items": page.Items, "count": len(page.Items)}
+	if page.Next != nil {
+		resp["next_cursor"] = page.Next.Encode()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func parseFilter(c *gin.Context, now time.Time) (storage.Filter, error) {
+	f, err := parseConditions(c, now)
+	if err != nil {
+		return f, err
+	}
+
+	if f.Sort, err = storage.ParseSortField(c.Query("sort")); err != nil {
+		return f, err
+	}
+	switch strings.ToLower(c.Query("order")) {
+	case "", "desc":
+	case "asc":
+		f.Asc = true
+	default:
+		return f, fmt.Errorf("order 参数非法（可选 asc / desc）")
+	}
+
+	f.Limit = storage.DefaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 || v > maxSearchLimit {
+			return f, fmt.Errorf("limit 参数非法（1-%d）", maxSearchLimit)
+		}
+		f.Limit = v
+	}
+	if raw := c.Query("cursor"); raw != "" {
+		if f.After, err = storage.DecodeCursor(raw); err != nil {
+			return f, err
+		}
+		if !f.After.Matches(f) {
+			return f, storage.ErrCursorMismatch
+		}
+	}
+	return f, nil
+}
+
+// parseConditions 解析时间范围与过滤条件，/search、/stats 等接口共用。
+func parseConditions(c *gin.Context, now time.Time) (storage.Filter, error) {
+	var (
+		f   storage.Filter
+		err error
+	)
+	if f.From, err = parseTime(c.Query("from"), now); err != nil {
+		return f, fmt.Errorf("from 参数非法：%w", err)
+	}
+	if f.To, err = parseTime(c.Query("to"), now); err != nil {
+		return f, fmt.Errorf("to 参数非法：%w", err)
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return f, fmt.Errorf("from 必须早于 to")
+	}
+
+	for name, dst := range map[string]*string{"ip": &f.IP, "src_ip": &f.SrcIP, "dst_ip": &f.DstIP} {
+		if raw := c.Query(name); raw != "" {
+			if net.ParseIP(raw) == nil {
+				return f, fmt.Errorf("%s 参数非法", name)
+			}
+			*dst = raw
+		}
+	}
+	for name, dst := range map[string]*int{"src_port": &f.SrcPort, "dst_port": &f.DstPort} {
+		if raw := c.Query(name); raw != "" {
+			v, err := strconv.Atoi(raw)
+			if err != nil || !validPort(v) {
+				return f, fmt.Errorf("%s 参数非法", name)
+			}
+			*dst = v
+		}
+	}
+	if raw := c.Query("pid"); raw != "" {
+		if f.PID, err = strconv.Atoi(raw); err != nil || f.PID <= 0 {
+			return f, fmt.Errorf("pid 参数非法")
+		}
+	}
+
+	f.Method = strings.ToUpper(c.Query("method"))
+	f.Path = c.Query("path")
+	f.Route = c.Query("route")
+
+	if f.Status, err = parseStatus(c.Query("status")); err != nil {
+		return f, err
+	}
+	for name, dst := range map[string]*int64{"min_latency": &f.MinLatencyMS, "max_latency": &f.MaxLatencyMS} {
+		if raw := c.Query(name); raw != "" {
+			if *dst, err = strconv.ParseInt(raw, 10, 64); err != nil || *dst < 0 {
+				return f, fmt.Errorf("%s 参数非法", name)
+			}
+		}
+	}
+	return f, nil
+}
+
+// parseTime 解析绝对或相对时间，空串返回零值表示不限制。
+func parseTime(raw string, now time.Time) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	switch {
+	case raw == "":
+		return time.Time{}, nil
+	case raw == "now":
+		return now, nil
+	case strings.HasPrefix(raw, "-") || strings.HasPrefix(raw, "now-"):
+		d, err := parseRelative(strings.TrimPrefix(strings.TrimPrefix(raw, "now"), "-"))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return t, nil
+	}
+	if sec, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间：%s", raw)
+}
+
+// parseRelative 在 time.ParseDuration 之上支持天（d）单位，如 7d、1d12h。
+func parseRelative(s string) (time.Duration, error) {
+	var days int
+	if i := strings.IndexByte(s, 'd'); i > 0 {
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, fmt.Errorf("无法解析相对时间：%s", s)
+		}
+		days, s = n, s[i+1:]
+	}
+	var d time.Duration
+	if s != "" {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("无法解析相对时间：%s", s)
+		}
+	}
+	d += time.Duration(days) * 24 * time.Hour
+	if d <= 0 {
+		return 0, fmt.Errorf("相对时间必须大于 0")
+	}
+	return d, nil
+}
+
+// parseStatus 解析 "200,404,5xx" 这类状态码条件。
+func parseStatus(raw string) ([]storage.StatusRange, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var out []storage.StatusRange
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if len(part) == 3 && strings.HasSuffix(part, "xx") && part[0] >= '1' && part[0] <= '5' {
+			base := int(part[0]-'0') * 100
+			out = append(out, storage.StatusRange{Min: base, Max: base + 99})
+			continue
+		}
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("status 参数非法：%s", part)
+		}
+		out = append(out, storage.StatusRange{Min: code, Max: code})
+	}
+	return out, nil
+}
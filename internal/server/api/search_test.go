@@ -0,0 +1,351 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lightobs/internal/server/storage"
+	"lightobs/pkg/model"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Time{
+		"":                     {},
+		"now":                  now,
+		"-15m":                 now.Add(-15 * time.Minute),
+		"now-2h":               now.Add(-2 * time.Hour),
+		"-1d12h":               now.Add(-36 * time.Hour),
+		"2024-04-30T08:00:00Z": time.Date(2024, 4, 30, 8, 0, 0, 0, time.UTC),
+		"1714500000":           time.Unix(1714500000, 0),
+	}
+	for raw, want := range cases {
+		got, err := parseTime(raw, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseTime(%q)=%v,%v want %v", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"-", "-0m", "yesterday", "-xd"} {
+		if _, err := parseTime(raw, now); err == nil {
+			t.Errorf("parseTime(%q) expected error", raw)
+		}
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	got, err := parseStatus("404, 5xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []storage.StatusRange{{Min: 404, Max: 404}, {Min: 500, Max: 599}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v want %+v", got, want)
+	}
+	for _, raw := range []string{"6xx", "abc", "99"} {
+		if _, err := parseStatus(raw); err == nil {
+			t.Errorf("parseStatus(%q) expected error", raw)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var got storage.Filter
+	store := &fakeStore{
+		query: func(ctx context.Context, f storage.Filter) (storage.Page, error) {
+			got = f
+			return storage.Page{Items: []model.TrafficLog{{PID: 7}}}, nil
+		},
+	}
+	r := gin.New()
+	r.GET("/api/v1/search", NewHandlers(store).Search)
+
+	req := httptest.NewRequest(http.MethodGet,
+		"/api/v1/search?from=-15m&method=get&path=/api/*&status=5xx&min_latency=100&dst_port=80&pid=7&sort=latency&order=asc&limit=10", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Items      []model.TrafficLog `json:"items"`
+		Count      int                `json:"count"`
+		NextCursor *string            `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Count != 1 || resp.Items[0].PID != 7 {
+		t.Fatalf("resp=%+v err=%v", resp, err)
+	}
+	if resp.NextCursor != nil {
+		t.Errorf("last page should not carry next_cursor")
+	}
+	if got.From.IsZero() || time.Since(got.From) < 14*time.Minute {
+		t.Errorf("from=%v", got.From)
+	}
+	got.From = time.Time{}
+	want := storage.Filter{
+		DstPort:      80,
+		PID:          7,
+		Method:       "GET",
+		Path:         "/api/*",
+		Status:       []storage.StatusRange{{Min: 500, Max: 599}},
+		MinLatencyMS: 100,
+		Sort:         storage.SortLatency,
+		Asc:          true,
+		Limit:        10,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filter=%+v\nwant   %+v", got, want)
+	}
+}
+
+func TestSearchBadParams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/v1/search", NewHandlers(&fakeStore{}).Search)
+	for _, q := range []string{
+		"ip=bad", "src_port=70000", "pid=-1", "status=700", "min_latency=x",
+		"sort=size", "order=up", "limit=0", "from=-1h&to=-2h",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/search?"+q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status=%d", q, w.Code)
+		}
+	}
+}
+
+func TestSearchCursor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	next := &storage.Cursor{Sort: storage.SortLatency, SortValue: 42, Timestamp: time.Unix(1714500000, 0).UTC(), RowID: 9}
+	var got storage.Filter
+	store := &fakeStore{
+		query: func(ctx context.Context, f storage.Filter) (storage.Page, error) {
+			got = f
+			return storage.Page{Items: []model.TrafficLog{{PID: 1}}, Next: next}, nil
+		},
+	}
+	r := gin.New()
+	r.GET("/api/v1/search", NewHandlers(store).Search)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/search?sort=latency", nil))
+	var resp struct {
+		NextCursor string `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.NextCursor == "" {
+		t.Fatalf("body=%s err=%v", w.Body.String(), err)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/search?sort=latency&cursor="+resp.NextCursor, nil))
+	if w.Code != http.StatusOK || got.After == nil || *got.After != *next {
+		t.Fatalf("status=%d after=%+v", w.Code, got.After)
+	}
+
+	for _, q := range []string{"cursor=!!!", "sort=status&cursor=" + resp.NextCursor} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/search?"+q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status=%d", q, w.Code)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var got storage.StatsQuery
+	store := &fakeStore{
+		stats: func(ctx context.Context, q storage.StatsQuery) ([]storage.StatsRow, error) {
+			got = q
+			return []storage.StatsRow{{Group: []string{"10.0.0.9", "80"}, Count: 600, Errors: 6, P99MS: 120}}, nil
+		},
+	}
+	r := gin.New()
+	r.GET("/api/v1/stats", NewHandlers(store).Stats)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"/api/v1/stats?group_by=dst_ip,dst_port&from=2024-05-01T12:00:00Z&to=2024-05-01T12:10:00Z&sort=p99&method=GET", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	if got.Sort != storage.StatsSortP99 || got.Filter.Method != "GET" || len(got.GroupBy) != 2 || got.Limit != storage.DefaultStatsLimit {
+		t.Errorf("query=%+v", got)
+	}
+	var resp struct {
+		Rows []map[string]any `json:"rows"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Rows) != 1 {
+		t.Fatalf("body=%s err=%v", w.Body.String(), err)
+	}
+	row := resp.Rows[0]
+	if row["dst_ip"] != "10.0.0.9" || row["dst_port"] != float64(80) || row["rps"] != float64(1) || row["error_rate"] != 0.01 {
+		t.Errorf("row=%v", row)
+	}
+
+	// 未指定 from 时默认统计最近 15 分钟。
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stats", nil))
+	if w.Code != http.StatusOK || time.Since(got.Filter.From) < defaultStatsWindow {
+		t.Errorf("status=%d from=%v", w.Code, got.Filter.From)
+	}
+
+	for _, q := range []string{"group_by=host", "sort=p95", "limit=5000"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stats?"+q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status=%d", q, w.Code)
+		}
+	}
+}
+
+func TestSeries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var got storage.SeriesQuery
+	store := &fakeStore{
+		series: func(ctx context.Context, q storage.SeriesQuery) ([]storage.SeriesPoint, error) {
+			got = q
+			return []storage.SeriesPoint{
+				{Time: base.Add(10 * time.Second), StatsRow: storage.StatsRow{Group: []string{"80"}, Count: 20, Errors: 5}},
+			}, nil
+		},
+	}
+	r := gin.New()
+	r.GET("/api/v1/series", NewHandlers(store).Series)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"/api/v1/series?from=2024-05-01T12:00:00Z&to=2024-05-01T12:00:30Z&step=10s&group_by=dst_port", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	if got.Step != 10*time.Second || len(got.GroupBy) != 1 {
+		t.Errorf("query=%+v", got)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &rows); err != nil {
+		t.Fatal(err)
+	}
+	// 三个桶，缺失的两个补 0。
+	if len(rows) != 3 {
+		t.Fatalf("rows=%v", rows)
+	}
+	if rows[0]["time"] != "2024-05-01T12:00:00Z" || rows[0]["count"] != float64(0) || rows[0]["dst_port"] != float64(80) {
+		t.Errorf("row0=%v", rows[0])
+	}
+	if rows[1]["count"] != float64(20) || rows[1]["rps"] != float64(2) || rows[1]["error_rate"] != 0.25 {
+		t.Errorf("row1=%v", rows[1])
+	}
+
+	for _, q := range []string{"step=500ms", "step=1500ms", "step=x", "from=-30d&step=1s", "group_by=foo"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/series?"+q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status=%d", q, w.Code)
+		}
+	}
+}
+
+func TestTopology(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var got storage.StatsQuery
+	store := &fakeStore{
+		stats: func(ctx context.Context, q storage.StatsQuery) ([]storage.StatsRow, error) {
+			got = q
+			if len(q.GroupBy) == 2 {
+				return []storage.StatsRow{{Group: []string{"10.0.0.1", "10.0.0.9"}, Count: 60}}, nil
+			}
+			return []storage.StatsRow{
+				{Group: []string{"10.0.0.1", "42", "10.0.0.9", "80"}, Count: 600, Errors: 60, P99MS: 80},
+				{Group: []string{"10.0.0.2", "0", "10.0.0.9", "80"}, Count: 60},
+				{Group: []string{"10.0.0.1", "42", "10.0.0.8", "5432"}, Count: 6},
+			}, nil
+		},
+	}
+	r := gin.New()
+	r.GET("/api/v1/topology", NewHandlers(store).Topology)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"/api/v1/topology?from=2024-05-01T12:00:00Z&to=2024-05-01T12:10:00Z&ip=10.0.0.9", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	if got.Filter.IP != "10.0.0.9" || len(got.GroupBy) != 4 || got.Limit != defaultTopologyEdges {
+		t.Errorf("query=%+v", got)
+	}
+	var resp struct {
+		Nodes []topologyNode `json:"nodes"`
+		Edges []topologyEdge `json:"edges"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, n := range resp.Nodes {
+		ids = append(ids, n.ID)
+	}
+	// 10.0.0.9:80 被两个调用方共享，只出现一次；PID 未知时退回 IP。
+	if strings.Join(ids, ",") != "10.0.0.1/pid:42,10.0.0.9:80,10.0.0.2,10.0.0.8:5432" {
+		t.Errorf("nodes=%v", ids)
+	}
+	if len(resp.Edges) != 3 {
+		t.Fatalf("edges=%+v", resp.Edges)
+	}
+	e := resp.Edges[0]
+	if e.Source != "10.0.0.1/pid:42" || e.Target != "10.0.0.9:80" || e.RPS != 1 || e.ErrorRate != 0.1 || e.P99MS != 80 {
+		t.Errorf("edge=%+v", e)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/topology?by=ip", nil))
+	if w.Code != http.StatusOK || len(got.GroupBy) != 2 || !strings.Contains(w.Body.String(), `"target":"10.0.0.9"`) {
+		t.Errorf("by=ip: status=%d body=%s", w.Code, w.Body.String())
+	}
+
+	for _, q := range []string{"by=pod", "limit=0", "from=x"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/topology?"+q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status=%d", q, w.Code)
+		}
+	}
+}
+
+func TestBuildTopology_Chain(t *testing.T) {
+	rows := []storage.StatsRow{
+		// 10.0.0.1 → 10.0.0.9:80 → 10.0.0.8:5432：10.0.0.9 上只有 pid 7、只监听 80，两端是同一个服务。
+		{Group: []string{"10.0.0.1", "42", "10.0.0.9", "80"}, Count: 10},
+		{Group: []string{"10.0.0.9", "7", "10.0.0.8", "5432"}, Count: 5},
+		// 10.0.0.8 上 PID 未知的调用方就是唯一监听的 5432。
+		{Group: []string{"10.0.0.8", "0", "10.0.0.7", "53"}, Count: 2},
+		// 10.0.0.5 上有两个进程，无法确定谁监听 8080，保持两种节点。
+		{Group: []string{"10.0.0.5", "1", "10.0.0.9", "80"}, Count: 1},
+		{Group: []string{"10.0.0.5", "2", "10.0.0.9", "80"}, Count: 1},
+		{Group: []string{"10.0.0.1", "42", "10.0.0.5", "8080"}, Count: 1},
+	}
+	nodes, edges := buildTopology(topologyByProcess, rows, 1)
+	var ids []string
+	for _, n := range nodes {
+		ids = append(ids, n.ID)
+	}
+	want := "10.0.0.1/pid:42,10.0.0.9/pid:7,10.0.0.8:5432,10.0.0.7:53,10.0.0.5/pid:1,10.0.0.5/pid:2,10.0.0.5:8080"
+	if strings.Join(ids, ",") != want {
+		t.Errorf("nodes=%v, want %s", ids, want)
+	}
+	if edges[0].Target != edges[1].Source || edges[1].Target != edges[2].Source {
+		t.Errorf("chain broken: %+v", edges[:3])
+	}
+	if n := nodes[1]; n.PID != 7 || n.Port != 80 || n.Label != "10.0.0.9:80 (pid 7)" {
+		t.Errorf("service node=%+v", n)
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lightobs/internal/server/storage"
+)
+
+const (
+	// defaultSeriesWindow/defaultSeriesStep 是未指定 from/step 时的默认值。
+	defaultSeriesWindow = time.Hour
+	defaultSeriesStep   = time.Minute
+	// maxSeriesPoints 限制 (桶数 × 分组数)，与 Grafana 默认的最大数据点数量级一致。
+	maxSeriesPoints = 11000
+)
+
+// Series 返回按时间桶聚合的 RED 序列，响应是扁平的 JSON 数组，每个元素一行：
+//
+//	[{"time":"2024-05-01T12:00:00Z","count":10,"errors":1,"error_rate":0.1,"rps":0.17,
+//	  "avg_ms":12.5,"p50_ms":10,"p90_ms":30,"p99_ms":48,"dst_ip":"10.0.0.9"}, ...]
+//
+// Grafana Infinity 数据源可直接解析：time 列选 Time 类型，其余为数值列；分组时按 group_by 中的列拆分序列。
+// 参数：step（如 10s、1m，默认 1m）、group_by（同 /stats），过滤条件同 /search；
+// 未指定 from 时取最近 1 小时。没有数据的桶补 0，保证每条序列的时间点连续。
+func (h *Handlers) Series(c *gin.Context) {
+	now := time.Now()
+	q, err := parseSeriesQuery(c, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	points, err := h.store.Series(c.Request.Context(), q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "时序查询失败：" + err.Error()})
+		return
+	}
+
+	to := q.Filter.To
+	if to.IsZero() {
+		to = now
+	}
+	filled, err := fillSeries(points, q, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	step := q.Step.Seconds()
+	out := make([]gin.H, 0, len(filled))
+	for _, p := range filled {
+		item := gin.H{
+			"time":       p.Time,
+			"count":      p.Count,
+			"errors":     p.Errors,
+			"error_rate": p.ErrorRate(),
+			"rps":        float64(p.Count) / step,
+			"avg_ms":     p.AvgMS,
+			"p50_ms":     p.P50MS,
+			"p90_ms":     p.P90MS,
+			"p99_ms":     p.P99MS,
+		}
+		for i, d := range q.GroupBy {
+			item[string(d)] = dimensionValue(d, p.Group[i])
+		}
+		out = append(out, item)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func parseSeriesQuery(c *gin.Context, now time.Time) (storage.SeriesQuery, error) {
+	var q storage.SeriesQuery
+	f, err := parseConditions(c, now)
+	if err != nil {
+		return q, err
+	}
+	end := f.To
+	if end.IsZero() {
+		end = now
+	}
+	if f.From.IsZero() {
+		f.From = end.Add(-defaultSeriesWindow)
+	}
+	q.Filter = f
+
+	q.Step = defaultSeriesStep
+	if raw := c.Query("step"); raw != "" {
+		if q.Step, err = time.ParseDuration(raw); err != nil || q.Step < time.Second || q.Step%time.Second != 0 {
+			return q, fmt.Errorf("step 参数非法：需为整数秒，如 10s、1m")
+		}
+	}
+	if buckets := end.Sub(f.From) / q.Step; buckets > maxSeriesPoints {
+		return q, fmt.Errorf("时间范围内共 %d 个桶，超过上限 %d，请增大 step", buckets, maxSeriesPoints)
+	}
+	if q.GroupBy, err = storage.ParseDimensions(c.Query("group_by")); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// fillSeries 为每个分组补齐 [from, to) 内缺失的桶（计数为 0），结果按 (时间, 分组) 排列。
+func fillSeries(points []storage.SeriesPoint, q storage.SeriesQuery, to time.Time) ([]storage.SeriesPoint, error) {
+	step := int64(q.StepSeconds())
+	first := q.Filter.From.Unix() / step * step
+	var buckets []int64
+	for b := first; b < to.Unix(); b += step {
+		buckets = append(buckets, b)
+	}
+
+	var groups [][]string
+	byKey := make(map[string]storage.SeriesPoint, len(points))
+	seen := make(map[string]bool)
+	for _, p := range points {
+		g := strings.Join(p.Group, "\x00")
+		if !seen[g] {
+			seen[g] = true
+			groups = append(groups, p.Group)
+		}
+		byKey[fmt.Sprintf("%d\x01%s", p.Time.Unix(), g)] = p
+	}
+	if len(groups) == 0 && len(q.GroupBy) == 0 {
+		groups = [][]string{{}}
+	}
+	if len(buckets)*len(groups) > maxSeriesPoints {
+		return nil, fmt.Errorf("数据点数量 %d 超过上限 %d，请增大 step 或减少分组", len(buckets)*len(groups), maxSeriesPoints)
+	}
+
+	out := make([]storage.SeriesPoint, 0, len(buckets)*len(groups))
+	for _, b := range buckets {
+		for _, g := range groups {
+			if p, ok := byKey[fmt.Sprintf("%d\x01%s", b, strings.Join(g, "\x00"))]; ok {
+				out = append(out, p)
+				continue
+			}
+			out = append(out, storage.SeriesPoint{Time: time.Unix(b, 0).UTC(), StatsRow: storage.StatsRow{Group: g}})
+		}
+	}
+	return out, nil
+}
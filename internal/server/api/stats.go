@@ -0,0 +1,124 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lightobs/internal/server/storage"
+)
+
+// defaultStatsWindow 是未指定 from 时的统计窗口。
+const defaultStatsWindow = 15 * time.Minute
+
+// maxStatsLimit 是 /stats 单次返回的最大组数。
+const maxStatsLimit = 1000
+
+// Stats 返回按维度分组的 RED 指标：
+//
+//	group_by      逗号分隔：src_ip / dst_ip / dst_port / method / path / pid，为空则整体汇总
+//	sort          count（默认）/ errors / error_rate / avg / p50 / p90 / p99，均为降序
+//	limit         默认 100，最大 1000
+//
+// 过滤条件与 /search 相同；未指定 from 时统计最近 15 分钟，rps 按 [from, to) 的时长计算。
+func (h *Handlers) Stats(c *gin.Context) {
+	now := time.Now()
+	q, err := parseStatsQuery(c, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rows, err := h.store.Stats(c.Request.Context(), q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "聚合查询失败：" + err.Error()})
+		return
+	}
+
+	to := q.Filter.To
+	if to.IsZero() {
+		to = now
+	}
+	seconds := to.Sub(q.Filter.From).Seconds()
+
+	out := make([]gin.H, 0, len(rows))
+	for _, r := range rows {
+		item := gin.H{
+			"count":      r.Count,
+			"errors":     r.Errors,
+			"error_rate": r.ErrorRate(),
+			"rps":        float64(r.Count) / seconds,
+			"avg_ms":     r.AvgMS,
+			"p50_ms":     r.P50MS,
+			"p90_ms":     r.P90MS,
+			"p99_ms":     r.P99MS,
+		}
+		for i, d := range q.GroupBy {
+			item[string(d)] = dimensionValue(d, r.Group[i])
+		}
+		out = append(out, item)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":     q.Filter.From,
+		"to":       to,
+		"group_by": q.GroupBy,
+		"rows":     out,
+	})
+}
+
+func parseStatsQuery(c *gin.Context, now time.Time) (storage.StatsQuery, error) {
+	var q storage.StatsQuery
+	f, err := parseWindow(c, now)
+	if err != nil {
+		return q, err
+	}
+	q.Filter = f
+	if q.GroupBy, err = storage.ParseDimensions(c.Query("group_by")); err != nil {
+		return q, err
+	}
+	if q.Sort, err = storage.ParseStatsSort(c.Query("sort")); err != nil {
+		return q, err
+	}
+	q.Limit, err = parseStatsLimit(c, storage.DefaultStatsLimit)
+	return q, err
+}
+
+// parseWindow 解析过滤条件，未指定 from 时取 to（默认当前时间）之前的 15 分钟。
+func parseWindow(c *gin.Context, now time.Time) (storage.Filter, error) {
+	f, err := parseConditions(c, now)
+	if err != nil {
+		return f, err
+	}
+	if f.From.IsZero() {
+		end := f.To
+		if end.IsZero() {
+			end = now
+		}
+		f.From = end.Add(-defaultStatsWindow)
+	}
+	return f, nil
+}
+
+func parseStatsLimit(c *gin.Context, def int) (int, error) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 || v > maxStatsLimit {
+		return 0, fmt.Errorf("limit 参数非法（1-%d）", maxStatsLimit)
+	}
+	return v, nil
+}
+
+// dimensionValue 把整数维度还原为数字，便于 Grafana 等下游按数值处理。
+func dimensionValue(d storage.Dimension, v string) any {
+	if d.Numeric() {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return v
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tailHeartbeat 是空闲时发送 SSE 注释的间隔，避免代理因连接长时间无数据而断开。
+const tailHeartbeat = 15 * time.Second
+
+// Tail 以 Server-Sent Events 推送此后新写入且满足条件的记录，过滤参数与 /search 相同
+// （from/to、sort、limit、cursor 不生效）。事件类型：
+//
+//	log       data 为一条 TrafficLog（JSON）
+//	dropped   客户端消费过慢导致记录被丢弃，data 为 {"dropped": 累计条数}
+//
+// 空闲时每 15 秒发送一次 ": ping" 注释。
+func (h *Handlers) Tail(c *gin.Context) {
+	f, err := parseConditions(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	f.From, f.To = time.Time{}, time.Time{}
+
+	sub := h.tail.Subscribe(f, 0)
+	if sub == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "实时推送不可用"})
+		return
+	}
+	defer h.tail.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// 关闭 nginx 等反向代理的响应缓冲。
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(tailHeartbeat)
+	defer heartbeat.Stop()
+	var reported uint64
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case l, ok := <-sub.C:
+			if !ok {
+				return false
+			}
+			c.SSEvent("log", l)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-c.Request.Context().Done():
+			return false
+		}
+		if n := sub.Dropped(); n > reported {
+			reported = n
+			c.SSEvent("dropped", gin.H{"dropped": n})
+		}
+		return true
+	})
+}
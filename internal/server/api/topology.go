@@ -0,0 +1,229 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"lightobs/internal/server/storage"
+)
+
+// defaultTopologyEdges 是 /topology 未指定 limit 时返回的最大边数。
+const defaultTopologyEdges = 200
+
+// 拓扑节点的粒度。
+const (
+	// topologyByProcess：调用方为 IP+PID（PID 未知时为 IP），被调方为 IP:端口；
+	// 能确定监听端口的进程时两端合并为同一个节点，见 hostInfo.service。
+	topologyByProcess = "process"
+	// topologyByIP：两端都只按 IP 聚合，忽略端口与进程。
+	topologyByIP = "ip"
+)
+
+type topologyNode struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	IP    string `json:"ip"`
+	Port  int    `json:"port,omitempty"`
+	PID   int    `json:"pid,omitempty"`
+}
+
+type topologyEdge struct {
+	Source    string  `json:"source"`
+	Target    string  `json:"target"`
+	Count     int64   `json:"count"`
+	RPS       float64 `json:"rps"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	AvgMS     float64 `json:"avg_ms"`
+	P50MS     float64 `json:"p50_ms"`
+	P90MS     float64 `json:"p90_ms"`
+	P99MS     float64 `json:"p99_ms"`
+}
+
+// Topology 根据 src/dst 与 PID 推导服务调用关系，返回节点与带 RED 指标的有向边：
+//
+//	by            process（默认）/ ip，节点粒度
+//	limit         最多返回的边数，按请求数降序，默认 200，最大 1000
+//
+// 过滤条件与 /search 相同（如 ip=、dst_port=），未指定 from 时统计最近 15 分钟。
+func (h *Handlers) Topology(c *gin.Context) {
+	now := time.Now()
+	f, err := parseWindow(c, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	by := c.DefaultQuery("by", topologyByProcess)
+	q := storage.StatsQuery{Filter: f, Sort: storage.StatsSortCount}
+	switch by {
+	case topologyByProcess:
+		q.GroupBy = []storage.Dimension{storage.DimSrcIP, storage.DimPID, storage.DimDstIP, storage.DimDstPort}
+	case topologyByIP:
+		q.GroupBy = []storage.Dimension{storage.DimSrcIP, storage.DimDstIP}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "by 参数非法（可选 process / ip）"})
+		return
+	}
+	if q.Limit, err = parseStatsLimit(c, defaultTopologyEdges); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := h.store.Stats(c.Request.Context(), q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "拓扑查询失败：" + err.Error()})
+		return
+	}
+
+	to := f.To
+	if to.IsZero() {
+		to = now
+	}
+	nodes, edges := buildTopology(by, rows, to.Sub(f.From).Seconds())
+	c.JSON(http.StatusOK, gin.H{
+		"from":  f.From,
+		"to":    to,
+		"by":    by,
+		"nodes": nodes,
+		"edges": edges,
+	})
+}
+
+// buildTopology 把聚合行转换为去重后的节点与边，节点按首次出现的顺序排列。
+func buildTopology(by string, rows []storage.StatsRow, seconds float64) ([]topologyNode, []topologyEdge) {
+	nodes := make([]topologyNode, 0, len(rows))
+	seen := make(map[string]bool)
+	add := func(n topologyNode) string {
+		if !seen[n.ID] {
+			seen[n.ID] = true
+			nodes = append(nodes, n)
+		}
+		return n.ID
+	}
+
+	var hosts map[string]*hostInfo
+	if by == topologyByProcess {
+		hosts = collectHosts(rows)
+	}
+	edges := make([]topologyEdge, 0, len(rows))
+	for _, r := range rows {
+		var src, dst topologyNode
+		if by == topologyByIP {
+			src = ipNode(r.Group[0])
+			dst = ipNode(r.Group[1])
+		} else {
+			pid, _ := strconv.Atoi(r.Group[1])
+			port, _ := strconv.Atoi(r.Group[3])
+			src = hosts[r.Group[0]].caller(r.Group[0], pid)
+			dst = hosts[r.Group[2]].callee(r.Group[2], port)
+		}
+		edges = append(edges, topologyEdge{
+			Source:    add(src),
+			Target:    add(dst),
+			Count:     r.Count,
+			RPS:       float64(r.Count) / seconds,
+			Errors:    r.Errors,
+			ErrorRate: r.ErrorRate(),
+			AvgMS:     r.AvgMS,
+			P50MS:     r.P50MS,
+			P90MS:     r.P90MS,
+			P99MS:     r.P99MS,
+		})
+	}
+	return nodes, edges
+}
+
+// hostInfo 是 process 粒度下一个 IP 上出现过的进程（作为调用方）与端口（作为被调方）。
+type hostInfo struct {
+	pids  map[int]bool
+	ports map[int]bool
+}
+
+func collectHosts(rows []storage.StatsRow) map[string]*hostInfo {
+	hosts := make(map[string]*hostInfo)
+	get := func(ip string) *hostInfo {
+		h := hosts[ip]
+		if h == nil {
+			h = &hostInfo{pids: make(map[int]bool), ports: make(map[int]bool)}
+			hosts[ip] = h
+		}
+		return h
+	}
+	for _, r := range rows {
+		if pid, _ := strconv.Atoi(r.Group[1]); pid > 0 {
+			get(r.Group[0]).pids[pid] = true
+		}
+		port, _ := strconv.Atoi(r.Group[3])
+		get(r.Group[2]).ports[port] = true
+	}
+	return hosts
+}
+
+// service 在 IP 上只有一个进程、只监听一个端口时返回二者：这时可以确定监听该端口的就是这个进程，
+// 它作为调用方与被调方的两端合并为同一个节点，拓扑中才能连出 A→B→C 的调用链。
+func (h *hostInfo) service() (pid, port int, ok bool) {
+	if h == nil || len(h.pids) > 1 || len(h.ports) != 1 {
+		return 0, 0, false
+	}
+	for p := range h.pids {
+		pid = p
+	}
+	for p := range h.ports {
+		port = p
+	}
+	return pid, port, true
+}
+
+// caller 返回调用方节点：进程已知时为 ip/pid；PID 未知但该 IP 上的服务唯一时为该服务。
+func (h *hostInfo) caller(ip string, pid int) topologyNode {
+	if svcPID, port, ok := h.service(); ok && (pid == svcPID || pid <= 0) {
+		return serviceNode(ip, svcPID, port)
+	}
+	return processNode(ip, pid)
+}
+
+// callee 返回被调方节点：监听进程可以确定时为该进程，否则为 ip:port。
+func (h *hostInfo) callee(ip string, port int) topologyNode {
+	if pid, _, ok := h.service(); ok {
+		return serviceNode(ip, pid, port)
+	}
+	return endpointNode(ip, port)
+}
+
+// serviceNode 是调用方与被调方合并后的节点，ID 与调用方节点相同。
+func serviceNode(ip string, pid, port int) topologyNode {
+	if pid <= 0 {
+		return endpointNode(ip, port)
+	}
+	n := processNode(ip, pid)
+	n.Port = port
+	n.Label = fmt.Sprintf("%s (pid %d)", net.JoinHostPort(ip, strconv.Itoa(port)), pid)
+	return n
+}
+
+func ipNode(ip string) topologyNode {
+	return topologyNode{ID: ip, Label: ip, IP: ip}
+}
+
+// processNode 在 PID 已知时以 ip/pid 区分同一主机上的不同进程。
+func processNode(ip string, pid int) topologyNode {
+	if pid <= 0 {
+		return ipNode(ip)
+	}
+	return topologyNode{
+		ID:    fmt.Sprintf("%s/pid:%d", ip, pid),
+		Label: fmt.Sprintf("%s (pid %d)", ip, pid),
+		IP:    ip,
+		PID:   pid,
+	}
+}
+
+func endpointNode(ip string, port int) topologyNode {
+	hostPort := net.JoinHostPort(ip, strconv.Itoa(port))
+	return topologyNode{ID: hostPort, Label: hostPort, IP: ip, Port: port}
+}
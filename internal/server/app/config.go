@@ -1,7 +1,65 @@
 package app
 
+import (
+	"time"
+
+	"lightobs/internal/server/anomaly"
+	"lightobs/internal/server/auth"
+	"lightobs/internal/server/storage"
+	"lightobs/internal/server/storage/duckdb"
+	"lightobs/internal/server/writebuf"
+)
+
 type Config struct {
 	ListenAddr string
-	DBDriver   string
-	DBPath     string
+	// DBDriver 为 duckdb、sqlite 或 memory；memory 不使用 DBPath，最多保留 MemoryCapacity 条记录。
+	DBDriver       string
+	DBPath         string
+	MemoryCapacity int
+
+	TLSCert              string
+	TLSKey               string
+	TLSClientCA          string
+	TLSRequireClientCert bool
+
+	// Retention 为数据保留策略，零值表示永久保留；RetentionInterval 为清理任务的执行间隔，默认 10 分钟。
+	Retention         storage.RetentionPolicy
+	RetentionInterval time.Duration
+
+	// Rollup 为各精度预聚合表的保留时长；RollupInterval 为预聚合任务的执行间隔，默认 1 分钟。
+	// DisableRollup 为 true 时不运行预聚合任务，查询全部读原始表。
+	Rollup         storage.RollupPolicy
+	RollupInterval time.Duration
+	DisableRollup  bool
+
+	// Cold 配置 DuckDB 的冷存储：Cold.SealAfter 大于 0 时启用，早于该时长的完整分区封存为 Parquet 文件；
+	// ColdInterval 为封存任务的执行间隔，默认 10 分钟。
+	Cold         duckdb.ColdTier
+	ColdInterval time.Duration
+
+	// WriteBuffer 配置上报记录的写缓冲：并发上报的记录合并成批写入。DisableWriteBuffer 为 true 时逐请求直接写库。
+	WriteBuffer        writebuf.Options
+	DisableWriteBuffer bool
+
+	// AlertRulesFile 是告警规则文件（YAML），为空则不启用告警。
+	AlertRulesFile string
+
+	// Anomaly 配置按接口学习基线的异常检测，EnableAnomaly 为 true 时启用；
+	// Anomaly.StatePath 为空时保存在数据库文件旁的 <db>.baselines.json（memory 后端不保存）。
+	Anomaly       anomaly.Options
+	EnableAnomaly bool
+
+	// DisableMetrics 为 true 时不暴露 /metrics；MetricsRED 为 true 时额外输出按目的地址与接口划分的 RED 指标，
+	// 最多 MetricsREDMaxSeries 个接口（默认 500），超出的合并为一组。
+	DisableMetrics      bool
+	MetricsRED          bool
+	MetricsREDMaxSeries int
+
+	// RoutesFile 是路由模式文件，每行一条（如 /users/{id}/orders/*），为空则只用启发式归一化。
+	RoutesFile string
+
+	// AuthFile 是静态凭证文件（YAML），为空且未设置 Authenticator 时不启用认证。
+	AuthFile string
+	// Authenticator 用于嵌入场景替换认证实现，优先于 AuthFile。
+	Authenticator auth.Authenticator
 }
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"lightobs/internal/server/api"
+	"lightobs/internal/server/metrics"
+	"lightobs/internal/server/storage"
+)
+
+// usageCacheTTL 是存储大小的缓存时间：SQLite 统计行数需要扫全表，不必每次采集都重新计算。
+const usageCacheTTL = 30 * time.Second
+
+// usageTimeout 是单次统计存储大小的超时。
+const usageTimeout = 5 * time.Second
+
+// newMetrics 注册 server 的全部指标（含 go_* 与 process_* 运行时指标），
+// 返回 /metrics 使用的 Registry 与 API 层的记录器。
+func newMetrics(cfg Config, st storage.Store) (*prometheus.Registry, *api.Metrics) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	var red *metrics.RED
+	if cfg.MetricsRED {
+		red = metrics.NewRED(reg, cfg.MetricsREDMaxSeries)
+	}
+	m := api.NewMetrics(reg, red)
+	if r, ok := st.(storage.UsageReporter); ok {
+		u := &storeUsage{st: r}
+		f := promauto.With(reg)
+		// 统计失败时输出 NaN，不把 0 当作真实的大小。
+		f.NewGaugeFunc(prometheus.GaugeOpts{Name: "lightobs_store_bytes", Help: "存储占用的字节数（含冷存储文件）。"}, func() float64 {
+			bytes, _, ok := u.get()
+			if !ok {
+				return math.NaN()
+			}
+			return float64(bytes)
+		})
+		f.NewGaugeFunc(prometheus.GaugeOpts{Name: "lightobs_store_rows", Help: "存储中的流量记录条数。"}, func() float64 {
+			_, rows, ok := u.get()
+			if !ok {
+				return math.NaN()
+			}
+			return float64(rows)
+		})
+	}
+	return reg, m
+}
+
+// storeUsage 缓存存储大小，两个 gauge 共用一次统计。
+type storeUsage struct {
+	st storage.UsageReporter
+
+	mu          sync.Mutex
+	at          time.Time
+	bytes, rows int64
+	ok          bool
+}
+
+func (u *storeUsage) get() (bytes, rows int64, ok bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if time.Since(u.at) < usageCacheTTL {
+		return u.bytes, u.rows, u.ok
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), usageTimeout)
+	defer cancel()
+	bytes, rows, err := u.st.Usage(ctx)
+	if err != nil {
+		log.Printf("统计存储大小失败：%v", err)
+	}
+	u.at, u.bytes, u.rows, u.ok = time.Now(), bytes, rows, err == nil
+	return u.bytes, u.rows, u.ok
+}
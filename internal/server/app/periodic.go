@@ -0,0 +1,35 @@
+package app
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// 后台任务的默认执行间隔。
+const (
+	defaultRetentionInterval = 10 * time.Minute
+	defaultRollupInterval    = time.Minute
+	defaultSealInterval      = 10 * time.Minute
+)
+
+// runPeriodic 启动时先执行一次 job，之后按 interval 周期执行，直到 ctx 取消。
+// job 返回的错误以 name 为前缀记录日志，ctx 取消导致的错误不记录；成功时的日志由 job 自己输出。
+func runPeriodic(ctx context.Context, name string, interval time.Duration, job func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := job(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("%s失败：%v", name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -2,20 +2,40 @@ package app
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"lightobs/internal/server/alert"
+	"lightobs/internal/server/anomaly"
 	"lightobs/internal/server/api"
+	"lightobs/internal/server/auth"
 	"lightobs/internal/server/storage"
 	"lightobs/internal/server/storage/duckdb"
+	"lightobs/internal/server/storage/memory"
 	"lightobs/internal/server/storage/sqlite"
+	"lightobs/internal/server/tail"
+	"lightobs/internal/server/writebuf"
+	"lightobs/internal/tlsutil"
+	"lightobs/pkg/pathnorm"
 )
 
 type Server struct {
 	httpServer *http.Server
 	store      storage.Store
+	tail       *tail.Hub
+	// buf 为 nil 表示未启用写缓冲。
+	buf *writebuf.Buffer
+
+	// stopJobs 结束后台任务，jobsDone 在任务全部退出后关闭。
+	stopJobs context.CancelFunc
+	jobsDone chan struct{}
 }
 
 func NewServer(cfg Config) (*Server, error) {
@@ -26,20 +46,64 @@ func NewServer(cfg Config) (*Server, error) {
 		cfg.DBDriver = "duckdb"
 	}
 	if cfg.DBPath == "" {
-		if cfg.DBDriver == "sqlite" {
+		switch cfg.DBDriver {
+		case "sqlite":
 			cfg.DBPath = "./traffic.sqlite"
-		} else {
+		case "memory":
+		default:
 			cfg.DBPath = "./traffic.duckdb"
 		}
 	}
 
+	tlsCfg, err := tlsutil.ServerConfig(tlsutil.ServerOptions{
+		CertFile:          cfg.TLSCert,
+		KeyFile:           cfg.TLSKey,
+		ClientCAFile:      cfg.TLSClientCA,
+		RequireClientCert: cfg.TLSRequireClientCert,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	authn := cfg.Authenticator
+	if authn == nil && cfg.AuthFile != "" {
+		static, err := auth.LoadStatic(cfg.AuthFile)
+		if err != nil {
+			return nil, err
+		}
+		authn = static
+	}
+
+	paths, err := pathnorm.New(nil)
+	if cfg.RoutesFile != "" {
+		paths, err = pathnorm.Load(cfg.RoutesFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rules *alert.File
+	if cfg.AlertRulesFile != "" {
+		if rules, err = alert.Load(cfg.AlertRulesFile); err != nil {
+			return nil, err
+		}
+	}
+
+	coldTier := cfg.Cold.SealAfter > 0
 	var st storage.Store
-	var err error
-	switch cfg.DBDriver {
-	case "sqlite":
+	switch {
+	case coldTier && (cfg.DBDriver == "sqlite" || cfg.DBDriver == "memory"):
+		return nil, errors.New("冷存储仅支持 DuckDB 后端")
+	case cfg.DBDriver == "sqlite":
 		st, err = sqlite.NewStore(cfg.DBPath)
+	case cfg.DBDriver == "memory":
+		st = memory.NewStore(cfg.MemoryCapacity)
 	default:
-		st, err = duckdb.NewStore(cfg.DBPath)
+		var opts []duckdb.Option
+		if coldTier {
+			opts = append(opts, duckdb.WithColdTier(cfg.Cold))
+		}
+		st, err = duckdb.NewStore(cfg.DBPath, opts...)
 	}
 	if err != nil {
 		return nil, err
@@ -48,28 +112,179 @@ func NewServer(cfg Config) (*Server, error) {
 	router := gin.New()
 	router.Use(gin.Recovery())
 
-	h := api.NewHandlers(st)
+	hub := tail.NewHub()
+	opts := []api.Option{api.WithNormalizer(paths), api.WithTail(hub), api.WithParquetReader(storage.ParquetReaderFunc(duckdb.ReadParquet))}
+	var m *api.Metrics
+	if !cfg.DisableMetrics {
+		var reg *prometheus.Registry
+		reg, m = newMetrics(cfg, st)
+		opts = append(opts, api.WithMetrics(m))
+		router.GET("/metrics", auth.Require(authn, auth.RoleQuery), gin.WrapH(promhttp.HandlerFor(reg, promhttp.HandlerOpts{})))
+	}
+	var buf *writebuf.Buffer
+	if !cfg.DisableWriteBuffer {
+		// 写缓冲包在计时外面，写库耗时只统计实际的批量写入。
+		buf = writebuf.New(m.TimeInserts(st), cfg.WriteBuffer)
+		opts = append(opts, api.WithWriteBuffer(buf))
+	}
+	var alerts *alert.Engine
+	if rules != nil {
+		var notifier alert.Notifier
+		if rules.Webhook.URL != "" {
+			notifier = alert.NewWebhook(rules.Webhook)
+		}
+		alerts = alert.NewEngine(st, rules.Rules, notifier)
+		opts = append(opts, api.WithAlerts(alerts))
+	}
+	var detector *anomaly.Detector
+	if cfg.EnableAnomaly {
+		if cfg.Anomaly.StatePath == "" && cfg.DBPath != "" {
+			cfg.Anomaly.StatePath = cfg.DBPath + ".baselines.json"
+		}
+		if detector, err = anomaly.New(st, cfg.Anomaly); err != nil {
+			_ = st.Close()
+			return nil, err
+		}
+		opts = append(opts, api.WithAnomalies(detector))
+	}
+	h := api.NewHandlers(st, opts...)
 	v1 := router.Group("/api/v1")
 	{
-		v1.POST("/upload", h.Upload)
-		v1.GET("/query", h.Query)
+		ingest := auth.Require(authn, auth.RoleIngest)
+		query := auth.Require(authn, auth.RoleQuery)
+		admin := auth.Require(authn, auth.RoleAdmin)
+		timed := m.ObserveQuery()
+
+		v1.POST("/upload", ingest, h.Upload)
+		v1.POST("/upload/batch", ingest, h.UploadBatch)
+		v1.POST("/import", admin, h.Import)
+		v1.GET("/query", query, timed, h.Query)
+		v1.GET("/search", query, timed, h.Search)
+		v1.GET("/stats", query, timed, h.Stats)
+		v1.GET("/series", query, timed, h.Series)
+		v1.GET("/topology", query, timed, h.Topology)
+		v1.GET("/tail", query, h.Tail)
+		v1.GET("/export", query, timed, h.Export)
+		v1.GET("/alerts", query, timed, h.Alerts)
+		v1.GET("/anomalies", query, timed, h.Anomalies)
+		v1.GET("/baselines", query, timed, h.Baselines)
+	}
+
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	jobsDone := make(chan struct{})
+	var jobs sync.WaitGroup
+	periodic := func(name string, interval time.Duration, job func(ctx context.Context) error) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			runPeriodic(jobCtx, name, interval, job)
+		}()
+	}
+	if cfg.Retention.Enabled() {
+		interval := cfg.RetentionInterval
+		if interval <= 0 {
+			interval = defaultRetentionInterval
+		}
+		periodic("数据清理", interval, func(ctx context.Context) error {
+			start := time.Now()
+			res, err := st.Prune(ctx, cfg.Retention)
+			if err == nil && res.Deleted > 0 {
+				log.Printf("数据清理：删除 %d 条（%d 个分区），耗时 %s", res.Deleted, res.Partitions, time.Since(start).Round(time.Millisecond))
+			}
+			return err
+		})
+	}
+	if !cfg.DisableRollup {
+		interval := cfg.RollupInterval
+		if interval <= 0 {
+			interval = defaultRollupInterval
+		}
+		periodic("预聚合", interval, func(ctx context.Context) error {
+			start := time.Now()
+			res, err := st.Rollup(ctx, cfg.Rollup)
+			if err == nil && (res.Written > 0 || res.Pruned > 0) {
+				log.Printf("预聚合：写入 %d 行，清理 %d 行，耗时 %s", res.Written, res.Pruned, time.Since(start).Round(time.Millisecond))
+			}
+			return err
+		})
 	}
+	if sealer, ok := st.(storage.Sealer); ok && coldTier {
+		interval := cfg.ColdInterval
+		if interval <= 0 {
+			interval = defaultSealInterval
+		}
+		periodic("冷存储封存", interval, func(ctx context.Context) error {
+			start := time.Now()
+			res, err := sealer.Seal(ctx)
+			if err == nil && res.Partitions > 0 {
+				log.Printf("冷存储封存：%d 个分区，%d 条，耗时 %s", res.Partitions, res.Rows, time.Since(start).Round(time.Millisecond))
+			}
+			return err
+		})
+	}
+	if alerts != nil {
+		periodic("告警评估", rules.Interval, alerts.Evaluate)
+	}
+	if detector != nil {
+		interval := cfg.Anomaly.Step
+		if interval <= 0 {
+			interval = anomaly.DefaultStep
+		}
+		// 首次启动时从历史数据学习，之后每个时间桶处理一次。
+		periodic("异常检测", interval, func(ctx context.Context) error {
+			n, err := detector.Update(ctx)
+			if err == nil && n > 0 {
+				log.Printf("异常检测：%d 个异常时间桶", n)
+			}
+			return err
+		})
+	}
+	go func() {
+		jobs.Wait()
+		close(jobsDone)
+	}()
 
 	return &Server{
-		store: st,
+		store:    st,
+		tail:     hub,
+		buf:      buf,
+		stopJobs: stopJobs,
+		jobsDone: jobsDone,
 		httpServer: &http.Server{
-		Addr:              cfg.ListenAddr,
-		Handler:           router,
-		ReadHeaderTimeout: 5 * time.Second,
+			Addr:              cfg.ListenAddr,
+			Handler:           router,
+			ReadHeaderTimeout: 5 * time.Second,
+			TLSConfig:         tlsCfg,
 		},
 	}, nil
 }
 
+// TLSEnabled 表示 server 是否以 HTTPS 监听。
+func (s *Server) TLSEnabled() bool {
+	return s.httpServer.TLSConfig != nil
+}
+
 func (s *Server) ListenAndServe() error {
+	if s.TLSEnabled() {
+		// 证书已加载到 TLSConfig 中，这里无需再传文件路径。
+		return s.httpServer.ListenAndServeTLS("", "")
+	}
 	return s.httpServer.ListenAndServe()
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
+	// 先结束 /tail 长连接，否则 Shutdown 会一直等到超时。
+	s.tail.Close()
 	_ = s.httpServer.Shutdown(ctx)
+	// 上报请求都已返回，写缓冲中只剩已确认前的记录，写完再继续。
+	if s.buf != nil {
+		_ = s.buf.Close()
+	}
+	// 等后台任务退出后再关闭存储，避免清理进行到一半时连接被关闭。
+	s.stopJobs()
+	select {
+	case <-s.jobsDone:
+	case <-ctx.Done():
+	}
 	return s.store.Close()
 }
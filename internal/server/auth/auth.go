@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// Role 是权限粒度：ingest 写入流量，query 读取流量，admin 包含全部权限，
+// 另外只有 admin 可以导入历史数据（可写入任意时间、任意来源的记录）。
+type Role string
+
+const (
+	RoleIngest Role = "ingest"
+	RoleQuery  Role = "query"
+	RoleAdmin  Role = "admin"
+)
+
+type Principal struct {
+	Name  string
+	Roles []Role
+}
+
+// Has 判断是否具备某个角色；admin 视为拥有所有角色。
+func (p *Principal) Has(role Role) bool {
+	for _, r := range p.Roles {
+		if r == role || r == RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// ErrNoCredentials 表示请求未携带任何凭证。
+	ErrNoCredentials = errors.New("缺少认证凭证")
+	// ErrInvalidCredentials 表示凭证无法识别。
+	ErrInvalidCredentials = errors.New("认证凭证无效")
+)
+
+// Authenticator 是可插拔的认证实现：从请求中识别调用方身份。
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Static 使用配置文件中的静态凭证：
+//   - Authorization: Bearer <token>，通常分配给 agent（每个 agent 一个 token）
+//   - X-API-Key: <key>，通常分配给查询方（client、Grafana 等）
+//
+// 凭证只以 SHA-256 摘要形式保存在内存中，查找走 map，避免逐个比较带来的时序差异。
+type Static struct {
+	tokens  map[[32]byte]*Principal
+	apiKeys map[[32]byte]*Principal
+}
+
+type fileConfig struct {
+	Tokens  []credential `yaml:"tokens"`
+	APIKeys []credential `yaml:"api_keys"`
+}
+
+type credential struct {
+	Name  string   `yaml:"name"`
+	Token string   `yaml:"token"`
+	Key   string   `yaml:"key"`
+	Roles []string `yaml:"roles"`
+}
+
+// LoadStatic 读取 YAML 凭证文件，格式：
+//
+//	tokens:
+//	  - name: agent-node1
+//	    token: <随机串>
+//	    roles: [ingest]
+//	api_keys:
+//	  - name: oncall
+//	    key: <随机串>
+//	    roles: [query]
+func LoadStatic(path string) (*Static, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取认证配置失败：%w", err)
+	}
+	var fc fileConfig
+	if err := yaml.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("解析认证配置失败：%w", err)
+	}
+	s := &Static{
+		tokens:  make(map[[32]byte]*Principal, len(fc.Tokens)),
+		apiKeys: make(map[[32]byte]*Principal, len(fc.APIKeys)),
+	}
+	for _, c := range fc.Tokens {
+		if err := s.add(s.tokens, c.Name, c.Token, c.Roles); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range fc.APIKeys {
+		if err := s.add(s.apiKeys, c.Name, c.Key, c.Roles); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Static) add(m map[[32]byte]*Principal, name, secret string, roles []string) error {
+	if name == "" || secret == "" {
+		return fmt.Errorf("认证配置中的凭证必须包含 name 与 token/key")
+	}
+	p := &Principal{Name: name}
+	for _, r := range roles {
+		role, err := ParseRole(r)
+		if err != nil {
+			return fmt.Errorf("凭证 %s：%w", name, err)
+		}
+		p.Roles = append(p.Roles, role)
+	}
+	if len(p.Roles) == 0 {
+		return fmt.Errorf("凭证 %s 未配置 roles", name)
+	}
+	sum := sha256.Sum256([]byte(secret))
+	if _, dup := m[sum]; dup {
+		return fmt.Errorf("凭证 %s 与其他凭证重复", name)
+	}
+	m[sum] = p
+	return nil
+}
+
+func ParseRole(s string) (Role, error) {
+	switch r := Role(strings.ToLower(strings.TrimSpace(s))); r {
+	case RoleIngest, RoleQuery, RoleAdmin:
+		return r, nil
+	default:
+		return "", fmt.Errorf("未知角色：%s（可选 ingest / query / admin）", s)
+	}
+}
+
+func (s *Static) Authenticate(r *http.Request) (*Principal, error) {
+	if raw := r.Header.Get("Authorization"); raw != "" {
+		scheme, token, ok := strings.Cut(raw, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return nil, ErrInvalidCredentials
+		}
+		if p := s.tokens[sha256.Sum256([]byte(strings.TrimSpace(token)))]; p != nil {
+			return p, nil
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		if p := s.apiKeys[sha256.Sum256([]byte(key))]; p != nil {
+			return p, nil
+		}
+		return nil, ErrInvalidCredentials
+	}
+	return nil, ErrNoCredentials
+}
+
+const principalKey = "lightobs.principal"
+
+// Require 返回校验角色的 gin 中间件。a 为 nil 表示未启用认证，直接放行。
+func Require(a Authenticator, role Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if a == nil {
+			c.Next()
+			return
+		}
+		p, err := a.Authenticate(c.Request)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="lightobs"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if !p.Has(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("%s 没有 %s 权限", p.Name, role)})
+			return
+		}
+		c.Set(principalKey, p)
+		c.Next()
+	}
+}
+
+// FromContext 取出 Require 校验通过的调用方；未启用认证时返回 nil。
+func FromContext(c *gin.Context) *Principal {
+	if v, ok := c.Get(principalKey); ok {
+		if p, ok := v.(*Principal); ok {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testConfig = `
+tokens:
+  - name: agent-node1
+    token: agent-secret
+    roles: [ingest]
+api_keys:
+  - name: oncall
+    key: reader-key
+    roles: [query]
+  - name: ops
+    key: admin-key
+    roles: [admin]
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "auth.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	a, err := LoadStatic(writeConfig(t, testConfig))
+	if err != nil {
+		t.Fatalf("LoadStatic failed: %v", err)
+	}
+	r := gin.New()
+	ok := func(c *gin.Context) { c.String(http.StatusOK, FromContext(c).Name) }
+	r.POST("/upload", Require(a, RoleIngest), ok)
+	r.GET("/query", Require(a, RoleQuery), ok)
+	r.POST("/import", Require(a, RoleAdmin), ok)
+	return r
+}
+
+func TestRequire(t *testing.T) {
+	r := newRouter(t)
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		header [2]string
+		want   int
+		who    string
+	}{
+		{"no credentials", http.MethodGet, "/query", [2]string{}, http.StatusUnauthorized, ""},
+		{"unknown api key", http.MethodGet, "/query", [2]string{"X-API-Key", "nope"}, http.StatusUnauthorized, ""},
+		{"wrong scheme", http.MethodPost, "/upload", [2]string{"Authorization", "Basic agent-secret"}, http.StatusUnauthorized, ""},
+		{"agent can ingest", http.MethodPost, "/upload", [2]string{"Authorization", "Bearer agent-secret"}, http.StatusOK, "agent-node1"},
+		{"agent cannot query", http.MethodGet, "/query", [2]string{"Authorization", "Bearer agent-secret"}, http.StatusForbidden, ""},
+		{"reader can query", http.MethodGet, "/query", [2]string{"X-API-Key", "reader-key"}, http.StatusOK, "oncall"},
+		{"reader cannot ingest", http.MethodPost, "/upload", [2]string{"X-API-Key", "reader-key"}, http.StatusForbidden, ""},
+		{"admin can do both", http.MethodPost, "/upload", [2]string{"X-API-Key", "admin-key"}, http.StatusOK, "ops"},
+		{"agent cannot import", http.MethodPost, "/import", [2]string{"Authorization", "Bearer agent-secret"}, http.StatusForbidden, ""},
+		{"admin can import", http.MethodPost, "/import", [2]string{"X-API-Key", "admin-key"}, http.StatusOK, "ops"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.header[0] != "" {
+				req.Header.Set(tc.header[0], tc.header[1])
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Fatalf("status=%d want %d body=%s", w.Code, tc.want, w.Body.String())
+			}
+			if tc.who != "" && w.Body.String() != tc.who {
+				t.Errorf("principal=%q want %q", w.Body.String(), tc.who)
+			}
+		})
+	}
+}
+
+func TestRequireDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/query", Require(nil, RoleQuery), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/query", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("nil authenticator should allow all, got %d", w.Code)
+	}
+}
+
+func TestLoadStaticValidation(t *testing.T) {
+	cases := map[string]string{
+		"missing roles": "tokens:\n  - name: a\n    token: x\n",
+		"unknown role":  "tokens:\n  - name: a\n    token: x\n    roles: [write]\n",
+		"empty secret":  "api_keys:\n  - name: a\n    roles: [query]\n",
+		"duplicate":     "api_keys:\n  - {name: a, key: x, roles: [query]}\n  - {name: b, key: x, roles: [query]}\n",
+		"bad yaml":      "tokens: [",
+	}
+	for name, content := range cases {
+		if _, err := LoadStatic(writeConfig(t, content)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
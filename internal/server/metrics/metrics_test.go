@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"lightobs/pkg/model"
+)
+
+func TestRED(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	red := NewRED(reg, 2)
+	logs := []model.TrafficLog{
+		{DstIP: "10.0.0.8", DstPort: 80, HTTPMethod: "GET", HTTPPath: "/users/1", HTTPRoute: "/users/{id}", StatusCode: 200, LatencyMS: 20},
+		{DstIP: "10.0.0.8", DstPort: 80, HTTPMethod: "GET", HTTPPath: "/users/2", HTTPRoute: "/users/{id}", StatusCode: 503, LatencyMS: 700},
+		{DstIP: "10.0.0.9", DstPort: 8080, HTTPMethod: "POST", HTTPPath: "/orders", StatusCode: 201, LatencyMS: 5},
+		// 超出 2 个接口的上限，合并到 __overflow__。
+		{DstIP: "10.0.0.9", DstPort: 8080, HTTPMethod: "GET", HTTPPath: "/orders/9", StatusCode: 500, LatencyMS: 5},
+		{DstIP: "10.0.0.7", DstPort: 80, HTTPMethod: "GET", HTTPPath: "/", StatusCode: 200, LatencyMS: 5},
+	}
+	red.Observe(logs...)
+	var nilRED *RED
+	nilRED.Observe(logs...)
+
+	w := httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	out := w.Body.String()
+	for _, want := range []string{
+		`lightobs_red_requests_total{dst="10.0.0.8:80",method="GET",route="/users/{id}"} 2`,
+		`lightobs_red_requests_total{dst="10.0.0.9:8080",method="POST",route="/orders"} 1`,
+		`lightobs_red_requests_total{dst="__overflow__",method="__overflow__",route="__overflow__"} 2`,
+		`lightobs_red_errors_total{dst="10.0.0.8:80",method="GET",route="/users/{id}"} 1`,
+		`lightobs_red_errors_total{dst="__overflow__",method="__overflow__",route="__overflow__"} 1`,
+		`lightobs_red_latency_seconds_bucket{dst="10.0.0.8:80",method="GET",route="/users/{id}",le="0.5"} 1`,
+		`lightobs_red_latency_seconds_bucket{dst="10.0.0.8:80",method="GET",route="/users/{id}",le="1"} 2`,
+		`lightobs_red_latency_seconds_sum{dst="10.0.0.8:80",method="GET",route="/users/{id}"} 0.72`,
+		`lightobs_red_overflow_total 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if n := strings.Count(out, "lightobs_red_requests_total{"); n != 3 {
+		t.Errorf("%d request series, want 3", n)
+	}
+}
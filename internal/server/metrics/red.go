@@ -0,0 +1,98 @@
+// Package metrics 提供 server 自身指标中本项目特有的部分：从上报流量推导的 RED 指标及其基数限制。
+// 指标的注册、编码与 /metrics 暴露使用 Prometheus 客户端库。
+package metrics
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"lightobs/internal/server/storage"
+	"lightobs/pkg/model"
+)
+
+// DefaultREDMaxSeries 是 RED 指标默认的最大接口数。
+const DefaultREDMaxSeries = 500
+
+// overflowLabel 是超出接口数上限后合并记录时使用的标签值。
+const overflowLabel = "__overflow__"
+
+// redBuckets 是被观测流量的延迟直方图上界（秒）。
+var redBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// RED 从上报的流量推导各目的地址与接口的请求数、错误数与延迟分布。
+// 接口（dst + method + route）数达到上限后，新出现的接口合并到标签值为 __overflow__ 的一组，
+// 避免原始路径等高基数取值撑爆 Prometheus。nil RED 上的方法均为空操作。
+type RED struct {
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	overflow prometheus.Counter
+
+	maxSeries int
+	mu        sync.Mutex
+	seen      map[redKey]bool
+}
+
+type redKey struct {
+	dst, method, route string
+}
+
+// NewRED 在 reg 中注册 lightobs_red_* 指标，maxSeries<=0 时使用 DefaultREDMaxSeries。
+func NewRED(reg prometheus.Registerer, maxSeries int) *RED {
+	if maxSeries <= 0 {
+		maxSeries = DefaultREDMaxSeries
+	}
+	f := promauto.With(reg)
+	labels := []string{"dst", "method", "route"}
+	return &RED{
+		requests: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "lightobs_red_requests_total", Help: "被观测的 HTTP 请求数，按目的地址与接口区分。"}, labels),
+		errors: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "lightobs_red_errors_total", Help: "被观测的 5xx 请求数，按目的地址与接口区分。"}, labels),
+		latency: f.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "lightobs_red_latency_seconds", Help: "被观测的 HTTP 请求延迟（秒），按目的地址与接口区分。", Buckets: redBuckets}, labels),
+		overflow: f.NewCounter(prometheus.CounterOpts{
+			Name: "lightobs_red_overflow_total", Help: "因接口数达到上限而记入 __overflow__ 的请求数。"}),
+		maxSeries: maxSeries,
+		seen:      make(map[redKey]bool),
+	}
+}
+
+// Observe 记录一批写入成功的流量。
+func (m *RED) Observe(logs ...model.TrafficLog) {
+	if m == nil {
+		return
+	}
+	for i := range logs {
+		l := &logs[i]
+		k := m.key(l)
+		m.requests.WithLabelValues(k.dst, k.method, k.route).Inc()
+		if storage.IsError(l.StatusCode) {
+			m.errors.WithLabelValues(k.dst, k.method, k.route).Inc()
+		}
+		m.latency.WithLabelValues(k.dst, k.method, k.route).Observe(float64(l.LatencyMS) / 1000)
+	}
+}
+
+// key 返回记录所属的接口，超出上限的新接口归入 overflow。
+func (m *RED) key(l *model.TrafficLog) redKey {
+	k := redKey{
+		dst:    fmt.Sprintf("%s:%d", l.DstIP, l.DstPort),
+		method: l.HTTPMethod,
+		route:  storage.DimPath.Value(l),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.seen[k] {
+		return k
+	}
+	if len(m.seen) >= m.maxSeries {
+		m.overflow.Inc()
+		return redKey{overflowLabel, overflowLabel, overflowLabel}
+	}
+	m.seen[k] = true
+	return k
+}
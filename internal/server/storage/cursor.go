@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"lightobs/pkg/model"
+)
+
+// Cursor 标识分页中已读到的最后一条记录。它携带排序方式，换了排序条件的游标会被拒绝，
+// 避免客户端拿旧游标续读得到错乱的结果。
+type Cursor struct {
+	Sort      SortField `json:"s"`
+	Asc       bool      `json:"a,omitempty"`
+	SortValue int64     `json:"v,omitempty"`
+	Timestamp time.Time `json:"t"`
+	RowID     int64     `json:"r"`
+}
+
+var ErrCursorMismatch = errors.New("游标与当前排序条件不一致")
+
+// Encode 返回 URL 安全的不透明字符串。
+func (c *Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("游标格式非法：%w", err)
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("游标格式非法：%w", err)
+	}
+	if _, ok := sortColumns[c.Sort]; !ok {
+		return nil, fmt.Errorf("游标格式非法：未知排序字段 %q", c.Sort)
+	}
+	return &c, nil
+}
+
+// Matches 判断游标是否属于 f 所描述的排序。
+func (c *Cursor) Matches(f Filter) bool {
+	sort := f.Sort
+	if sort == "" {
+		sort = SortTimestamp
+	}
+	return c.Sort == sort && c.Asc == f.Asc
+}
+
+// Page 是一页查询结果；Next 为空表示没有更多数据。
+type Page struct {
+	Items []model.TrafficLog
+	Next  *Cursor
+}
@@ -0,0 +1,344 @@
+package duckdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lightobs/internal/server/storage"
+)
+
+// ColdTier 配置按时间分区的冷存储：早于 SealAfter 的完整分区从 traffic_logs 移出，
+// 封存为本地 Parquet 文件（每个分区一个或多个文件），查询时按时间范围只读取重叠的文件。
+type ColdTier struct {
+	// Dir 是 Parquet 文件所在目录，为空时使用数据库文件旁的 <数据库文件名>.cold。
+	Dir string
+	// Partition 是分区粒度，time.Hour（默认）或 24*time.Hour，分区按 UTC 对齐。
+	Partition time.Duration
+	// SealAfter 是数据留在 DuckDB 热表中的时长，默认 24 小时；只封存结束时间早于 now-SealAfter 的分区。
+	SealAfter time.Duration
+}
+
+// DefaultSealAfter 是 ColdTier.SealAfter 未设置时热数据保留的时长。
+const DefaultSealAfter = 24 * time.Hour
+
+type Option func(*Store)
+
+// WithColdTier 启用冷存储封存；未启用时仍会读取此前已封存的文件。
+func WithColdTier(c ColdTier) Option {
+	return func(s *Store) {
+		s.cold = &c
+	}
+}
+
+// init 补全 ColdTier 的默认值并创建目录。
+func (c *ColdTier) init(dbPath string) error {
+	if c.Partition <= 0 {
+		c.Partition = time.Hour
+	}
+	if c.Partition != time.Hour && c.Partition != 24*time.Hour {
+		return fmt.Errorf("冷存储分区粒度只能是 1h 或 24h：%s", c.Partition)
+	}
+	if c.SealAfter <= 0 {
+		c.SealAfter = DefaultSealAfter
+	}
+	if c.Dir == "" {
+		if dbPath == "" {
+			return fmt.Errorf("内存数据库需要指定冷存储目录")
+		}
+		c.Dir = dbPath + ".cold"
+	}
+	dir, err := filepath.Abs(c.Dir)
+	if err != nil {
+		return fmt.Errorf("冷存储目录非法：%w", err)
+	}
+	c.Dir = dir
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("创建冷存储目录失败：%w", err)
+	}
+	return nil
+}
+
+// hotColumns 是热表与冷文件共有的列（不含 id），顺序与 ExportColumns 一致。
+// 冷文件中的 id 列名为 row_id：封存时原样写入热表的 id，早期版本封存的文件为负数，排在之后写入的数据之前。
+var hotColumns = strings.Join(storage.ExportColumns, ", ")
+
+// quote 把路径写成 SQL 字符串字面量；COPY 与 read_parquet 的文件名不能使用占位符。
+func quote(path string) string {
+	return "'" + strings.ReplaceAll(path, "'", "''") + "'"
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// coldFiles 返回与 [from, to) 重叠的冷分区文件，from/to 为零值表示不限制。
+func coldFiles(ctx context.Context, q queryer, from, to time.Time) ([]string, error) {
+	conds := []string{"1=1"}
+	var args []any
+	if !from.IsZero() {
+		conds = append(conds, "max_ts >= ?")
+		args = append(args, from.UTC())
+	}
+	if !to.IsZero() {
+		conds = append(conds, "min_ts < ?")
+		args = append(args, to.UTC())
+	}
+	rows, err := q.QueryContext(ctx, `SELECT path FROM cold_partitions WHERE `+strings.Join(conds, " AND ")+` ORDER BY min_ts`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("读取冷分区目录失败：%w", err)
+	}
+	defer rows.Close()
+	var files []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, fmt.Errorf("读取冷分区目录失败：%w", err)
+		}
+		files = append(files, p)
+	}
+	return files, rows.Err()
+}
+
+// source 返回查询 [from, to) 时的 FROM 子句：热表，有重叠的冷分区时再 UNION ALL 冷文件。
+// 对外仍叫 traffic_logs，并把 id 作为 rowid 列给出：DuckDB 自身的 rowid 在删除与封存后会变，不能用于翻页。
+func source(ctx context.Context, q queryer, from, to time.Time) (string, error) {
+	files, err := coldFiles(ctx, q, from, to)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return `(SELECT id AS rowid, ` + hotColumns + ` FROM traffic_logs) AS traffic_logs`, nil
+	}
+	quoted := make([]string, len(files))
+	for i, f := range files {
+		quoted[i] = quote(f)
+	}
+	// union_by_name：以后新增列时，旧文件中缺少的列读为 NULL。
+	return `(
+	SELECT id AS rowid, ` + hotColumns + ` FROM traffic_logs
+	UNION ALL
+	SELECT row_id AS rowid, ` + hotColumns + ` FROM read_parquet([` + strings.Join(quoted, ", ") + `], union_by_name = true)
+) AS traffic_logs`, nil
+}
+
+// read 在一个事务中确定数据来源并执行 fn：冷分区目录与热表取自同一快照，
+// 查询不会因为同时进行的封存而漏掉或重复读到一个分区；持有 filesMu 读锁，
+// 快照中引用的文件在 fn 返回之前不会被清理删除。
+func (s *Store) read(ctx context.Context, from, to time.Time, fn func(tx *sql.Tx, src string) error) error {
+	s.filesMu.RLock()
+	defer s.filesMu.RUnlock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开启事务失败：%w", err)
+	}
+	defer tx.Rollback()
+	src, err := source(ctx, tx, from, to)
+	if err != nil {
+		return err
+	}
+	return fn(tx, src)
+}
+
+// Seal 把结束时间早于 now-SealAfter 的分区从热表移到 Parquet 文件，从最旧的分区开始，
+// 每个分区在一个事务中完成写文件、登记目录与删除热数据。未启用冷存储时不做任何事。
+func (s *Store) Seal(ctx context.Context) (storage.SealResult, error) {
+	var res storage.SealResult
+	if s.cold == nil {
+		return res, nil
+	}
+	s.coldMu.Lock()
+	defer s.coldMu.Unlock()
+
+	boundary := time.Now().UTC().Add(-s.cold.SealAfter).Truncate(s.cold.Partition)
+	for {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		var oldest time.Time
+		err := s.db.QueryRowContext(ctx, `SELECT timestamp FROM traffic_logs WHERE timestamp < ? ORDER BY timestamp LIMIT 1`, boundary).Scan(&oldest)
+		if err == sql.ErrNoRows {
+			return res, nil
+		}
+		if err != nil {
+			return res, fmt.Errorf("查询待封存数据失败：%w", err)
+		}
+		start := oldest.UTC().Truncate(s.cold.Partition)
+		n, err := s.sealPartition(ctx, start, start.Add(s.cold.Partition))
+		if err != nil {
+			return res, fmt.Errorf("封存分区 %s 失败：%w", start.Format(time.RFC3339), err)
+		}
+		res.Partitions++
+		res.Rows += n
+	}
+}
+
+func (s *Store) sealPartition(ctx context.Context, start, end time.Time) (int64, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `BEGIN TRANSACTION`); err != nil {
+		return 0, err
+	}
+	path := filepath.Join(s.cold.Dir, fmt.Sprintf("traffic_%s_%d.parquet", start.Format("20060102T15"), time.Now().UnixNano()))
+	n, err := sealInTx(ctx, conn, path, start, end)
+	if err != nil {
+		_, _ = conn.ExecContext(context.Background(), `ROLLBACK`)
+		_ = os.Remove(path)
+		return 0, err
+	}
+	if _, err := conn.ExecContext(ctx, `COMMIT`); err != nil {
+		_, _ = conn.ExecContext(context.Background(), `ROLLBACK`)
+		_ = os.Remove(path)
+		return 0, err
+	}
+	return n, nil
+}
+
+func sealInTx(ctx context.Context, conn *sql.Conn, path string, start, end time.Time) (int64, error) {
+	var (
+		n            int64
+		minTS, maxTS time.Time
+		maxID        int64
+	)
+	if err := conn.QueryRowContext(ctx, `SELECT count(*), min(timestamp), max(timestamp), max(id) FROM traffic_logs WHERE timestamp >= ? AND timestamp < ?`,
+		start, end).Scan(&n, &minTS, &maxTS, &maxID); err != nil {
+		return 0, err
+	}
+	if _, err := conn.ExecContext(ctx, `
+COPY (
+	SELECT id AS row_id, `+hotColumns+`
+	FROM traffic_logs
+	WHERE timestamp >= ? AND timestamp < ?
+	ORDER BY timestamp, row_id
+) TO `+quote(path)+` (FORMAT PARQUET, COMPRESSION ZSTD);
+`, start, end); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := conn.ExecContext(ctx, `
+INSERT INTO cold_partitions (path, partition_start, min_ts, max_ts, row_count, byte_size, max_row_id, sealed_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, path, start, minTS, maxTS, n, info.Size(), maxID, time.Now().UTC()); err != nil {
+		return 0, err
+	}
+	if _, err := conn.ExecContext(ctx, `DELETE FROM traffic_logs WHERE timestamp >= ? AND timestamp < ?`, start, end); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// coldPartition 是冷分区目录中的一行。
+type coldPartition struct {
+	path  string
+	minTS time.Time
+	maxTS time.Time
+	rows  int64
+}
+
+// deleteColdBefore 删除冷数据中 timestamp < t 的记录：整个文件都早于 t 时删除文件，
+// 文件跨过 t 时改写为只含 t 之后记录的新文件。返回删除条数。
+func (s *Store) deleteColdBefore(ctx context.Context, t time.Time) (int64, error) {
+	s.coldMu.Lock()
+	defer s.coldMu.Unlock()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT path, min_ts, max_ts, row_count FROM cold_partitions WHERE min_ts < ? ORDER BY min_ts`, t.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("读取冷分区目录失败：%w", err)
+	}
+	var parts []coldPartition
+	for rows.Next() {
+		var p coldPartition
+		if err := rows.Scan(&p.path, &p.minTS, &p.maxTS, &p.rows); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("读取冷分区目录失败：%w", err)
+		}
+		parts = append(parts, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("读取冷分区目录失败：%w", err)
+	}
+
+	var deleted int64
+	for _, p := range parts {
+		var n int64
+		if p.maxTS.Before(t) {
+			n, err = s.dropColdFile(ctx, p)
+		} else {
+			n, err = s.trimColdFile(ctx, p, t)
+		}
+		if err != nil {
+			return deleted, fmt.Errorf("删除冷数据 %s 失败：%w", filepath.Base(p.path), err)
+		}
+		deleted += n
+	}
+	return deleted, nil
+}
+
+func (s *Store) dropColdFile(ctx context.Context, p coldPartition) (int64, error) {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM cold_partitions WHERE path = ?`, p.path); err != nil {
+		return 0, err
+	}
+	s.removeColdFile(p.path)
+	return p.rows, nil
+}
+
+// removeColdFile 删除目录已不再引用的冷文件，先等待此前开始、可能仍在读取它的查询结束。
+// 删除失败只会留下一个不被读取的文件。
+func (s *Store) removeColdFile(path string) {
+	s.filesMu.Lock()
+	defer s.filesMu.Unlock()
+	_ = os.Remove(path)
+}
+
+// trimColdFile 把 p 中 timestamp >= t 的记录（保留原 row_id）写入新文件并替换目录项。
+func (s *Store) trimColdFile(ctx context.Context, p coldPartition, t time.Time) (int64, error) {
+	var (
+		n            int64
+		minTS, maxTS time.Time
+	)
+	if err := s.db.QueryRowContext(ctx, `SELECT count(*), min(timestamp), max(timestamp) FROM read_parquet(`+quote(p.path)+`) WHERE timestamp >= ?`,
+		t.UTC()).Scan(&n, &minTS, &maxTS); err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return s.dropColdFile(ctx, p)
+	}
+	path := strings.TrimSuffix(p.path, ".parquet") + fmt.Sprintf("_%d.parquet", time.Now().UnixNano())
+	if _, err := s.db.ExecContext(ctx, `
+COPY (SELECT * FROM read_parquet(`+quote(p.path)+`) WHERE timestamp >= ? ORDER BY timestamp, row_id)
+TO `+quote(path)+` (FORMAT PARQUET, COMPRESSION ZSTD);
+`, t.UTC()); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.db.ExecContext(ctx, `UPDATE cold_partitions SET path = ?, min_ts = ?, max_ts = ?, row_count = ?, byte_size = ? WHERE path = ?`,
+		path, minTS, maxTS, n, info.Size(), p.path); err != nil {
+		_ = os.Remove(path)
+		return 0, err
+	}
+	s.removeColdFile(p.path)
+	return p.rows - n, nil
+}
+
+// coldUsage 返回冷数据文件的总字节数与总行数。
+func (s *Store) coldUsage(ctx context.Context) (int64, int64, error) {
+	var bytes, rows int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(sum(byte_size), 0), COALESCE(sum(row_count), 0) FROM cold_partitions`).Scan(&bytes, &rows); err != nil {
+		return 0, 0, fmt.Errorf("统计冷数据失败：%w", err)
+	}
+	return bytes, rows, nil
+}
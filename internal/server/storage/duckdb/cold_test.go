@@ -0,0 +1,336 @@
+package duckdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"lightobs/internal/server/storage"
+	"lightobs/internal/server/storage/storagetest"
+	"lightobs/pkg/model"
+)
+
+// sealingStore 每次写入后立即封存，一致性测试中早于一天的数据全部从 Parquet 文件读取。
+type sealingStore struct {
+	*Store
+}
+
+func (s sealingStore) Insert(ctx context.Context, l *model.TrafficLog) error {
+	if err := s.Store.Insert(ctx, l); err != nil {
+		return err
+	}
+	_, err := s.Seal(ctx)
+	return err
+}
+
+func (s sealingStore) InsertBatch(ctx context.Context, logs []model.TrafficLog) error {
+	if err := s.Store.InsertBatch(ctx, logs); err != nil {
+		return err
+	}
+	_, err := s.Seal(ctx)
+	return err
+}
+
+func TestStore_ConformanceColdTier(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		s, err := NewStore(filepath.Join(t.TempDir(), "traffic.duckdb"), WithColdTier(ColdTier{}))
+		if err != nil {
+			t.Fatalf("NewStore failed: %v", err)
+		}
+		return sealingStore{s}
+	})
+}
+
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(files)
+}
+
+func TestStore_ColdTier(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "traffic.duckdb")
+	s, err := NewStore(path, WithColdTier(ColdTier{SealAfter: time.Hour}))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	ctx := context.Background()
+
+	// 5 小时前到现在，每 2 分钟一条：封存边界之前有 4 个多完整或部分的小时分区。
+	now := time.Now().UTC()
+	start := now.Truncate(time.Hour).Add(-5 * time.Hour)
+	var logs []model.TrafficLog
+	for i, ts := 0, start; ts.Before(now); i, ts = i+1, ts.Add(2*time.Minute) {
+		l := model.TrafficLog{Timestamp: ts, SrcIP: "10.0.0.2", SrcPort: 40000 + i, DstIP: "10.0.0.1", DstPort: 80,
+			PID: 7 + i%2, HTTPMethod: "GET", HTTPPath: "/users/1", HTTPRoute: "/users/{id}", StatusCode: 200,
+			LatencyMS: int64(i%97 + 1), PacketSize: i}
+		if i%5 == 0 {
+			l.StatusCode = 500
+		}
+		logs = append(logs, l)
+	}
+	if err := s.InsertBatch(ctx, logs); err != nil {
+		t.Fatal(err)
+	}
+
+	// 封存前的结果作为基准。
+	statsQ := storage.StatsQuery{GroupBy: []storage.Dimension{storage.DimPID}}
+	seriesQ := storage.SeriesQuery{Step: 10 * time.Minute}
+	wantStats, err := s.statsRaw(ctx, statsQ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSeries, err := s.seriesRaw(ctx, seriesQ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPID, err := s.QueryByPID(ctx, 7, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.Seal(ctx)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	boundary := now.Add(-time.Hour).Truncate(time.Hour)
+	var sealed int64
+	for _, l := range logs {
+		if l.Timestamp.Before(boundary) {
+			sealed++
+		}
+	}
+	if res.Rows != sealed || res.Partitions != int(boundary.Sub(start)/time.Hour) {
+		t.Fatalf("Seal: res=%+v, want %d rows", res, sealed)
+	}
+	coldDir := path + ".cold"
+	if n := countFiles(t, coldDir); n != res.Partitions {
+		t.Errorf("%d parquet files, want %d", n, res.Partitions)
+	}
+	var hot int64
+	if err := s.db.QueryRow(`SELECT count(*) FROM traffic_logs`).Scan(&hot); err != nil || hot != int64(len(logs))-sealed {
+		t.Errorf("hot rows=%d err=%v", hot, err)
+	}
+	if again, err := s.Seal(ctx); err != nil || again.Partitions != 0 {
+		t.Errorf("second Seal: res=%+v err=%v", again, err)
+	}
+
+	// 查询同时覆盖热表与冷文件，结果与封存前相同。
+	gotPID, err := s.QueryByPID(ctx, 7, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotPID, wantPID) {
+		t.Errorf("QueryByPID differs after seal: %d vs %d rows", len(gotPID), len(wantPID))
+	}
+	if got, err := s.statsRaw(ctx, statsQ); err != nil || !reflect.DeepEqual(got, wantStats) {
+		t.Errorf("stats after seal:\n got %+v\nwant %+v (err=%v)", got, wantStats, err)
+	}
+	if got, err := s.seriesRaw(ctx, seriesQ); err != nil || !reflect.DeepEqual(got, wantSeries) {
+		t.Errorf("series after seal differs (err=%v)", err)
+	}
+
+	// 按时间范围裁剪冷文件：只查热数据时不读任何文件，查一个小时只读一个文件。
+	if files, err := coldFiles(ctx, s.db, boundary, time.Time{}); err != nil || len(files) != 0 {
+		t.Errorf("hot range reads %v (err=%v)", files, err)
+	}
+	if files, err := coldFiles(ctx, s.db, start.Add(time.Hour+time.Minute), start.Add(2*time.Hour)); err != nil || len(files) != 1 {
+		t.Errorf("one hour reads %v (err=%v)", files, err)
+	}
+	page, err := s.Query(ctx, storage.Filter{From: start.Add(time.Hour), To: start.Add(2 * time.Hour), Asc: true, Limit: 1000})
+	if err != nil || len(page.Items) != 30 {
+		t.Errorf("one cold hour: n=%d err=%v", len(page.Items), err)
+	}
+
+	// Parquet 导出同样包含冷数据。
+	out := filepath.Join(dir, "export.parquet")
+	if err := s.ExportParquet(ctx, storage.Filter{}, out); err != nil {
+		t.Fatal(err)
+	}
+	var exported int
+	if err := ReadParquet(ctx, out, func(*model.TrafficLog) error { exported++; return nil }); err != nil || exported != len(logs) {
+		t.Errorf("exported %d rows, want %d (err=%v)", exported, len(logs), err)
+	}
+
+	// 保留策略：整个早于截止时间的文件被删除，跨过截止时间的文件被改写。
+	cutoff := start.Add(90 * time.Minute)
+	var before int64
+	for _, l := range logs {
+		if l.Timestamp.Before(cutoff) {
+			before++
+		}
+	}
+	pruned, err := s.deleteBefore(ctx, cutoff)
+	if err != nil || pruned != before {
+		t.Fatalf("deleteBefore: n=%d err=%v, want %d", pruned, err, before)
+	}
+	if n := countFiles(t, coldDir); n != res.Partitions-1 {
+		t.Errorf("%d parquet files after prune, want %d", n, res.Partitions-1)
+	}
+	if oldest, ok, err := s.oldest(ctx); err != nil || !ok || oldest.Before(cutoff) {
+		t.Errorf("oldest=%v ok=%v err=%v", oldest, ok, err)
+	}
+	if _, rows, err := s.usage(ctx); err != nil || rows != int64(len(logs))-before {
+		t.Errorf("usage rows=%d err=%v, want %d", rows, err, int64(len(logs))-before)
+	}
+	s.Close()
+
+	// 不启用冷存储重新打开，仍能读到已封存的数据。
+	s, err = NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	all, err := s.QueryByIP(ctx, "10.0.0.1", 10000)
+	if err != nil || int64(len(all)) != int64(len(logs))-before {
+		t.Errorf("reopened: n=%d err=%v", len(all), err)
+	}
+	if res, err := s.Seal(ctx); err != nil || res.Partitions != 0 {
+		t.Errorf("Seal without cold tier: res=%+v err=%v", res, err)
+	}
+}
+
+func TestColdTier_Options(t *testing.T) {
+	if _, err := NewStore("", WithColdTier(ColdTier{})); err == nil {
+		t.Error("in-memory database without cold dir accepted")
+	}
+	if _, err := NewStore(filepath.Join(t.TempDir(), "x.duckdb"), WithColdTier(ColdTier{Partition: 2 * time.Hour})); err == nil {
+		t.Error("2h partition accepted")
+	}
+	dir := filepath.Join(t.TempDir(), "cold")
+	s, err := NewStore(filepath.Join(t.TempDir(), "x.duckdb"), WithColdTier(ColdTier{Dir: dir, Partition: 24 * time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("cold dir not created: %v", err)
+	}
+}
+
+// 翻页途中封存与删除数据：时间相同的记录靠 id 排序，游标不受 rowid 变化影响。
+func TestStore_PagingAcrossSeal(t *testing.T) {
+	s, err := NewStore(filepath.Join(t.TempDir(), "traffic.duckdb"), WithColdTier(ColdTier{SealAfter: time.Hour}))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	old := time.Now().UTC().Add(-48 * time.Hour).Truncate(time.Second)
+	recent := time.Now().UTC().Truncate(time.Second)
+	var logs []model.TrafficLog
+	for i := 0; i < 10; i++ {
+		logs = append(logs, model.TrafficLog{Timestamp: old, SrcIP: "10.0.0.2", SrcPort: 40000 + i, DstIP: "10.0.0.1", DstPort: 80,
+			HTTPMethod: "GET", HTTPPath: "/a", StatusCode: 200})
+	}
+	for i := 0; i < 4; i++ {
+		logs = append(logs, model.TrafficLog{Timestamp: recent, SrcIP: "10.0.0.3", SrcPort: 50000 + i, DstIP: "10.0.0.1", DstPort: 80,
+			HTTPMethod: "GET", HTTPPath: "/a", StatusCode: 200})
+	}
+	if err := s.InsertBatch(ctx, logs[:5]); err != nil {
+		t.Fatal(err)
+	}
+	// 单条写入走 INSERT 语句，id 取列的默认值。
+	for i := range logs[5:] {
+		if err := s.Insert(ctx, &logs[5+i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := storage.Filter{DstIP: "10.0.0.1", Asc: true, Limit: 3}
+	var got []int
+	for page := 0; ; page++ {
+		p, err := s.Query(ctx, f)
+		if err != nil {
+			t.Fatalf("page %d: %v", page, err)
+		}
+		for _, l := range p.Items {
+			got = append(got, l.SrcPort)
+		}
+		switch page {
+		case 0:
+			if res, err := s.Seal(ctx); err != nil || res.Rows != 10 {
+				t.Fatalf("Seal: res=%+v err=%v", res, err)
+			}
+		case 2:
+			// 翻页途中删除一条尚未读到的记录。
+			if _, err := s.db.ExecContext(ctx, `DELETE FROM traffic_logs WHERE src_port = 50003`); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if p.Next == nil {
+			break
+		}
+		f.After = p.Next
+	}
+	want := []int{40000, 40001, 40002, 40003, 40004, 40005, 40006, 40007, 40008, 40009, 50000, 50001, 50002}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("paged src ports = %v, want %v", got, want)
+	}
+}
+
+func TestStore_PruneWaitsForColdReads(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(filepath.Join(dir, "traffic.duckdb"), WithColdTier(ColdTier{SealAfter: time.Hour}))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	old := time.Now().UTC().Add(-48 * time.Hour).Truncate(time.Hour)
+	if err := s.InsertBatch(ctx, storagetest.BatchLogs(old, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := s.Seal(ctx); err != nil || res.Partitions != 1 {
+		t.Fatalf("Seal: res=%+v err=%v", res, err)
+	}
+	coldDir := s.cold.Dir
+
+	// 查询已经确定了要读的文件，清理在它读完之前不能删除文件。
+	started, release := make(chan struct{}), make(chan struct{})
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- s.read(ctx, time.Time{}, time.Time{}, func(tx *sql.Tx, src string) error {
+			close(started)
+			<-release
+			var n int
+			if err := tx.QueryRowContext(ctx, `SELECT count(*) FROM `+src).Scan(&n); err != nil {
+				return err
+			}
+			if n != 10 {
+				return fmt.Errorf("count=%d want 10", n)
+			}
+			return nil
+		})
+	}()
+	<-started
+	pruned := make(chan error, 1)
+	go func() {
+		_, err := s.Prune(ctx, storage.RetentionPolicy{MaxAge: time.Hour})
+		pruned <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if n := countFiles(t, coldDir); n != 1 {
+		t.Errorf("cold file removed during read: files=%d", n)
+	}
+	close(release)
+	if err := <-readErr; err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if err := <-pruned; err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if n := countFiles(t, coldDir); n != 0 {
+		t.Errorf("files after prune=%d want 0", n)
+	}
+}
@@ -0,0 +1,47 @@
+package duckdb
+
+import "lightobs/internal/server/storage"
+
+// migrations 是 DuckDB 库的表结构变更，只能在末尾追加。
+// 引入版本号之前的库会从头执行一遍，因此全部使用 IF NOT EXISTS。
+var migrations = []storage.Migration{
+	{Version: 1, Description: "traffic_logs 表", Up: storage.Statements(`
+CREATE TABLE IF NOT EXISTS traffic_logs (
+	timestamp   TIMESTAMP,
+	src_ip      VARCHAR,
+	src_port    INTEGER,
+	dst_ip      VARCHAR,
+	dst_port    INTEGER,
+	http_method VARCHAR,
+	http_path   VARCHAR,
+	status_code INTEGER,
+	latency_ms  BIGINT,
+	packet_size INTEGER
+)`)},
+	{Version: 2, Description: "pid 列", Up: storage.Statements(
+		`ALTER TABLE traffic_logs ADD COLUMN IF NOT EXISTS pid INTEGER`,
+	)},
+	{Version: 3, Description: "http_query、http_route 列", Up: storage.Statements(
+		`ALTER TABLE traffic_logs ADD COLUMN IF NOT EXISTS http_query VARCHAR`,
+		`ALTER TABLE traffic_logs ADD COLUMN IF NOT EXISTS http_route VARCHAR`,
+	)},
+	{Version: 4, Description: "预聚合表", Up: storage.Statements(storage.RollupSchema()...)},
+	{Version: 5, Description: "冷分区目录", Up: storage.Statements(`
+CREATE TABLE IF NOT EXISTS cold_partitions (
+	path            VARCHAR PRIMARY KEY,
+	partition_start TIMESTAMP,
+	min_ts          TIMESTAMP,
+	max_ts          TIMESTAMP,
+	row_count       BIGINT,
+	byte_size       BIGINT,
+	max_row_id      BIGINT,
+	sealed_at       TIMESTAMP
+)`)},
+	// DuckDB 的 rowid 在删除与封存后可能被复用或重新编号，不能作为翻页游标的第二排序键。
+	// 已有的行按 rowid 顺序分配 id。
+	{Version: 6, Description: "id 列", Up: storage.Statements(
+		`CREATE SEQUENCE IF NOT EXISTS traffic_logs_id_seq START 1`,
+		`ALTER TABLE traffic_logs ADD COLUMN IF NOT EXISTS id BIGINT DEFAULT nextval('traffic_logs_id_seq')`,
+	)},
+	{Version: 7, Description: "迟到数据记录表", Up: storage.Statements(storage.LateRollupSchema()...)},
+}
@@ -0,0 +1,132 @@
+package duckdb
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"lightobs/internal/server/storage"
+	"lightobs/internal/server/storage/storagetest"
+	"lightobs/pkg/model"
+)
+
+// openFixture 用 testdata 中的脚本建出旧版本的库，返回库文件路径。
+func openFixture(t *testing.T, name string) string {
+	t.Helper()
+	script, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "traffic.duckdb")
+	db, err := sql.Open("duckdb", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(string(script)); err != nil {
+		t.Fatalf("apply %s: %v", name, err)
+	}
+	return path
+}
+
+func TestMigrate_UpgradeFixtures(t *testing.T) {
+	for _, name := range []string{"v0_no_pid.sql", "v0_baseline.sql", "v2.sql"} {
+		t.Run(name, func(t *testing.T) {
+			path := openFixture(t, name)
+			ctx := context.Background()
+
+			s, err := NewStore(path)
+			if err != nil {
+				t.Fatalf("NewStore failed: %v", err)
+			}
+			if v, err := storage.SchemaVersion(ctx, s.db); err != nil || v != len(migrations) {
+				t.Fatalf("version=%d err=%v, want %d", v, err, len(migrations))
+			}
+
+			rows, err := s.db.QueryContext(ctx, `SELECT column_name FROM information_schema.columns WHERE table_name = 'traffic_logs'`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cols := map[string]bool{}
+			for rows.Next() {
+				var c string
+				if err := rows.Scan(&c); err != nil {
+					t.Fatal(err)
+				}
+				cols[c] = true
+			}
+			rows.Close()
+			for _, c := range storage.ExportColumns {
+				if !cols[c] {
+					t.Errorf("column %s missing after migration", c)
+				}
+			}
+			// 已有的行按写入顺序分配了 id。
+			var ids, distinct int
+			if err := s.db.QueryRowContext(ctx, `SELECT count(id), count(DISTINCT id) FROM traffic_logs`).Scan(&ids, &distinct); err != nil || ids != 2 || distinct != 2 {
+				t.Errorf("ids=%d distinct=%d err=%v", ids, distinct, err)
+			}
+
+			// 旧数据升级后仍可读，新列为空值。
+			old, err := s.QueryByIP(ctx, "10.0.0.1", 10)
+			if err != nil || len(old) != 2 {
+				t.Fatalf("old rows: n=%d err=%v", len(old), err)
+			}
+			for _, l := range old {
+				if l.HTTPRoute != "" || l.HTTPQuery != "" {
+					t.Errorf("old row has route/query: %+v", l)
+				}
+				if l.HTTPPath == "/users/1" && name != "v0_no_pid.sql" && l.PID != 4242 {
+					t.Errorf("old row lost pid: %+v", l)
+				}
+			}
+
+			now := time.Now().UTC().Truncate(time.Second)
+			if err := s.InsertBatch(ctx, storagetest.BatchLogs(now.Add(-2*time.Hour), 50)); err != nil {
+				t.Fatalf("InsertBatch failed: %v", err)
+			}
+			if err := s.Insert(ctx, &model.TrafficLog{Timestamp: now, SrcIP: "10.0.0.3", DstIP: "10.0.0.1", DstPort: 80,
+				PID: 7, HTTPMethod: "GET", HTTPPath: "/a", HTTPQuery: "x=1", HTTPRoute: "/a", StatusCode: 200}); err != nil {
+				t.Fatalf("Insert failed: %v", err)
+			}
+			if res, err := s.Rollup(ctx, storage.RollupPolicy{}); err != nil || res.Written == 0 {
+				t.Fatalf("Rollup: res=%+v err=%v", res, err)
+			}
+			s.Close()
+
+			// 再次打开不会重复执行迁移。
+			s, err = NewStore(path)
+			if err != nil {
+				t.Fatalf("reopen failed: %v", err)
+			}
+			defer s.Close()
+			var n int
+			if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_version`).Scan(&n); err != nil || n != len(migrations) {
+				t.Errorf("schema_version rows=%d err=%v", n, err)
+			}
+		})
+	}
+}
+
+func TestMigrate_RejectNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.duckdb")
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	if _, err := s.db.Exec(`INSERT INTO schema_version (version, description) VALUES (99, 'future')`); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if s, err := NewStore(path); err == nil || !strings.Contains(err.Error(), "请升级程序") {
+		if s != nil {
+			s.Close()
+		}
+		t.Fatalf("err=%v, want newer schema rejected", err)
+	}
+}
@@ -0,0 +1,100 @@
+package duckdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"lightobs/internal/server/storage"
+	"lightobs/pkg/model"
+)
+
+// parquetColumnTypes 是读取 Parquet 时各列转换成的类型，缺少的列按零值处理。
+var parquetColumnTypes = map[string]string{
+	"timestamp":   "TIMESTAMP",
+	"src_ip":      "VARCHAR",
+	"src_port":    "BIGINT",
+	"dst_ip":      "VARCHAR",
+	"dst_port":    "BIGINT",
+	"pid":         "BIGINT",
+	"http_method": "VARCHAR",
+	"http_path":   "VARCHAR",
+	"http_query":  "VARCHAR",
+	"http_route":  "VARCHAR",
+	"status_code": "BIGINT",
+	"latency_ms":  "BIGINT",
+	"packet_size": "BIGINT",
+}
+
+// ReadParquet 用内存中的 DuckDB 逐行读取 Parquet 文件中的 TrafficLog，与当前使用的存储后端无关。
+// 列按名称匹配（与 storage.ExportColumns 相同），多余的列被忽略；fn 返回错误时停止读取。
+func ReadParquet(ctx context.Context, path string, fn func(*model.TrafficLog) error) error {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		return fmt.Errorf("打开 DuckDB 失败：%w", err)
+	}
+	defer db.Close()
+
+	probe, err := db.QueryContext(ctx, `SELECT * FROM read_parquet(?) LIMIT 0`, path)
+	if err != nil {
+		return fmt.Errorf("读取 Parquet 失败：%w", err)
+	}
+	cols, err := probe.Columns()
+	probe.Close()
+	if err != nil {
+		return fmt.Errorf("读取 Parquet 失败：%w", err)
+	}
+	present := make(map[string]bool, len(cols))
+	for _, c := range cols {
+		present[strings.ToLower(c)] = true
+	}
+
+	exprs := make([]string, len(storage.ExportColumns))
+	for i, col := range storage.ExportColumns {
+		typ := parquetColumnTypes[col]
+		switch {
+		case !present[col] && col == "timestamp":
+			exprs[i] = "NULL::TIMESTAMP"
+		case !present[col] && typ == "VARCHAR":
+			exprs[i] = "''"
+		case !present[col]:
+			exprs[i] = "0"
+		case typ == "VARCHAR":
+			exprs[i] = fmt.Sprintf(`COALESCE(CAST("%s" AS VARCHAR), '')`, col)
+		case typ == "TIMESTAMP":
+			exprs[i] = fmt.Sprintf(`CAST("%s" AS TIMESTAMP)`, col)
+		default:
+			exprs[i] = fmt.Sprintf(`COALESCE(CAST("%s" AS BIGINT), 0)`, col)
+		}
+	}
+	rows, err := db.QueryContext(ctx, `SELECT `+strings.Join(exprs, ", ")+` FROM read_parquet(?)`, path)
+	if err != nil {
+		return fmt.Errorf("读取 Parquet 失败：%w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			ts                                           sql.NullTime
+			srcPort, dstPort, pid, status, latency, size int64
+			l                                            model.TrafficLog
+		)
+		if err := rows.Scan(&ts, &l.SrcIP, &srcPort, &l.DstIP, &dstPort, &pid,
+			&l.HTTPMethod, &l.HTTPPath, &l.HTTPQuery, &l.HTTPRoute, &status, &latency, &size); err != nil {
+			return fmt.Errorf("读取 Parquet 行失败：%w", err)
+		}
+		if ts.Valid {
+			l.Timestamp = ts.Time.UTC()
+		}
+		l.SrcPort, l.DstPort, l.PID = int(srcPort), int(dstPort), int(pid)
+		l.StatusCode, l.LatencyMS, l.PacketSize = int(status), latency, int(size)
+		if err := fn(&l); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("读取 Parquet 失败：%w", err)
+	}
+	return nil
+}
@@ -3,27 +3,54 @@ package duckdb
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
-	_ "github.com/marcboeker/go-duckdb"
+	goduckdb "github.com/marcboeker/go-duckdb"
 
+	"lightobs/internal/server/storage"
 	"lightobs/pkg/model"
 )
 
 type Store struct {
-	db   *sql.DB
-	ins  *sql.Stmt
-	path string
+	db  *sql.DB
+	ins *sql.Stmt
+	// appendCols 按 traffic_logs 的实际列顺序给出 Appender 每列的取值，
+	// 旧库通过 ADD COLUMN 补上的列排在最后，顺序与建表语句不同。
+	appendCols []func(*model.TrafficLog) driver.Value
+	// idCol 是 id 列在 appendCols 中的位置：Appender 不计算默认值，id 须预先从序列中取出。
+	idCol   int
+	rollups *storage.SQLRollups
+	path    string
+
+	// cold 非空时由 Seal 把旧分区封存为 Parquet 文件；coldMu 串行化封存与删除冷数据。
+	cold   *ColdTier
+	coldMu sync.Mutex
+	// filesMu 保护冷文件的删除：read 从确定文件列表到读完一直持有读锁，
+	// 删除文件前取写锁，等待已经引用该文件的查询结束。
+	filesMu sync.RWMutex
 }
 
-func NewStore(path string) (*Store, error) {
+func NewStore(path string, opts ...Option) (*Store, error) {
+	s := &Store{path: path}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.cold != nil {
+		if err := s.cold.init(path); err != nil {
+			return nil, err
+		}
+	}
+
 	// DuckDB 是嵌入式分析型数据库：单文件、零依赖，适合本项目在本地/集群内快速落盘与查询。
 	db, err := sql.Open("duckdb", path)
 	if err != nil {
 		return nil, fmt.Errorf("打开 DuckDB 失败：%w", err)
 	}
-
-	s := &Store{db: db, path: path}
+	s.db = db
 	if err := s.init(); err != nil {
 		_ = db.Close()
 		return nil, err
@@ -32,38 +59,26 @@ func NewStore(path string) (*Store, error) {
 }
 
 func (s *Store) init() error {
-	ddl := `
-CREATE TABLE IF NOT EXISTS traffic_logs (
-	timestamp   TIMESTAMP,
-	src_ip      VARCHAR,
-	src_port    INTEGER,
-	dst_ip      VARCHAR,
-	dst_port    INTEGER,
-	pid         INTEGER,
-	http_method VARCHAR,
-	http_path   VARCHAR,
-	status_code INTEGER,
-	latency_ms  BIGINT,
-	packet_size INTEGER
-);`
-	if _, err := s.db.Exec(ddl); err != nil {
-		return fmt.Errorf("建表失败：%w", err)
-	}
-	if _, err := s.db.Exec(`ALTER TABLE traffic_logs ADD COLUMN IF NOT EXISTS pid INTEGER;`); err != nil {
-		return fmt.Errorf("更新表结构失败：%w", err)
+	if err := storage.Migrate(context.Background(), s.db, migrations); err != nil {
+		return err
 	}
 
 	// 插入使用 prepared statement，减少每次写入的 SQL 解析开销。
 	stmt, err := s.db.Prepare(`
 INSERT INTO traffic_logs (
 	timestamp, src_ip, src_port, dst_ip, dst_port, pid,
-	http_method, http_path, status_code, latency_ms, packet_size
-) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+	http_method, http_path, http_query, http_route, status_code, latency_ms, packet_size
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 `)
 	if err != nil {
 		return fmt.Errorf("准备插入语句失败：%w", err)
 	}
 	s.ins = stmt
+	if err := s.initAppendColumns(); err != nil {
+		return err
+	}
+
+	s.rollups = storage.NewSQLRollups(s.db, s.Query)
 	return nil
 }
 
@@ -80,6 +95,8 @@ func (s *Store) Insert(ctx context.Context, logEntry *model.TrafficLog) error {
 		logEntry.PID,
 		logEntry.HTTPMethod,
 		logEntry.HTTPPath,
+		logEntry.HTTPQuery,
+		logEntry.HTTPRoute,
 		logEntry.StatusCode,
 		logEntry.LatencyMS,
 		logEntry.PacketSize,
@@ -87,95 +104,393 @@ func (s *Store) Insert(ctx context.Context, logEntry *model.TrafficLog) error {
 	if err != nil {
 		return fmt.Errorf("插入失败：%w", err)
 	}
+	s.rollups.Inserted(ctx, *logEntry)
 	return nil
 }
 
-func (s *Store) QueryByIP(ctx context.Context, ip string, limit int) ([]model.TrafficLog, error) {
-	if limit <= 0 {
-		limit = 200
-	}
+// appendValues 是各列传给 Appender 的值，类型须与列类型严格一致（INTEGER 为 int32，BIGINT 为 int64）。
+var appendValues = map[string]func(*model.TrafficLog) driver.Value{
+	"timestamp":   func(l *model.TrafficLog) driver.Value { return l.Timestamp },
+	"src_ip":      func(l *model.TrafficLog) driver.Value { return l.SrcIP },
+	"src_port":    func(l *model.TrafficLog) driver.Value { return int32(l.SrcPort) },
+	"dst_ip":      func(l *model.TrafficLog) driver.Value { return l.DstIP },
+	"dst_port":    func(l *model.TrafficLog) driver.Value { return int32(l.DstPort) },
+	"pid":         func(l *model.TrafficLog) driver.Value { return int32(l.PID) },
+	"http_method": func(l *model.TrafficLog) driver.Value { return l.HTTPMethod },
+	"http_path":   func(l *model.TrafficLog) driver.Value { return l.HTTPPath },
+	"http_query":  func(l *model.TrafficLog) driver.Value { return l.HTTPQuery },
+	"http_route":  func(l *model.TrafficLog) driver.Value { return l.HTTPRoute },
+	"status_code": func(l *model.TrafficLog) driver.Value { return int32(l.StatusCode) },
+	"latency_ms":  func(l *model.TrafficLog) driver.Value { return l.LatencyMS },
+	"packet_size": func(l *model.TrafficLog) driver.Value { return int32(l.PacketSize) },
+}
 
-	rows, err := s.db.QueryContext(ctx, `
-SELECT
-	timestamp, src_ip, src_port, dst_ip, dst_port, COALESCE(pid, 0),
-	http_method, http_path, status_code, latency_ms, packet_size
-FROM traffic_logs
-WHERE src_ip = ? OR dst_ip = ?
-ORDER BY timestamp DESC
-LIMIT ?;
-`, ip, ip, limit)
+func (s *Store) initAppendColumns() error {
+	rows, err := s.db.Query(`
+SELECT column_name FROM information_schema.columns
+WHERE table_name = 'traffic_logs'
+ORDER BY ordinal_position`)
 	if err != nil {
-		return nil, fmt.Errorf("查询失败：%w", err)
+		return fmt.Errorf("读取表结构失败：%w", err)
 	}
 	defer rows.Close()
-
-	out := make([]model.TrafficLog, 0, 64)
+	s.appendCols = s.appendCols[:0]
+	s.idCol = -1
 	for rows.Next() {
-		var r model.TrafficLog
-		if err := rows.Scan(
-			&r.Timestamp,
-			&r.SrcIP,
-			&r.SrcPort,
-			&r.DstIP,
-			&r.DstPort,
-			&r.PID,
-			&r.HTTPMethod,
-			&r.HTTPPath,
-			&r.StatusCode,
-			&r.LatencyMS,
-			&r.PacketSize,
-		); err != nil {
-			return nil, fmt.Errorf("读取行失败：%w", err)
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("读取表结构失败：%w", err)
+		}
+		if name == "id" {
+			s.idCol = len(s.appendCols)
+		}
+		fn, ok := appendValues[name]
+		if !ok {
+			// 不认识的列（如手工添加的）写 NULL。
+			fn = func(*model.TrafficLog) driver.Value { return nil }
+		}
+		s.appendCols = append(s.appendCols, fn)
+	}
+	return rows.Err()
+}
+
+// InsertBatch 用 Appender 写入，绕过 SQL 解析与逐行绑定参数；整批在一个事务中提交。
+func (s *Store) InsertBatch(ctx context.Context, logs []model.TrafficLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("获取连接失败：%w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `BEGIN TRANSACTION`); err != nil {
+		return fmt.Errorf("开启事务失败：%w", err)
+	}
+	ids, err := nextIDs(ctx, conn, len(logs))
+	if err != nil {
+		_, _ = conn.ExecContext(context.Background(), `ROLLBACK`)
+		return fmt.Errorf("分配 id 失败：%w", err)
+	}
+	err = conn.Raw(func(dc any) error {
+		app, err := goduckdb.NewAppenderFromConn(dc.(driver.Conn), "", "traffic_logs")
+		if err != nil {
+			return err
+		}
+		row := make([]driver.Value, len(s.appendCols))
+		for i := range logs {
+			for j, col := range s.appendCols {
+				row[j] = col(&logs[i])
+			}
+			if s.idCol >= 0 {
+				row[s.idCol] = ids[i]
+			}
+			if err := app.AppendRow(row...); err != nil {
+				_ = app.Close()
+				return err
+			}
 		}
-		out = append(out, r)
+		return app.Close()
+	})
+	if err != nil {
+		_, _ = conn.ExecContext(context.Background(), `ROLLBACK`)
+		return fmt.Errorf("批量插入失败：%w", err)
+	}
+	if _, err := conn.ExecContext(ctx, `COMMIT`); err != nil {
+		_, _ = conn.ExecContext(context.Background(), `ROLLBACK`)
+		return fmt.Errorf("提交事务失败：%w", err)
+	}
+	s.rollups.Inserted(ctx, logs...)
+	return nil
+}
+
+// nextIDs 从 id 序列中按顺序取 n 个值。
+func nextIDs(ctx context.Context, conn *sql.Conn, n int) ([]int64, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT nextval('traffic_logs_id_seq') AS id FROM range(?) ORDER BY id`, n)
+	if err != nil {
+		return nil, err
 	}
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("遍历结果失败：%w", err)
+	defer rows.Close()
+	ids := make([]int64, 0, n)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
 	}
-	return out, nil
+	return ids, rows.Err()
+}
+
+func (s *Store) QueryByIP(ctx context.Context, ip string, limit int) ([]model.TrafficLog, error) {
+	page, err := s.Query(ctx, storage.Filter{IP: ip, Limit: limit})
+	return page.Items, err
 }
 
 func (s *Store) QueryByPID(ctx context.Context, pid int, limit int) ([]model.TrafficLog, error) {
-	if limit <= 0 {
-		limit = 200
+	page, err := s.Query(ctx, storage.Filter{PID: pid, Limit: limit})
+	return page.Items, err
+}
+
+// Query 多取一条用于判断是否还有下一页，下一页游标取自本页最后一条记录的 (timestamp, id)。
+// 数据来源（见 source）把 id 列作为 rowid 列给出，排序与游标条件无需区分后端。
+func (s *Store) Query(ctx context.Context, f storage.Filter) (storage.Page, error) {
+	if f.After != nil && !f.After.Matches(f) {
+		return storage.Page{}, storage.ErrCursorMismatch
 	}
-	rows, err := s.db.QueryContext(ctx, `
+	limit := f.EffectiveLimit()
+	where, args := f.Where()
+	args = append(args, limit+1)
+	var page storage.Page
+	err := s.read(ctx, f.From, f.To, func(tx *sql.Tx, src string) error {
+		rows, err := tx.QueryContext(ctx, `
 SELECT
-	timestamp, src_ip, src_port, dst_ip, dst_port, COALESCE(pid, 0),
-	http_method, http_path, status_code, latency_ms, packet_size
-FROM traffic_logs
-WHERE pid = ?
-ORDER BY timestamp DESC
+	rowid, timestamp, src_ip, src_port, dst_ip, dst_port, COALESCE(pid, 0),
+	http_method, http_path, COALESCE(http_query, ''), COALESCE(http_route, ''),
+	status_code, latency_ms, packet_size
+FROM `+src+`
+WHERE `+where+`
+ORDER BY `+f.OrderBy()+`
 LIMIT ?;
-`, pid, limit)
+`, args...)
+		if err != nil {
+			return fmt.Errorf("查询失败：%w", err)
+		}
+		defer rows.Close()
+
+		out := make([]model.TrafficLog, 0, 64)
+		var lastRowID int64
+		for rows.Next() {
+			if len(out) == limit {
+				page = storage.Page{Items: out, Next: f.CursorFor(&out[len(out)-1], lastRowID)}
+				return nil
+			}
+			var r model.TrafficLog
+			if err := rows.Scan(
+				&lastRowID,
+				&r.Timestamp,
+				&r.SrcIP,
+				&r.SrcPort,
+				&r.DstIP,
+				&r.DstPort,
+				&r.PID,
+				&r.HTTPMethod,
+				&r.HTTPPath,
+				&r.HTTPQuery,
+				&r.HTTPRoute,
+				&r.StatusCode,
+				&r.LatencyMS,
+				&r.PacketSize,
+			); err != nil {
+				return fmt.Errorf("读取行失败：%w", err)
+			}
+			out = append(out, r)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("遍历结果失败：%w", err)
+		}
+		page = storage.Page{Items: out}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("查询失败：%w", err)
+		return storage.Page{}, err
 	}
-	defer rows.Close()
-	out := make([]model.TrafficLog, 0, 64)
-	for rows.Next() {
-		var r model.TrafficLog
-		if err := rows.Scan(
-			&r.Timestamp,
-			&r.SrcIP,
-			&r.SrcPort,
-			&r.DstIP,
-			&r.DstPort,
-			&r.PID,
-			&r.HTTPMethod,
-			&r.HTTPPath,
-			&r.StatusCode,
-			&r.LatencyMS,
-			&r.PacketSize,
-		); err != nil {
-			return nil, fmt.Errorf("读取行失败：%w", err)
+	return page, nil
+}
+
+// Stats 优先读预聚合表，无法覆盖请求的范围或条件时查原始表。
+func (s *Store) Stats(ctx context.Context, q storage.StatsQuery) ([]storage.StatsRow, error) {
+	if rows, ok, err := s.rollups.Stats(ctx, q, time.Now()); ok || err != nil {
+		return rows, err
+	}
+	return s.statsRaw(ctx, q)
+}
+
+// statsRaw 直接使用 DuckDB 的聚合过滤与 quantile_disc：取第一个满足 rank >= p*n 的值，
+// 与 SQLite、内存后端的 nearest-rank 分位数一致，/stats 的结果不随后端变化。
+func (s *Store) statsRaw(ctx context.Context, q storage.StatsQuery) ([]storage.StatsRow, error) {
+	f := q.Filter
+	f.After = nil
+	where, args := f.Where()
+	groupCols, groupBy := q.GroupSQL("VARCHAR")
+	args = append(args, q.EffectiveLimit())
+	var out []storage.StatsRow
+	err := s.read(ctx, f.From, f.To, func(tx *sql.Tx, src string) error {
+		rows, err := tx.QueryContext(ctx, `
+SELECT `+groupCols+`
+	count(*) AS cnt,
+	count(*) FILTER (WHERE `+storage.ErrorCondition+`) AS errs,
+	avg(latency_ms) AS avg_ms,
+	quantile_disc(latency_ms, 0.5) AS p50,
+	quantile_disc(latency_ms, 0.9) AS p90,
+	quantile_disc(latency_ms, 0.99) AS p99
+FROM `+src+`
+WHERE `+where+`
+`+groupBy+`
+ORDER BY `+q.OrderBy()+`
+LIMIT ?;
+`, args...)
+		if err != nil {
+			return fmt.Errorf("聚合查询失败：%w", err)
+		}
+		defer rows.Close()
+		out, err = storage.ScanStatsRows(rows, len(q.GroupBy))
+		return err
+	})
+	return out, err
+}
+
+// Series 与 Stats 一样优先读预聚合表。
+func (s *Store) Series(ctx context.Context, q storage.SeriesQuery) ([]storage.SeriesPoint, error) {
+	if points, ok, err := s.rollups.Series(ctx, q, time.Now()); ok || err != nil {
+		return points, err
+	}
+	return s.seriesRaw(ctx, q)
+}
+
+func (s *Store) seriesRaw(ctx context.Context, q storage.SeriesQuery) ([]storage.SeriesPoint, error) {
+	f := q.Filter
+	f.After = nil
+	where, whereArgs := f.Where()
+	groupCols, _ := q.Stats().GroupSQL("VARCHAR")
+	step := q.StepSeconds()
+	args := append([]any{step, step}, whereArgs...)
+	var out []storage.SeriesPoint
+	err := s.read(ctx, f.From, f.To, func(tx *sql.Tx, src string) error {
+		rows, err := tx.QueryContext(ctx, `
+SELECT
+	CAST(floor(epoch(timestamp) / ?) AS BIGINT) * ? AS bucket,
+	`+groupCols+`
+	count(*) AS cnt,
+	count(*) FILTER (WHERE `+storage.ErrorCondition+`) AS errs,
+	avg(latency_ms) AS avg_ms,
+	quantile_disc(latency_ms, 0.5) AS p50,
+	quantile_disc(latency_ms, 0.9) AS p90,
+	quantile_disc(latency_ms, 0.99) AS p99
+FROM `+src+`
+WHERE `+where+`
+GROUP BY `+q.GroupKeys()+`
+ORDER BY `+q.OrderBy()+`;
+`, args...)
+		if err != nil {
+			return fmt.Errorf("时序查询失败：%w", err)
 		}
-		out = append(out, r)
+		defer rows.Close()
+		out, err = storage.ScanSeriesRows(rows, len(q.GroupBy))
+		return err
+	})
+	return out, err
+}
+
+// Prune 按保留策略删除最旧的数据，热表与冷文件一并处理。删除释放的块在 checkpoint 后由 DuckDB 复用，文件不会缩小。
+func (s *Store) Prune(ctx context.Context, p storage.RetentionPolicy) (storage.PruneResult, error) {
+	return storage.Prune(ctx, p, time.Now(), storage.PruneOps{
+		Oldest:       s.oldest,
+		DeleteBefore: s.deleteBefore,
+		Usage:        s.usage,
+	})
+}
+
+func (s *Store) oldestHot(ctx context.Context) (time.Time, bool, error) {
+	// 不用 MIN()：聚合结果丢失列类型，驱动不会转换为 time.Time；ORDER BY + LIMIT 同样走索引。
+	var t time.Time
+	err := s.db.QueryRowContext(ctx, `SELECT timestamp FROM traffic_logs ORDER BY timestamp LIMIT 1`).Scan(&t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("查询最早记录失败：%w", err)
+	}
+	return t, true, nil
+}
+
+// oldest 取热表与冷分区中较早的一个。
+func (s *Store) oldest(ctx context.Context) (time.Time, bool, error) {
+	t, ok, err := s.oldestHot(ctx)
+	if err != nil {
+		return t, ok, err
 	}
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("遍历结果失败：%w", err)
+	var cold time.Time
+	err = s.db.QueryRowContext(ctx, `SELECT min_ts FROM cold_partitions ORDER BY min_ts LIMIT 1`).Scan(&cold)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, ok, nil
 	}
-	return out, nil
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("读取冷分区目录失败：%w", err)
+	}
+	if !ok || cold.Before(t) {
+		return cold, true, nil
+	}
+	return t, true, nil
+}
+
+func (s *Store) deleteBefore(ctx context.Context, t time.Time) (int64, error) {
+	if err := s.rollups.Pruned(ctx, t); err != nil {
+		return 0, err
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM traffic_logs WHERE timestamp < ?`, t.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("删除过期数据失败：%w", err)
+	}
+	hot, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	cold, err := s.deleteColdBefore(ctx, t)
+	return hot + cold, err
+}
+
+// Usage 实现 storage.UsageReporter。
+func (s *Store) Usage(ctx context.Context) (int64, int64, error) {
+	return s.usage(ctx)
+}
+
+// usage 以已使用的块计算占用空间，加上冷数据文件的大小。先 CHECKPOINT 把 WAL 合并进主文件，否则新写入的数据不计入。
+func (s *Store) usage(ctx context.Context) (int64, int64, error) {
+	if _, err := s.db.ExecContext(ctx, `CHECKPOINT`); err != nil {
+		return 0, 0, fmt.Errorf("checkpoint 失败：%w", err)
+	}
+	var bytes, rows int64
+	if err := s.db.QueryRowContext(ctx, `SELECT used_blocks * block_size FROM pragma_database_size()`).Scan(&bytes); err != nil {
+		return 0, 0, fmt.Errorf("查询数据库大小失败：%w", err)
+	}
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM traffic_logs`).Scan(&rows); err != nil {
+		return 0, 0, fmt.Errorf("统计行数失败：%w", err)
+	}
+	coldBytes, coldRows, err := s.coldUsage(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return bytes + coldBytes, rows + coldRows, nil
+}
+
+func (s *Store) Rollup(ctx context.Context, p storage.RollupPolicy) (storage.RollupResult, error) {
+	return s.rollups.Run(ctx, p, time.Now())
+}
+
+// ExportParquet 用 COPY ... TO 直接写出 Parquet 文件，不经过 Go 侧逐行读取。
+// 列与 CSV/NDJSON 导出一致，pid、http_query、http_route 为空时输出 0 或空串。
+func (s *Store) ExportParquet(ctx context.Context, f storage.Filter, path string) error {
+	f.Sort, f.Asc, f.After = storage.SortTimestamp, true, nil
+	where, args := f.Where()
+	return s.read(ctx, f.From, f.To, func(tx *sql.Tx, src string) error {
+		// COPY 的目标文件不能使用占位符，只能写成字符串字面量。
+		_, err := tx.ExecContext(ctx, `
+COPY (
+	SELECT
+		timestamp, src_ip, src_port, dst_ip, dst_port, COALESCE(pid, 0) AS pid,
+		http_method, http_path, COALESCE(http_query, '') AS http_query, COALESCE(http_route, '') AS http_route,
+		status_code, latency_ms, packet_size
+	FROM `+src+`
+	WHERE `+where+`
+	ORDER BY `+f.OrderBy()+`
+) TO `+quote(path)+` (FORMAT PARQUET, COMPRESSION ZSTD);
+`, args...)
+		if err != nil {
+			return fmt.Errorf("导出 Parquet 失败：%w", err)
+		}
+		return nil
+	})
 }
 
 func (s *Store) Close() error {
@@ -0,0 +1,129 @@
+package duckdb
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lightobs/internal/server/storage"
+	"lightobs/internal/server/storage/storagetest"
+	"lightobs/pkg/model"
+)
+
+func TestStore_ExportParquet(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(filepath.Join(dir, "traffic.duckdb"))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := s.InsertBatch(ctx, storagetest.BatchLogs(base, 20)); err != nil {
+		t.Fatalf("InsertBatch failed: %v", err)
+	}
+
+	// 路径中的单引号需要转义。
+	path := filepath.Join(dir, "it's.parquet")
+	f := storage.Filter{From: base, Status: []storage.StatusRange{{Min: 500, Max: 599}}}
+	if err := s.ExportParquet(ctx, f, path); err != nil {
+		t.Fatalf("ExportParquet failed: %v", err)
+	}
+	page, err := s.Query(ctx, storage.Filter{From: base, Status: f.Status, Asc: true, Limit: 100})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT timestamp, src_ip, status_code, pid FROM read_parquet(?)`, path)
+	if err != nil {
+		t.Fatalf("read_parquet failed: %v", err)
+	}
+	defer rows.Close()
+	var n int
+	for rows.Next() {
+		var l model.TrafficLog
+		if err := rows.Scan(&l.Timestamp, &l.SrcIP, &l.StatusCode, &l.PID); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		if n >= len(page.Items) {
+			t.Fatalf("exported more rows than Query: %d", len(page.Items))
+		}
+		want := page.Items[n]
+		if !l.Timestamp.Equal(want.Timestamp) || l.SrcIP != want.SrcIP || l.StatusCode != want.StatusCode || l.PID != want.PID {
+			t.Errorf("row %d: got %+v want %+v", n, l, want)
+		}
+		n++
+	}
+	if n == 0 || n != len(page.Items) {
+		t.Errorf("exported %d rows, Query returned %d", n, len(page.Items))
+	}
+}
+
+func TestStore_InsertBatchLegacyColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.duckdb")
+	// 旧版本建的表没有 pid、http_query、http_route，补上的列排在最后，Appender 须按实际列顺序写入。
+	legacy, err := sql.Open("duckdb", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := legacy.Exec(`CREATE TABLE traffic_logs (
+	timestamp TIMESTAMP, src_ip VARCHAR, src_port INTEGER, dst_ip VARCHAR, dst_port INTEGER,
+	http_method VARCHAR, http_path VARCHAR, status_code INTEGER, latency_ms BIGINT, packet_size INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	legacy.Close()
+
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	logs := storagetest.BatchLogs(base, 3000)
+	if err := s.InsertBatch(ctx, logs); err != nil {
+		t.Fatalf("InsertBatch failed: %v", err)
+	}
+	if err := s.Insert(ctx, &model.TrafficLog{Timestamp: base.Add(time.Hour), SrcIP: "10.0.0.2", DstIP: "10.0.0.9", DstPort: 80,
+		HTTPMethod: "GET", HTTPPath: "/x", StatusCode: 200}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	var got []model.TrafficLog
+	if err := storage.Scan(ctx, s.Query, storage.Filter{Asc: true, To: base.Add(time.Hour)}, func(l *model.TrafficLog) error {
+		got = append(got, *l)
+		return nil
+	}); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(got) != len(logs) {
+		t.Fatalf("got %d rows, want %d", len(got), len(logs))
+	}
+	for i := range logs {
+		if got[i] != logs[i] {
+			t.Fatalf("row %d: got %+v want %+v", i, got[i], logs[i])
+		}
+	}
+}
+
+func BenchmarkStore(b *testing.B) {
+	storagetest.Bench(b, func(b *testing.B) storage.Store {
+		s, err := NewStore(filepath.Join(b.TempDir(), "traffic.duckdb"))
+		if err != nil {
+			b.Fatalf("NewStore failed: %v", err)
+		}
+		return s
+	})
+}
+
+func TestStore_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		s, err := NewStore(filepath.Join(t.TempDir(), "traffic.duckdb"))
+		if err != nil {
+			t.Fatalf("NewStore failed: %v", err)
+		}
+		return s
+	})
+}
@@ -0,0 +1,16 @@
+-- 最早的 DuckDB 库：还没有 pid 列，也没有 schema_version 表。
+CREATE TABLE traffic_logs (
+	timestamp   TIMESTAMP,
+	src_ip      VARCHAR,
+	src_port    INTEGER,
+	dst_ip      VARCHAR,
+	dst_port    INTEGER,
+	http_method VARCHAR,
+	http_path   VARCHAR,
+	status_code INTEGER,
+	latency_ms  BIGINT,
+	packet_size INTEGER
+);
+INSERT INTO traffic_logs VALUES
+	(date_trunc('minute', now()::TIMESTAMP) - INTERVAL 1 DAY, '10.0.0.2', 40000, '10.0.0.1', 80, 'GET', '/users/1', 200, 12, 300),
+	(date_trunc('minute', now()::TIMESTAMP) - INTERVAL 1 DAY + INTERVAL 1 SECOND, '10.0.0.2', 40001, '10.0.0.1', 80, 'POST', '/orders', 503, 900, 120);
@@ -0,0 +1,25 @@
+-- 版本 2 的 DuckDB 库：已有 schema_version 与 pid 列，还没有 http_query、http_route 与预聚合表。
+CREATE TABLE schema_version (
+	version     INTEGER PRIMARY KEY,
+	description VARCHAR,
+	applied_at  TIMESTAMP
+);
+INSERT INTO schema_version VALUES
+	(1, 'traffic_logs 表', '2024-05-01 00:00:00'),
+	(2, 'pid 列', '2024-05-01 00:00:00');
+CREATE TABLE traffic_logs (
+	timestamp   TIMESTAMP,
+	src_ip      VARCHAR,
+	src_port    INTEGER,
+	dst_ip      VARCHAR,
+	dst_port    INTEGER,
+	http_method VARCHAR,
+	http_path   VARCHAR,
+	status_code INTEGER,
+	latency_ms  BIGINT,
+	packet_size INTEGER,
+	pid         INTEGER
+);
+INSERT INTO traffic_logs VALUES
+	(date_trunc('minute', now()::TIMESTAMP) - INTERVAL 1 DAY, '10.0.0.2', 40000, '10.0.0.1', 80, 'GET', '/users/1', 200, 12, 300, 4242),
+	(date_trunc('minute', now()::TIMESTAMP) - INTERVAL 1 DAY + INTERVAL 1 SECOND, '10.0.0.2', 40001, '10.0.0.1', 80, 'POST', '/orders', 503, 900, 120, NULL);
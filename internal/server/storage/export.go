@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"lightobs/pkg/model"
+)
+
+// ExportFormat 是导出、导入文件的格式。
+type ExportFormat string
+
+const (
+	ExportNDJSON  ExportFormat = "ndjson"
+	ExportCSV     ExportFormat = "csv"
+	ExportParquet ExportFormat = "parquet"
+)
+
+func ParseExportFormat(s string) (ExportFormat, error) {
+	switch f := ExportFormat(strings.ToLower(s)); f {
+	case "", ExportNDJSON:
+		return ExportNDJSON, nil
+	case ExportCSV, ExportParquet:
+		return f, nil
+	}
+	return "", fmt.Errorf("不支持的导出格式：%s（可选 ndjson / csv / parquet）", s)
+}
+
+// ExportColumns 是导出文件的列，顺序与 traffic_logs 一致。
+var ExportColumns = []string{
+	"timestamp", "src_ip", "src_port", "dst_ip", "dst_port", "pid",
+	"http_method", "http_path", "http_query", "http_route",
+	"status_code", "latency_ms", "packet_size",
+}
+
+// ParquetExporter 由能够直接写出 Parquet 文件的后端实现（目前为 DuckDB）。
+type ParquetExporter interface {
+	// ExportParquet 把满足 f 的记录按时间升序写入 path，f 的排序、Limit 与游标不生效。
+	ExportParquet(ctx context.Context, f Filter, path string) error
+}
+
+// ParquetReader 逐行读取 Parquet 文件中的 TrafficLog，导入时使用，与当前使用的存储后端无关（目前由 DuckDB 实现）。
+type ParquetReader interface {
+	// ReadParquet 按名称匹配 ExportColumns 中的列，多余的列被忽略；fn 返回错误时停止读取。
+	ReadParquet(ctx context.Context, path string, fn func(*model.TrafficLog) error) error
+}
+
+// ParquetReaderFunc 让普通函数实现 ParquetReader。
+type ParquetReaderFunc func(ctx context.Context, path string, fn func(*model.TrafficLog) error) error
+
+func (f ParquetReaderFunc) ReadParquet(ctx context.Context, path string, fn func(*model.TrafficLog) error) error {
+	return f(ctx, path, fn)
+}
+
+// scanPageSize 是 Scan 每次从 Query 读取的条数。
+const scanPageSize = 5000
+
+// QueryFunc 是 Store.Query 的函数签名。
+type QueryFunc func(ctx context.Context, f Filter) (Page, error)
+
+// Scan 按 keyset 分页读取满足 f 的全部记录（按 f 的排序），每次只在内存中保留一页。
+// f 的 Limit 与游标不生效；fn 返回错误时停止并返回该错误。
+func Scan(ctx context.Context, query QueryFunc, f Filter, fn func(*model.TrafficLog) error) error {
+	f.Limit, f.After = scanPageSize, nil
+	for {
+		page, err := query(ctx, f)
+		if err != nil {
+			return err
+		}
+		for i := range page.Items {
+			if err := fn(&page.Items[i]); err != nil {
+				return err
+			}
+		}
+		if page.Next == nil {
+			return nil
+		}
+		f.After = page.Next
+	}
+}
@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"lightobs/pkg/model"
+)
+
+// SortField 是 Query 支持的排序字段。
+type SortField string
+
+const (
+	SortTimestamp SortField = "timestamp"
+	SortLatency   SortField = "latency"
+	SortStatus    SortField = "status"
+)
+
+var sortColumns = map[SortField]string{
+	SortTimestamp: "timestamp",
+	SortLatency:   "latency_ms",
+	SortStatus:    "status_code",
+}
+
+func ParseSortField(s string) (SortField, error) {
+	f := SortField(strings.ToLower(s))
+	if f == "" {
+		return SortTimestamp, nil
+	}
+	if _, ok := sortColumns[f]; !ok {
+		return "", fmt.Errorf("不支持的排序字段：%s（可选 timestamp / latency / status）", s)
+	}
+	return f, nil
+}
+
+// StatusRange 是闭区间 [Min, Max]，单个状态码时 Min == Max，5xx 即 [500, 599]。
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+// Filter 描述一次通用查询。各字段之间按 AND 组合，零值表示不过滤；
+// Status 内的多个区间按 OR 组合。
+type Filter struct {
+	// From/To 为左闭右开区间 [From, To)。
+	From time.Time
+	To   time.Time
+
+	// IP 同时匹配源和目的地址；SrcIP/DstIP 只匹配一侧。
+	IP    string
+	SrcIP string
+	DstIP string
+
+	SrcPort int
+	DstPort int
+	PID     int
+
+	Method string
+	// Path 匹配原始路径：含 * ? [ 时按 glob 匹配，否则按前缀匹配。
+	Path string
+	// Route 精确匹配路由模板，如 /users/{id}。
+	Route string
+
+	Status []StatusRange
+
+	// MinLatencyMS/MaxLatencyMS 为闭区间，0 表示不限制。
+	MinLatencyMS int64
+	MaxLatencyMS int64
+
+	Sort SortField
+	// Asc 为 true 时升序，默认降序（最新/最慢在前）。
+	Asc bool
+
+	Limit int
+	// After 非空时只返回排在该游标之后的记录（keyset 分页）。
+	After *Cursor
+}
+
+// DefaultLimit 是 Filter.Limit 未设置时返回的最大条数。
+const DefaultLimit = 200
+
+// IsGlob 判断路径条件是否为 glob 模式。
+func IsGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// Where 生成 WHERE 子句（不含 WHERE 关键字）与参数，占位符为 ?，SQLite 与 DuckDB 通用。
+// 没有任何条件时返回 "1=1"。
+func (f Filter) Where() (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(cond string, a ...any) {
+		conds = append(conds, cond)
+		args = append(args, a...)
+	}
+
+	if !f.From.IsZero() {
+		add("timestamp >= ?", f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		add("timestamp < ?", f.To.UTC())
+	}
+	if f.IP != "" {
+		add("(src_ip = ? OR dst_ip = ?)", f.IP, f.IP)
+	}
+	if f.SrcIP != "" {
+		add("src_ip = ?", f.SrcIP)
+	}
+	if f.DstIP != "" {
+		add("dst_ip = ?", f.DstIP)
+	}
+	if f.SrcPort > 0 {
+		add("src_port = ?", f.SrcPort)
+	}
+	if f.DstPort > 0 {
+		add("dst_port = ?", f.DstPort)
+	}
+	if f.PID > 0 {
+		add("pid = ?", f.PID)
+	}
+	if f.Method != "" {
+		add("http_method = ?", strings.ToUpper(f.Method))
+	}
+	if f.Path != "" {
+		if IsGlob(f.Path) {
+			add("http_path GLOB ?", f.Path)
+		} else {
+			add(`http_path LIKE ? ESCAPE '\'`, escapeLike(f.Path)+"%")
+		}
+	}
+	if f.Route != "" {
+		add("http_route = ?", f.Route)
+	}
+	if len(f.Status) > 0 {
+		ors := make([]string, 0, len(f.Status))
+		for _, r := range f.Status {
+			if r.Min == r.Max {
+				ors = append(ors, "status_code = ?")
+				args = append(args, r.Min)
+			} else {
+				ors = append(ors, "status_code BETWEEN ? AND ?")
+				args = append(args, r.Min, r.Max)
+			}
+		}
+		conds = append(conds, "("+strings.Join(ors, " OR ")+")")
+	}
+	if f.MinLatencyMS > 0 {
+		add("latency_ms >= ?", f.MinLatencyMS)
+	}
+	if f.MaxLatencyMS > 0 {
+		add("latency_ms <= ?", f.MaxLatencyMS)
+	}
+
+	if f.After != nil {
+		cond, a := f.keyset()
+		add(cond, a...)
+	}
+
+	if len(conds) == 0 {
+		return "1=1", nil
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// OrderBy 生成 ORDER BY 子句（不含关键字）。排序键依次为排序字段、时间与 rowid，
+// 方向一致，保证结果全序、可以按游标续读。
+func (f Filter) OrderBy() string {
+	dir := f.direction()
+	keys := []string{"timestamp " + dir, "rowid " + dir}
+	if col := f.sortColumn(); col != "timestamp" {
+		keys = append([]string{col + " " + dir}, keys...)
+	}
+	return strings.Join(keys, ", ")
+}
+
+func (f Filter) direction() string {
+	if f.Asc {
+		return "ASC"
+	}
+	return "DESC"
+}
+
+func (f Filter) sortColumn() string {
+	if col, ok := sortColumns[f.Sort]; ok {
+		return col
+	}
+	return sortColumns[SortTimestamp]
+}
+
+// keyset 生成“排在游标之后”的条件。展开为 OR 形式而不是行值比较，两个后端都能走索引。
+func (f Filter) keyset() (string, []any) {
+	op := "<"
+	if f.Asc {
+		op = ">"
+	}
+	c := f.After
+	ts := c.Timestamp.UTC()
+	tsCond := fmt.Sprintf("(timestamp %[1]s ? OR (timestamp = ? AND rowid %[1]s ?))", op)
+	tsArgs := []any{ts, ts, c.RowID}
+	col := f.sortColumn()
+	if col == "timestamp" {
+		return tsCond, tsArgs
+	}
+	return fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND %[3]s))", col, op, tsCond),
+		append([]any{c.SortValue, c.SortValue}, tsArgs...)
+}
+
+// EffectiveLimit 返回实际使用的 LIMIT。
+func (f Filter) EffectiveLimit() int {
+	if f.Limit <= 0 {
+		return DefaultLimit
+	}
+	return f.Limit
+}
+
+// CursorFor 根据一页中最后一条记录生成下一页游标。
+func (f Filter) CursorFor(l *model.TrafficLog, rowID int64) *Cursor {
+	c := &Cursor{Sort: f.Sort, Asc: f.Asc, Timestamp: l.Timestamp, RowID: rowID}
+	switch f.sortColumn() {
+	case "latency_ms":
+		c.SortValue = l.LatencyMS
+	case "status_code":
+		c.SortValue = int64(l.StatusCode)
+	}
+	if c.Sort == "" {
+		c.Sort = SortTimestamp
+	}
+	return c
+}
+
+// Match 在内存中判断一条记录是否满足过滤条件，语义与 Where 一致（Sort、Limit、After 不参与）。
+// 供实时推送等不经过数据库的场景使用。
+func (f Filter) Match(l *model.TrafficLog) bool {
+	switch {
+	case !f.From.IsZero() && l.Timestamp.Before(f.From),
+		!f.To.IsZero() && !l.Timestamp.Before(f.To),
+		f.IP != "" && l.SrcIP != f.IP && l.DstIP != f.IP,
+		f.SrcIP != "" && l.SrcIP != f.SrcIP,
+		f.DstIP != "" && l.DstIP != f.DstIP,
+		f.SrcPort > 0 && l.SrcPort != f.SrcPort,
+		f.DstPort > 0 && l.DstPort != f.DstPort,
+		f.PID > 0 && l.PID != f.PID,
+		f.Method != "" && l.HTTPMethod != strings.ToUpper(f.Method),
+		f.Route != "" && l.HTTPRoute != f.Route,
+		f.MinLatencyMS > 0 && l.LatencyMS < f.MinLatencyMS,
+		f.MaxLatencyMS > 0 && l.LatencyMS > f.MaxLatencyMS:
+		return false
+	}
+	if f.Path != "" {
+		if IsGlob(f.Path) {
+			if !globMatch(f.Path, l.HTTPPath) {
+				return false
+			}
+		} else if !strings.HasPrefix(l.HTTPPath, f.Path) {
+			return false
+		}
+	}
+	if len(f.Status) > 0 {
+		ok := false
+		for _, r := range f.Status {
+			if l.StatusCode >= r.Min && l.StatusCode <= r.Max {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// globMatch 实现与 SQLite GLOB 相同的语义：* 匹配任意字符（包括 /），? 匹配单个字符，
+// [...] 为字符集合，[^...] 取反；区分大小写。
+func globMatch(pattern, s string) bool {
+	p, str := []rune(pattern), []rune(s)
+	// star/match 记录最近一个 * 的位置，失配时回溯让它多吞一个字符。
+	star, match := -1, 0
+	i, j := 0, 0
+	for j < len(str) {
+		if i < len(p) {
+			switch p[i] {
+			case '*':
+				star, match = i, j
+				i++
+				continue
+			case '?':
+				i++
+				j++
+				continue
+			case '[':
+				if n, ok := matchClass(p[i:], str[j]); n > 0 {
+					if ok {
+						i += n
+						j++
+						continue
+					}
+				} else if str[j] == '[' {
+					// 未闭合的 [ 按普通字符处理。
+					i++
+					j++
+					continue
+				}
+			default:
+				if p[i] == str[j] {
+					i++
+					j++
+					continue
+				}
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		match++
+		i, j = star+1, match
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
+
+// matchClass 匹配以 [ 开头的字符集合，返回集合在模式中的长度（未闭合时为 0）与是否命中。
+func matchClass(p []rune, c rune) (int, bool) {
+	i := 1
+	negate := i < len(p) && p[i] == '^'
+	if negate {
+		i++
+	}
+	hit := false
+	for first := true; i < len(p); first = false {
+		if p[i] == ']' && !first {
+			return i + 1, hit != negate
+		}
+		lo := p[i]
+		if i+2 < len(p) && p[i+1] == '-' && p[i+2] != ']' {
+			if lo <= c && c <= p[i+2] {
+				hit = true
+			}
+			i += 3
+			continue
+		}
+		if lo == c {
+			hit = true
+		}
+		i++
+	}
+	return 0, false
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
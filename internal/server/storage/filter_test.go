@@ -0,0 +1,32 @@
+package storage
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"/api/*", "/api/users/1", true},
+		{"/api/*", "/apix", false},
+		{"*/orders", "/v1/users/1/orders", true},
+		{"/users/?", "/users/7", true},
+		{"/users/?", "/users/42", false},
+		{"/v[12]/*", "/v2/x", true},
+		{"/v[12]/*", "/v3/x", false},
+		{"/v[0-9]/*", "/v7/x", true},
+		{"/v[^0-9]/*", "/v7/x", false},
+		{"/v[^0-9]/*", "/vx/x", true},
+		{"/a[]]", "/a]", true},
+		{"/a[", "/a[", true},
+		{"*a*b*", "xxaYYbzz", true},
+		{"*a*b", "xxaYYbzz", false},
+		{"/API/*", "/api/x", false},
+		{"", "", true},
+	}
+	for _, tc := range cases {
+		if got := globMatch(tc.pattern, tc.s); got != tc.want {
+			t.Errorf("globMatch(%q, %q)=%v want %v", tc.pattern, tc.s, got, tc.want)
+		}
+	}
+}
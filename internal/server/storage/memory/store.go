@@ -0,0 +1,457 @@
+// Package memory 是保存在进程内存中的存储后端：容量固定的环形缓冲区，写满后覆盖最旧的记录，
+// 按 IP 与 PID 建索引。不落盘、不依赖 CGO，适合本地开发、CI 以及只需要最近一段流量的边缘部署。
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lightobs/internal/server/storage"
+	"lightobs/pkg/model"
+)
+
+// DefaultCapacity 是未指定容量时最多保留的记录条数。
+const DefaultCapacity = 100000
+
+// ErrClosed 表示存储已关闭。
+var ErrClosed = errors.New("内存存储已关闭")
+
+// recordOverhead 是估算占用空间时每条记录除字符串内容外的固定开销（结构体与索引项）。
+const recordOverhead = 160
+
+type entry struct {
+	// id 从 1 开始递增，即 SQL 后端的 rowid：决定同一时间记录的先后，也是翻页游标的一部分。
+	id   int64
+	live bool
+	log  model.TrafficLog
+}
+
+// Store 的记录 id 为 [first, next)，id 对应的槽位为 id % 容量。
+// 索引中每个 IP、PID 对应按 id 升序排列的记录 id；槽位被覆盖时最旧的 id 一定在列表头部，
+// 按时间删除的记录只标记为失效，索引项随槽位被覆盖时一起移除。
+type Store struct {
+	mu     sync.RWMutex
+	closed bool
+	ring   []entry
+	first  int64
+	next   int64
+	live   int64
+	bytes  int64
+	byIP   map[string][]int64
+	byPID  map[int][]int64
+}
+
+// NewStore 创建最多保留 capacity 条记录的存储，capacity 不大于 0 时使用 DefaultCapacity。
+func NewStore(capacity int) *Store {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Store{
+		ring:  make([]entry, capacity),
+		first: 1,
+		next:  1,
+		byIP:  make(map[string][]int64),
+		byPID: make(map[int][]int64),
+	}
+}
+
+func (s *Store) Insert(ctx context.Context, logEntry *model.TrafficLog) error {
+	if logEntry == nil {
+		return fmt.Errorf("logEntry 为空")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	s.add(logEntry)
+	return nil
+}
+
+// InsertBatch 在同一次加锁中写入整批，读者不会看到写入一半的批次。
+func (s *Store) InsertBatch(ctx context.Context, logs []model.TrafficLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	for i := range logs {
+		s.add(&logs[i])
+	}
+	return nil
+}
+
+// add 写入一条记录的副本，环满时先覆盖最旧的槽位；调用方持有写锁。
+func (s *Store) add(l *model.TrafficLog) {
+	slot := &s.ring[s.next%int64(len(s.ring))]
+	if s.next-s.first == int64(len(s.ring)) {
+		s.evict(slot)
+		s.first++
+	}
+	slot.id, slot.live, slot.log = s.next, true, *l
+	slot.log.Timestamp = l.Timestamp.UTC()
+	s.next++
+	s.live++
+	s.bytes += size(&slot.log)
+
+	s.byIP[l.SrcIP] = append(s.byIP[l.SrcIP], slot.id)
+	if l.DstIP != l.SrcIP {
+		s.byIP[l.DstIP] = append(s.byIP[l.DstIP], slot.id)
+	}
+	if l.PID > 0 {
+		s.byPID[l.PID] = append(s.byPID[l.PID], slot.id)
+	}
+}
+
+// evict 移除即将被覆盖的槽位及其索引项。
+func (s *Store) evict(e *entry) {
+	if e.live {
+		s.live--
+		s.bytes -= size(&e.log)
+	}
+	popIP := func(ip string) {
+		if ids := s.byIP[ip]; len(ids) > 0 && ids[0] == e.id {
+			if len(ids) == 1 {
+				delete(s.byIP, ip)
+			} else {
+				s.byIP[ip] = ids[1:]
+			}
+		}
+	}
+	popIP(e.log.SrcIP)
+	popIP(e.log.DstIP)
+	if ids := s.byPID[e.log.PID]; len(ids) > 0 && ids[0] == e.id {
+		if len(ids) == 1 {
+			delete(s.byPID, e.log.PID)
+		} else {
+			s.byPID[e.log.PID] = ids[1:]
+		}
+	}
+	*e = entry{}
+}
+
+// size 估算一条记录占用的内存。
+func size(l *model.TrafficLog) int64 {
+	return recordOverhead + int64(len(l.SrcIP)+len(l.DstIP)+len(l.HTTPMethod)+len(l.HTTPPath)+len(l.HTTPQuery)+len(l.HTTPRoute))
+}
+
+// get 返回 id 对应的有效记录；调用方持有读锁。
+func (s *Store) get(id int64) (*entry, bool) {
+	if id < s.first || id >= s.next {
+		return nil, false
+	}
+	e := &s.ring[id%int64(len(s.ring))]
+	return e, e.live && e.id == id
+}
+
+// candidates 返回可能满足 f 的记录 id：有 PID 或 IP 条件时取对应索引中最短的列表；
+// 没有可用的索引时 ok 为 false，需要扫描全部记录。调用方持有读锁。
+func (s *Store) candidates(f storage.Filter) (ids []int64, ok bool) {
+	use := func(list []int64) {
+		if !ok || len(list) < len(ids) {
+			ids, ok = list, true
+		}
+	}
+	if f.PID > 0 {
+		use(s.byPID[f.PID])
+	}
+	for _, ip := range []string{f.IP, f.SrcIP, f.DstIP} {
+		if ip != "" {
+			use(s.byIP[ip])
+		}
+	}
+	return ids, ok
+}
+
+// scan 对满足 f 的每条记录调用 fn（按 id 升序），不处理排序与游标。调用方持有读锁。
+func (s *Store) scan(f storage.Filter, fn func(e *entry)) {
+	visit := func(id int64) {
+		if e, ok := s.get(id); ok && f.Match(&e.log) {
+			fn(e)
+		}
+	}
+	if ids, ok := s.candidates(f); ok {
+		for _, id := range ids {
+			visit(id)
+		}
+		return
+	}
+	for id := s.first; id < s.next; id++ {
+		visit(id)
+	}
+}
+
+func (s *Store) QueryByIP(ctx context.Context, ip string, limit int) ([]model.TrafficLog, error) {
+	page, err := s.Query(ctx, storage.Filter{IP: ip, Limit: limit})
+	return page.Items, err
+}
+
+func (s *Store) QueryByPID(ctx context.Context, pid int, limit int) ([]model.TrafficLog, error) {
+	page, err := s.Query(ctx, storage.Filter{PID: pid, Limit: limit})
+	return page.Items, err
+}
+
+// sortKey 是排序用的 (排序字段, 时间, id)，与 SQL 后端 Filter.OrderBy 的顺序一致。
+type sortKey struct {
+	value int64
+	ts    time.Time
+	id    int64
+}
+
+func keyOf(f storage.Filter, e *entry) sortKey {
+	k := sortKey{ts: e.log.Timestamp, id: e.id}
+	switch f.Sort {
+	case storage.SortLatency:
+		k.value = e.log.LatencyMS
+	case storage.SortStatus:
+		k.value = int64(e.log.StatusCode)
+	}
+	return k
+}
+
+// before 判断按 f 的排序方向 a 是否排在 b 之前。
+func before(f storage.Filter, a, b sortKey) bool {
+	var c int
+	switch {
+	case a.value != b.value:
+		c = cmpInt(a.value, b.value)
+	case !a.ts.Equal(b.ts):
+		c = a.ts.Compare(b.ts)
+	default:
+		c = cmpInt(a.id, b.id)
+	}
+	if f.Asc {
+		return c < 0
+	}
+	return c > 0
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Query 筛选出排在游标之后的全部匹配记录，排序后取前 limit 条。
+func (s *Store) Query(ctx context.Context, f storage.Filter) (storage.Page, error) {
+	if f.After != nil && !f.After.Matches(f) {
+		return storage.Page{}, storage.ErrCursorMismatch
+	}
+	var after *sortKey
+	if c := f.After; c != nil {
+		after = &sortKey{value: c.SortValue, ts: c.Timestamp, id: c.RowID}
+	}
+
+	type hit struct {
+		key sortKey
+		log model.TrafficLog
+	}
+	var hits []hit
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return storage.Page{}, ErrClosed
+	}
+	s.scan(f, func(e *entry) {
+		k := keyOf(f, e)
+		if after == nil || before(f, *after, k) {
+			hits = append(hits, hit{key: k, log: e.log})
+		}
+	})
+	s.mu.RUnlock()
+
+	sort.Slice(hits, func(i, j int) bool { return before(f, hits[i].key, hits[j].key) })
+	limit := f.EffectiveLimit()
+	n := min(limit, len(hits))
+	page := storage.Page{Items: make([]model.TrafficLog, n)}
+	for i := range page.Items {
+		page.Items[i] = hits[i].log
+	}
+	if len(hits) > limit {
+		page.Next = f.CursorFor(&page.Items[n-1], hits[n-1].key.id)
+	}
+	return page, nil
+}
+
+// group 累计一组记录的 RED 指标，延迟全部保留以计算精确分位数。
+type group struct {
+	bucket  int64
+	keys    []string
+	errors  int64
+	sum     int64
+	latency []int64
+}
+
+func (g *group) add(l *model.TrafficLog) {
+	if storage.IsError(l.StatusCode) {
+		g.errors++
+	}
+	g.sum += l.LatencyMS
+	g.latency = append(g.latency, l.LatencyMS)
+}
+
+// row 与 SQLite 的 nearest-rank 分位数一致：取第一个满足 rank >= p*n 的值（rank 从 1 开始）。
+func (g *group) row() storage.StatsRow {
+	sort.Slice(g.latency, func(i, j int) bool { return g.latency[i] < g.latency[j] })
+	n := len(g.latency)
+	quantile := func(p float64) float64 {
+		rank := max(int(math.Ceil(p*float64(n))), 1)
+		return float64(g.latency[min(rank, n)-1])
+	}
+	return storage.StatsRow{
+		Group:  g.keys,
+		Count:  int64(n),
+		Errors: g.errors,
+		AvgMS:  float64(g.sum) / float64(n),
+		P50MS:  quantile(0.5),
+		P90MS:  quantile(0.9),
+		P99MS:  quantile(0.99),
+	}
+}
+
+// aggregate 按 step 秒的时间桶（step 为 0 时不分桶）与 dims 分组汇总满足 f 的记录。
+func (s *Store) aggregate(f storage.Filter, dims []storage.Dimension, step int64) ([]*group, error) {
+	f.After = nil
+	groups := make(map[string]*group)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	s.scan(f, func(e *entry) {
+		var bucket int64
+		if step > 0 {
+			bucket = e.log.Timestamp.Unix() / step * step
+		}
+		keys := make([]string, len(dims))
+		for i, d := range dims {
+			keys[i] = d.Value(&e.log)
+		}
+		id := strconv.FormatInt(bucket, 10) + "\x00" + strings.Join(keys, "\x00")
+		g, ok := groups[id]
+		if !ok {
+			g = &group{bucket: bucket, keys: keys}
+			groups[id] = g
+		}
+		g.add(&e.log)
+	})
+	out := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, g)
+	}
+	return out, nil
+}
+
+func (s *Store) Stats(ctx context.Context, q storage.StatsQuery) ([]storage.StatsRow, error) {
+	groups, err := s.aggregate(q.Filter, q.GroupBy, 0)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]storage.StatsRow, 0, len(groups))
+	for _, g := range groups {
+		rows = append(rows, g.row())
+	}
+	storage.SortStatsRows(rows, q.Sort)
+	if limit := q.EffectiveLimit(); len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows, nil
+}
+
+func (s *Store) Series(ctx context.Context, q storage.SeriesQuery) ([]storage.SeriesPoint, error) {
+	groups, err := s.aggregate(q.Filter, q.GroupBy, q.StepSeconds())
+	if err != nil {
+		return nil, err
+	}
+	points := make([]storage.SeriesPoint, 0, len(groups))
+	for _, g := range groups {
+		points = append(points, storage.SeriesPoint{Time: time.Unix(g.bucket, 0).UTC(), StatsRow: g.row()})
+	}
+	storage.SortSeriesPoints(points)
+	return points, nil
+}
+
+// Prune 与 SQL 后端共用分区删除逻辑；MaxBytes 按估算的内存占用计算。
+// 环形缓冲区本身已限制了条数，按时间清理用于只保留最近一段时间的流量。
+func (s *Store) Prune(ctx context.Context, p storage.RetentionPolicy) (storage.PruneResult, error) {
+	return storage.Prune(ctx, p, time.Now(), storage.PruneOps{
+		Oldest:       s.oldest,
+		DeleteBefore: s.deleteBefore,
+		Usage:        s.usage,
+	})
+}
+
+func (s *Store) oldest(ctx context.Context) (time.Time, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return time.Time{}, false, ErrClosed
+	}
+	var (
+		t     time.Time
+		found bool
+	)
+	for id := s.first; id < s.next; id++ {
+		if e, ok := s.get(id); ok && (!found || e.log.Timestamp.Before(t)) {
+			t, found = e.log.Timestamp, true
+		}
+	}
+	return t, found, nil
+}
+
+func (s *Store) deleteBefore(ctx context.Context, t time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+	var n int64
+	for id := s.first; id < s.next; id++ {
+		if e, ok := s.get(id); ok && e.log.Timestamp.Before(t) {
+			e.live = false
+			s.live--
+			s.bytes -= size(&e.log)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Usage 实现 storage.UsageReporter。
+func (s *Store) Usage(ctx context.Context) (int64, int64, error) {
+	return s.usage(ctx)
+}
+
+func (s *Store) usage(ctx context.Context) (int64, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return 0, 0, ErrClosed
+	}
+	return s.bytes, s.live, nil
+}
+
+// Rollup 不做任何事：内存中只保留最近的数据，统计查询直接扫描原始记录。
+func (s *Store) Rollup(ctx context.Context, p storage.RollupPolicy) (storage.RollupResult, error) {
+	return storage.RollupResult{}, nil
+}
+
+// Close 释放全部记录，之后的调用返回 ErrClosed。
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.ring, s.byIP, s.byPID = nil, nil, nil
+	return nil
+}
@@ -0,0 +1,192 @@
+package memory
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"lightobs/internal/server/storage"
+	"lightobs/internal/server/storage/sqlite"
+	"lightobs/internal/server/storage/storagetest"
+	"lightobs/pkg/model"
+)
+
+func TestStore_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		return NewStore(0)
+	})
+}
+
+func TestStore_RingEviction(t *testing.T) {
+	s := NewStore(5)
+	defer s.Close()
+	ctx := context.Background()
+	base := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < 12; i++ {
+		l := model.TrafficLog{Timestamp: base.Add(time.Duration(i) * time.Second), SrcIP: "10.0.0.2", DstIP: "10.0.0.1",
+			PID: 100 + i%3, HTTPMethod: "GET", HTTPPath: "/", PacketSize: i}
+		if i%2 == 0 {
+			l.SrcIP = "10.0.0.3"
+		}
+		if err := s.Insert(ctx, &l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 只保留最新的 5 条（7..11）。
+	got, err := s.QueryByIP(ctx, "10.0.0.1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seqs []int
+	for _, l := range got {
+		seqs = append(seqs, l.PacketSize)
+	}
+	if want := []int{11, 10, 9, 8, 7}; !reflect.DeepEqual(seqs, want) {
+		t.Errorf("retained=%v, want %v", seqs, want)
+	}
+	if got, _ := s.QueryByIP(ctx, "10.0.0.3", 100); len(got) != 2 {
+		t.Errorf("10.0.0.3: n=%d, want 2 (8, 10)", len(got))
+	}
+	if got, _ := s.QueryByPID(ctx, 101, 100); len(got) != 2 {
+		t.Errorf("pid 101: n=%d, want 2 (7, 10)", len(got))
+	}
+
+	// 被覆盖记录的索引项同时移除，索引大小不随写入总量增长。
+	for ip, ids := range s.byIP {
+		for _, id := range ids {
+			if id < s.first {
+				t.Errorf("index %s keeps evicted id %d", ip, id)
+			}
+		}
+	}
+	for pid, ids := range s.byPID {
+		if len(ids) > 2 {
+			t.Errorf("index pid %d=%v", pid, ids)
+		}
+	}
+	if _, rows, _ := s.usage(ctx); rows != 5 {
+		t.Errorf("rows=%d", rows)
+	}
+}
+
+func TestStore_Prune(t *testing.T) {
+	s := NewStore(10)
+	defer s.Close()
+	ctx := context.Background()
+	now := time.Now()
+	for i := 0; i < 6; i++ {
+		// 0、2、4 为两小时前的记录。
+		ts := now.Add(-time.Duration(i%2) * time.Minute)
+		if i%2 == 0 {
+			ts = now.Add(-2 * time.Hour)
+		}
+		if err := s.Insert(ctx, &model.TrafficLog{Timestamp: ts, SrcIP: "10.0.0.2", DstIP: "10.0.0.1", PID: 7, PacketSize: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bytesBefore, _, _ := s.usage(ctx)
+
+	res, err := s.Prune(ctx, storage.RetentionPolicy{MaxAge: time.Hour})
+	if err != nil || res.Deleted != 3 {
+		t.Fatalf("Prune: res=%+v err=%v", res, err)
+	}
+	got, _ := s.QueryByPID(ctx, 7, 100)
+	if len(got) != 3 {
+		t.Fatalf("after prune: n=%d", len(got))
+	}
+	for _, l := range got {
+		if l.PacketSize%2 == 0 {
+			t.Errorf("pruned record %d still visible", l.PacketSize)
+		}
+	}
+	bytesAfter, rows, _ := s.usage(ctx)
+	if rows != 3 || bytesAfter*2 != bytesBefore {
+		t.Errorf("usage: rows=%d bytes=%d before=%d", rows, bytesAfter, bytesBefore)
+	}
+
+	// 失效的槽位被覆盖后不再计数。
+	for i := 0; i < 10; i++ {
+		if err := s.Insert(ctx, &model.TrafficLog{Timestamp: now, SrcIP: "10.0.0.5", DstIP: "10.0.0.1", PacketSize: 100 + i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, rows, _ := s.usage(ctx); rows != 10 {
+		t.Errorf("rows=%d, want 10", rows)
+	}
+	if got, _ := s.QueryByPID(ctx, 7, 100); len(got) != 0 {
+		t.Errorf("pid 7 after overwrite: n=%d", len(got))
+	}
+
+	res, err = s.Prune(ctx, storage.RetentionPolicy{MaxBytes: 5 * (recordOverhead + 30)})
+	if err != nil || res.Deleted == 0 {
+		t.Errorf("Prune by bytes: res=%+v err=%v", res, err)
+	}
+}
+
+// TestStore_AggregatesMatchSQLite 用同一批数据比较内存与 SQLite 后端的 Stats、Series 结果。
+func TestStore_AggregatesMatchSQLite(t *testing.T) {
+	ref, err := sqlite.NewStore(filepath.Join(t.TempDir(), "traffic.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Close()
+	mem := NewStore(0)
+	defer mem.Close()
+
+	ctx := context.Background()
+	base := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	logs := make([]model.TrafficLog, 300)
+	for i := range logs {
+		logs[i] = model.TrafficLog{
+			Timestamp: base.Add(time.Duration(i*7) * time.Second), SrcIP: "10.0.0.2", DstIP: "10.0.0.1", DstPort: 80,
+			PID: 1 + i%3, HTTPMethod: "GET", HTTPPath: "/users/1", HTTPRoute: "/users/{id}", StatusCode: 200,
+			LatencyMS: int64(i*37%400 + 1),
+		}
+		if i%4 == 0 {
+			logs[i].HTTPPath, logs[i].HTTPRoute = "/healthz", ""
+		}
+		if i%9 == 0 {
+			logs[i].StatusCode = 502
+		}
+	}
+	for _, s := range []storage.Store{ref, mem} {
+		if err := s.InsertBatch(ctx, logs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, q := range []storage.StatsQuery{
+		{},
+		{GroupBy: []storage.Dimension{storage.DimPath, storage.DimPID}, Sort: storage.StatsSortP99},
+		{GroupBy: []storage.Dimension{storage.DimRawPath}, Sort: storage.StatsSortErrorRate, Limit: 1},
+		{Filter: storage.Filter{Status: []storage.StatusRange{{Min: 500, Max: 599}}}, GroupBy: []storage.Dimension{storage.DimPID}},
+	} {
+		want, err := ref.Stats(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := mem.Stats(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Stats %+v:\n got %+v\nwant %+v", q, got, want)
+		}
+	}
+
+	q := storage.SeriesQuery{Step: 5 * time.Minute, GroupBy: []storage.Dimension{storage.DimPath}}
+	want, err := ref.Series(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := mem.Series(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Series:\n got %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Migration 是一次表结构变更。Version 从 1 开始连续递增，已发布的迁移不能再修改，
+// 新的变更只能追加新版本。
+//
+// 引入版本号之前创建的库没有 schema_version 表，会从第 1 个迁移开始全部执行一遍，
+// 因此迁移须是幂等的：建表用 IF NOT EXISTS，加列前先确认列不存在。
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, tx *sql.Tx) error
+}
+
+// Statements 返回依次执行 stmts 的迁移函数。
+func Statements(stmts ...string) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// schemaVersionDDL 每个已执行的迁移一行，当前版本为 MAX(version)。SQLite 与 DuckDB 通用。
+const schemaVersionDDL = `
+CREATE TABLE IF NOT EXISTS schema_version (
+	version     INTEGER PRIMARY KEY,
+	description VARCHAR,
+	applied_at  TIMESTAMP
+)`
+
+// SchemaVersion 返回库的当前版本，尚未执行过任何迁移时为 0。
+func SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	if _, err := db.ExecContext(ctx, schemaVersionDDL); err != nil {
+		return 0, fmt.Errorf("创建 schema_version 表失败：%w", err)
+	}
+	var v int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&v); err != nil {
+		return 0, fmt.Errorf("读取表结构版本失败：%w", err)
+	}
+	return v, nil
+}
+
+// Migrate 依次执行版本高于当前版本的迁移，每个迁移与它的版本记录在同一个事务中提交，
+// 中途失败时库停留在上一个版本，下次启动从失败处继续。
+// 库的版本高于 migrations 中的最高版本（被更新的程序升级过）时拒绝打开。
+func Migrate(ctx context.Context, db *sql.DB, migrations []Migration) error {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return fmt.Errorf("迁移版本不连续：第 %d 个迁移的版本为 %d", i+1, m.Version)
+		}
+	}
+	current, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("数据库表结构版本为 %d，高于当前程序支持的 %d，请升级程序", current, len(migrations))
+	}
+	for _, m := range migrations[current:] {
+		if err := applyMigration(ctx, db, m); err != nil {
+			return fmt.Errorf("升级表结构到版本 %d（%s）失败：%w", m.Version, m.Description, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, m Migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := m.Up(ctx, tx); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?)`,
+		m.Version, m.Description, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
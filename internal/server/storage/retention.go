@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// PartitionSize 是按时间删除数据的粒度：每次删除最旧的一个小时，
+// 避免一条 DELETE 长时间持有写锁而阻塞写入。
+const PartitionSize = time.Hour
+
+// RetentionPolicy 描述数据保留策略，两个条件可以同时生效，零值表示不限制。
+type RetentionPolicy struct {
+	// MaxAge 之前的数据会被删除。
+	MaxAge time.Duration
+	// MaxBytes 是数据实际占用空间的上限，超出时从最旧的分区开始删除。
+	// 删除后文件本身不会缩小，释放的空间由后续写入复用。
+	MaxBytes int64
+}
+
+// Enabled 表示策略至少包含一个条件。
+func (p RetentionPolicy) Enabled() bool {
+	return p.MaxAge > 0 || p.MaxBytes > 0
+}
+
+// PruneResult 汇总一次清理的结果。
+type PruneResult struct {
+	Deleted    int64
+	Partitions int
+	// UsedBytes 是清理前数据占用的空间，仅在设置了 MaxBytes 时统计。
+	UsedBytes int64
+}
+
+// PruneOps 是各后端提供给 Prune 的基础操作。
+type PruneOps struct {
+	// Oldest 返回最旧一条记录的时间，表为空时 ok 为 false。
+	Oldest func(ctx context.Context) (t time.Time, ok bool, err error)
+	// DeleteBefore 删除 timestamp < t 的记录，返回删除条数。
+	DeleteBefore func(ctx context.Context, t time.Time) (int64, error)
+	// Usage 返回数据占用的字节数与总行数。
+	Usage func(ctx context.Context) (bytes, rows int64, err error)
+}
+
+// Prune 按策略从最旧的分区开始删除数据，SQL 后端的 Store.Prune 共用这段逻辑：
+// 先删除早于 now-MaxAge 的分区；若占用仍超过 MaxBytes，按行数比例估算需要删除的条数，
+// 再继续删除最旧的分区直到满足。空间统计在删除后往往不会立即下降，因此不反复测量。
+func Prune(ctx context.Context, p RetentionPolicy, now time.Time, ops PruneOps) (PruneResult, error) {
+	var res PruneResult
+	if p.MaxAge > 0 {
+		cutoff := now.Add(-p.MaxAge)
+		if err := prunePartitions(ctx, ops, &res, func(oldest time.Time, _ int64) (time.Time, bool) {
+			if !oldest.Before(cutoff) {
+				return time.Time{}, false
+			}
+			end := partitionEnd(oldest)
+			if end.After(cutoff) {
+				end = cutoff
+			}
+			return end, true
+		}); err != nil {
+			return res, err
+		}
+	}
+
+	if p.MaxBytes > 0 {
+		used, rows, err := ops.Usage(ctx)
+		if err != nil {
+			return res, err
+		}
+		res.UsedBytes = used
+		if used <= p.MaxBytes || rows == 0 {
+			return res, nil
+		}
+		excess := rows - int64(float64(rows)*float64(p.MaxBytes)/float64(used))
+		var deleted int64
+		err = prunePartitions(ctx, ops, &res, func(oldest time.Time, n int64) (time.Time, bool) {
+			deleted += n
+			return partitionEnd(oldest), deleted < excess
+		})
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// prunePartitions 反复取最旧记录，由 next 决定本轮删除的截止时间（next 的 n 为上一轮删除的条数），
+// 直到 next 返回 false、表为空或某一轮没有删除任何数据。
+func prunePartitions(ctx context.Context, ops PruneOps, res *PruneResult, next func(oldest time.Time, n int64) (time.Time, bool)) error {
+	var n int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		oldest, ok, err := ops.Oldest(ctx)
+		if err != nil || !ok {
+			return err
+		}
+		end, more := next(oldest, n)
+		if !more {
+			return nil
+		}
+		if n, err = ops.DeleteBefore(ctx, end); err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		res.Deleted += n
+		res.Partitions++
+	}
+}
+
+func partitionEnd(t time.Time) time.Time {
+	return t.UTC().Truncate(PartitionSize).Add(PartitionSize)
+}
@@ -0,0 +1,905 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lightobs/pkg/model"
+)
+
+// Resolution 是预聚合表的时间粒度。
+type Resolution time.Duration
+
+const (
+	ResolutionMinute = Resolution(time.Minute)
+	ResolutionHour   = Resolution(time.Hour)
+)
+
+// rollupTiers 按从粗到细排列，查询时优先使用更粗的表。
+var rollupTiers = []Resolution{ResolutionHour, ResolutionMinute}
+
+func (r Resolution) String() string {
+	if r == ResolutionHour {
+		return "1h"
+	}
+	return "1m"
+}
+
+func (r Resolution) table() string {
+	return "traffic_rollup_" + r.String()
+}
+
+func (r Resolution) floor(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Duration(r))
+}
+
+func (r Resolution) ceil(t time.Time) time.Time {
+	f := r.floor(t)
+	if f.Equal(t) {
+		return f
+	}
+	return f.Add(time.Duration(r))
+}
+
+// rollupChunk 是单个事务处理的时间跨度，避免首次启用时回填历史数据占用过长的写事务。
+func (r Resolution) rollupChunk() time.Duration {
+	if r == ResolutionHour {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+// RollupDelay 是分钟桶结束后等待多久再聚合，给 agent 批量上报留出时间。
+// 在此之后才到达的数据（如长时间落盘重传）由 Inserted 记下，下次 Run 时重算所在的桶。
+const RollupDelay = 2 * time.Minute
+
+// RollupPolicy 配置各精度预聚合表的保留时长，缺省或 0 表示永久保留。
+type RollupPolicy struct {
+	MaxAge map[Resolution]time.Duration
+}
+
+// RollupResult 汇总一次预聚合任务的结果。
+type RollupResult struct {
+	Written int64
+	Pruned  int64
+}
+
+// rollupKey 是预聚合的维度：调用方（src_ip、pid）与被调接口（dst_ip、dst_port、方法、路由）。
+// 不含源端口与原始路径，以控制基数。
+type rollupKey struct {
+	SrcIP    string
+	DstIP    string
+	DstPort  int
+	PID      int
+	Method   string
+	Endpoint string
+}
+
+func keyFromLog(l *model.TrafficLog) rollupKey {
+	// 与 DimPath 一致：没有路由模板的旧数据退回原始路径。
+	endpoint := l.HTTPRoute
+	if endpoint == "" {
+		endpoint = l.HTTPPath
+	}
+	return rollupKey{
+		SrcIP:    l.SrcIP,
+		DstIP:    l.DstIP,
+		DstPort:  l.DstPort,
+		PID:      l.PID,
+		Method:   l.HTTPMethod,
+		Endpoint: endpoint,
+	}
+}
+
+// dimension 返回维度取值，格式与 SQL 后端 CAST(... AS TEXT) 的结果一致。
+func (k rollupKey) dimension(d Dimension) string {
+	switch d {
+	case DimSrcIP:
+		return k.SrcIP
+	case DimDstIP:
+		return k.DstIP
+	case DimDstPort:
+		return strconv.Itoa(k.DstPort)
+	case DimMethod:
+		return k.Method
+	case DimPath:
+		return k.Endpoint
+	case DimPID:
+		return strconv.Itoa(k.PID)
+	}
+	return ""
+}
+
+type rollupRow struct {
+	Bucket time.Time
+	rollupKey
+	Count  int64
+	Errors int64
+	SumMS  int64
+	Sketch *Sketch
+}
+
+func (r *rollupRow) addLog(l *model.TrafficLog) {
+	r.Count++
+	if IsError(l.StatusCode) {
+		r.Errors++
+	}
+	r.SumMS += l.LatencyMS
+	r.Sketch.Add(l.LatencyMS, 1)
+}
+
+func (r *rollupRow) merge(o rollupRow) {
+	r.Count += o.Count
+	r.Errors += o.Errors
+	r.SumMS += o.SumMS
+	r.Sketch.Merge(o.Sketch)
+}
+
+// rollupState 记录某个精度已覆盖的时间范围 [horizon, watermark)。
+type rollupState struct {
+	watermark time.Time
+	horizon   time.Time
+}
+
+// SQLRollups 在原始表之外维护 1 分钟与 1 小时两级预聚合表，SQLite 与 DuckDB 共用：
+// 表结构与 SQL 只用两者都支持的类型和 ? 占位符，读取原始数据走后端自己的 Query。
+type SQLRollups struct {
+	db    *sql.DB
+	query QueryFunc
+	// mu 保证同一时刻只有一个预聚合任务在推进水位。
+	mu sync.Mutex
+
+	// lateMu 保护以下字段，与 mu 分开，写入不必等待正在进行的预聚合。
+	lateMu sync.Mutex
+	// claimed 是分钟表已经或正在聚合到的位置，早于它写入的数据需要重算。
+	claimed time.Time
+	loaded  bool
+	// late 是记入 rollup_late 失败时保留在内存中的最早时间，零值表示没有。
+	late time.Time
+}
+
+func NewSQLRollups(db *sql.DB, query QueryFunc) *SQLRollups {
+	return &SQLRollups{db: db, query: query}
+}
+
+// RollupSchema 返回预聚合表与状态表的建表语句，由各后端的迁移执行。
+func RollupSchema() []string {
+	stmts := []string{`
+CREATE TABLE IF NOT EXISTS rollup_state (
+	resolution VARCHAR PRIMARY KEY,
+	watermark  TIMESTAMP,
+	horizon    TIMESTAMP
+)`}
+	for _, res := range rollupTiers {
+		stmts = append(stmts, `
+CREATE TABLE IF NOT EXISTS `+res.table()+` (
+	bucket      TIMESTAMP,
+	src_ip      VARCHAR,
+	dst_ip      VARCHAR,
+	dst_port    INTEGER,
+	pid         INTEGER,
+	http_method VARCHAR,
+	endpoint    VARCHAR,
+	cnt         BIGINT,
+	errs        BIGINT,
+	sum_ms      BIGINT,
+	sketch      BLOB
+)`, `CREATE INDEX IF NOT EXISTS idx_`+res.table()+`_bucket ON `+res.table()+`(bucket)`)
+	}
+	return stmts
+}
+
+// ResetRollups 返回清空预聚合表与水位的语句，由各后端在改写了原始数据的迁移中执行，
+// 下次预聚合会从最早的数据重新回填。
+func ResetRollups() []string {
+	stmts := []string{`DELETE FROM rollup_state`}
+	for _, res := range rollupTiers {
+		stmts = append(stmts, `DELETE FROM `+res.table())
+	}
+	return stmts
+}
+
+// LateRollupSchema 返回记录迟到数据的表，由各后端的迁移执行。只追加、不更新，
+// 写入路径与预聚合任务之间不会因为修改同一行而冲突。
+func LateRollupSchema() []string {
+	return []string{`CREATE TABLE IF NOT EXISTS rollup_late (ts TIMESTAMP)`}
+}
+
+// Inserted 在一批记录提交之后调用：其中早于已聚合位置的记录（迟到的数据）所在的桶在下次 Run 时重算。
+// 必须在提交之后检查，否则与同时进行的聚合交错时，可能既没有被聚合读到，也没有被记下。
+// 记录失败时保留在内存中，不影响已经成功的写入。
+func (r *SQLRollups) Inserted(ctx context.Context, logs ...model.TrafficLog) {
+	var oldest time.Time
+	for i := range logs {
+		if oldest.IsZero() || logs[i].Timestamp.Before(oldest) {
+			oldest = logs[i].Timestamp
+		}
+	}
+	if oldest.IsZero() {
+		return
+	}
+	r.lateMu.Lock()
+	defer r.lateMu.Unlock()
+	if !r.loaded {
+		states, err := r.states(ctx)
+		if err != nil {
+			r.markLate(oldest)
+			return
+		}
+		if st, ok := states[ResolutionMinute]; ok && st.watermark.After(r.claimed) {
+			r.claimed = st.watermark
+		}
+		r.loaded = true
+	}
+	if !oldest.Before(r.claimed) {
+		return
+	}
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO rollup_late (ts) VALUES (?)`, oldest.UTC()); err != nil {
+		r.markLate(oldest)
+	}
+}
+
+// markLate 在内存中记下迟到数据的最早时间。调用方持有 lateMu。
+func (r *SQLRollups) markLate(t time.Time) {
+	if r.late.IsZero() || t.Before(r.late) {
+		r.late = t.UTC()
+	}
+}
+
+// claim 在聚合 [watermark, end) 之前调用，此后提交的、早于 end 的写入都会被 Inserted 记下。
+func (r *SQLRollups) claim(end time.Time) {
+	r.lateMu.Lock()
+	if end.After(r.claimed) {
+		r.claimed = end
+	}
+	r.lateMu.Unlock()
+}
+
+// rawPruned 是 rollup_state 中记录原始表清理边界的行，horizon 之前的原始数据已经删除。
+const rawPruned = "raw"
+
+// Pruned 在删除早于 t 的原始数据之前由后端调用，记下原始表的清理边界。边界只前进不后退；
+// 先记下再删除，删除失败时边界偏新，只是少重算几个桶。
+func (r *SQLRollups) Pruned(ctx context.Context, t time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开启事务失败：%w", err)
+	}
+	defer tx.Rollback()
+	cur, err := rawHorizon(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if !t.After(cur) {
+		return nil
+	}
+	if err := saveStateRow(ctx, tx, rawPruned, rollupState{watermark: t, horizon: t}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败：%w", err)
+	}
+	return nil
+}
+
+// rawHorizon 返回原始表的清理边界，从未清理过时为零值。
+func rawHorizon(ctx context.Context, tx *sql.Tx) (time.Time, error) {
+	var t time.Time
+	err := tx.QueryRowContext(ctx, `SELECT horizon FROM rollup_state WHERE resolution = ?`, rawPruned).Scan(&t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("读取预聚合状态失败：%w", err)
+	}
+	return t.UTC(), nil
+}
+
+// rewind 取出全部迟到记录，把两级预聚合表的水位退回到最早的迟到时间所在的桶并删除此后的预聚合行，
+// 随后的 advance 会重新聚合这些桶。取出与回退在同一事务中，失败时迟到记录保留到下次。
+// 分钟表已清理的小时无法从分钟表重算，小时表只回退到分钟表的 horizon 之后；
+// 同理两级都不回退到原始表的清理边界之前，早于边界的迟到数据不计入预聚合表，下次清理时随之删除。
+func (r *SQLRollups) rewind(ctx context.Context, states map[Resolution]rollupState) error {
+	r.lateMu.Lock()
+	late := r.late
+	r.late = time.Time{}
+	r.lateMu.Unlock()
+	restore := func() {
+		if !late.IsZero() {
+			r.lateMu.Lock()
+			r.markLate(late)
+			r.lateMu.Unlock()
+		}
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		restore()
+		return fmt.Errorf("开启事务失败：%w", err)
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, `DELETE FROM rollup_late RETURNING ts`)
+	if err != nil {
+		restore()
+		return fmt.Errorf("读取迟到数据记录失败：%w", err)
+	}
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			rows.Close()
+			restore()
+			return fmt.Errorf("读取迟到数据记录失败：%w", err)
+		}
+		if late.IsZero() || t.Before(late) {
+			late = t.UTC()
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		restore()
+		return fmt.Errorf("读取迟到数据记录失败：%w", err)
+	}
+	if late.IsZero() {
+		return nil
+	}
+
+	raw, err := rawHorizon(ctx, tx)
+	if err != nil {
+		restore()
+		return err
+	}
+
+	next := make(map[Resolution]rollupState, len(states))
+	for res, st := range states {
+		next[res] = st
+	}
+	minute, ok := states[ResolutionMinute]
+	if ok {
+		for _, res := range []Resolution{ResolutionMinute, ResolutionHour} {
+			st, ok := states[res]
+			if !ok {
+				continue
+			}
+			to := res.floor(late)
+			if st.horizon.After(to) {
+				to = st.horizon
+			}
+			if res == ResolutionHour && minute.horizon.After(to) {
+				to = ResolutionHour.ceil(minute.horizon)
+			}
+			if raw.After(to) {
+				to = res.ceil(raw)
+			}
+			if !to.Before(st.watermark) {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+res.table()+` WHERE bucket >= ?`, to); err != nil {
+				restore()
+				return fmt.Errorf("删除待重算的预聚合数据失败：%w", err)
+			}
+			st.watermark = to
+			if err := saveState(ctx, tx, res, st); err != nil {
+				restore()
+				return err
+			}
+			next[res] = st
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		restore()
+		return fmt.Errorf("提交事务失败：%w", err)
+	}
+	for res, st := range next {
+		states[res] = st
+	}
+	return nil
+}
+
+// Run 推进各精度的水位并按策略清理过期的预聚合数据：分钟表从原始表聚合到 now-RollupDelay，
+// 小时表从分钟表合并已完整覆盖的小时。首次运行时从最早的数据开始回填；
+// 此前有迟到的数据写入时，先回退水位重算这些数据所在的桶。
+func (r *SQLRollups) Run(ctx context.Context, p RollupPolicy, now time.Time) (RollupResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res RollupResult
+	states, err := r.states(ctx)
+	if err != nil {
+		return res, err
+	}
+	if err := r.rewind(ctx, states); err != nil {
+		return res, err
+	}
+	n, err := r.advance(ctx, ResolutionMinute, states, ResolutionMinute.floor(now.Add(-RollupDelay)))
+	res.Written += n
+	if err != nil {
+		return res, err
+	}
+	if st, ok := states[ResolutionMinute]; ok {
+		n, err = r.advance(ctx, ResolutionHour, states, ResolutionHour.floor(st.watermark))
+		res.Written += n
+		if err != nil {
+			return res, err
+		}
+	}
+
+	for _, tier := range []Resolution{ResolutionMinute, ResolutionHour} {
+		n, err := r.prune(ctx, tier, states, p.MaxAge[tier], now)
+		res.Pruned += n
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+func (r *SQLRollups) advance(ctx context.Context, res Resolution, states map[Resolution]rollupState, limit time.Time) (int64, error) {
+	st, ok := states[res]
+	if !ok {
+		oldest, found, err := r.oldestSource(ctx, res)
+		if err != nil || !found {
+			return 0, err
+		}
+		start := res.floor(oldest)
+		st = rollupState{watermark: start, horizon: start}
+	}
+	var written int64
+	for st.watermark.Before(limit) {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		end := st.watermark.Add(res.rollupChunk())
+		if end.After(limit) {
+			end = limit
+		}
+		if res == ResolutionMinute {
+			r.claim(end)
+		}
+		rows, err := r.aggregate(ctx, res, st.watermark, end)
+		if err != nil {
+			return written, err
+		}
+		st.watermark = end
+		if err := r.write(ctx, res, rows, st); err != nil {
+			return written, err
+		}
+		states[res] = st
+		written += int64(len(rows))
+	}
+	return written, nil
+}
+
+// oldestSource 返回某一精度数据来源中最早的时间：分钟表来自原始表，小时表来自分钟表。
+func (r *SQLRollups) oldestSource(ctx context.Context, res Resolution) (time.Time, bool, error) {
+	if res == ResolutionMinute {
+		page, err := r.query(ctx, Filter{Asc: true, Limit: 1})
+		if err != nil || len(page.Items) == 0 {
+			return time.Time{}, false, err
+		}
+		return page.Items[0].Timestamp, true, nil
+	}
+	var t time.Time
+	err := r.db.QueryRowContext(ctx, `SELECT bucket FROM `+ResolutionMinute.table()+` ORDER BY bucket LIMIT 1`).Scan(&t)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("查询预聚合数据失败：%w", err)
+	}
+	return t, true, nil
+}
+
+// aggregate 计算 [from, to) 内 res 精度的预聚合行。
+func (r *SQLRollups) aggregate(ctx context.Context, res Resolution, from, to time.Time) ([]rollupRow, error) {
+	type rowID struct {
+		bucket int64
+		rollupKey
+	}
+	acc := make(map[rowID]*rollupRow)
+	get := func(t time.Time, k rollupKey) *rollupRow {
+		bucket := res.floor(t)
+		id := rowID{bucket.Unix(), k}
+		row, ok := acc[id]
+		if !ok {
+			row = &rollupRow{Bucket: bucket, rollupKey: k, Sketch: NewSketch()}
+			acc[id] = row
+		}
+		return row
+	}
+
+	var err error
+	if res == ResolutionMinute {
+		err = r.scanRaw(ctx, Filter{}, from, to, func(l *model.TrafficLog) {
+			get(l.Timestamp, keyFromLog(l)).addLog(l)
+		})
+	} else {
+		err = r.scanRollup(ctx, ResolutionMinute, Filter{}, from, to, func(m rollupRow) {
+			get(m.Bucket, m.rollupKey).merge(m)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]rollupRow, 0, len(acc))
+	for _, row := range acc {
+		out = append(out, *row)
+	}
+	return out, nil
+}
+
+// write 在同一事务内写入预聚合行并更新水位，读取方不会看到只写了一半的桶。
+func (r *SQLRollups) write(ctx context.Context, res Resolution, rows []rollupRow, st rollupState) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开启事务失败：%w", err)
+	}
+	defer tx.Rollback()
+
+	if len(rows) > 0 {
+		stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO `+res.table()+` (bucket, src_ip, dst_ip, dst_port, pid, http_method, endpoint, cnt, errs, sum_ms, sketch)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return fmt.Errorf("准备插入语句失败：%w", err)
+		}
+		defer stmt.Close()
+		for _, row := range rows {
+			sketch, err := row.Sketch.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			if _, err := stmt.ExecContext(ctx, row.Bucket.UTC(), row.SrcIP, row.DstIP, row.DstPort, row.PID,
+				row.Method, row.Endpoint, row.Count, row.Errors, row.SumMS, sketch); err != nil {
+				return fmt.Errorf("写入预聚合数据失败：%w", err)
+			}
+		}
+	}
+	if err := saveState(ctx, tx, res, st); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败：%w", err)
+	}
+	return nil
+}
+
+// prune 删除早于 now-maxAge 的预聚合数据。分钟表至少保留到小时表已合并的位置，
+// 否则小时表会缺少尚未合并的分钟数据。
+func (r *SQLRollups) prune(ctx context.Context, res Resolution, states map[Resolution]rollupState, maxAge time.Duration, now time.Time) (int64, error) {
+	st, ok := states[res]
+	if maxAge <= 0 || !ok {
+		return 0, nil
+	}
+	cutoff := res.floor(now.Add(-maxAge))
+	if res == ResolutionMinute {
+		if hour, ok := states[ResolutionHour]; !ok {
+			return 0, nil
+		} else if hour.watermark.Before(cutoff) {
+			cutoff = hour.watermark
+		}
+	}
+	if !cutoff.After(st.horizon) {
+		return 0, nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("开启事务失败：%w", err)
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, `DELETE FROM `+res.table()+` WHERE bucket < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("删除过期预聚合数据失败：%w", err)
+	}
+	n, _ := result.RowsAffected()
+	st.horizon = cutoff
+	if st.watermark.Before(cutoff) {
+		st.watermark = cutoff
+	}
+	if err := saveState(ctx, tx, res, st); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败：%w", err)
+	}
+	states[res] = st
+	return n, nil
+}
+
+func (r *SQLRollups) states(ctx context.Context) (map[Resolution]rollupState, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT resolution, watermark, horizon FROM rollup_state`)
+	if err != nil {
+		return nil, fmt.Errorf("读取预聚合状态失败：%w", err)
+	}
+	defer rows.Close()
+	out := make(map[Resolution]rollupState)
+	for rows.Next() {
+		var (
+			name string
+			st   rollupState
+		)
+		if err := rows.Scan(&name, &st.watermark, &st.horizon); err != nil {
+			return nil, fmt.Errorf("读取预聚合状态失败：%w", err)
+		}
+		for _, res := range rollupTiers {
+			if res.String() == name {
+				out[res] = rollupState{watermark: st.watermark.UTC(), horizon: st.horizon.UTC()}
+			}
+		}
+	}
+	return out, rows.Err()
+}
+
+// saveState 先 UPDATE，不存在时再 INSERT：DuckDB 不允许在同一事务内删除后重新插入相同主键。
+func saveState(ctx context.Context, tx *sql.Tx, res Resolution, st rollupState) error {
+	return saveStateRow(ctx, tx, res.String(), st)
+}
+
+func saveStateRow(ctx context.Context, tx *sql.Tx, name string, st rollupState) error {
+	result, err := tx.ExecContext(ctx, `UPDATE rollup_state SET watermark = ?, horizon = ? WHERE resolution = ?`,
+		st.watermark.UTC(), st.horizon.UTC(), name)
+	if err != nil {
+		return fmt.Errorf("更新预聚合状态失败：%w", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO rollup_state (resolution, watermark, horizon) VALUES (?, ?, ?)`,
+		name, st.watermark.UTC(), st.horizon.UTC()); err != nil {
+		return fmt.Errorf("更新预聚合状态失败：%w", err)
+	}
+	return nil
+}
+
+// scanRaw 按时间升序分页读取原始表 [from, to) 内满足 f 的记录。
+func (r *SQLRollups) scanRaw(ctx context.Context, f Filter, from, to time.Time, fn func(*model.TrafficLog)) error {
+	f.From, f.To = from, to
+	f.Sort, f.Asc = SortTimestamp, true
+	return Scan(ctx, r.query, f, func(l *model.TrafficLog) error {
+		fn(l)
+		return nil
+	})
+}
+
+func (r *SQLRollups) scanRollup(ctx context.Context, res Resolution, f Filter, from, to time.Time, fn func(rollupRow)) error {
+	where, args := f.rollupWhere(from, to)
+	rows, err := r.db.QueryContext(ctx, `
+SELECT bucket, src_ip, dst_ip, dst_port, pid, http_method, endpoint, cnt, errs, sum_ms, sketch
+FROM `+res.table()+`
+WHERE `+where, args...)
+	if err != nil {
+		return fmt.Errorf("查询预聚合数据失败：%w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			row    rollupRow
+			sketch []byte
+		)
+		if err := rows.Scan(&row.Bucket, &row.SrcIP, &row.DstIP, &row.DstPort, &row.PID, &row.Method, &row.Endpoint,
+			&row.Count, &row.Errors, &row.SumMS, &sketch); err != nil {
+			return fmt.Errorf("读取行失败：%w", err)
+		}
+		row.Sketch = NewSketch()
+		if err := row.Sketch.UnmarshalBinary(sketch); err != nil {
+			return err
+		}
+		fn(row)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("遍历结果失败：%w", err)
+	}
+	return nil
+}
+
+// rollupWhere 生成预聚合表的查询条件，只支持 rollupSupports 允许的字段。
+func (f Filter) rollupWhere(from, to time.Time) (string, []any) {
+	conds := []string{"bucket >= ?", "bucket < ?"}
+	args := []any{from.UTC(), to.UTC()}
+	add := func(cond string, a ...any) {
+		conds = append(conds, cond)
+		args = append(args, a...)
+	}
+	if f.IP != "" {
+		add("(src_ip = ? OR dst_ip = ?)", f.IP, f.IP)
+	}
+	if f.SrcIP != "" {
+		add("src_ip = ?", f.SrcIP)
+	}
+	if f.DstIP != "" {
+		add("dst_ip = ?", f.DstIP)
+	}
+	if f.DstPort > 0 {
+		add("dst_port = ?", f.DstPort)
+	}
+	if f.PID > 0 {
+		add("pid = ?", f.PID)
+	}
+	if f.Method != "" {
+		add("http_method = ?", strings.ToUpper(f.Method))
+	}
+	if f.Route != "" {
+		add("endpoint = ?", f.Route)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// rollupSupports 判断查询能否由预聚合表回答：预聚合没有保留源端口、原始路径、
+// 单条状态码与延迟，涉及这些字段的条件或分组只能查原始表。
+func rollupSupports(f Filter, dims []Dimension) bool {
+	return f.SrcPort == 0 && f.Path == "" && len(f.Status) == 0 &&
+		f.MinLatencyMS == 0 && f.MaxLatencyMS == 0 &&
+		!slices.Contains(dims, DimRawPath)
+}
+
+// segment 是查询计划中的一段，res 为 0 表示读原始表。
+type segment struct {
+	res      Resolution
+	from, to time.Time
+}
+
+// planSegments 把 [from, to) 拆分为若干段：优先用最粗的表覆盖与其桶边界对齐、且在其
+// [horizon, watermark) 内的部分，两端剩余的零头交给更细的表，最后落到原始表。
+func planSegments(from, to time.Time, tiers []Resolution, states map[Resolution]rollupState) []segment {
+	if !from.Before(to) {
+		return nil
+	}
+	if len(tiers) == 0 {
+		return []segment{{from: from, to: to}}
+	}
+	res, rest := tiers[0], tiers[1:]
+	if st, ok := states[res]; ok {
+		lo, hi := res.ceil(from), res.floor(to)
+		if st.horizon.After(lo) {
+			lo = st.horizon
+		}
+		if st.watermark.Before(hi) {
+			hi = st.watermark
+		}
+		if lo.Before(hi) {
+			out := planSegments(from, lo, rest, states)
+			out = append(out, segment{res: res, from: lo, to: hi})
+			return append(out, planSegments(hi, to, rest, states)...)
+		}
+	}
+	return planSegments(from, to, rest, states)
+}
+
+// plan 为查询生成计划；无法使用预聚合表时 ok 为 false，由调用方直接查原始表。
+// step 为时序查询的桶宽，只有桶宽是某一精度的整数倍时才能使用该精度。
+func (r *SQLRollups) plan(ctx context.Context, f Filter, dims []Dimension, step time.Duration, now time.Time) ([]segment, bool, error) {
+	if f.From.IsZero() || !rollupSupports(f, dims) {
+		return nil, false, nil
+	}
+	to := f.To
+	if to.IsZero() {
+		to = now
+	}
+	tiers := make([]Resolution, 0, len(rollupTiers))
+	for _, res := range rollupTiers {
+		if step == 0 || step%time.Duration(res) == 0 {
+			tiers = append(tiers, res)
+		}
+	}
+	states, err := r.states(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	segs := planSegments(f.From.UTC(), to.UTC(), tiers, states)
+	for _, s := range segs {
+		if s.res != 0 {
+			return segs, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// rollupAgg 是查询时在内存中合并的一组结果。
+type rollupAgg struct {
+	bucket time.Time
+	group  []string
+	row    rollupRow
+}
+
+// collect 按计划读取各段数据，按分组（及 step 秒的时间桶，step 为 0 时不分桶）合并。
+func (r *SQLRollups) collect(ctx context.Context, f Filter, dims []Dimension, step int64, segs []segment) ([]*rollupAgg, error) {
+	acc := make(map[string]*rollupAgg)
+	get := func(t time.Time, k rollupKey) *rollupRow {
+		group := make([]string, len(dims))
+		for i, d := range dims {
+			group[i] = k.dimension(d)
+		}
+		var bucket time.Time
+		if step > 0 {
+			bucket = time.Unix(t.Unix()/step*step, 0).UTC()
+		}
+		id := strconv.FormatInt(bucket.Unix(), 10) + "\x00" + strings.Join(group, "\x00")
+		a, ok := acc[id]
+		if !ok {
+			a = &rollupAgg{bucket: bucket, group: group, row: rollupRow{Sketch: NewSketch()}}
+			acc[id] = a
+		}
+		return &a.row
+	}
+
+	for _, seg := range segs {
+		var err error
+		if seg.res == 0 {
+			err = r.scanRaw(ctx, f, seg.from, seg.to, func(l *model.TrafficLog) {
+				get(l.Timestamp, keyFromLog(l)).addLog(l)
+			})
+		} else {
+			err = r.scanRollup(ctx, seg.res, f, seg.from, seg.to, func(row rollupRow) {
+				get(row.Bucket, row.rollupKey).merge(row)
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	out := make([]*rollupAgg, 0, len(acc))
+	for _, a := range acc {
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+func (a *rollupAgg) stats() StatsRow {
+	r := a.row
+	return StatsRow{
+		Group:  a.group,
+		Count:  r.Count,
+		Errors: r.Errors,
+		AvgMS:  float64(r.SumMS) / float64(r.Count),
+		P50MS:  r.Sketch.Quantile(0.5),
+		P90MS:  r.Sketch.Quantile(0.9),
+		P99MS:  r.Sketch.Quantile(0.99),
+	}
+}
+
+// Stats 尽量用预聚合表回答聚合查询，排序与截断规则与 SQL 后端相同；ok 为 false 时需查原始表。
+func (r *SQLRollups) Stats(ctx context.Context, q StatsQuery, now time.Time) ([]StatsRow, bool, error) {
+	segs, ok, err := r.plan(ctx, q.Filter, q.GroupBy, 0, now)
+	if !ok || err != nil {
+		return nil, false, err
+	}
+	aggs, err := r.collect(ctx, q.Filter, q.GroupBy, 0, segs)
+	if err != nil {
+		return nil, true, err
+	}
+	rows := make([]StatsRow, 0, len(aggs))
+	for _, a := range aggs {
+		rows = append(rows, a.stats())
+	}
+	SortStatsRows(rows, q.Sort)
+	if limit := q.EffectiveLimit(); len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows, true, nil
+}
+
+// Series 尽量用预聚合表回答时序查询，结果按 (桶, 分组) 升序排列；ok 为 false 时需查原始表。
+func (r *SQLRollups) Series(ctx context.Context, q SeriesQuery, now time.Time) ([]SeriesPoint, bool, error) {
+	step := q.StepSeconds()
+	segs, ok, err := r.plan(ctx, q.Filter, q.GroupBy, time.Duration(step)*time.Second, now)
+	if !ok || err != nil {
+		return nil, false, err
+	}
+	aggs, err := r.collect(ctx, q.Filter, q.GroupBy, step, segs)
+	if err != nil {
+		return nil, true, err
+	}
+	points := make([]SeriesPoint, 0, len(aggs))
+	for _, a := range aggs {
+		points = append(points, SeriesPoint{Time: a.bucket, StatsRow: a.stats()})
+	}
+	SortSeriesPoints(points)
+	return points, true, nil
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanSegments(t *testing.T) {
+	base := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h, m, s int) time.Time {
+		return base.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second)
+	}
+	states := map[Resolution]rollupState{
+		ResolutionHour:   {horizon: at(0, 0, 0), watermark: at(10, 0, 0)},
+		ResolutionMinute: {horizon: at(2, 0, 0), watermark: at(10, 42, 0)},
+	}
+	cases := []struct {
+		name     string
+		from, to time.Time
+		tiers    []Resolution
+		states   map[Resolution]rollupState
+		want     []segment
+	}{
+		{
+			name: "head and tail fall back to finer tiers",
+			from: at(2, 30, 15), to: at(10, 45, 0), tiers: rollupTiers, states: states,
+			want: []segment{
+				{0, at(2, 30, 15), at(2, 31, 0)},
+				{ResolutionMinute, at(2, 31, 0), at(3, 0, 0)},
+				{ResolutionHour, at(3, 0, 0), at(10, 0, 0)},
+				{ResolutionMinute, at(10, 0, 0), at(10, 42, 0)},
+				{0, at(10, 42, 0), at(10, 45, 0)},
+			},
+		},
+		{
+			name: "minute tier pruned before head",
+			from: at(1, 30, 0), to: at(4, 0, 0), tiers: rollupTiers, states: states,
+			want: []segment{
+				{0, at(1, 30, 0), at(2, 0, 0)},
+				{ResolutionHour, at(2, 0, 0), at(4, 0, 0)},
+			},
+		},
+		{
+			name: "series step below an hour skips hour tier",
+			from: at(3, 0, 0), to: at(5, 0, 0), tiers: []Resolution{ResolutionMinute}, states: states,
+			want: []segment{{ResolutionMinute, at(3, 0, 0), at(5, 0, 0)}},
+		},
+		{
+			name: "nothing rolled up yet",
+			from: at(3, 0, 0), to: at(5, 0, 0), tiers: rollupTiers, states: nil,
+			want: []segment{{0, at(3, 0, 0), at(5, 0, 0)}},
+		},
+		{
+			name: "empty range", from: at(3, 0, 0), to: at(3, 0, 0), tiers: rollupTiers, states: states,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := planSegments(tc.from, tc.to, tc.tiers, tc.states)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %v want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i].res != tc.want[i].res || !got[i].from.Equal(tc.want[i].from) || !got[i].to.Equal(tc.want[i].to) {
+					t.Errorf("segment %d: got %v want %v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRollupSupports(t *testing.T) {
+	if !rollupSupports(Filter{IP: "10.0.0.1", Method: "GET", Route: "/a", PID: 1, DstPort: 80}, []Dimension{DimPath, DimPID}) {
+		t.Error("端点与调用方维度应能使用预聚合表")
+	}
+	for _, f := range []Filter{{SrcPort: 1}, {Path: "/a"}, {Status: []StatusRange{{500, 599}}}, {MinLatencyMS: 1}} {
+		if rollupSupports(f, nil) {
+			t.Errorf("%+v 不应使用预聚合表", f)
+		}
+	}
+	if rollupSupports(Filter{}, []Dimension{DimRawPath}) {
+		t.Error("raw_path 分组不应使用预聚合表")
+	}
+}
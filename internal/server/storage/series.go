@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SeriesQuery 描述按固定时间桶聚合的时序查询。桶按 Unix 纪元对齐到 Step 的整数倍，
+// 每个桶内的指标与 StatsRow 相同；GroupBy 非空时每个分组各自成一条序列。
+type SeriesQuery struct {
+	Filter  Filter
+	Step    time.Duration
+	GroupBy []Dimension
+}
+
+// StepSeconds 返回桶宽（秒），至少为 1。
+func (q SeriesQuery) StepSeconds() int64 {
+	if s := int64(q.Step / time.Second); s > 0 {
+		return s
+	}
+	return 1
+}
+
+// Stats 返回不含时间桶的等价聚合查询，用于复用分组 SQL 的生成逻辑。
+func (q SeriesQuery) Stats() StatsQuery {
+	return StatsQuery{Filter: q.Filter, GroupBy: q.GroupBy}
+}
+
+// GroupKeys 返回分组键加时间桶 "g0, g1, ..., bucket"，用于 GROUP BY / PARTITION BY。
+func (q SeriesQuery) GroupKeys() string {
+	keys := make([]string, 0, len(q.GroupBy)+1)
+	for i := range q.GroupBy {
+		keys = append(keys, fmt.Sprintf("g%d", i))
+	}
+	return strings.Join(append(keys, "bucket"), ", ")
+}
+
+// OrderBy 返回 "bucket, g0, g1, ..."，结果先按时间再按分组排列。
+func (q SeriesQuery) OrderBy() string {
+	keys := []string{"bucket"}
+	for i := range q.GroupBy {
+		keys = append(keys, fmt.Sprintf("g%d", i))
+	}
+	return strings.Join(keys, ", ")
+}
+
+// SeriesPoint 是某个分组在一个时间桶内的聚合结果，Time 为桶的起始时间。
+type SeriesPoint struct {
+	Time time.Time
+	StatsRow
+}
+
+// SortSeriesPoints 在内存中按 (桶, 分组) 升序排列，与 OrderBy 一致。
+func SortSeriesPoints(points []SeriesPoint) {
+	sort.Slice(points, func(i, j int) bool {
+		if !points[i].Time.Equal(points[j].Time) {
+			return points[i].Time.Before(points[j].Time)
+		}
+		return slices.Compare(points[i].Group, points[j].Group) < 0
+	})
+}
+
+// ScanSeriesRows 读取按 [bucket, g0..gN, cnt, errs, avg_ms, p50, p90, p99] 排列的结果，
+// bucket 为桶起点的 Unix 秒。
+func ScanSeriesRows(rows *sql.Rows, dims int) ([]SeriesPoint, error) {
+	out := make([]SeriesPoint, 0, 64)
+	for rows.Next() {
+		var (
+			bucket             int64
+			p                  SeriesPoint
+			avg, p50, p90, p99 sql.NullFloat64
+		)
+		groups := make([]sql.NullString, dims)
+		dest := make([]any, 0, dims+7)
+		dest = append(dest, &bucket)
+		for i := range groups {
+			dest = append(dest, &groups[i])
+		}
+		dest = append(dest, &p.Count, &p.Errors, &avg, &p50, &p90, &p99)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("读取行失败：%w", err)
+		}
+		p.Time = time.Unix(bucket, 0).UTC()
+		p.Group = make([]string, dims)
+		for i, g := range groups {
+			p.Group[i] = g.String
+		}
+		p.AvgMS, p.P50MS, p.P90MS, p.P99MS = avg.Float64, p50.Float64, p90.Float64, p99.Float64
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历结果失败：%w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+// sketchAccuracy 是 Sketch 分位数的相对误差上限。
+const sketchAccuracy = 0.01
+
+var (
+	sketchGamma    = (1 + sketchAccuracy) / (1 - sketchAccuracy)
+	sketchLogGamma = math.Log(sketchGamma)
+)
+
+// Sketch 是按对数分桶的延迟直方图（DDSketch 的思路）：第 i 个桶覆盖 (γ^(i-1), γ^i]，
+// 分位数的相对误差不超过 1%。多个 Sketch 可以直接相加，因此预聚合表按分钟写入后
+// 还能合并为小时粒度，或在查询时跨任意分组合并。
+type Sketch struct {
+	zero  int64 // 延迟 <= 0 的样本
+	bins  map[int32]int64
+	count int64
+}
+
+func NewSketch() *Sketch {
+	return &Sketch{bins: make(map[int32]int64)}
+}
+
+// Add 记录 n 个延迟为 ms 的样本。
+func (s *Sketch) Add(ms int64, n int64) {
+	s.count += n
+	if ms <= 0 {
+		s.zero += n
+		return
+	}
+	s.bins[int32(math.Ceil(math.Log(float64(ms))/sketchLogGamma))] += n
+}
+
+// Merge 把 o 的样本累加到 s。
+func (s *Sketch) Merge(o *Sketch) {
+	if o == nil {
+		return
+	}
+	s.zero += o.zero
+	s.count += o.count
+	for i, n := range o.bins {
+		s.bins[i] += n
+	}
+}
+
+// Count 返回样本数。
+func (s *Sketch) Count() int64 {
+	return s.count
+}
+
+// Quantile 返回 nearest-rank 分位数（第 ceil(q*n) 小的样本），与 SQL 后端的算法一致。
+// 原始延迟是整数毫秒，估计值四舍五入到整数。
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(s.count)))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank <= s.zero {
+		return 0
+	}
+	seen := s.zero
+	for _, i := range s.sortedBins() {
+		seen += s.bins[i]
+		if seen >= rank {
+			return math.Round(2 * math.Pow(sketchGamma, float64(i)) / (sketchGamma + 1))
+		}
+	}
+	return 0
+}
+
+func (s *Sketch) sortedBins() []int32 {
+	idx := make([]int32, 0, len(s.bins))
+	for i := range s.bins {
+		idx = append(idx, i)
+	}
+	sort.Slice(idx, func(a, b int) bool { return idx[a] < idx[b] })
+	return idx
+}
+
+// MarshalBinary 编码为 zero、桶数，随后按桶序号升序写入（序号差值, 计数），均为 varint。
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, 8+len(s.bins)*4)
+	buf = binary.AppendUvarint(buf, uint64(s.zero))
+	buf = binary.AppendUvarint(buf, uint64(len(s.bins)))
+	var prev int32
+	for _, i := range s.sortedBins() {
+		buf = binary.AppendVarint(buf, int64(i-prev))
+		buf = binary.AppendUvarint(buf, uint64(s.bins[i]))
+		prev = i
+	}
+	return buf, nil
+}
+
+var errBadSketch = errors.New("sketch 数据损坏")
+
+func (s *Sketch) UnmarshalBinary(b []byte) error {
+	*s = Sketch{bins: make(map[int32]int64)}
+	uvarint := func() (uint64, error) {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return 0, errBadSketch
+		}
+		b = b[n:]
+		return v, nil
+	}
+	zero, err := uvarint()
+	if err != nil {
+		return err
+	}
+	nbins, err := uvarint()
+	if err != nil {
+		return err
+	}
+	s.zero, s.count = int64(zero), int64(zero)
+	var idx int32
+	for k := uint64(0); k < nbins; k++ {
+		d, n := binary.Varint(b)
+		if n <= 0 {
+			return errBadSketch
+		}
+		b = b[n:]
+		c, err := uvarint()
+		if err != nil {
+			return err
+		}
+		idx += int32(d)
+		s.bins[idx] += int64(c)
+		s.count += int64(c)
+	}
+	if len(b) != 0 {
+		return errBadSketch
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSketchQuantile(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	values := make([]int64, 10000)
+	s := NewSketch()
+	for i := range values {
+		// 长尾分布：大部分几十毫秒，少量秒级。
+		values[i] = int64(rng.ExpFloat64() * 80)
+		s.Add(values[i], 1)
+	}
+	sort.Slice(values, func(a, b int) bool { return values[a] < values[b] })
+	for _, q := range []float64{0.5, 0.9, 0.99, 1} {
+		want := float64(values[int(math.Ceil(q*float64(len(values))))-1])
+		got := s.Quantile(q)
+		if math.Abs(got-want) > want*sketchAccuracy+0.5 {
+			t.Errorf("q=%v got %v want %v", q, got, want)
+		}
+	}
+	if s.Count() != int64(len(values)) {
+		t.Errorf("count=%d", s.Count())
+	}
+}
+
+// 相对误差 1%，50ms 以内的整数延迟四舍五入后没有误差。
+func TestSketchSmallValuesExact(t *testing.T) {
+	s := NewSketch()
+	for i := int64(1); i <= 50; i++ {
+		s.Add(i, 2)
+	}
+	for q, want := range map[float64]float64{0.1: 5, 0.5: 25, 0.9: 45, 1: 50} {
+		if got := s.Quantile(q); got != want {
+			t.Errorf("q=%v got %v want %v", q, got, want)
+		}
+	}
+}
+
+func TestSketchMergeAndEncode(t *testing.T) {
+	a, b := NewSketch(), NewSketch()
+	a.Add(0, 3)
+	a.Add(10, 5)
+	b.Add(1000, 2)
+	a.Merge(b)
+
+	raw, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Sketch
+	if err := got.UnmarshalBinary(raw); err != nil {
+		t.Fatal(err)
+	}
+	if got.Count() != 10 || got.Quantile(0.3) != 0 || got.Quantile(0.8) != 10 || math.Abs(got.Quantile(1)-1000) > 10 {
+		t.Errorf("got count=%d q30=%v q80=%v q100=%v", got.Count(), got.Quantile(0.3), got.Quantile(0.8), got.Quantile(1))
+	}
+	if err := got.UnmarshalBinary(raw[:len(raw)-1]); err == nil {
+		t.Error("截断的数据应当报错")
+	}
+	if NewSketch().Quantile(0.5) != 0 {
+		t.Error("空 sketch 应返回 0")
+	}
+}
@@ -0,0 +1,120 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"lightobs/internal/server/storage"
+)
+
+// migrations 是 SQLite 库的表结构变更，只能在末尾追加。
+// 引入版本号之前的库会从头执行一遍，因此加列要先查表结构（SQLite 的 ADD COLUMN 不支持 IF NOT EXISTS）。
+var migrations = []storage.Migration{
+	{Version: 1, Description: "traffic_logs 表与 IP 索引", Up: storage.Statements(`
+CREATE TABLE IF NOT EXISTS traffic_logs (
+	timestamp   TIMESTAMP,
+	src_ip      TEXT,
+	src_port    INTEGER,
+	dst_ip      TEXT,
+	dst_port    INTEGER,
+	http_method TEXT,
+	http_path   TEXT,
+	status_code INTEGER,
+	latency_ms  INTEGER,
+	packet_size INTEGER
+)`,
+		`CREATE INDEX IF NOT EXISTS idx_traffic_src_ip ON traffic_logs(src_ip)`,
+		`CREATE INDEX IF NOT EXISTS idx_traffic_dst_ip ON traffic_logs(dst_ip)`,
+	)},
+	{Version: 2, Description: "pid 列与索引", Up: func(ctx context.Context, tx *sql.Tx) error {
+		if err := addColumn(ctx, tx, "traffic_logs", "pid", "INTEGER"); err != nil {
+			return err
+		}
+		return storage.Statements(`CREATE INDEX IF NOT EXISTS idx_traffic_pid ON traffic_logs(pid)`)(ctx, tx)
+	}},
+	{Version: 3, Description: "时间索引", Up: storage.Statements(
+		`CREATE INDEX IF NOT EXISTS idx_traffic_ts ON traffic_logs(timestamp)`,
+	)},
+	{Version: 4, Description: "http_query、http_route 列", Up: func(ctx context.Context, tx *sql.Tx) error {
+		if err := addColumn(ctx, tx, "traffic_logs", "http_query", "TEXT"); err != nil {
+			return err
+		}
+		return addColumn(ctx, tx, "traffic_logs", "http_route", "TEXT")
+	}},
+	{Version: 5, Description: "预聚合表", Up: storage.Statements(storage.RollupSchema()...)},
+	{Version: 6, Description: "旧数据的时间改写为 UTC", Up: normalizeTimestamps},
+	{Version: 7, Description: "迟到数据记录表", Up: storage.Statements(storage.LateRollupSchema()...)},
+}
+
+// normalizeBatch 是 normalizeTimestamps 每次读取的行数。
+const normalizeBatch = 1000
+
+// normalizeTimestamps 把按主机本地时区写入的旧数据改写为 UTC。
+// 驱动以 time.Time.String() 的文本保存时间，早期版本写入时没有转为 UTC（如 "+0800 CST"，还可能带 "m=" 后缀），
+// 而范围过滤、游标排序与时序分桶都按 UTC 文本比较，不改写的话这些行会被错误地过滤、排序与分桶。
+// 改写了数据时同时清空预聚合表，让下次预聚合从最早的数据重新回填。
+func normalizeTimestamps(ctx context.Context, tx *sql.Tx) error {
+	var lastRowID, fixed int64
+	for {
+		rows, err := tx.QueryContext(ctx, `
+SELECT rowid, timestamp FROM traffic_logs
+WHERE rowid > ? AND timestamp NOT LIKE '% +0000 UTC'
+ORDER BY rowid
+LIMIT ?`, lastRowID, normalizeBatch)
+		if err != nil {
+			return err
+		}
+		type row struct {
+			id int64
+			ts time.Time
+		}
+		var batch []row
+		n := 0
+		for rows.Next() {
+			var id int64
+			var v any
+			if err := rows.Scan(&id, &v); err != nil {
+				rows.Close()
+				return err
+			}
+			n++
+			lastRowID = id
+			// 无法解析的值保持原样，不影响其余数据的升级。
+			if ts, ok := v.(time.Time); ok {
+				batch = append(batch, row{id, ts})
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		for _, r := range batch {
+			if _, err := tx.ExecContext(ctx, `UPDATE traffic_logs SET timestamp = ? WHERE rowid = ?`, r.ts.UTC(), r.id); err != nil {
+				return err
+			}
+		}
+		fixed += int64(len(batch))
+		if n < normalizeBatch {
+			break
+		}
+	}
+	if fixed == 0 {
+		return nil
+	}
+	return storage.Statements(storage.ResetRollups()...)(ctx, tx)
+}
+
+// addColumn 在列不存在时添加。
+func addColumn(ctx context.Context, tx *sql.Tx, table, name, typ string) error {
+	var n int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, name).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `ALTER TABLE `+table+` ADD COLUMN `+name+` `+typ)
+	return err
+}
@@ -3,23 +3,33 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 
+	"lightobs/internal/server/storage"
 	"lightobs/pkg/model"
 )
 
 type Store struct {
-	db  *sql.DB
-	ins *sql.Stmt
+	db      *sql.DB
+	ins     *sql.Stmt
+	rollups *storage.SQLRollups
 }
 
 func NewStore(path string) (*Store, error) {
 	if path == "" {
 		path = "./traffic.sqlite"
 	}
-	db, err := sql.Open("sqlite", path)
+	// 预聚合、数据清理等后台任务与写入并发，遇到写锁时等待而不是立即返回 SQLITE_BUSY。
+	dsn := path
+	if !strings.Contains(dsn, "?") {
+		dsn += "?_pragma=busy_timeout(5000)"
+	}
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("打开 SQLite 失败：%w", err)
 	}
@@ -32,37 +42,16 @@ func NewStore(path string) (*Store, error) {
 }
 
 func (s *Store) init() error {
-	ddl := `
-CREATE TABLE IF NOT EXISTS traffic_logs (
-	timestamp   TIMESTAMP,
-	src_ip      TEXT,
-	src_port    INTEGER,
-	dst_ip      TEXT,
-	dst_port    INTEGER,
-	pid         INTEGER,
-	http_method TEXT,
-	http_path   TEXT,
-	status_code INTEGER,
-	latency_ms  INTEGER,
-	packet_size INTEGER
-);
-CREATE INDEX IF NOT EXISTS idx_traffic_src_ip ON traffic_logs(src_ip);
-CREATE INDEX IF NOT EXISTS idx_traffic_dst_ip ON traffic_logs(dst_ip);
-CREATE INDEX IF NOT EXISTS idx_traffic_pid    ON traffic_logs(pid);
-`
-	if _, err := s.db.Exec(ddl); err != nil {
-		return fmt.Errorf("建表失败：%w", err)
-	}
-	stmt, err := s.db.Prepare(`
-INSERT INTO traffic_logs (
-	timestamp, src_ip, src_port, dst_ip, dst_port, pid,
-	http_method, http_path, status_code, latency_ms, packet_size
-) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
-`)
+	if err := storage.Migrate(context.Background(), s.db, migrations); err != nil {
+		return err
+	}
+	stmt, err := s.db.Prepare(insertPrefix + insertRow)
 	if err != nil {
 		return fmt.Errorf("准备插入语句失败：%w", err)
 	}
 	s.ins = stmt
+
+	s.rollups = storage.NewSQLRollups(s.db, s.Query)
 	return nil
 }
 
@@ -70,46 +59,116 @@ func (s *Store) Insert(ctx context.Context, logEntry *model.TrafficLog) error {
 	if logEntry == nil {
 		return fmt.Errorf("logEntry 为空")
 	}
-	_, err := s.ins.ExecContext(ctx,
-		logEntry.Timestamp,
-		logEntry.SrcIP,
-		logEntry.SrcPort,
-		logEntry.DstIP,
-		logEntry.DstPort,
-		logEntry.PID,
-		logEntry.HTTPMethod,
-		logEntry.HTTPPath,
-		logEntry.StatusCode,
-		logEntry.LatencyMS,
-		logEntry.PacketSize,
-	)
-	if err != nil {
+	if _, err := s.ins.ExecContext(ctx, insertArgs(nil, logEntry)...); err != nil {
 		return fmt.Errorf("插入失败：%w", err)
 	}
+	s.rollups.Inserted(ctx, *logEntry)
 	return nil
 }
 
+// batchRows 是 InsertBatch 每条多行 INSERT 的行数：13 列 × 500 行，低于 SQLite 的参数个数上限 32766。
+const batchRows = 500
+
+const insertPrefix = `INSERT INTO traffic_logs (
+	timestamp, src_ip, src_port, dst_ip, dst_port, pid,
+	http_method, http_path, http_query, http_route, status_code, latency_ms, packet_size
+) VALUES `
+
+const insertRow = `(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// InsertBatch 在一个事务中按每 500 行一条多行 INSERT 写入，整批只提交（fsync）一次。
+func (s *Store) InsertBatch(ctx context.Context, logs []model.TrafficLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开启事务失败：%w", err)
+	}
+	defer tx.Rollback()
+
+	args := make([]any, 0, min(len(logs), batchRows)*13)
+	for start := 0; start < len(logs); start += batchRows {
+		chunk := logs[start:min(start+batchRows, len(logs))]
+		args = args[:0]
+		for i := range chunk {
+			args = insertArgs(args, &chunk[i])
+		}
+		query := insertPrefix + strings.TrimSuffix(strings.Repeat(insertRow+", ", len(chunk)), ", ")
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("批量插入失败：%w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败：%w", err)
+	}
+	s.rollups.Inserted(ctx, logs...)
+	return nil
+}
+
+// insertArgs 把一条记录的各列按插入语句的顺序追加到 args。
+// 驱动以文本形式保存时间，统一转为 UTC 才能按字符串顺序做范围比较。
+func insertArgs(args []any, l *model.TrafficLog) []any {
+	return append(args,
+		l.Timestamp.UTC(),
+		l.SrcIP,
+		l.SrcPort,
+		l.DstIP,
+		l.DstPort,
+		l.PID,
+		l.HTTPMethod,
+		l.HTTPPath,
+		l.HTTPQuery,
+		l.HTTPRoute,
+		l.StatusCode,
+		l.LatencyMS,
+		l.PacketSize,
+	)
+}
+
 func (s *Store) QueryByIP(ctx context.Context, ip string, limit int) ([]model.TrafficLog, error) {
-	if limit <= 0 {
-		limit = 200
+	page, err := s.Query(ctx, storage.Filter{IP: ip, Limit: limit})
+	return page.Items, err
+}
+
+func (s *Store) QueryByPID(ctx context.Context, pid int, limit int) ([]model.TrafficLog, error) {
+	page, err := s.Query(ctx, storage.Filter{PID: pid, Limit: limit})
+	return page.Items, err
+}
+
+// Query 多取一条用于判断是否还有下一页，下一页游标取自本页最后一条记录的 (timestamp, rowid)。
+func (s *Store) Query(ctx context.Context, f storage.Filter) (storage.Page, error) {
+	if f.After != nil && !f.After.Matches(f) {
+		return storage.Page{}, storage.ErrCursorMismatch
 	}
+	limit := f.EffectiveLimit()
+	where, args := f.Where()
+	args = append(args, limit+1)
 	rows, err := s.db.QueryContext(ctx, `
 SELECT
-	timestamp, src_ip, src_port, dst_ip, dst_port, pid,
-	http_method, http_path, status_code, latency_ms, packet_size
+	rowid, timestamp, src_ip, src_port, dst_ip, dst_port, COALESCE(pid, 0),
+	http_method, http_path, COALESCE(http_query, ''), COALESCE(http_route, ''),
+	status_code, latency_ms, packet_size
 FROM traffic_logs
-WHERE src_ip = ? OR dst_ip = ?
-ORDER BY timestamp DESC
+WHERE `+where+`
+ORDER BY `+f.OrderBy()+`
 LIMIT ?;
-`, ip, ip, limit)
+`, args...)
 	if err != nil {
-		return nil, fmt.Errorf("查询失败：%w", err)
+		return storage.Page{}, fmt.Errorf("查询失败：%w", err)
 	}
 	defer rows.Close()
+
 	out := make([]model.TrafficLog, 0, 64)
+	var lastRowID int64
 	for rows.Next() {
+		if len(out) == limit {
+			page := storage.Page{Items: out, Next: f.CursorFor(&out[len(out)-1], lastRowID)}
+			return page, nil
+		}
 		var r model.TrafficLog
 		if err := rows.Scan(
+			&lastRowID,
 			&r.Timestamp,
 			&r.SrcIP,
 			&r.SrcPort,
@@ -118,61 +177,185 @@ LIMIT ?;
 			&r.PID,
 			&r.HTTPMethod,
 			&r.HTTPPath,
+			&r.HTTPQuery,
+			&r.HTTPRoute,
 			&r.StatusCode,
 			&r.LatencyMS,
 			&r.PacketSize,
 		); err != nil {
-			return nil, fmt.Errorf("读取行失败：%w", err)
+			return storage.Page{}, fmt.Errorf("读取行失败：%w", err)
 		}
 		out = append(out, r)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("遍历结果失败：%w", err)
+		return storage.Page{}, fmt.Errorf("遍历结果失败：%w", err)
 	}
-	return out, nil
+	return storage.Page{Items: out}, nil
 }
 
-func (s *Store) QueryByPID(ctx context.Context, pid int, limit int) ([]model.TrafficLog, error) {
-	if limit <= 0 {
-		limit = 200
+// Stats 优先读预聚合表，无法覆盖请求的范围或条件时查原始表。
+func (s *Store) Stats(ctx context.Context, q storage.StatsQuery) ([]storage.StatsRow, error) {
+	if rows, ok, err := s.rollups.Stats(ctx, q, time.Now()); ok || err != nil {
+		return rows, err
 	}
+	return s.statsRaw(ctx, q)
+}
+
+// statsRaw 在 SQLite 中用窗口函数计算分位数：组内按延迟排序编号，
+// 取第一个满足 rn >= p*n 的值，即 nearest-rank 分位数。
+func (s *Store) statsRaw(ctx context.Context, q storage.StatsQuery) ([]storage.StatsRow, error) {
+	f := q.Filter
+	f.After = nil
+	where, args := f.Where()
+	groupCols, groupBy := q.GroupSQL("TEXT")
+	partition := ""
+	if len(q.GroupBy) > 0 {
+		partition = "PARTITION BY " + strings.TrimPrefix(groupBy, "GROUP BY ")
+	}
+	args = append(args, q.EffectiveLimit())
 	rows, err := s.db.QueryContext(ctx, `
-SELECT
-	timestamp, src_ip, src_port, dst_ip, dst_port, pid,
-	http_method, http_path, status_code, latency_ms, packet_size
-FROM traffic_logs
-WHERE pid = ?
-ORDER BY timestamp DESC
+WITH base AS (
+	SELECT `+groupCols+`latency_ms, status_code
+	FROM traffic_logs
+	WHERE `+where+`
+), ranked AS (
+	SELECT *,
+		ROW_NUMBER() OVER (`+partition+` ORDER BY latency_ms) AS rn,
+		COUNT(*) OVER (`+partition+`) AS n
+	FROM base
+)
+SELECT `+groupKeys(len(q.GroupBy))+`
+	COUNT(*) AS cnt,
+	COALESCE(SUM(CASE WHEN `+storage.ErrorCondition+` THEN 1 ELSE 0 END), 0) AS errs,
+	AVG(latency_ms) AS avg_ms,
+	MIN(CASE WHEN rn >= 0.5 * n THEN latency_ms END) AS p50,
+	MIN(CASE WHEN rn >= 0.9 * n THEN latency_ms END) AS p90,
+	MIN(CASE WHEN rn >= 0.99 * n THEN latency_ms END) AS p99
+FROM ranked
+`+groupBy+`
+ORDER BY `+q.OrderBy()+`
 LIMIT ?;
-`, pid, limit)
+`, args...)
 	if err != nil {
-		return nil, fmt.Errorf("查询失败：%w", err)
+		return nil, fmt.Errorf("聚合查询失败：%w", err)
 	}
 	defer rows.Close()
-	out := make([]model.TrafficLog, 0, 64)
-	for rows.Next() {
-		var r model.TrafficLog
-		if err := rows.Scan(
-			&r.Timestamp,
-			&r.SrcIP,
-			&r.SrcPort,
-			&r.DstIP,
-			&r.DstPort,
-			&r.PID,
-			&r.HTTPMethod,
-			&r.HTTPPath,
-			&r.StatusCode,
-			&r.LatencyMS,
-			&r.PacketSize,
-		); err != nil {
-			return nil, fmt.Errorf("读取行失败：%w", err)
-		}
-		out = append(out, r)
+	return storage.ScanStatsRows(rows, len(q.GroupBy))
+}
+
+// groupKeys 返回外层查询引用的分组列 g0, g1, ...。
+func groupKeys(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "g%d, ", i)
 	}
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("遍历结果失败：%w", err)
+	return b.String()
+}
+
+// Series 与 Stats 一样优先读预聚合表。
+func (s *Store) Series(ctx context.Context, q storage.SeriesQuery) ([]storage.SeriesPoint, error) {
+	if points, ok, err := s.rollups.Series(ctx, q, time.Now()); ok || err != nil {
+		return points, err
+	}
+	return s.seriesRaw(ctx, q)
+}
+
+// seriesRaw 的时间桶由文本时间戳的前 19 个字符（YYYY-MM-DD HH:MM:SS，UTC）换算为 Unix 秒，
+// 桶宽至少 1 秒，因此舍弃小数部分不影响分桶。
+func (s *Store) seriesRaw(ctx context.Context, q storage.SeriesQuery) ([]storage.SeriesPoint, error) {
+	f := q.Filter
+	f.After = nil
+	where, whereArgs := f.Where()
+	groupCols, _ := q.Stats().GroupSQL("TEXT")
+	keys := q.GroupKeys()
+	step := q.StepSeconds()
+	args := append([]any{step, step}, whereArgs...)
+	rows, err := s.db.QueryContext(ctx, `
+WITH base AS (
+	SELECT
+		(CAST(strftime('%s', substr(timestamp, 1, 19)) AS INTEGER) / ?) * ? AS bucket,
+		`+groupCols+`latency_ms, status_code
+	FROM traffic_logs
+	WHERE `+where+`
+), ranked AS (
+	SELECT *,
+		ROW_NUMBER() OVER (PARTITION BY `+keys+` ORDER BY latency_ms) AS rn,
+		COUNT(*) OVER (PARTITION BY `+keys+`) AS n
+	FROM base
+)
+SELECT bucket, `+groupKeys(len(q.GroupBy))+`
+	COUNT(*) AS cnt,
+	COALESCE(SUM(CASE WHEN `+storage.ErrorCondition+` THEN 1 ELSE 0 END), 0) AS errs,
+	AVG(latency_ms) AS avg_ms,
+	MIN(CASE WHEN rn >= 0.5 * n THEN latency_ms END) AS p50,
+	MIN(CASE WHEN rn >= 0.9 * n THEN latency_ms END) AS p90,
+	MIN(CASE WHEN rn >= 0.99 * n THEN latency_ms END) AS p99
+FROM ranked
+GROUP BY `+keys+`
+ORDER BY `+q.OrderBy()+`;
+`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("时序查询失败：%w", err)
 	}
-	return out, nil
+	defer rows.Close()
+	return storage.ScanSeriesRows(rows, len(q.GroupBy))
+}
+
+// Prune 按保留策略删除最旧的数据。删除后的空闲页由 SQLite 复用，文件不会缩小。
+func (s *Store) Prune(ctx context.Context, p storage.RetentionPolicy) (storage.PruneResult, error) {
+	return storage.Prune(ctx, p, time.Now(), storage.PruneOps{
+		Oldest:       s.oldest,
+		DeleteBefore: s.deleteBefore,
+		Usage:        s.usage,
+	})
+}
+
+func (s *Store) oldest(ctx context.Context) (time.Time, bool, error) {
+	// 不用 MIN()：聚合结果丢失列类型，驱动不会转换为 time.Time；ORDER BY + LIMIT 同样走索引。
+	var t time.Time
+	err := s.db.QueryRowContext(ctx, `SELECT timestamp FROM traffic_logs ORDER BY timestamp LIMIT 1`).Scan(&t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("查询最早记录失败：%w", err)
+	}
+	return t, true, nil
+}
+
+func (s *Store) deleteBefore(ctx context.Context, t time.Time) (int64, error) {
+	if err := s.rollups.Pruned(ctx, t); err != nil {
+		return 0, err
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM traffic_logs WHERE timestamp < ?`, t.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("删除过期数据失败：%w", err)
+	}
+	return res.RowsAffected()
+}
+
+// Usage 实现 storage.UsageReporter。
+func (s *Store) Usage(ctx context.Context) (int64, int64, error) {
+	return s.usage(ctx)
+}
+
+// usage 以已使用的页（总页数减空闲页）计算占用空间。
+func (s *Store) usage(ctx context.Context) (int64, int64, error) {
+	var bytes, rows int64
+	err := s.db.QueryRowContext(ctx, `
+SELECT (pc.page_count - fc.freelist_count) * ps.page_size
+FROM pragma_page_count() AS pc, pragma_freelist_count() AS fc, pragma_page_size() AS ps`).Scan(&bytes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("查询数据库大小失败：%w", err)
+	}
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM traffic_logs`).Scan(&rows); err != nil {
+		return 0, 0, fmt.Errorf("统计行数失败：%w", err)
+	}
+	return bytes, rows, nil
+}
+
+func (s *Store) Rollup(ctx context.Context, p storage.RollupPolicy) (storage.RollupResult, error) {
+	return s.rollups.Run(ctx, p, time.Now())
 }
 
 func (s *Store) Close() error {
@@ -3,9 +3,12 @@ package sqlite
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"lightobs/internal/server/storage"
+	"lightobs/internal/server/storage/storagetest"
 	"lightobs/pkg/model"
 )
 
@@ -75,3 +78,71 @@ func TestStore_InsertAndQuery(t *testing.T) {
 		t.Errorf("Expected 0 logs, got %d", len(logs))
 	}
 }
+
+func TestStore_BusyTimeout(t *testing.T) {
+	s, err := NewStore(filepath.Join(t.TempDir(), "traffic.sqlite"))
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	defer s.Close()
+	var ms int
+	if err := s.db.QueryRow(`PRAGMA busy_timeout`).Scan(&ms); err != nil || ms != 5000 {
+		t.Errorf("busy_timeout=%d err=%v", ms, err)
+	}
+}
+
+// TestStore_RollupLateAfterRestart 检查迟到数据的记录保存在库中：写入后重启，下次预聚合仍会重算。
+func TestStore_RollupLateAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.sqlite")
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	ctx := context.Background()
+	base := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	if err := s.InsertBatch(ctx, storagetest.BatchLogs(base, 100)); err != nil {
+		t.Fatalf("InsertBatch failed: %v", err)
+	}
+	if _, err := s.Rollup(ctx, storage.RollupPolicy{}); err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+	if err := s.Insert(ctx, &storagetest.BatchLogs(base.Add(10*time.Minute), 1)[0]); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	s.Close()
+
+	if s, err = NewStore(path); err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer s.Close()
+	if _, err := s.Rollup(ctx, storage.RollupPolicy{}); err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+	q := storage.StatsQuery{Filter: storage.Filter{From: base}}
+	if _, ok, err := s.rollups.Stats(ctx, q, time.Now()); !ok || err != nil {
+		t.Fatalf("预聚合表未被使用：ok=%v err=%v", ok, err)
+	}
+	if rows, err := s.Stats(ctx, q); err != nil || len(rows) != 1 || rows[0].Count != 101 {
+		t.Errorf("rows=%+v err=%v, want 101", rows, err)
+	}
+}
+
+func BenchmarkStore(b *testing.B) {
+	storagetest.Bench(b, func(b *testing.B) storage.Store {
+		s, err := NewStore(filepath.Join(b.TempDir(), "traffic.sqlite"))
+		if err != nil {
+			b.Fatalf("NewStore failed: %v", err)
+		}
+		return s
+	})
+}
+
+func TestStore_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		s, err := NewStore(filepath.Join(t.TempDir(), "traffic.sqlite"))
+		if err != nil {
+			t.Fatalf("NewStore failed: %v", err)
+		}
+		return s
+	})
+}
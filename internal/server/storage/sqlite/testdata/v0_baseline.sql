@@ -0,0 +1,20 @@
+-- 引入版本号之前的 SQLite 库：有 pid 列与索引，没有 http_query、http_route 与预聚合表。
+CREATE TABLE traffic_logs (
+	timestamp   TIMESTAMP,
+	src_ip      TEXT,
+	src_port    INTEGER,
+	dst_ip      TEXT,
+	dst_port    INTEGER,
+	pid         INTEGER,
+	http_method TEXT,
+	http_path   TEXT,
+	status_code INTEGER,
+	latency_ms  INTEGER,
+	packet_size INTEGER
+);
+CREATE INDEX idx_traffic_src_ip ON traffic_logs(src_ip);
+CREATE INDEX idx_traffic_dst_ip ON traffic_logs(dst_ip);
+CREATE INDEX idx_traffic_pid    ON traffic_logs(pid);
+INSERT INTO traffic_logs VALUES
+	(strftime('%Y-%m-%d %H:%M:00 +0000 UTC', 'now', '-1 day'), '10.0.0.2', 40000, '10.0.0.1', 80, 4242, 'GET', '/users/1', 200, 12, 300),
+	(strftime('%Y-%m-%d %H:%M:01 +0000 UTC', 'now', '-1 day'), '10.0.0.2', 40001, '10.0.0.1', 80, NULL, 'POST', '/orders', 503, 900, 120);
@@ -0,0 +1,22 @@
+-- 时间未统一为 UTC 之前的 SQLite 库：驱动按 time.Time.String() 保存，带写入时主机的时区，
+-- 直接用 time.Now() 写入的还带单调时钟后缀。三行依次为 UTC 00:00:30、00:01:10、00:02:05.5。
+CREATE TABLE traffic_logs (
+	timestamp   TIMESTAMP,
+	src_ip      TEXT,
+	src_port    INTEGER,
+	dst_ip      TEXT,
+	dst_port    INTEGER,
+	pid         INTEGER,
+	http_method TEXT,
+	http_path   TEXT,
+	status_code INTEGER,
+	latency_ms  INTEGER,
+	packet_size INTEGER
+);
+CREATE INDEX idx_traffic_src_ip ON traffic_logs(src_ip);
+CREATE INDEX idx_traffic_dst_ip ON traffic_logs(dst_ip);
+CREATE INDEX idx_traffic_pid    ON traffic_logs(pid);
+INSERT INTO traffic_logs VALUES
+	('2024-05-01 08:00:30 +0800 CST', '10.0.0.2', 40000, '10.0.0.1', 80, 4242, 'GET', '/users/1', 200, 12, 300),
+	('2024-04-30 19:01:10 -0500 EST', '10.0.0.2', 40001, '10.0.0.1', 80, 4242, 'POST', '/orders', 503, 900, 120),
+	('2024-05-01 00:02:05.5 +0000 UTC m=+12.345678901', '10.0.0.2', 40002, '10.0.0.1', 80, 4242, 'GET', '/users/2', 200, 30, 300);
@@ -0,0 +1,18 @@
+-- 最早的 SQLite 库：还没有 pid 列，也没有 schema_version 表。
+CREATE TABLE traffic_logs (
+	timestamp   TIMESTAMP,
+	src_ip      TEXT,
+	src_port    INTEGER,
+	dst_ip      TEXT,
+	dst_port    INTEGER,
+	http_method TEXT,
+	http_path   TEXT,
+	status_code INTEGER,
+	latency_ms  INTEGER,
+	packet_size INTEGER
+);
+CREATE INDEX idx_traffic_src_ip ON traffic_logs(src_ip);
+CREATE INDEX idx_traffic_dst_ip ON traffic_logs(dst_ip);
+INSERT INTO traffic_logs VALUES
+	(strftime('%Y-%m-%d %H:%M:00 +0000 UTC', 'now', '-1 day'), '10.0.0.2', 40000, '10.0.0.1', 80, 'GET', '/users/1', 200, 12, 300),
+	(strftime('%Y-%m-%d %H:%M:01 +0000 UTC', 'now', '-1 day'), '10.0.0.2', 40001, '10.0.0.1', 80, 'POST', '/orders', 503, 900, 120);
@@ -0,0 +1,30 @@
+-- 版本 3 的 SQLite 库：已有 schema_version 与时间索引，还没有 http_query、http_route 与预聚合表。
+CREATE TABLE schema_version (
+	version     INTEGER PRIMARY KEY,
+	description VARCHAR,
+	applied_at  TIMESTAMP
+);
+INSERT INTO schema_version VALUES
+	(1, 'traffic_logs 表与 IP 索引', '2024-05-01 00:00:00 +0000 UTC'),
+	(2, 'pid 列与索引', '2024-05-01 00:00:00 +0000 UTC'),
+	(3, '时间索引', '2024-05-01 00:00:00 +0000 UTC');
+CREATE TABLE traffic_logs (
+	timestamp   TIMESTAMP,
+	src_ip      TEXT,
+	src_port    INTEGER,
+	dst_ip      TEXT,
+	dst_port    INTEGER,
+	http_method TEXT,
+	http_path   TEXT,
+	status_code INTEGER,
+	latency_ms  INTEGER,
+	packet_size INTEGER,
+	pid         INTEGER
+);
+CREATE INDEX idx_traffic_src_ip ON traffic_logs(src_ip);
+CREATE INDEX idx_traffic_dst_ip ON traffic_logs(dst_ip);
+CREATE INDEX idx_traffic_pid    ON traffic_logs(pid);
+CREATE INDEX idx_traffic_ts     ON traffic_logs(timestamp);
+INSERT INTO traffic_logs VALUES
+	(strftime('%Y-%m-%d %H:%M:00 +0000 UTC', 'now', '-1 day'), '10.0.0.2', 40000, '10.0.0.1', 80, 'GET', '/users/1', 200, 12, 300, 4242),
+	(strftime('%Y-%m-%d %H:%M:01 +0000 UTC', 'now', '-1 day'), '10.0.0.2', 40001, '10.0.0.1', 80, 'POST', '/orders', 503, 900, 120, NULL);
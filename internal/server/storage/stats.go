@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"lightobs/pkg/model"
+)
+
+// Dimension 是聚合查询的分组维度。
+type Dimension string
+
+const (
+	DimSrcIP   Dimension = "src_ip"
+	DimDstIP   Dimension = "dst_ip"
+	DimDstPort Dimension = "dst_port"
+	DimMethod  Dimension = "method"
+	// DimPath 按路由模板分组；DimRawPath 按原始路径分组，基数可能很高。
+	DimPath    Dimension = "path"
+	DimRawPath Dimension = "raw_path"
+	DimPID     Dimension = "pid"
+)
+
+var dimensionColumns = map[Dimension]string{
+	DimSrcIP:   "src_ip",
+	DimDstIP:   "dst_ip",
+	DimDstPort: "dst_port",
+	DimMethod:  "http_method",
+	// 归一化之前写入的旧数据没有 http_route，退回原始路径。
+	DimPath:    "COALESCE(NULLIF(http_route, ''), http_path)",
+	DimRawPath: "http_path",
+	DimPID:     "COALESCE(pid, 0)",
+}
+
+// Column 返回维度对应的 SQL 表达式。
+func (d Dimension) Column() string {
+	return dimensionColumns[d]
+}
+
+// Numeric 表示维度取值为整数，API 输出时不加引号。
+func (d Dimension) Numeric() bool {
+	return d == DimDstPort || d == DimPID
+}
+
+// Value 返回记录在该维度上的取值，与 Column 转为文本后的结果一致，供不经过数据库的聚合使用。
+func (d Dimension) Value(l *model.TrafficLog) string {
+	switch d {
+	case DimSrcIP:
+		return l.SrcIP
+	case DimDstIP:
+		return l.DstIP
+	case DimDstPort:
+		return strconv.Itoa(l.DstPort)
+	case DimMethod:
+		return l.HTTPMethod
+	case DimPath:
+		if l.HTTPRoute != "" {
+			return l.HTTPRoute
+		}
+		return l.HTTPPath
+	case DimRawPath:
+		return l.HTTPPath
+	case DimPID:
+		return strconv.Itoa(l.PID)
+	}
+	return ""
+}
+
+// ParseDimensions 解析逗号分隔的分组维度，空串表示不分组（整体汇总）。
+func ParseDimensions(s string) ([]Dimension, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var out []Dimension
+	seen := make(map[Dimension]bool)
+	for _, part := range strings.Split(s, ",") {
+		d := Dimension(strings.ToLower(strings.TrimSpace(part)))
+		if _, ok := dimensionColumns[d]; !ok {
+			return nil, fmt.Errorf("不支持的分组维度：%s（可选 src_ip / dst_ip / dst_port / method / path / raw_path / pid）", part)
+		}
+		if !seen[d] {
+			seen[d] = true
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+// StatsSort 是聚合结果的排序字段，均为降序。
+type StatsSort string
+
+const (
+	StatsSortCount     StatsSort = "count"
+	StatsSortErrors    StatsSort = "errors"
+	StatsSortErrorRate StatsSort = "error_rate"
+	StatsSortAvg       StatsSort = "avg"
+	StatsSortP50       StatsSort = "p50"
+	StatsSortP90       StatsSort = "p90"
+	StatsSortP99       StatsSort = "p99"
+)
+
+// statsSortColumns 引用各后端聚合查询中约定的列别名（cnt、errs、avg_ms、p50 ...）。
+var statsSortColumns = map[StatsSort]string{
+	StatsSortCount:     "cnt",
+	StatsSortErrors:    "errs",
+	StatsSortErrorRate: "CAST(errs AS DOUBLE) / cnt",
+	StatsSortAvg:       "avg_ms",
+	StatsSortP50:       "p50",
+	StatsSortP90:       "p90",
+	StatsSortP99:       "p99",
+}
+
+func ParseStatsSort(s string) (StatsSort, error) {
+	if s == "" {
+		return StatsSortCount, nil
+	}
+	v := StatsSort(strings.ToLower(s))
+	if _, ok := statsSortColumns[v]; !ok {
+		return "", fmt.Errorf("不支持的排序字段：%s（可选 count / errors / error_rate / avg / p50 / p90 / p99）", s)
+	}
+	return v, nil
+}
+
+// StatsQuery 描述一次 RED 聚合：Filter 中的条件决定统计范围（Sort/Limit/After 不生效），
+// 按 GroupBy 分组后取排序靠前的 Limit 组。
+type StatsQuery struct {
+	Filter  Filter
+	GroupBy []Dimension
+	Sort    StatsSort
+	Limit   int
+}
+
+// DefaultStatsLimit 是 StatsQuery.Limit 未设置时返回的最大组数。
+const DefaultStatsLimit = 100
+
+// ErrorCondition 是计为错误的条件，RED 中的 errors 只统计服务端错误（5xx）。
+const ErrorCondition = "status_code >= 500"
+
+// IsError 在内存中判断状态码是否计为错误，与 ErrorCondition 一致。
+func IsError(status int) bool {
+	return status >= 500
+}
+
+// StatsRow 是一组聚合结果，Group 与 StatsQuery.GroupBy 一一对应。延迟单位均为毫秒。
+type StatsRow struct {
+	Group  []string
+	Count  int64
+	Errors int64
+	AvgMS  float64
+	P50MS  float64
+	P90MS  float64
+	P99MS  float64
+}
+
+// ErrorRate 返回错误占比（0~1）。
+func (r StatsRow) ErrorRate() float64 {
+	if r.Count == 0 {
+		return 0
+	}
+	return float64(r.Errors) / float64(r.Count)
+}
+
+// GroupSQL 返回分组列（已转为文本）与 GROUP BY 子句，textType 为后端的文本类型名。
+func (q StatsQuery) GroupSQL(textType string) (selectCols, groupBy string) {
+	if len(q.GroupBy) == 0 {
+		return "", ""
+	}
+	cols := make([]string, len(q.GroupBy))
+	for i, d := range q.GroupBy {
+		cols[i] = fmt.Sprintf("CAST(%s AS %s) AS g%d", d.Column(), textType, i)
+	}
+	keys := make([]string, len(q.GroupBy))
+	for i := range q.GroupBy {
+		keys[i] = fmt.Sprintf("g%d", i)
+	}
+	return strings.Join(cols, ", ") + ", ", "GROUP BY " + strings.Join(keys, ", ")
+}
+
+// OrderBy 返回聚合结果的 ORDER BY 子句（不含关键字），以分组键兜底保证顺序稳定。
+func (q StatsQuery) OrderBy() string {
+	col, ok := statsSortColumns[q.Sort]
+	if !ok {
+		col = statsSortColumns[StatsSortCount]
+	}
+	keys := []string{col + " DESC"}
+	for i := range q.GroupBy {
+		keys = append(keys, fmt.Sprintf("g%d", i))
+	}
+	return strings.Join(keys, ", ")
+}
+
+// SortStatsRows 在内存中按 s 降序排列聚合结果，取值相同时按分组键升序，与 OrderBy 一致。
+func SortStatsRows(rows []StatsRow, s StatsSort) {
+	sort.Slice(rows, func(i, j int) bool {
+		vi, vj := statsSortValue(rows[i], s), statsSortValue(rows[j], s)
+		if vi != vj {
+			return vi > vj
+		}
+		return slices.Compare(rows[i].Group, rows[j].Group) < 0
+	})
+}
+
+func statsSortValue(r StatsRow, s StatsSort) float64 {
+	switch s {
+	case StatsSortErrors:
+		return float64(r.Errors)
+	case StatsSortErrorRate:
+		return r.ErrorRate()
+	case StatsSortAvg:
+		return r.AvgMS
+	case StatsSortP50:
+		return r.P50MS
+	case StatsSortP90:
+		return r.P90MS
+	case StatsSortP99:
+		return r.P99MS
+	default:
+		return float64(r.Count)
+	}
+}
+
+// EffectiveLimit 返回实际使用的组数上限。
+func (q StatsQuery) EffectiveLimit() int {
+	if q.Limit <= 0 {
+		return DefaultStatsLimit
+	}
+	return q.Limit
+}
+
+// ScanStatsRows 读取按 [g0..gN, cnt, errs, avg_ms, p50, p90, p99] 排列的聚合结果，
+// 供各 SQL 后端共用；cnt 为 0 的行（无分组时空数据集的汇总行）会被跳过。
+func ScanStatsRows(rows *sql.Rows, dims int) ([]StatsRow, error) {
+	out := make([]StatsRow, 0, 16)
+	for rows.Next() {
+		groups := make([]sql.NullString, dims)
+		var (
+			r                  StatsRow
+			avg, p50, p90, p99 sql.NullFloat64
+		)
+		dest := make([]any, 0, dims+6)
+		for i := range groups {
+			dest = append(dest, &groups[i])
+		}
+		dest = append(dest, &r.Count, &r.Errors, &avg, &p50, &p90, &p99)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("读取行失败：%w", err)
+		}
+		if r.Count == 0 {
+			continue
+		}
+		r.Group = make([]string, dims)
+		for i, g := range groups {
+			r.Group[i] = g.String
+		}
+		r.AvgMS, r.P50MS, r.P90MS, r.P99MS = avg.Float64, p50.Float64, p90.Float64, p99.Float64
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历结果失败：%w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,288 @@
+package storagetest
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"lightobs/internal/server/storage"
+	"lightobs/pkg/model"
+)
+
+// bucketBase 是聚合测试的起始时间，对齐到整分钟，时间桶的边界可以直接写出。
+var bucketBase = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func testStats(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	// 10.0.0.9：延迟 1..100ms，其中 10 条 503；10.0.0.8：2 条 200。
+	logs := make([]model.TrafficLog, 0, 102)
+	for i := 1; i <= 100; i++ {
+		status := 200
+		if i%10 == 0 {
+			status = 503
+		}
+		logs = append(logs, model.TrafficLog{Timestamp: bucketBase.Add(time.Duration(i) * time.Second), SrcIP: "10.0.0.1", SrcPort: 1000,
+			DstIP: "10.0.0.9", DstPort: 80, PID: 7, HTTPMethod: "GET", HTTPPath: "/api", StatusCode: status, LatencyMS: int64(i)})
+	}
+	for i := 0; i < 2; i++ {
+		logs = append(logs, model.TrafficLog{Timestamp: bucketBase, SrcIP: "10.0.0.1", SrcPort: 1000, DstIP: "10.0.0.8", DstPort: 8080,
+			HTTPMethod: "POST", HTTPPath: "/login", StatusCode: 200, LatencyMS: 500})
+	}
+	insert(t, s, logs...)
+
+	rows, err := s.Stats(ctx, storage.StatsQuery{GroupBy: []storage.Dimension{storage.DimDstIP, storage.DimDstPort}})
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("rows=%+v", rows)
+	}
+	r := rows[0]
+	if r.Group[0] != "10.0.0.9" || r.Group[1] != "80" || r.Count != 100 || r.Errors != 10 || r.ErrorRate() != 0.1 {
+		t.Errorf("row=%+v", r)
+	}
+	// 各后端的分位数都是 nearest-rank：取第一个满足 rank >= p*n 的值。
+	if r.AvgMS != 50.5 || r.P50MS != 50 || r.P90MS != 90 || r.P99MS != 99 {
+		t.Errorf("avg=%v p50=%v p90=%v p99=%v, want 50.5/50/90/99", r.AvgMS, r.P50MS, r.P90MS, r.P99MS)
+	}
+
+	rows, err = s.Stats(ctx, storage.StatsQuery{GroupBy: []storage.Dimension{storage.DimPath}, Sort: storage.StatsSortP99, Limit: 1})
+	if err != nil || len(rows) != 1 || rows[0].Group[0] != "/login" {
+		t.Errorf("sort by p99: rows=%+v err=%v", rows, err)
+	}
+
+	rows, err = s.Stats(ctx, storage.StatsQuery{Filter: storage.Filter{Method: "POST"}})
+	if err != nil || len(rows) != 1 || rows[0].Count != 2 || len(rows[0].Group) != 0 {
+		t.Errorf("ungrouped: rows=%+v err=%v", rows, err)
+	}
+
+	rows, err = s.Stats(ctx, storage.StatsQuery{Filter: storage.Filter{Method: "DELETE"}})
+	if err != nil || len(rows) != 0 {
+		t.Errorf("empty: rows=%+v err=%v", rows, err)
+	}
+}
+
+func testSeries(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	// 12:00:00~12:00:09 每秒一条发往 .9；12:00:25.5 一条 503 发往 .8；12:00:40 之后的数据在范围之外。
+	at := func(ts time.Time, dst string, status int, latency int64) model.TrafficLog {
+		return model.TrafficLog{Timestamp: ts, SrcIP: "10.0.0.1", SrcPort: 1000, DstIP: dst, DstPort: 80,
+			HTTPMethod: "GET", HTTPPath: "/", StatusCode: status, LatencyMS: latency}
+	}
+	var logs []model.TrafficLog
+	for i := 0; i < 10; i++ {
+		logs = append(logs, at(bucketBase.Add(time.Duration(i)*time.Second), "10.0.0.9", 200, int64(i+1)))
+	}
+	logs = append(logs, at(bucketBase.Add(25500*time.Millisecond), "10.0.0.8", 503, 100), at(bucketBase.Add(40*time.Second), "10.0.0.9", 200, 1))
+	insert(t, s, logs...)
+
+	q := storage.SeriesQuery{Filter: storage.Filter{From: bucketBase, To: bucketBase.Add(30 * time.Second)}, Step: 10 * time.Second}
+	points, err := s.Series(ctx, q)
+	if err != nil {
+		t.Fatalf("Series failed: %v", err)
+	}
+	if len(points) != 2 {
+		t.Fatalf("points=%+v", points)
+	}
+	if !points[0].Time.Equal(bucketBase) || points[0].Count != 10 || points[0].Errors != 0 || points[0].AvgMS != 5.5 {
+		t.Errorf("first bucket=%+v", points[0])
+	}
+	if !points[1].Time.Equal(bucketBase.Add(20*time.Second)) || points[1].Count != 1 || points[1].Errors != 1 || points[1].P99MS != 100 {
+		t.Errorf("second bucket=%+v", points[1])
+	}
+
+	q.GroupBy = []storage.Dimension{storage.DimDstIP}
+	q.Step = time.Minute
+	points, err = s.Series(ctx, q)
+	if err != nil {
+		t.Fatalf("Series failed: %v", err)
+	}
+	if len(points) != 2 || points[0].Group[0] != "10.0.0.8" || points[1].Group[0] != "10.0.0.9" || points[1].Count != 10 {
+		t.Errorf("grouped=%+v", points)
+	}
+}
+
+// rawOnly 加上一个不排除任何记录的状态码条件：预聚合表不支持按状态码过滤，查询因此只读原始数据。
+func rawOnly(f storage.Filter) storage.Filter {
+	f.Status = []storage.StatusRange{{Min: 100, Max: 599}}
+	return f
+}
+
+// checkStats 比较 q 的结果与只读原始数据的结果：计数精确，分位数在 sketch 误差内。
+func checkStats(t *testing.T, s storage.Store, q storage.StatsQuery) {
+	t.Helper()
+	ctx := context.Background()
+	got, err := s.Stats(ctx, q)
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	raw := q
+	raw.Filter = rawOnly(q.Filter)
+	want, err := s.Stats(ctx, raw)
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if len(got) != len(want) || len(got) == 0 {
+		t.Fatalf("got %+v want %+v", got, want)
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if strings.Join(g.Group, ",") != strings.Join(w.Group, ",") || g.Count != w.Count || g.Errors != w.Errors || math.Abs(g.AvgMS-w.AvgMS) > 1e-6 {
+			t.Errorf("row %d: got %+v want %+v", i, g, w)
+		}
+		for _, p := range [][2]float64{{g.P50MS, w.P50MS}, {g.P90MS, w.P90MS}, {g.P99MS, w.P99MS}} {
+			if math.Abs(p[0]-p[1]) > p[1]*0.02+2 {
+				t.Errorf("row %d: percentile got %v want %v", i, p[0], p[1])
+			}
+		}
+	}
+}
+
+// checkSeries 比较 q 的结果与只读原始数据的结果中每个桶的计数。
+func checkSeries(t *testing.T, s storage.Store, q storage.SeriesQuery) {
+	t.Helper()
+	ctx := context.Background()
+	points, err := s.Series(ctx, q)
+	if err != nil {
+		t.Fatalf("Series failed: %v", err)
+	}
+	raw := q
+	raw.Filter = rawOnly(q.Filter)
+	want, err := s.Series(ctx, raw)
+	if err != nil || len(points) != len(want) {
+		t.Fatalf("points=%d raw=%d err=%v", len(points), len(want), err)
+	}
+	for i := range points {
+		if !points[i].Time.Equal(want[i].Time) || points[i].Count != want[i].Count || points[i].Errors != want[i].Errors ||
+			strings.Join(points[i].Group, ",") != strings.Join(want[i].Group, ",") {
+			t.Errorf("point %d: got %+v want %+v", i, points[i], want[i])
+		}
+	}
+}
+
+func testRollup(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+	start := now.UTC().Truncate(time.Hour).Add(-3 * time.Hour)
+	var logs []model.TrafficLog
+	for i, ts := 0, start; ts.Before(now.Add(-time.Minute)); i, ts = i+1, ts.Add(20*time.Second) {
+		l := model.TrafficLog{Timestamp: ts, SrcIP: "10.0.0.1", DstIP: "10.0.0.9", DstPort: 80, PID: 7,
+			HTTPMethod: "GET", HTTPPath: "/users/1", HTTPRoute: "/users/{id}", StatusCode: 200, LatencyMS: int64(i%250 + 1)}
+		if i%3 == 0 {
+			l.DstIP, l.HTTPPath, l.HTTPRoute = "10.0.0.8", "/healthz", ""
+		}
+		if i%7 == 0 {
+			l.StatusCode = 503
+		}
+		logs = append(logs, l)
+	}
+	if err := s.InsertBatch(ctx, logs); err != nil {
+		t.Fatalf("InsertBatch failed: %v", err)
+	}
+
+	res, err := s.Rollup(ctx, storage.RollupPolicy{})
+	if err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+	q := storage.StatsQuery{Filter: storage.Filter{From: start.Add(-90 * time.Second)}, GroupBy: []storage.Dimension{storage.DimDstIP, storage.DimPath}}
+	checkStats(t, s, q)
+	checkStats(t, s, storage.StatsQuery{Filter: storage.Filter{From: start.Add(30 * time.Minute), Route: "/users/{id}", PID: 7}})
+	checkSeries(t, s, storage.SeriesQuery{Filter: storage.Filter{From: start}, Step: time.Hour, GroupBy: []storage.Dimension{storage.DimDstIP}})
+
+	// 分钟表只保留 30 分钟，更早的部分改由小时表与原始表覆盖，结果不变。
+	if _, err := s.Rollup(ctx, storage.RollupPolicy{MaxAge: map[storage.Resolution]time.Duration{storage.ResolutionMinute: 30 * time.Minute}}); err != nil {
+		t.Fatalf("Rollup prune failed: %v", err)
+	}
+	checkStats(t, s, q)
+	if res.Written == 0 {
+		// 不维护预聚合表的后端（如内存）到此为止。
+		return
+	}
+
+	// 原始数据过期之后，已聚合的小时仍能从预聚合表查到。
+	first := storage.StatsQuery{Filter: storage.Filter{From: start, To: start.Add(time.Hour)}}
+	want, err := s.Stats(ctx, first)
+	if err != nil || len(want) != 1 {
+		t.Fatalf("Stats: rows=%+v err=%v", want, err)
+	}
+	if _, err := s.Prune(ctx, storage.RetentionPolicy{MaxAge: now.Sub(start.Add(90 * time.Minute))}); err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if page, err := s.Query(ctx, storage.Filter{From: start, To: start.Add(time.Hour)}); err != nil || len(page.Items) != 0 {
+		t.Fatalf("raw rows left: n=%d err=%v", len(page.Items), err)
+	}
+	got, err := s.Stats(ctx, first)
+	if err != nil || len(got) != 1 || got[0].Count != want[0].Count || got[0].Errors != want[0].Errors {
+		t.Errorf("after raw pruned: got %+v want %+v err=%v", got, want, err)
+	}
+}
+
+func testRollupLateData(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	start := time.Now().UTC().Truncate(time.Hour).Add(-3 * time.Hour)
+	logs := make([]model.TrafficLog, 0, 360)
+	for i := 0; i < 360; i++ {
+		logs = append(logs, model.TrafficLog{Timestamp: start.Add(time.Duration(i) * 30 * time.Second), SrcIP: "10.0.0.1", DstIP: "10.0.0.9",
+			DstPort: 80, HTTPMethod: "GET", HTTPPath: "/a", StatusCode: 200, LatencyMS: int64(i%100 + 1)})
+	}
+	// start 之前 20 天的历史，每天 10 条，用于原始数据清理之后的迟到数据。
+	for d := 1; d <= 20; d++ {
+		for i := 0; i < 10; i++ {
+			logs = append(logs, model.TrafficLog{Timestamp: start.Add(-time.Duration(d)*24*time.Hour + time.Duration(i)*time.Minute), SrcIP: "10.0.0.1",
+				DstIP: "10.0.0.9", DstPort: 80, HTTPMethod: "GET", HTTPPath: "/old", StatusCode: 200, LatencyMS: 5})
+		}
+	}
+	if err := s.InsertBatch(ctx, logs); err != nil {
+		t.Fatalf("InsertBatch failed: %v", err)
+	}
+	res, err := s.Rollup(ctx, storage.RollupPolicy{})
+	if err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+
+	// 已聚合的分钟与小时里又写入了数据，下次预聚合时重算这些桶。
+	late := model.TrafficLog{Timestamp: start.Add(10*time.Minute + 5*time.Second), SrcIP: "10.0.0.1", DstIP: "10.0.0.9",
+		DstPort: 80, HTTPMethod: "GET", HTTPPath: "/a", StatusCode: 503, LatencyMS: 900}
+	insert(t, s, late)
+	late.Timestamp = start.Add(95 * time.Minute)
+	if err := s.InsertBatch(ctx, []model.TrafficLog{late}); err != nil {
+		t.Fatalf("InsertBatch failed: %v", err)
+	}
+	if _, err := s.Rollup(ctx, storage.RollupPolicy{}); err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+
+	got, err := s.Stats(ctx, storage.StatsQuery{Filter: storage.Filter{From: start}})
+	if err != nil || len(got) != 1 {
+		t.Fatalf("Stats: rows=%+v err=%v", got, err)
+	}
+	if got[0].Count != 362 || got[0].Errors != 2 {
+		t.Errorf("count=%d errors=%d, want 362 and 2", got[0].Count, got[0].Errors)
+	}
+	checkSeries(t, s, storage.SeriesQuery{Filter: storage.Filter{From: start, To: start.Add(3 * time.Hour)}, Step: time.Hour})
+	if res.Written == 0 {
+		// 不维护预聚合表的后端（如内存）到此为止。
+		return
+	}
+
+	// 原始数据清理之后又到达了清理边界之前的数据：只剩在预聚合表中的历史不能被删除重算。
+	history := storage.StatsQuery{Filter: storage.Filter{From: start.Add(-21 * 24 * time.Hour), To: start}}
+	if _, err := s.Prune(ctx, storage.RetentionPolicy{MaxAge: 7 * 24 * time.Hour}); err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	want, err := s.Stats(ctx, history)
+	if err != nil || len(want) != 1 || want[0].Count != 200 {
+		t.Fatalf("Stats after prune: rows=%+v err=%v", want, err)
+	}
+	late.Timestamp = start.Add(-20*24*time.Hour + 30*time.Second)
+	insert(t, s, late)
+	if _, err := s.Rollup(ctx, storage.RollupPolicy{}); err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+	got, err = s.Stats(ctx, history)
+	if err != nil || len(got) != 1 || got[0].Count != want[0].Count {
+		t.Errorf("after late data older than raw retention: got %+v want %+v err=%v", got, want, err)
+	}
+}
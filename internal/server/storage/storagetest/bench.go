@@ -0,0 +1,51 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"lightobs/internal/server/storage"
+	"lightobs/pkg/model"
+)
+
+// BatchLogs 生成 n 条从 base 开始、按毫秒递增的记录，用于批量写入的测试与基准。
+func BatchLogs(base time.Time, n int) []model.TrafficLog {
+	logs := make([]model.TrafficLog, n)
+	for i := range logs {
+		logs[i] = model.TrafficLog{
+			Timestamp: base.Add(time.Duration(i) * time.Millisecond), SrcIP: "10.0.0.1", SrcPort: 40000 + i%1000,
+			DstIP: "10.0.0.9", DstPort: 80, PID: i % 7, HTTPMethod: "GET", HTTPPath: "/api/users/1", HTTPQuery: "q=1",
+			HTTPRoute: "/api/users/{id}", StatusCode: 200 + i%2*300, LatencyMS: int64(i % 100), PacketSize: 512,
+		}
+	}
+	return logs
+}
+
+// Bench 以子基准的形式比较逐条写入与批量写入，newStore 每次返回一个空的 Store，由 Bench 负责关闭。
+// 两者的 ns/op 都按每条记录计算，可直接比较。
+func Bench(b *testing.B, newStore func(b *testing.B) storage.Store) {
+	b.Run("Insert", func(b *testing.B) {
+		s := newStore(b)
+		defer s.Close()
+		logs := BatchLogs(time.Now(), 1000)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := s.Insert(context.Background(), &logs[i%len(logs)]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("InsertBatch", func(b *testing.B) {
+		s := newStore(b)
+		defer s.Close()
+		logs := BatchLogs(time.Now(), 1000)
+		b.ResetTimer()
+		// 每次迭代写入一条，按 1000 条一批提交。
+		for n := b.N; n > 0; n -= len(logs) {
+			if err := s.InsertBatch(context.Background(), logs[:min(n, len(logs))]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package storagetest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"lightobs/internal/server/storage"
+	"lightobs/pkg/model"
+)
+
+func paths(logs []model.TrafficLog) []string {
+	out := make([]string, len(logs))
+	for i, l := range logs {
+		out[i] = l.HTTPPath
+	}
+	return out
+}
+
+func testQueryFilter(t *testing.T, s storage.Store) {
+	insert(t, s,
+		model.TrafficLog{Timestamp: base, SrcIP: "10.0.0.1", SrcPort: 40000, DstIP: "10.0.0.9", DstPort: 80, PID: 1, HTTPMethod: "GET", HTTPPath: "/api/users/1", StatusCode: 200, LatencyMS: 10},
+		model.TrafficLog{Timestamp: base.Add(time.Minute), SrcIP: "10.0.0.1", SrcPort: 40001, DstIP: "10.0.0.9", DstPort: 80, PID: 1, HTTPMethod: "POST", HTTPPath: "/api/orders", StatusCode: 503, LatencyMS: 900},
+		model.TrafficLog{Timestamp: base.Add(2 * time.Minute), SrcIP: "10.0.0.2", SrcPort: 40002, DstIP: "10.0.0.8", DstPort: 8080, PID: 2, HTTPMethod: "GET", HTTPPath: "/healthz", StatusCode: 200, LatencyMS: 1},
+		model.TrafficLog{Timestamp: base.Add(3 * time.Minute), SrcIP: "10.0.0.2", SrcPort: 40003, DstIP: "10.0.0.9", DstPort: 80, PID: 2, HTTPMethod: "GET", HTTPPath: "/api_v2/users", StatusCode: 404, LatencyMS: 300},
+	)
+
+	cases := []struct {
+		name string
+		f    storage.Filter
+		want []string // 按返回顺序排列的 path
+	}{
+		{"all desc", storage.Filter{}, []string{"/api_v2/users", "/healthz", "/api/orders", "/api/users/1"}},
+		{"time range", storage.Filter{From: base.Add(time.Minute), To: base.Add(3 * time.Minute)}, []string{"/healthz", "/api/orders"}},
+		{"prefix is literal", storage.Filter{Path: "/api_"}, []string{"/api_v2/users"}},
+		{"glob", storage.Filter{Path: "/api/*"}, []string{"/api/orders", "/api/users/1"}},
+		{"method and port", storage.Filter{Method: "get", DstPort: 80}, []string{"/api_v2/users", "/api/users/1"}},
+		{"status class or code", storage.Filter{Status: []storage.StatusRange{{Min: 500, Max: 599}, {Min: 404, Max: 404}}}, []string{"/api_v2/users", "/api/orders"}},
+		{"latency window", storage.Filter{MinLatencyMS: 10, MaxLatencyMS: 300}, []string{"/api_v2/users", "/api/users/1"}},
+		{"pid and src ip", storage.Filter{PID: 2, SrcIP: "10.0.0.2", SrcPort: 40002}, []string{"/healthz"}},
+		{"ip either side", storage.Filter{IP: "10.0.0.8"}, []string{"/healthz"}},
+		{"sort latency asc", storage.Filter{Sort: storage.SortLatency, Asc: true, Limit: 2}, []string{"/healthz", "/api/users/1"}},
+		{"sort status desc", storage.Filter{Sort: storage.SortStatus, Limit: 1}, []string{"/api/orders"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := s.Query(context.Background(), tc.f)
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if got := paths(page.Items); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("got %v want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func testRoute(t *testing.T, s storage.Store) {
+	insert(t, s,
+		model.TrafficLog{Timestamp: base, SrcIP: "10.0.0.1", DstIP: "10.0.0.9", DstPort: 80, HTTPMethod: "GET", HTTPPath: "/users/1", HTTPQuery: "tab=a", HTTPRoute: "/users/{id}", StatusCode: 200},
+		model.TrafficLog{Timestamp: base.Add(time.Second), SrcIP: "10.0.0.1", DstIP: "10.0.0.9", DstPort: 80, HTTPMethod: "GET", HTTPPath: "/users/2", HTTPRoute: "/users/{id}", StatusCode: 200},
+		// 归一化之前写入的旧数据没有路由模板。
+		model.TrafficLog{Timestamp: base.Add(2 * time.Second), SrcIP: "10.0.0.1", DstIP: "10.0.0.9", DstPort: 80, HTTPMethod: "GET", HTTPPath: "/legacy", StatusCode: 200},
+	)
+	ctx := context.Background()
+
+	page, err := s.Query(ctx, storage.Filter{Route: "/users/{id}", Asc: true})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(page.Items) != 2 || page.Items[0].HTTPQuery != "tab=a" || page.Items[0].HTTPRoute != "/users/{id}" {
+		t.Fatalf("items=%+v", page.Items)
+	}
+
+	stats, err := s.Stats(ctx, storage.StatsQuery{GroupBy: []storage.Dimension{storage.DimPath}})
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if len(stats) != 2 || stats[0].Group[0] != "/users/{id}" || stats[0].Count != 2 || stats[1].Group[0] != "/legacy" {
+		t.Errorf("by path: %+v", stats)
+	}
+	stats, err = s.Stats(ctx, storage.StatsQuery{GroupBy: []storage.Dimension{storage.DimRawPath}})
+	if err != nil || len(stats) != 3 {
+		t.Errorf("by raw_path: %+v err=%v", stats, err)
+	}
+}
@@ -0,0 +1,588 @@
+// Package storagetest 是 storage.Store 的一致性测试套件：每个存储后端都必须通过，
+// 保证 API 层换用任何后端时看到的行为一致。
+//
+// 后端在自己的测试中调用：
+//
+//	func TestStore_Conformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.Store { ... })
+//	}
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"lightobs/internal/server/storage"
+	"lightobs/pkg/model"
+)
+
+// Factory 每次调用返回一个空的 Store，由套件负责关闭。
+type Factory func(t *testing.T) storage.Store
+
+// Run 以子测试的形式逐项检查 Store 的行为约定。
+func Run(t *testing.T, newStore Factory) {
+	open := func(t *testing.T) storage.Store {
+		t.Helper()
+		s := newStore(t)
+		t.Cleanup(func() { _ = s.Close() })
+		return s
+	}
+	t.Run("RoundTrip", func(t *testing.T) { testRoundTrip(t, open(t)) })
+	t.Run("Ordering", func(t *testing.T) { testOrdering(t, open(t)) })
+	t.Run("Limit", func(t *testing.T) { testLimit(t, open(t)) })
+	t.Run("Paging", func(t *testing.T) { testPaging(t, open(t)) })
+	t.Run("IPMatch", func(t *testing.T) { testIPMatch(t, open(t)) })
+	t.Run("PID", func(t *testing.T) { testPID(t, open(t)) })
+	t.Run("TimeZones", func(t *testing.T) { testTimeZones(t, open(t)) })
+	t.Run("InsertBatch", func(t *testing.T) { testInsertBatch(t, open(t)) })
+	t.Run("QueryFilter", func(t *testing.T) { testQueryFilter(t, open(t)) })
+	t.Run("Route", func(t *testing.T) { testRoute(t, open(t)) })
+	t.Run("Stats", func(t *testing.T) { testStats(t, open(t)) })
+	t.Run("Series", func(t *testing.T) { testSeries(t, open(t)) })
+	t.Run("Prune", func(t *testing.T) { testPrune(t, open) })
+	t.Run("Rollup", func(t *testing.T) { testRollup(t, open(t)) })
+	t.Run("RollupLateData", func(t *testing.T) { testRollupLateData(t, open(t)) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, open(t)) })
+	t.Run("Close", func(t *testing.T) { testClose(t, newStore(t)) })
+}
+
+// base 是测试数据的起始时间：取整到秒并留出微秒部分，各后端至少保留微秒精度。
+var base = time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC).Add(123456 * time.Microsecond)
+
+// logAt 生成一条记录，seq 写入 PacketSize 用于在结果中识别记录。
+func logAt(ts time.Time, seq int) model.TrafficLog {
+	return model.TrafficLog{
+		Timestamp: ts, SrcIP: "10.0.0.2", SrcPort: 40000 + seq, DstIP: "10.0.0.1", DstPort: 80, PID: 100,
+		HTTPMethod: "GET", HTTPPath: "/users/1", HTTPRoute: "/users/{id}", StatusCode: 200, LatencyMS: 10,
+		PacketSize: seq,
+	}
+}
+
+func insert(t *testing.T, s storage.Store, logs ...model.TrafficLog) {
+	t.Helper()
+	for i := range logs {
+		if err := s.Insert(context.Background(), &logs[i]); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+}
+
+// seqs 返回结果中各记录的 seq，用于比较顺序。
+func seqs(logs []model.TrafficLog) []int {
+	out := make([]int, len(logs))
+	for i, l := range logs {
+		out[i] = l.PacketSize
+	}
+	return out
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// scanAll 按 f 的排序读出全部记录。
+func scanAll(t *testing.T, s storage.Store, f storage.Filter) []model.TrafficLog {
+	t.Helper()
+	var out []model.TrafficLog
+	if err := storage.Scan(context.Background(), s.Query, f, func(l *model.TrafficLog) error {
+		out = append(out, *l)
+		return nil
+	}); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	return out
+}
+
+func testRoundTrip(t *testing.T, s storage.Store) {
+	want := model.TrafficLog{
+		Timestamp: base, SrcIP: "192.168.1.10", SrcPort: 12345, DstIP: "10.0.0.1", DstPort: 8080, PID: 4242,
+		HTTPMethod: "POST", HTTPPath: "/orders/17", HTTPQuery: "expand=items&x=%E4%B8%AD", HTTPRoute: "/orders/{id}",
+		StatusCode: 503, LatencyMS: 1500, PacketSize: 987,
+	}
+	// PID、查询串、路由为零值的记录读出时同样是零值，不能是 NULL 导致的扫描错误。
+	bare := model.TrafficLog{Timestamp: base.Add(time.Second), SrcIP: "192.168.1.11", DstIP: "10.0.0.1",
+		HTTPMethod: "GET", HTTPPath: "/"}
+	insert(t, s, want, bare)
+
+	got, err := s.QueryByIP(context.Background(), "10.0.0.1", 10)
+	if err != nil || len(got) != 2 {
+		t.Fatalf("QueryByIP: n=%d err=%v", len(got), err)
+	}
+	check := func(got, want model.TrafficLog) {
+		t.Helper()
+		if !got.Timestamp.Equal(want.Timestamp) {
+			t.Errorf("timestamp=%v, want %v", got.Timestamp, want.Timestamp)
+		}
+		if _, off := got.Timestamp.Zone(); off != 0 {
+			t.Errorf("timestamp %v not in UTC", got.Timestamp)
+		}
+		got.Timestamp = want.Timestamp
+		if got != want {
+			t.Errorf("got  %+v\nwant %+v", got, want)
+		}
+	}
+	check(got[0], bare)
+	check(got[1], want)
+}
+
+func testOrdering(t *testing.T, s storage.Store) {
+	// 插入顺序与时间顺序不同，并有两条时间相同的记录：同一时间按写入顺序排列（降序时后写入的在前）。
+	insert(t, s,
+		logAt(base.Add(2*time.Second), 1),
+		logAt(base, 2),
+		logAt(base.Add(time.Second), 3),
+		logAt(base.Add(time.Second), 4),
+	)
+	ctx := context.Background()
+
+	got, err := s.QueryByIP(ctx, "10.0.0.1", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 4, 3, 2}; !equalInts(seqs(got), want) {
+		t.Errorf("QueryByIP order=%v, want %v (newest first)", seqs(got), want)
+	}
+	page, err := s.Query(ctx, storage.Filter{Asc: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{2, 3, 4, 1}; !equalInts(seqs(page.Items), want) {
+		t.Errorf("ascending order=%v, want %v", seqs(page.Items), want)
+	}
+
+	slow := logAt(base, 5)
+	slow.LatencyMS = 900
+	insert(t, s, slow)
+	page, err = s.Query(ctx, storage.Filter{Sort: storage.SortLatency, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 延迟相同的记录再按时间降序排列。
+	if want := []int{5, 1}; !equalInts(seqs(page.Items), want) {
+		t.Errorf("latency order=%v, want %v", seqs(page.Items), want)
+	}
+}
+
+func testLimit(t *testing.T, s storage.Store) {
+	logs := make([]model.TrafficLog, storage.DefaultLimit+10)
+	for i := range logs {
+		logs[i] = logAt(base.Add(time.Duration(i)*time.Second), i)
+		logs[i].PID = 100 + i%2
+	}
+	if err := s.InsertBatch(context.Background(), logs); err != nil {
+		t.Fatalf("InsertBatch failed: %v", err)
+	}
+	ctx := context.Background()
+	last := len(logs) - 1
+
+	got, err := s.QueryByIP(ctx, "10.0.0.1", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{last, last - 1, last - 2}; !equalInts(seqs(got), want) {
+		t.Errorf("QueryByIP limit 3=%v, want %v", seqs(got), want)
+	}
+	got, err = s.QueryByPID(ctx, 101, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{last, last - 2}; !equalInts(seqs(got), want) {
+		t.Errorf("QueryByPID limit 2=%v, want %v", seqs(got), want)
+	}
+	// limit 不大于 0 时使用默认条数。
+	for _, limit := range []int{0, -1} {
+		got, err = s.QueryByIP(ctx, "10.0.0.1", limit)
+		if err != nil || len(got) != storage.DefaultLimit {
+			t.Errorf("limit %d: n=%d err=%v, want %d", limit, len(got), err, storage.DefaultLimit)
+		}
+	}
+	got, err = s.QueryByIP(ctx, "10.0.0.1", 10000)
+	if err != nil || len(got) != len(logs) {
+		t.Errorf("limit above total: n=%d err=%v, want %d", len(got), err, len(logs))
+	}
+}
+
+func testPaging(t *testing.T, s storage.Store) {
+	logs := make([]model.TrafficLog, 30)
+	for i := range logs {
+		// 每三条共用一个时间，翻页游标必须能区分时间相同的记录。
+		logs[i] = logAt(base.Add(time.Duration(i/3)*time.Second), i)
+		logs[i].LatencyMS = int64(i % 4)
+	}
+	insert(t, s, logs...)
+	ctx := context.Background()
+
+	for _, f := range []storage.Filter{
+		{Limit: 7},
+		{Limit: 10, Asc: true},
+		{Limit: 4, Sort: storage.SortLatency},
+		{Limit: 30},
+	} {
+		// 期望顺序：先按排序字段，再按时间，时间相同时按写入顺序；方向与 f 一致。
+		want := make([]model.TrafficLog, len(logs))
+		copy(want, logs)
+		sort.SliceStable(want, func(i, j int) bool {
+			a, b := want[i], want[j]
+			if f.Sort == storage.SortLatency && a.LatencyMS != b.LatencyMS {
+				return a.LatencyMS > b.LatencyMS
+			}
+			if !a.Timestamp.Equal(b.Timestamp) {
+				return a.Timestamp.After(b.Timestamp) != f.Asc
+			}
+			return a.PacketSize > b.PacketSize != f.Asc
+		})
+
+		var (
+			paged []model.TrafficLog
+			pages int
+		)
+		for {
+			if pages++; pages > len(logs) {
+				t.Fatalf("%+v: paging does not terminate", f)
+			}
+			page, err := s.Query(ctx, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Items) > f.Limit {
+				t.Fatalf("%+v: page of %d", f, len(page.Items))
+			}
+			paged = append(paged, page.Items...)
+			if page.Next == nil {
+				break
+			}
+			f.After = page.Next
+		}
+		if !equalInts(seqs(paged), seqs(want)) {
+			t.Errorf("%+v: paged=%v\nwant=%v", f, seqs(paged), seqs(want))
+		}
+		// 最后一页恰好满页时 Next 为空，不会多出一个空页。
+		if wantPages := (len(logs) + f.Limit - 1) / f.Limit; pages != wantPages {
+			t.Errorf("%+v: %d pages, want %d", f, pages, wantPages)
+		}
+	}
+
+	page, err := s.Query(ctx, storage.Filter{Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Query(ctx, storage.Filter{Limit: 5, Asc: true, After: page.Next}); err != storage.ErrCursorMismatch {
+		t.Errorf("cursor with other sort: err=%v, want ErrCursorMismatch", err)
+	}
+}
+
+func testIPMatch(t *testing.T, s storage.Store) {
+	out := logAt(base, 1) // 10.0.0.2 -> 10.0.0.1
+	in := logAt(base.Add(time.Second), 2)
+	in.SrcIP, in.DstIP = "10.0.0.1", "10.0.0.3"
+	other := logAt(base.Add(2*time.Second), 3)
+	other.SrcIP, other.DstIP = "10.0.0.10", "10.0.0.11" // 以 10.0.0.1 为前缀，不能被匹配
+	insert(t, s, out, in, other)
+	ctx := context.Background()
+
+	got, err := s.QueryByIP(ctx, "10.0.0.1", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{2, 1}; !equalInts(seqs(got), want) {
+		t.Errorf("QueryByIP matched %v, want %v (src or dst, exact)", seqs(got), want)
+	}
+	for _, c := range []struct {
+		f    storage.Filter
+		want []int
+	}{
+		{storage.Filter{IP: "10.0.0.3"}, []int{2}},
+		{storage.Filter{SrcIP: "10.0.0.1"}, []int{2}},
+		{storage.Filter{DstIP: "10.0.0.1"}, []int{1}},
+		{storage.Filter{SrcIP: "10.0.0.2", DstIP: "10.0.0.1"}, []int{1}},
+		{storage.Filter{SrcIP: "10.0.0.1", DstIP: "10.0.0.1"}, nil},
+		{storage.Filter{IP: "10.0.0.9"}, nil},
+	} {
+		page, err := s.Query(ctx, c.f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalInts(seqs(page.Items), c.want) {
+			t.Errorf("%+v matched %v, want %v", c.f, seqs(page.Items), c.want)
+		}
+	}
+	if got, err := s.QueryByIP(ctx, "10.0.0.9", 10); err != nil || len(got) != 0 {
+		t.Errorf("unknown IP: n=%d err=%v", len(got), err)
+	}
+}
+
+func testPID(t *testing.T, s storage.Store) {
+	a, b, unknown := logAt(base, 1), logAt(base.Add(time.Second), 2), logAt(base.Add(2*time.Second), 3)
+	a.PID, b.PID, unknown.PID = 7, 8, 0
+	a2 := logAt(base.Add(3*time.Second), 4)
+	a2.PID = 7
+	insert(t, s, a, b, unknown, a2)
+	ctx := context.Background()
+
+	got, err := s.QueryByPID(ctx, 7, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{4, 1}; !equalInts(seqs(got), want) {
+		t.Errorf("QueryByPID(7)=%v, want %v", seqs(got), want)
+	}
+	if got, err := s.QueryByPID(ctx, 9, 10); err != nil || len(got) != 0 {
+		t.Errorf("QueryByPID(9): n=%d err=%v", len(got), err)
+	}
+	page, err := s.Query(ctx, storage.Filter{PID: 8, IP: "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{2}; !equalInts(seqs(page.Items), want) {
+		t.Errorf("PID and IP=%v, want %v", seqs(page.Items), want)
+	}
+}
+
+func testTimeZones(t *testing.T, s storage.Store) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	newYork := time.FixedZone("EDT", -4*3600)
+	// 墙上时间的顺序与实际时刻的顺序相反：排序与范围过滤必须按时刻进行。
+	t1 := base.In(newYork)                       // 04:00 EDT
+	t2 := base.Add(time.Minute).In(shanghai)     // 16:01 CST
+	t3 := base.Add(2 * time.Minute).In(time.UTC) // 08:02 UTC
+	insert(t, s, logAt(t2, 2), logAt(t3, 3), logAt(t1, 1))
+	ctx := context.Background()
+
+	page, err := s.Query(ctx, storage.Filter{Asc: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 2, 3}; !equalInts(seqs(page.Items), want) {
+		t.Fatalf("order=%v, want %v", seqs(page.Items), want)
+	}
+	for i, want := range []time.Time{t1, t2, t3} {
+		if got := page.Items[i].Timestamp; !got.Equal(want) {
+			t.Errorf("item %d timestamp=%v, want %v", i, got, want)
+		}
+	}
+
+	// From/To 为左闭右开区间，边界用另一个时区表示。
+	page, err = s.Query(ctx, storage.Filter{From: t2.In(newYork), To: t3.In(shanghai)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{2}; !equalInts(seqs(page.Items), want) {
+		t.Errorf("[t2, t3)=%v, want %v", seqs(page.Items), want)
+	}
+}
+
+func testInsertBatch(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	if err := s.InsertBatch(ctx, nil); err != nil {
+		t.Errorf("empty batch: %v", err)
+	}
+	if err := s.Insert(ctx, nil); err == nil {
+		t.Error("Insert(nil) succeeded")
+	}
+	logs := []model.TrafficLog{logAt(base, 1), logAt(base.Add(time.Second), 2), logAt(base, 3)}
+	if err := s.InsertBatch(ctx, logs); err != nil {
+		t.Fatalf("InsertBatch failed: %v", err)
+	}
+	// 同一批中的记录按切片顺序写入。
+	got := scanAll(t, s, storage.Filter{Asc: true})
+	if want := []int{1, 3, 2}; !equalInts(seqs(got), want) {
+		t.Errorf("order=%v, want %v", seqs(got), want)
+	}
+	// 写入后修改调用方的切片不影响已写入的数据。
+	logs[0].SrcIP = "changed"
+	if got, _ := s.QueryByIP(ctx, "changed", 10); len(got) != 0 {
+		t.Error("store retains caller's slice")
+	}
+
+	// 超过 SQL 后端单条 INSERT 的行数，各列原样读回。
+	big := make([]model.TrafficLog, 1007)
+	for i := range big {
+		big[i] = model.TrafficLog{
+			Timestamp: base.Add(time.Hour + time.Duration(i)*time.Millisecond), SrcIP: "10.0.0.5", SrcPort: 40000 + i%1000,
+			DstIP: "10.0.0.9", DstPort: 80, PID: i % 7, HTTPMethod: "GET", HTTPPath: "/api/users/1", HTTPQuery: "q=1",
+			HTTPRoute: "/api/users/{id}", StatusCode: 200 + i%2*300, LatencyMS: int64(i % 100), PacketSize: 512,
+		}
+	}
+	if err := s.InsertBatch(ctx, big); err != nil {
+		t.Fatalf("InsertBatch failed: %v", err)
+	}
+	got = scanAll(t, s, storage.Filter{From: base.Add(time.Hour), Asc: true})
+	if len(got) != len(big) {
+		t.Fatalf("got %d rows, want %d", len(got), len(big))
+	}
+	for i := range big {
+		if got[i] != big[i] {
+			t.Fatalf("row %d: got %+v want %+v", i, got[i], big[i])
+		}
+	}
+
+	// 整批要么全部写入，要么全部不写：已取消的 ctx 不会只写入一部分。
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	err := s.InsertBatch(cctx, big[:10])
+	n := len(scanAll(t, s, storage.Filter{}))
+	if want := len(logs) + len(big); err != nil && n != want || err == nil && n != want+10 {
+		t.Errorf("canceled batch: err=%v rows=%d", err, n)
+	}
+}
+
+func testPrune(t *testing.T, open func(t *testing.T) storage.Store) {
+	ctx := context.Background()
+	now := time.Now()
+	// 最近 6 个小时，每小时 10 条，最新的一组在 now-1m。
+	seed := func(t *testing.T) storage.Store {
+		s := open(t)
+		logs := make([]model.TrafficLog, 0, 60)
+		for h := 0; h < 6; h++ {
+			for i := 0; i < 10; i++ {
+				ts := now.Add(-time.Duration(h)*time.Hour - time.Minute + time.Duration(i)*time.Second)
+				logs = append(logs, logAt(ts, h*10+i))
+			}
+		}
+		if err := s.InsertBatch(ctx, logs); err != nil {
+			t.Fatalf("InsertBatch failed: %v", err)
+		}
+		return s
+	}
+
+	t.Run("max age", func(t *testing.T) {
+		s := seed(t)
+		res, err := s.Prune(ctx, storage.RetentionPolicy{MaxAge: 150 * time.Minute})
+		if err != nil {
+			t.Fatalf("Prune failed: %v", err)
+		}
+		if n := len(scanAll(t, s, storage.Filter{})); res.Deleted != 30 || res.Partitions < 3 || n != 30 {
+			t.Errorf("res=%+v remaining=%d", res, n)
+		}
+		if n := len(scanAll(t, s, storage.Filter{To: now.Add(-150 * time.Minute)})); n != 0 {
+			t.Errorf("expired rows left: %d", n)
+		}
+
+		// 再次执行没有可删除的数据。
+		if res, err := s.Prune(ctx, storage.RetentionPolicy{MaxAge: 150 * time.Minute}); err != nil || res.Deleted != 0 {
+			t.Errorf("second run: res=%+v err=%v", res, err)
+		}
+	})
+
+	t.Run("max bytes", func(t *testing.T) {
+		s := seed(t)
+		u, ok := s.(storage.UsageReporter)
+		if !ok {
+			t.Skip("后端不统计占用")
+		}
+		used, rows, err := u.Usage(ctx)
+		if err != nil || used <= 0 || rows != 60 {
+			t.Fatalf("usage=%d rows=%d err=%v", used, rows, err)
+		}
+		res, err := s.Prune(ctx, storage.RetentionPolicy{MaxBytes: used / 2})
+		if err != nil {
+			t.Fatalf("Prune failed: %v", err)
+		}
+		// 按比例需要删除约一半，且只按整点分区从最旧的开始删。
+		if res.Deleted < 30 || res.Deleted >= 60 || res.UsedBytes != used {
+			t.Errorf("res=%+v", res)
+		}
+		if n := len(scanAll(t, s, storage.Filter{From: now.Add(-2 * time.Minute)})); n != 10 {
+			t.Errorf("newest rows: %d", n)
+		}
+
+		if res, err := s.Prune(ctx, storage.RetentionPolicy{MaxBytes: 1 << 40}); err != nil || res.Deleted != 0 {
+			t.Errorf("under limit: res=%+v err=%v", res, err)
+		}
+	})
+}
+
+func testConcurrency(t *testing.T, s storage.Store) {
+	const (
+		writers   = 8
+		perWriter = 40
+	)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*2)
+	for w := 0; w < writers; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				l := logAt(base.Add(time.Duration(i)*time.Millisecond), w*perWriter+i)
+				l.PID = 1000 + w
+				var err error
+				if i%2 == 0 {
+					err = s.Insert(ctx, &l)
+				} else {
+					err = s.InsertBatch(ctx, []model.TrafficLog{l})
+				}
+				if err != nil {
+					errs <- fmt.Errorf("writer %d: %w", w, err)
+					return
+				}
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				if _, err := s.Query(ctx, storage.Filter{Limit: 20}); err != nil {
+					errs <- fmt.Errorf("reader: %w", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	seen := map[int]bool{}
+	for _, l := range scanAll(t, s, storage.Filter{}) {
+		if seen[l.PacketSize] {
+			t.Errorf("record %d stored twice", l.PacketSize)
+		}
+		seen[l.PacketSize] = true
+	}
+	if len(seen) != writers*perWriter {
+		t.Errorf("stored %d records, want %d", len(seen), writers*perWriter)
+	}
+	for w := 0; w < writers; w++ {
+		if got, err := s.QueryByPID(ctx, 1000+w, 1000); err != nil || len(got) != perWriter {
+			t.Errorf("writer %d: n=%d err=%v", w, len(got), err)
+		}
+	}
+}
+
+func testClose(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	l := logAt(base, 1)
+	insert(t, s, l)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	// 关闭后各方法返回错误而不是 panic，重复 Close 也不 panic。
+	if err := s.Insert(ctx, &l); err == nil {
+		t.Error("Insert after Close succeeded")
+	}
+	if err := s.InsertBatch(ctx, []model.TrafficLog{l}); err == nil {
+		t.Error("InsertBatch after Close succeeded")
+	}
+	if _, err := s.QueryByIP(ctx, "10.0.0.1", 10); err == nil {
+		t.Error("QueryByIP after Close succeeded")
+	}
+	if _, err := s.Query(ctx, storage.Filter{}); err == nil {
+		t.Error("Query after Close succeeded")
+	}
+	_ = s.Close()
+}
@@ -8,7 +8,38 @@ import (
 
 type Store interface {
 	Insert(ctx context.Context, logEntry *model.TrafficLog) error
+	// InsertBatch 在一个事务中写入多条记录，要么全部成功，要么全部失败。
+	InsertBatch(ctx context.Context, logs []model.TrafficLog) error
 	QueryByIP(ctx context.Context, ip string, limit int) ([]model.TrafficLog, error)
 	QueryByPID(ctx context.Context, pid int, limit int) ([]model.TrafficLog, error)
+	// Query 按 Filter 组合条件查询，返回至多 f.EffectiveLimit() 条；
+	// 还有更多数据时 Page.Next 非空，放入 Filter.After 即可读取下一页。
+	Query(ctx context.Context, f Filter) (Page, error)
+	// Stats 按维度分组计算 RED 指标（请求数、错误数、延迟分位数）。
+	// Stats 与 Series 在条件允许时自动改读覆盖该时间范围的最粗的预聚合表。
+	Stats(ctx context.Context, q StatsQuery) ([]StatsRow, error)
+	// Series 按时间桶聚合，结果按 (桶, 分组) 升序排列，没有数据的桶不返回。
+	Series(ctx context.Context, q SeriesQuery) ([]SeriesPoint, error)
+	// Prune 按保留策略从最旧的时间分区开始删除数据。
+	Prune(ctx context.Context, p RetentionPolicy) (PruneResult, error)
+	// Rollup 把新数据聚合进 1 分钟与 1 小时预聚合表，并按策略清理过期的预聚合数据。
+	Rollup(ctx context.Context, p RollupPolicy) (RollupResult, error)
 	Close() error
 }
+
+// UsageReporter 由能统计自身占用的后端实现，/metrics 据此输出存储大小。
+type UsageReporter interface {
+	// Usage 返回数据占用的字节数与总行数。
+	Usage(ctx context.Context) (bytes, rows int64, err error)
+}
+
+// Sealer 由支持冷存储的后端实现：把超出热数据窗口的完整时间分区移到冷存储。
+type Sealer interface {
+	Seal(ctx context.Context) (SealResult, error)
+}
+
+// SealResult 汇总一次封存的结果。
+type SealResult struct {
+	Partitions int
+	Rows       int64
+}
@@ -0,0 +1,119 @@
+// Package tail 把新写入的 TrafficLog 实时分发给订阅者，用于 /api/v1/tail 推送。
+package tail
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"lightobs/internal/server/storage"
+	"lightobs/pkg/model"
+)
+
+// DefaultBuffer 是每个订阅者的缓冲条数。
+const DefaultBuffer = 256
+
+// Hub 在写入路径上按订阅者的过滤条件分发记录。
+// 写入方不会被慢订阅者阻塞：缓冲满时丢弃该订阅者的记录并计数。nil Hub 上的方法均为空操作。
+type Hub struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription 是一个订阅，C 在取消订阅或 Hub 关闭后被关闭。
+type Subscription struct {
+	C <-chan model.TrafficLog
+
+	ch      chan model.TrafficLog
+	filter  storage.Filter
+	dropped atomic.Uint64
+}
+
+// Dropped 返回因缓冲已满而丢弃的记录数。
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Subscribe 注册一个订阅，filter 的 Sort/Limit/After 被忽略；buffer<=0 时使用 DefaultBuffer。
+// Hub 已关闭时返回 nil。
+func (h *Hub) Subscribe(filter storage.Filter, buffer int) *Subscription {
+	if h == nil {
+		return nil
+	}
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	ch := make(chan model.TrafficLog, buffer)
+	s := &Subscription{C: ch, ch: ch, filter: filter}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	h.subs[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe 取消订阅并关闭 C，可重复调用。
+func (h *Hub) Unsubscribe(s *Subscription) {
+	if h == nil || s == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.ch)
+	}
+}
+
+// Publish 把记录分发给条件匹配的订阅者。
+func (h *Hub) Publish(logs ...model.TrafficLog) {
+	if h == nil {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.subs {
+		for i := range logs {
+			if !s.filter.Match(&logs[i]) {
+				continue
+			}
+			select {
+			case s.ch <- logs[i]:
+			default:
+				s.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// Subscribers 返回当前订阅数。
+func (h *Hub) Subscribers() int {
+	if h == nil {
+		return 0
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs)
+}
+
+// Close 关闭所有订阅，之后的 Subscribe 返回 nil。server 退出前调用，
+// 否则长连接会让 http.Server.Shutdown 一直等到超时。
+func (h *Hub) Close() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for s := range h.subs {
+		delete(h.subs, s)
+		close(s.ch)
+	}
+}
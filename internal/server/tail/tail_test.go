@@ -0,0 +1,48 @@
+package tail
+
+import (
+	"testing"
+
+	"lightobs/internal/server/storage"
+	"lightobs/pkg/model"
+)
+
+func TestHub(t *testing.T) {
+	h := NewHub()
+	all := h.Subscribe(storage.Filter{}, 1)
+	errs := h.Subscribe(storage.Filter{Status: []storage.StatusRange{{Min: 500, Max: 599}}}, 4)
+
+	h.Publish(
+		model.TrafficLog{HTTPPath: "/a", StatusCode: 200},
+		model.TrafficLog{HTTPPath: "/b", StatusCode: 503},
+	)
+	// all 的缓冲只有 1 条，第二条被丢弃而不是阻塞写入方。
+	if l := <-all.C; l.HTTPPath != "/a" || all.Dropped() != 1 {
+		t.Errorf("all: got %+v dropped=%d", l, all.Dropped())
+	}
+	if l := <-errs.C; l.HTTPPath != "/b" || errs.Dropped() != 0 {
+		t.Errorf("errs: got %+v dropped=%d", l, errs.Dropped())
+	}
+
+	h.Unsubscribe(all)
+	h.Unsubscribe(all)
+	if _, ok := <-all.C; ok || h.Subscribers() != 1 {
+		t.Errorf("unsubscribe: ok=%v subscribers=%d", ok, h.Subscribers())
+	}
+
+	h.Close()
+	if _, ok := <-errs.C; ok {
+		t.Error("Close 后订阅应被关闭")
+	}
+	if s := h.Subscribe(storage.Filter{}, 0); s != nil {
+		t.Error("Close 后 Subscribe 应返回 nil")
+	}
+	h.Publish(model.TrafficLog{})
+}
+
+func TestNilHub(t *testing.T) {
+	var h *Hub
+	h.Publish(model.TrafficLog{})
+	h.Unsubscribe(h.Subscribe(storage.Filter{}, 0))
+	h.Close()
+}
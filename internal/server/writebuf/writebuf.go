@@ -0,0 +1,182 @@
+// Package writebuf 把并发上报的记录合并成批写入存储（group commit）：
+// 每个请求仍等到自己的记录随某一批提交后才返回，但多个请求共用一次事务与 fsync。
+package writebuf
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"lightobs/pkg/model"
+)
+
+// DefaultMaxBatch 是 Options.MaxBatch 未设置时单批最多合并的条数。
+const DefaultMaxBatch = 1000
+
+// DefaultWriteTimeout 是 Options.WriteTimeout 未设置时单批写入的超时。
+const DefaultWriteTimeout = 30 * time.Second
+
+// queueSize 是等待写入的请求队列长度，队列满时上报请求阻塞等待。
+const queueSize = 1024
+
+// ErrClosed 表示缓冲已关闭（server 正在退出）。
+var ErrClosed = errors.New("写入缓冲已关闭")
+
+// BatchInserter 是 Buffer 依赖的写入接口，由 storage.Store 实现。
+type BatchInserter interface {
+	InsertBatch(ctx context.Context, logs []model.TrafficLog) error
+}
+
+type Options struct {
+	// MaxBatch 是单批最多合并的条数；单个请求超过该值时独立成批，不会被拆开。
+	MaxBatch int
+	// MaxDelay 是一批中第一条记录额外等待多久以凑更大的批。为 0 时不额外等待：
+	// 空闲时立即写入，写入进行中到达的请求自然合并为下一批，批大小随并发自动增长。
+	MaxDelay time.Duration
+	// WriteTimeout 是单批写入的超时，超时后该批的请求都返回错误。
+	// 交出记录之后请求不再受自己的 ctx 控制，由它保证等待有上限。
+	WriteTimeout time.Duration
+}
+
+type request struct {
+	logs []model.TrafficLog
+	done chan error
+}
+
+// Buffer 由单个后台协程按批写入；零值不可用，使用 New 创建。
+type Buffer struct {
+	store BatchInserter
+	opts  Options
+
+	mu     sync.RWMutex
+	closed bool
+	reqs   chan *request
+	exited chan struct{}
+}
+
+func New(store BatchInserter, opts Options) *Buffer {
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = DefaultMaxBatch
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = DefaultWriteTimeout
+	}
+	b := &Buffer{
+		store:  store,
+		opts:   opts,
+		reqs:   make(chan *request, queueSize),
+		exited: make(chan struct{}),
+	}
+	go b.loop()
+	return b
+}
+
+// InsertBatch 把 logs 的副本交给后台协程，等它所在的批写入后返回该批的结果。
+// ctx 只在交出之前生效：排队时取消返回 ctx.Err()，记录不会写入；交出之后一定等到写入结果
+// （最多 Options.WriteTimeout），返回 nil 即表示已提交，不会出现返回错误而记录仍被写入的情况。
+func (b *Buffer) InsertBatch(ctx context.Context, logs []model.TrafficLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	req := &request{logs: slices.Clone(logs), done: make(chan error, 1)}
+
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrClosed
+	}
+	select {
+	case b.reqs <- req:
+		b.mu.RUnlock()
+	case <-ctx.Done():
+		b.mu.RUnlock()
+		return ctx.Err()
+	}
+
+	// 后台协程写入时不使用请求的 ctx，每批写入受 WriteTimeout 限制。
+	return <-req.done
+}
+
+// Close 不再接收新记录，写完已接收的记录后返回。
+func (b *Buffer) Close() error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.reqs)
+	}
+	b.mu.Unlock()
+	<-b.exited
+	return nil
+}
+
+func (b *Buffer) loop() {
+	defer close(b.exited)
+	var (
+		batch   []model.TrafficLog
+		waiters []*request
+	)
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	for {
+		req, ok := <-b.reqs
+		if !ok {
+			return
+		}
+		batch = append(batch[:0], req.logs...)
+		waiters = append(waiters[:0], req)
+
+		var wait <-chan time.Time
+		if b.opts.MaxDelay > 0 {
+			timer.Reset(b.opts.MaxDelay)
+			wait = timer.C
+		}
+		open := true
+	collect:
+		for len(batch) < b.opts.MaxBatch {
+			var (
+				req *request
+				ok  bool
+			)
+			if wait == nil {
+				select {
+				case req, ok = <-b.reqs:
+				default:
+					break collect
+				}
+			} else {
+				select {
+				case req, ok = <-b.reqs:
+				case <-wait:
+					wait = nil
+					break collect
+				}
+			}
+			if !ok {
+				open = false
+				break
+			}
+			batch = append(batch, req.logs...)
+			waiters = append(waiters, req)
+		}
+		if wait != nil && !timer.Stop() {
+			<-timer.C
+		}
+
+		// 一批合并了多个请求，不能使用其中任何一个请求的 ctx。
+		ctx, cancel := context.WithTimeout(context.Background(), b.opts.WriteTimeout)
+		err := b.store.InsertBatch(ctx, batch)
+		cancel()
+		for _, w := range waiters {
+			w.done <- err
+		}
+		clear(waiters)
+		if !open {
+			return
+		}
+	}
+}
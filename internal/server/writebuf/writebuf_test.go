@@ -0,0 +1,226 @@
+package writebuf
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"lightobs/internal/server/storage/sqlite"
+	"lightobs/pkg/model"
+)
+
+type fakeInserter struct {
+	mu      sync.Mutex
+	batches []int
+	rows    int
+	paths   []string
+	// entered 非 nil 时，每批开始写入时发送一次。
+	entered chan struct{}
+	gate    chan struct{}
+	err     error
+}
+
+func (f *fakeInserter) InsertBatch(ctx context.Context, logs []model.TrafficLog) error {
+	if f.entered != nil {
+		f.entered <- struct{}{}
+	}
+	if f.gate != nil {
+		select {
+		case <-f.gate:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batches = append(f.batches, len(logs))
+	f.rows += len(logs)
+	for i := range logs {
+		f.paths = append(f.paths, logs[i].HTTPPath)
+	}
+	return f.err
+}
+
+func TestBufferGroupsConcurrentWrites(t *testing.T) {
+	store := &fakeInserter{gate: make(chan struct{})}
+	b := New(store, Options{MaxBatch: 100, MaxDelay: 50 * time.Millisecond})
+
+	// 第一批阻塞在写入中，期间到达的请求合并为下一批；凑满 MaxBatch 后不再等待。
+	var wg sync.WaitGroup
+	write := func(n int) {
+		defer wg.Done()
+		if err := b.InsertBatch(context.Background(), make([]model.TrafficLog, n)); err != nil {
+			t.Error(err)
+		}
+	}
+	wg.Add(1)
+	go write(100)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go write(10)
+	}
+	close(store.gate)
+	wg.Wait()
+	b.Close()
+
+	if store.rows != 200 {
+		t.Fatalf("rows=%d", store.rows)
+	}
+	if len(store.batches) > 3 {
+		t.Errorf("batches=%v, want concurrent writes grouped", store.batches)
+	}
+}
+
+func TestBufferDelayAndErrors(t *testing.T) {
+	store := &fakeInserter{err: errors.New("disk full")}
+	b := New(store, Options{MaxBatch: 1000, MaxDelay: 10 * time.Millisecond})
+	defer b.Close()
+
+	start := time.Now()
+	err := b.InsertBatch(context.Background(), make([]model.TrafficLog, 3))
+	if err == nil || err.Error() != "disk full" {
+		t.Fatalf("err=%v", err)
+	}
+	if d := time.Since(start); d < 10*time.Millisecond {
+		t.Errorf("returned after %s, before MaxDelay", d)
+	}
+	if err := b.InsertBatch(context.Background(), nil); err != nil {
+		t.Errorf("empty: %v", err)
+	}
+}
+
+func TestBufferClose(t *testing.T) {
+	store := &fakeInserter{gate: make(chan struct{})}
+	b := New(store, Options{MaxBatch: 10, MaxDelay: time.Hour})
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() { errs <- b.InsertBatch(context.Background(), make([]model.TrafficLog, 4)) }()
+	}
+	// 等三个请求都交给后台协程后再关闭：已接收的记录照常写完。
+	deadline := time.Now().Add(time.Second)
+	for len(b.reqs) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	closed := make(chan struct{})
+	go func() {
+		b.Close()
+		close(closed)
+	}()
+	close(store.gate)
+	<-closed
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil && !errors.Is(err, ErrClosed) {
+			t.Errorf("err=%v", err)
+		}
+	}
+	if err := b.InsertBatch(context.Background(), make([]model.TrafficLog, 1)); !errors.Is(err, ErrClosed) {
+		t.Errorf("after close: err=%v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b2 := New(&fakeInserter{}, Options{})
+	defer b2.Close()
+	if err := b2.InsertBatch(ctx, make([]model.TrafficLog, 1)); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled: err=%v", err)
+	}
+}
+
+func TestBufferCancelAfterHandOff(t *testing.T) {
+	store := &fakeInserter{entered: make(chan struct{}, 1), gate: make(chan struct{})}
+	b := New(store, Options{})
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	logs := []model.TrafficLog{{HTTPPath: "/a"}, {HTTPPath: "/b"}}
+	errs := make(chan error, 1)
+	go func() { errs <- b.InsertBatch(ctx, logs) }()
+
+	// 批已开始写入时取消请求：InsertBatch 仍等到写入结果，不会报告失败而记录照常提交。
+	<-store.entered
+	cancel()
+	select {
+	case err := <-errs:
+		close(store.gate)
+		t.Fatalf("returned before the batch committed: err=%v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	// 交出的是副本，调用方改写自己的切片不影响写入的内容。
+	logs[0].HTTPPath = "/changed"
+	close(store.gate)
+	if err := <-errs; err != nil {
+		t.Fatalf("err=%v, want nil once committed", err)
+	}
+	if store.rows != 2 || store.paths[0] != "/a" {
+		t.Errorf("rows=%d paths=%v", store.rows, store.paths)
+	}
+}
+
+func TestBufferWriteTimeout(t *testing.T) {
+	store := &fakeInserter{gate: make(chan struct{})}
+	b := New(store, Options{WriteTimeout: 20 * time.Millisecond})
+	defer b.Close()
+
+	// 存储卡住时请求在超时后返回，不会无限等待。
+	start := time.Now()
+	if err := b.InsertBatch(context.Background(), make([]model.TrafficLog, 1)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err=%v, want deadline exceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("waited %s", d)
+	}
+	close(store.gate)
+	if err := b.InsertBatch(context.Background(), make([]model.TrafficLog, 1)); err != nil {
+		t.Fatalf("after recovery: %v", err)
+	}
+}
+
+func benchLog(i int) model.TrafficLog {
+	return model.TrafficLog{
+		Timestamp: time.Now(), SrcIP: "10.0.0.1", SrcPort: 40000 + i%1000, DstIP: "10.0.0.9", DstPort: 80,
+		HTTPMethod: "GET", HTTPPath: "/api/users/1", HTTPRoute: "/api/users/{id}", StatusCode: 200, LatencyMS: 5,
+	}
+}
+
+// BenchmarkUploadDirect 与 BenchmarkUploadBuffered 模拟并发的单条上报写入 SQLite。
+func BenchmarkUploadDirect(b *testing.B) {
+	s, err := sqlite.NewStore(filepath.Join(b.TempDir(), "traffic.sqlite"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer s.Close()
+	b.SetParallelism(8)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			if err := s.InsertBatch(context.Background(), []model.TrafficLog{benchLog(i)}); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkUploadBuffered(b *testing.B) {
+	s, err := sqlite.NewStore(filepath.Join(b.TempDir(), "traffic.sqlite"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer s.Close()
+	buf := New(s, Options{})
+	defer buf.Close()
+	b.SetParallelism(8)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			if err := buf.InsertBatch(context.Background(), []model.TrafficLog{benchLog(i)}); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
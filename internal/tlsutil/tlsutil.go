@@ -0,0 +1,114 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// ServerOptions 对应 server 的 -tls-* 参数。CertFile/KeyFile 为空表示不启用 TLS。
+type ServerOptions struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile 非空时校验客户端证书；RequireClientCert 决定没有证书的客户端是否被拒绝。
+	ClientCAFile      string
+	RequireClientCert bool
+}
+
+func (o ServerOptions) Enabled() bool {
+	return o.CertFile != "" || o.KeyFile != ""
+}
+
+// ServerConfig 构造 server 端 TLS 配置；未启用时返回 nil。
+func ServerConfig(o ServerOptions) (*tls.Config, error) {
+	if !o.Enabled() {
+		if o.ClientCAFile != "" || o.RequireClientCert {
+			return nil, fmt.Errorf("启用客户端证书校验需要同时指定 -tls-cert 与 -tls-key")
+		}
+		return nil, nil
+	}
+	if o.CertFile == "" || o.KeyFile == "" {
+		return nil, fmt.Errorf("-tls-cert 与 -tls-key 必须同时指定")
+	}
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("加载 server 证书失败：%w", err)
+	}
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if o.ClientCAFile != "" {
+		pool, err := loadPool(o.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if o.RequireClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if o.RequireClientCert {
+		return nil, fmt.Errorf("要求客户端证书时必须指定 -tls-client-ca")
+	}
+	return cfg, nil
+}
+
+// ClientOptions 对应 agent / client 的 -tls-* 参数。
+type ClientOptions struct {
+	// Enable 显式开启 TLS（使用系统根证书）；指定了 CAFile 或 CertFile 时自动开启。
+	Enable     bool
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+	// InsecureSkipVerify 仅用于调试，跳过 server 证书校验。
+	InsecureSkipVerify bool
+}
+
+func (o ClientOptions) Enabled() bool {
+	return o.Enable || o.CAFile != "" || o.CertFile != "" || o.InsecureSkipVerify
+}
+
+// ClientConfig 构造客户端 TLS 配置；未启用时返回 nil。
+func ClientConfig(o ClientOptions) (*tls.Config, error) {
+	if !o.Enabled() {
+		return nil, nil
+	}
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if o.CAFile != "" {
+		pool, err := loadPool(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, fmt.Errorf("-tls-cert 与 -tls-key 必须同时指定")
+		}
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败：%w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 CA 文件失败：%w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA 文件中没有有效证书：%s", path)
+	}
+	return pool, nil
+}
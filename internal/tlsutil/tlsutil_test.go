@@ -0,0 +1,203 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue 签发叶子证书并写入 dir，返回证书与私钥文件路径。
+func (ca *testCA) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type pki struct {
+	caFile                string
+	serverCert, serverKey string
+	clientCert, clientKey string
+	rogueCert, rogueKey   string
+}
+
+func newPKI(t *testing.T) pki {
+	dir := t.TempDir()
+	ca := newCA(t, "lightobs-test-ca")
+	rogue := newCA(t, "rogue-ca")
+	p := pki{caFile: filepath.Join(dir, "ca.crt")}
+	writeFile(t, p.caFile, ca.pem)
+	p.serverCert, p.serverKey = ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	p.clientCert, p.clientKey = ca.issue(t, dir, "agent", x509.ExtKeyUsageClientAuth)
+	p.rogueCert, p.rogueKey = rogue.issue(t, dir, "rogue", x509.ExtKeyUsageClientAuth)
+	return p
+}
+
+func startServer(t *testing.T, o ServerOptions) string {
+	t.Helper()
+	cfg, err := ServerConfig(o)
+	if err != nil {
+		t.Fatalf("ServerConfig failed: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.TLS = cfg
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func get(t *testing.T, url string, o ClientOptions) error {
+	t.Helper()
+	cfg, err := ClientConfig(o)
+	if err != nil {
+		t.Fatalf("ClientConfig failed: %v", err)
+	}
+	client := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{TLSClientConfig: cfg}}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func TestMutualTLS(t *testing.T) {
+	p := newPKI(t)
+	url := startServer(t, ServerOptions{
+		CertFile:          p.serverCert,
+		KeyFile:           p.serverKey,
+		ClientCAFile:      p.caFile,
+		RequireClientCert: true,
+	})
+
+	if err := get(t, url, ClientOptions{CAFile: p.caFile, CertFile: p.clientCert, KeyFile: p.clientKey}); err != nil {
+		t.Errorf("trusted client cert rejected: %v", err)
+	}
+	if err := get(t, url, ClientOptions{CAFile: p.caFile}); err == nil {
+		t.Errorf("missing client cert should be rejected")
+	}
+	if err := get(t, url, ClientOptions{CAFile: p.caFile, CertFile: p.rogueCert, KeyFile: p.rogueKey}); err == nil {
+		t.Errorf("client cert from untrusted CA should be rejected")
+	}
+}
+
+func TestOptionalClientCert(t *testing.T) {
+	p := newPKI(t)
+	url := startServer(t, ServerOptions{CertFile: p.serverCert, KeyFile: p.serverKey, ClientCAFile: p.caFile})
+
+	if err := get(t, url, ClientOptions{CAFile: p.caFile}); err != nil {
+		t.Errorf("client without cert should be allowed: %v", err)
+	}
+	if err := get(t, url, ClientOptions{CAFile: p.caFile, CertFile: p.clientCert, KeyFile: p.clientKey}); err != nil {
+		t.Errorf("trusted client cert rejected: %v", err)
+	}
+}
+
+func TestServerCertVerification(t *testing.T) {
+	p := newPKI(t)
+	url := startServer(t, ServerOptions{CertFile: p.serverCert, KeyFile: p.serverKey})
+
+	if err := get(t, url, ClientOptions{Enable: true}); err == nil {
+		t.Errorf("server cert from private CA should fail with system roots")
+	}
+	if err := get(t, url, ClientOptions{InsecureSkipVerify: true}); err != nil {
+		t.Errorf("insecure client failed: %v", err)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	if cfg, err := ServerConfig(ServerOptions{}); cfg != nil || err != nil {
+		t.Errorf("disabled server config=%v err=%v", cfg, err)
+	}
+	if _, err := ServerConfig(ServerOptions{CertFile: "a.crt"}); err == nil {
+		t.Errorf("cert without key should fail")
+	}
+	if _, err := ServerConfig(ServerOptions{RequireClientCert: true}); err == nil {
+		t.Errorf("client auth without server cert should fail")
+	}
+	if cfg, err := ClientConfig(ClientOptions{}); cfg != nil || err != nil {
+		t.Errorf("disabled client config=%v err=%v", cfg, err)
+	}
+	if _, err := ClientConfig(ClientOptions{CertFile: "a.crt"}); err == nil {
+		t.Errorf("client cert without key should fail")
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.pem")
+	writeFile(t, bad, []byte("not a cert"))
+	if _, err := ClientConfig(ClientOptions{CAFile: bad}); err == nil {
+		t.Errorf("invalid CA file should fail")
+	}
+}
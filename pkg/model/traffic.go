@@ -11,6 +11,8 @@ type TrafficLog struct {
 	PID        int       `json:"pid"`
 	HTTPMethod string    `json:"http_method"`
 	HTTPPath   string    `json:"http_path"`
+	HTTPQuery  string    `json:"http_query,omitempty"`
+	HTTPRoute  string    `json:"http_route,omitempty"`
 	StatusCode int       `json:"status_code"`
 	LatencyMS  int64     `json:"latency_ms"`
 	PacketSize int       `json:"packet_size"`
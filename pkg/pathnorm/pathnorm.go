@@ -0,0 +1,222 @@
+// Package pathnorm 把原始 URL 路径归一化为路由模板，降低按接口聚合时的基数。
+package pathnorm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"lightobs/pkg/model"
+)
+
+// 启发式规则替换的占位符。
+const (
+	PlaceholderID   = "{id}"
+	PlaceholderUUID = "{uuid}"
+	PlaceholderHex  = "{hex}"
+)
+
+// minHexLen 是按十六进制串处理的最短长度，避免把 "cafe"、"add" 这类普通单词替换掉。
+const minHexLen = 8
+
+// Normalizer 先按用户配置的路由模式匹配，未命中时再用启发式规则替换路径段。
+// 零值可直接使用（只有启发式规则）。
+type Normalizer struct {
+	patterns []pattern
+}
+
+// pattern 是一条用户路由，如 /users/{id}/orders/*。
+// {name} 与 * 匹配单个路径段，末尾的 ** 匹配剩余任意层级。
+type pattern struct {
+	raw      string
+	segments []string
+	rest     bool
+}
+
+// New 编译路由模式，按给定顺序匹配，先命中者优先。
+func New(patterns []string) (*Normalizer, error) {
+	n := &Normalizer{}
+	for _, raw := range patterns {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if !strings.HasPrefix(raw, "/") {
+			return nil, fmt.Errorf("路由模式必须以 / 开头：%s", raw)
+		}
+		p := pattern{raw: raw, segments: splitPath(raw)}
+		for i, seg := range p.segments {
+			if seg == "**" {
+				if i != len(p.segments)-1 {
+					return nil, fmt.Errorf("** 只能出现在路由模式末尾：%s", raw)
+				}
+				p.segments, p.rest = p.segments[:i], true
+			}
+		}
+		n.patterns = append(n.patterns, p)
+	}
+	return n, nil
+}
+
+// Load 从文件读取路由模式，每行一条，# 开头为注释。
+func Load(path string) (*Normalizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取路由模式失败：%w", err)
+	}
+	defer f.Close()
+	patterns, err := readLines(f)
+	if err != nil {
+		return nil, fmt.Errorf("读取路由模式失败：%w", err)
+	}
+	return New(patterns)
+}
+
+func readLines(r io.Reader) ([]string, error) {
+	var out []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out, sc.Err()
+}
+
+// Split 把原始请求目标拆分为路径与查询串，并丢弃 #fragment。
+func Split(raw string) (path, query string) {
+	if i := strings.IndexByte(raw, '#'); i >= 0 {
+		raw = raw[:i]
+	}
+	path, query, _ = strings.Cut(raw, "?")
+	return path, query
+}
+
+// Apply 就地归一化一条记录：HTTPPath 中的查询串移入 HTTPQuery，并填充 HTTPRoute。
+// 已带查询串或路由的记录（如新版本 agent 已处理过）不会被覆盖。
+func (n *Normalizer) Apply(l *model.TrafficLog) {
+	path, query := Split(l.HTTPPath)
+	l.HTTPPath = path
+	if l.HTTPQuery == "" {
+		l.HTTPQuery = query
+	}
+	if l.HTTPRoute == "" {
+		l.HTTPRoute = n.Route(path)
+	}
+}
+
+// Route 返回路径（不含查询串）对应的路由模板。
+func (n *Normalizer) Route(path string) string {
+	if path == "" {
+		return ""
+	}
+	segs := splitPath(path)
+	if n != nil {
+		for _, p := range n.patterns {
+			if p.match(segs) {
+				return p.raw
+			}
+		}
+	}
+	for i, seg := range segs {
+		segs[i] = placeholder(seg)
+	}
+	out := "/" + strings.Join(segs, "/")
+	if len(segs) > 0 && strings.HasSuffix(path, "/") {
+		out += "/"
+	}
+	return out
+}
+
+func (p pattern) match(segs []string) bool {
+	if len(segs) < len(p.segments) || (!p.rest && len(segs) != len(p.segments)) {
+		return false
+	}
+	for i, want := range p.segments {
+		if want == "*" || (strings.HasPrefix(want, "{") && strings.HasSuffix(want, "}")) {
+			continue
+		}
+		if want != segs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func placeholder(seg string) string {
+	switch {
+	case isNumeric(seg):
+		return PlaceholderID
+	case isUUID(seg):
+		return PlaceholderUUID
+	case isHex(seg):
+		return PlaceholderHex
+	default:
+		return seg
+	}
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isUUID 匹配 8-4-4-4-12 格式，不区分大小写。
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHexDigit(s[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isHex 匹配足够长且至少含一个数字的十六进制串（对象 ID、哈希等）。
+func isHex(s string) bool {
+	if len(s) < minHexLen {
+		return false
+	}
+	digit := false
+	for i := 0; i < len(s); i++ {
+		if !isHexDigit(s[i]) {
+			return false
+		}
+		if s[i] >= '0' && s[i] <= '9' {
+			digit = true
+		}
+	}
+	return digit
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,90 @@
+package pathnorm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lightobs/pkg/model"
+)
+
+func TestRouteHeuristics(t *testing.T) {
+	var n *Normalizer // 零值只用启发式规则
+	cases := map[string]string{
+		"":                    "",
+		"/":                   "/",
+		"/healthz":            "/healthz",
+		"/users/12345/orders": "/users/{id}/orders",
+		"/users/12345/":       "/users/{id}/",
+		"/v1/items/3f2504e0-4f89-11d3-9a0c-0305e82c3301":  "/v1/items/{uuid}",
+		"/blobs/9f86d081884c7d659a2feaa0c55ad015a3bf4f1b": "/blobs/{hex}",
+		"/static/cafebabe":     "/static/cafebabe", // 不含数字的十六进制串视为普通单词
+		"/static/abc123":       "/static/abc123",   // 太短
+		"/api/v2/users/me":     "/api/v2/users/me",
+		"/orders/42/items/007": "/orders/{id}/items/{id}",
+	}
+	for in, want := range cases {
+		if got := n.Route(in); got != want {
+			t.Errorf("Route(%q)=%q want %q", in, got, want)
+		}
+	}
+}
+
+func TestRoutePatterns(t *testing.T) {
+	n, err := New([]string{
+		"/users/{uid}/orders/*",
+		"/static/**",
+		"/users/{uid}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"/users/alice/orders/abc-uuid": "/users/{uid}/orders/*",
+		"/users/alice":                 "/users/{uid}",
+		"/static/js/app.9f86d081.js":   "/static/**",
+		"/static":                      "/static/**",
+		"/users/alice/profile":         "/users/alice/profile", // 未命中，回退启发式
+		"/users/42/profile":            "/users/{id}/profile",
+	}
+	for in, want := range cases {
+		if got := n.Route(in); got != want {
+			t.Errorf("Route(%q)=%q want %q", in, got, want)
+		}
+	}
+
+	for _, bad := range []string{"users/{id}", "/a/**/b"} {
+		if _, err := New([]string{bad}); err == nil {
+			t.Errorf("New(%q) expected error", bad)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	l := &model.TrafficLog{HTTPPath: "/users/12345/orders?x=1&y=2#frag"}
+	(&Normalizer{}).Apply(l)
+	if l.HTTPPath != "/users/12345/orders" || l.HTTPQuery != "x=1&y=2" || l.HTTPRoute != "/users/{id}/orders" {
+		t.Errorf("got %+v", l)
+	}
+
+	// 已填充的字段保持不变。
+	l = &model.TrafficLog{HTTPPath: "/a/1", HTTPQuery: "q", HTTPRoute: "/a/{n}"}
+	(&Normalizer{}).Apply(l)
+	if l.HTTPQuery != "q" || l.HTTPRoute != "/a/{n}" {
+		t.Errorf("got %+v", l)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.txt")
+	if err := os.WriteFile(path, []byte("# 注释\n\n/users/{id}/orders/*\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	n, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := n.Route("/users/u1/orders/o1"); got != "/users/{id}/orders/*" {
+		t.Errorf("Route=%q", got)
+	}
+}
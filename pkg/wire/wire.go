@@ -0,0 +1,294 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"lightobs/pkg/model"
+)
+
+// 传输编码通过 Content-Type 协商，压缩通过 Content-Encoding 协商，两者相互独立。
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-lightobs-traffic+protobuf"
+
+	EncodingIdentity = ""
+	EncodingGzip     = "gzip"
+	EncodingZstd     = "zstd"
+)
+
+var ErrTooManyRecords = errors.New("记录条数超过上限")
+
+// maxMessageSize 是单条 TrafficLog 消息的长度上限，防止异常长度前缀导致大块内存分配。
+const maxMessageSize = 1 << 20
+
+const (
+	fieldTimestamp  protowire.Number = 1
+	fieldSrcIP      protowire.Number = 2
+	fieldSrcPort    protowire.Number = 3
+	fieldDstIP      protowire.Number = 4
+	fieldDstPort    protowire.Number = 5
+	fieldPID        protowire.Number = 6
+	fieldHTTPMethod protowire.Number = 7
+	fieldHTTPPath   protowire.Number = 8
+	fieldStatusCode protowire.Number = 9
+	fieldLatencyMS  protowire.Number = 10
+	fieldPacketSize protowire.Number = 11
+	fieldHTTPQuery  protowire.Number = 12
+	fieldHTTPRoute  protowire.Number = 13
+)
+
+// IsProtobuf 判断 Content-Type 是否为二进制格式（忽略参数部分）。
+func IsProtobuf(contentType string) bool {
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.EqualFold(strings.TrimSpace(mt), ContentTypeProtobuf)
+}
+
+// AppendTrafficLog 把一条记录编码为 protobuf 消息（不含长度前缀）。零值字段不编码。
+func AppendTrafficLog(b []byte, l *model.TrafficLog) []byte {
+	if !l.Timestamp.IsZero() {
+		b = protowire.AppendTag(b, fieldTimestamp, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(l.Timestamp.UnixNano()))
+	}
+	b = appendIP(b, fieldSrcIP, l.SrcIP)
+	b = appendVarint(b, fieldSrcPort, uint64(l.SrcPort))
+	b = appendIP(b, fieldDstIP, l.DstIP)
+	b = appendVarint(b, fieldDstPort, uint64(l.DstPort))
+	b = appendVarint(b, fieldPID, uint64(l.PID))
+	b = appendString(b, fieldHTTPMethod, l.HTTPMethod)
+	b = appendString(b, fieldHTTPPath, l.HTTPPath)
+	b = appendVarint(b, fieldStatusCode, uint64(l.StatusCode))
+	b = appendVarint(b, fieldLatencyMS, uint64(l.LatencyMS))
+	b = appendVarint(b, fieldPacketSize, uint64(l.PacketSize))
+	b = appendString(b, fieldHTTPQuery, l.HTTPQuery)
+	b = appendString(b, fieldHTTPRoute, l.HTTPRoute)
+	return b
+}
+
+// AppendDelimited 追加一条带 varint 长度前缀的消息。
+func AppendDelimited(b []byte, l *model.TrafficLog) []byte {
+	msg := AppendTrafficLog(nil, l)
+	b = protowire.AppendVarint(b, uint64(len(msg)))
+	return append(b, msg...)
+}
+
+func Marshal(logs []*model.TrafficLog) []byte {
+	b := make([]byte, 0, len(logs)*96)
+	var msg []byte
+	for _, l := range logs {
+		msg = AppendTrafficLog(msg[:0], l)
+		b = protowire.AppendVarint(b, uint64(len(msg)))
+		b = append(b, msg...)
+	}
+	return b
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendIP 把合法 IP 编成 4/16 字节；非法值按原字符串字节编码，
+// 解码后会得到一个同样非法的字符串，交由 server 端校验拒绝。
+func appendIP(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	raw := []byte(s)
+	if ip := net.ParseIP(s); ip != nil {
+		if v4 := ip.To4(); v4 != nil {
+			raw = v4
+		} else {
+			raw = ip
+		}
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, raw)
+}
+
+// UnmarshalTrafficLog 解码一条 protobuf 消息，未知字段会被跳过以便前向兼容。
+func UnmarshalTrafficLog(b []byte) (model.TrafficLog, error) {
+	var l model.TrafficLog
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return l, fmt.Errorf("解析字段标签失败：%w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return l, fmt.Errorf("解析字段 %d 失败：%w", num, protowire.ParseError(n))
+			}
+			b = b[n:]
+			switch num {
+			case fieldTimestamp:
+				l.Timestamp = time.Unix(0, int64(v)).UTC()
+			case fieldSrcPort:
+				l.SrcPort = int(v)
+			case fieldDstPort:
+				l.DstPort = int(v)
+			case fieldPID:
+				l.PID = int(int64(v))
+			case fieldStatusCode:
+				l.StatusCode = int(int64(v))
+			case fieldLatencyMS:
+				l.LatencyMS = int64(v)
+			case fieldPacketSize:
+				l.PacketSize = int(int64(v))
+			}
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return l, fmt.Errorf("解析字段 %d 失败：%w", num, protowire.ParseError(n))
+			}
+			b = b[n:]
+			switch num {
+			case fieldSrcIP:
+				l.SrcIP = decodeIP(v)
+			case fieldDstIP:
+				l.DstIP = decodeIP(v)
+			case fieldHTTPMethod:
+				l.HTTPMethod = string(v)
+			case fieldHTTPPath:
+				l.HTTPPath = string(v)
+			case fieldHTTPQuery:
+				l.HTTPQuery = string(v)
+			case fieldHTTPRoute:
+				l.HTTPRoute = string(v)
+			}
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return l, fmt.Errorf("跳过字段 %d 失败：%w", num, protowire.ParseError(n))
+			}
+			b = b[n:]
+		}
+	}
+	return l, nil
+}
+
+func decodeIP(v []byte) string {
+	if len(v) == net.IPv4len || len(v) == net.IPv6len {
+		return net.IP(v).String()
+	}
+	return string(v)
+}
+
+// Decode 读取 length-delimited 消息流，最多 maxRecords 条（<=0 表示不限制）。
+func Decode(r io.Reader, maxRecords int) ([]model.TrafficLog, error) {
+	br := bufio.NewReader(r)
+	out := make([]model.TrafficLog, 0, 64)
+	var buf []byte
+	for {
+		// ReadUvarint 在消息边界处返回 io.EOF，读到一半则返回 io.ErrUnexpectedEOF。
+		size, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取消息长度失败：%w", err)
+		}
+		if size > maxMessageSize {
+			return nil, fmt.Errorf("消息长度 %d 超过上限", size)
+		}
+		if maxRecords > 0 && len(out) >= maxRecords {
+			return nil, ErrTooManyRecords
+		}
+		if uint64(cap(buf)) < size {
+			buf = make([]byte, size)
+		}
+		buf = buf[:size]
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, fmt.Errorf("读取消息体失败：%w", err)
+		}
+		l, err := UnmarshalTrafficLog(buf)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+}
+
+// Compress 按 Content-Encoding 压缩请求体，EncodingIdentity 原样返回。
+func Compress(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case EncodingIdentity:
+		return data, nil
+	case EncodingGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, fmt.Errorf("gzip 压缩失败：%w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("gzip 压缩失败：%w", err)
+		}
+		return buf.Bytes(), nil
+	case EncodingZstd:
+		return zstdEncoder.EncodeAll(data, make([]byte, 0, len(data)/2)), nil
+	default:
+		return nil, fmt.Errorf("不支持的压缩方式：%s", encoding)
+	}
+}
+
+// zstdEncoder 的 EncodeAll 可并发调用，全局复用一个即可。
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+
+// NewReader 按 Content-Encoding 包装解压 reader，调用方负责 Close。
+func NewReader(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return io.NopCloser(r), nil
+	case EncodingGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("gzip 解压失败：%w", err)
+		}
+		return zr, nil
+	case EncodingZstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("zstd 解压失败：%w", err)
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("不支持的压缩方式：%s", encoding)
+	}
+}
+
+// ParseCompression 校验命令行传入的压缩方式，"none" 视为不压缩。
+func ParseCompression(s string) (string, error) {
+	switch s {
+	case "", "none":
+		return EncodingIdentity, nil
+	case EncodingGzip, EncodingZstd:
+		return s, nil
+	default:
+		return "", fmt.Errorf("不支持的压缩方式：%s（可选 none / gzip / zstd）", s)
+	}
+}
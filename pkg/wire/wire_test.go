@@ -0,0 +1,191 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"lightobs/pkg/model"
+)
+
+func sampleLogs(n int) []*model.TrafficLog {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+	out := make([]*model.TrafficLog, 0, n)
+	for i := 0; i < n; i++ {
+		out = append(out, &model.TrafficLog{
+			Timestamp:  base.Add(time.Duration(i) * time.Millisecond),
+			SrcIP:      fmt.Sprintf("10.244.%d.%d", i%4, i%250+1),
+			SrcPort:    30000 + i%20000,
+			DstIP:      "10.96.0.10",
+			DstPort:    80,
+			PID:        1000 + i%32,
+			HTTPMethod: "GET",
+			HTTPPath:   fmt.Sprintf("/api/v1/users/%d/orders", i),
+			StatusCode: 200,
+			LatencyMS:  int64(i % 500),
+			PacketSize: 512 + i%1024,
+		})
+	}
+	return out
+}
+
+func TestRoundTrip(t *testing.T) {
+	logs := sampleLogs(3)
+	logs = append(logs, &model.TrafficLog{SrcIP: "fe80::1", DstIP: "not-an-ip", PID: -1})
+	logs = append(logs, &model.TrafficLog{HTTPPath: "/users/1", HTTPQuery: "x=1", HTTPRoute: "/users/{id}"})
+
+	got, err := Decode(bytes.NewReader(Marshal(logs)), 0)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if len(got) != len(logs) {
+		t.Fatalf("len=%d want %d", len(got), len(logs))
+	}
+	for i := range logs {
+		want := *logs[i]
+		if !got[i].Timestamp.Equal(want.Timestamp) {
+			t.Errorf("[%d] timestamp=%v want %v", i, got[i].Timestamp, want.Timestamp)
+		}
+		got[i].Timestamp, want.Timestamp = time.Time{}, time.Time{}
+		if got[i] != want {
+			t.Errorf("[%d] got %+v want %+v", i, got[i], want)
+		}
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	data := Marshal(sampleLogs(3))
+	if _, err := Decode(bytes.NewReader(data), 2); !errors.Is(err, ErrTooManyRecords) {
+		t.Errorf("expected ErrTooManyRecords, got %v", err)
+	}
+	if _, err := Decode(bytes.NewReader(data[:len(data)-1]), 0); err == nil {
+		t.Errorf("expected error for truncated stream")
+	}
+}
+
+func TestUnknownFieldsSkipped(t *testing.T) {
+	msg := AppendTrafficLog(nil, &model.TrafficLog{HTTPMethod: "GET"})
+	msg = protowire.AppendTag(msg, 99, protowire.BytesType)
+	msg = protowire.AppendString(msg, "future")
+	l, err := UnmarshalTrafficLog(msg)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if l.HTTPMethod != "GET" {
+		t.Errorf("method=%q", l.HTTPMethod)
+	}
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	data := Marshal(sampleLogs(100))
+	for _, enc := range []string{EncodingIdentity, EncodingGzip, EncodingZstd} {
+		packed, err := Compress(enc, data)
+		if err != nil {
+			t.Fatalf("%q Compress failed: %v", enc, err)
+		}
+		r, err := NewReader(enc, bytes.NewReader(packed))
+		if err != nil {
+			t.Fatalf("%q NewReader failed: %v", enc, err)
+		}
+		out, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(out, data) {
+			t.Errorf("%q round trip mismatch err=%v", enc, err)
+		}
+	}
+	if _, err := NewReader("br", bytes.NewReader(nil)); err == nil {
+		t.Errorf("expected error for unsupported encoding")
+	}
+}
+
+func TestIsProtobuf(t *testing.T) {
+	if !IsProtobuf(ContentTypeProtobuf + "; charset=binary") {
+		t.Errorf("parameters should be ignored")
+	}
+	if IsProtobuf(ContentTypeJSON) {
+		t.Errorf("json is not protobuf")
+	}
+}
+
+// 以下基准对比一批 200 条记录在 JSON 与二进制格式下的编解码吞吐和体积（bytes/batch）。
+
+const benchBatch = 200
+
+func BenchmarkEncode(b *testing.B) {
+	logs := sampleLogs(benchBatch)
+	cases := []struct {
+		name string
+		enc  func() ([]byte, error)
+	}{
+		{"json", func() ([]byte, error) { return json.Marshal(logs) }},
+		{"json+gzip", func() ([]byte, error) {
+			data, _ := json.Marshal(logs)
+			return Compress(EncodingGzip, data)
+		}},
+		{"protobuf", func() ([]byte, error) { return Marshal(logs), nil }},
+		{"protobuf+gzip", func() ([]byte, error) { return Compress(EncodingGzip, Marshal(logs)) }},
+		{"protobuf+zstd", func() ([]byte, error) { return Compress(EncodingZstd, Marshal(logs)) }},
+	}
+	for _, tc := range cases {
+		b.Run(tc.name, func(b *testing.B) {
+			var size int
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := tc.enc()
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "bytes/batch")
+			b.ReportMetric(float64(b.N*benchBatch)/b.Elapsed().Seconds(), "records/s")
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	logs := sampleLogs(benchBatch)
+	jsonData, _ := json.Marshal(logs)
+	pbData := Marshal(logs)
+	zstdData, _ := Compress(EncodingZstd, pbData)
+
+	b.Run("json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var out []model.TrafficLog
+			if err := json.Unmarshal(jsonData, &out); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(b.N*benchBatch)/b.Elapsed().Seconds(), "records/s")
+	})
+	b.Run("protobuf", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := Decode(bytes.NewReader(pbData), 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(b.N*benchBatch)/b.Elapsed().Seconds(), "records/s")
+	})
+	b.Run("protobuf+zstd", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			r, err := NewReader(EncodingZstd, bytes.NewReader(zstdData))
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := Decode(r, 0); err != nil {
+				b.Fatal(err)
+			}
+			r.Close()
+		}
+		b.ReportMetric(float64(b.N*benchBatch)/b.Elapsed().Seconds(), "records/s")
+	})
+}